@@ -1,5 +1,19 @@
 package device
 
+import "github.com/gorilla/websocket"
+
+const (
+	// CloseReasonInboundRateExceeded is the CloseReason text used when a device is disconnected
+	// for exceeding its inbound rate limit.
+	CloseReasonInboundRateExceeded = "inbound-rate-exceeded"
+
+	// RedirectCloseCode is the websocket close code sent to a device whose CloseReason carries a Redirect
+	RedirectCloseCode = websocket.CloseServiceRestart
+
+	// maxCloseText is the largest text permitted in a websocket close frame
+	maxCloseText = 123
+)
+
 // CloseReason exposes metadata around why a particular device was closed
 type CloseReason struct {
 	// Err is the optional field that specifies the underlying error that occurred, such as
@@ -8,6 +22,11 @@ type CloseReason struct {
 
 	// Text is the required field indicating a JSON-friendly value describing the reason for closure.
 	Text string
+
+	// Redirect is the optional URL of the instance the device should reconnect to.  If set, the device is sent
+	// a close frame with RedirectCloseCode and this URL as its text, so that cooperating clients can reconnect
+	// to that instance.  A redirect longer than a close frame allows is not sent.
+	Redirect string
 }
 
 func (c CloseReason) String() string {
@@ -0,0 +1,89 @@
+package device
+
+import (
+	"bufio"
+	"errors"
+	"net"
+	"net/http"
+	"strings"
+)
+
+const (
+	// PerMessageDeflate is the websocket extension token for per-message compression
+	PerMessageDeflate = "permessage-deflate"
+
+	extensionsHeader = "Sec-Websocket-Extensions"
+)
+
+var errNotHijacker = errors.New("response does not implement http.Hijacker")
+
+// offersCompression tests if a websocket upgrade request offers the permessage-deflate extension.
+// This mirrors the negotiation done by the gorilla websocket.Upgrader, which does not otherwise
+// expose whether compression was negotiated.
+func offersCompression(header http.Header) bool {
+	for _, value := range header[extensionsHeader] {
+		for _, extension := range strings.Split(value, ",") {
+			token := extension
+			if i := strings.IndexByte(extension, ';'); i >= 0 {
+				token = extension[:i]
+			}
+
+			if strings.EqualFold(strings.TrimSpace(token), PerMessageDeflate) {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+// wireConn is a net.Conn that tracks the bytes actually read from and written to the network.
+// When compression is negotiated, these counts differ from the logical message sizes.
+type wireConn struct {
+	net.Conn
+
+	// statistics is set once the websocket handshake is complete, so that the handshake
+	// itself isn't counted
+	statistics WireStatistics
+}
+
+func (wc *wireConn) Read(b []byte) (int, error) {
+	n, err := wc.Conn.Read(b)
+	if n > 0 && wc.statistics != nil {
+		wc.statistics.AddWireBytesReceived(n)
+	}
+
+	return n, err
+}
+
+func (wc *wireConn) Write(b []byte) (int, error) {
+	n, err := wc.Conn.Write(b)
+	if n > 0 && wc.statistics != nil {
+		wc.statistics.AddWireBytesSent(n)
+	}
+
+	return n, err
+}
+
+// wireResponseWriter decorates an http.ResponseWriter so that the connection produced by
+// hijacking it is a wireConn.
+type wireResponseWriter struct {
+	http.ResponseWriter
+	conn *wireConn
+}
+
+func (wrw *wireResponseWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	hijacker, ok := wrw.ResponseWriter.(http.Hijacker)
+	if !ok {
+		return nil, nil, errNotHijacker
+	}
+
+	c, brw, err := hijacker.Hijack()
+	if err != nil || brw.Reader.Buffered() > 0 {
+		// let the upgrader deal with any data sent prematurely by the client
+		return c, brw, err
+	}
+
+	wrw.conn = &wireConn{Conn: c}
+	return wrw.conn, bufio.NewReadWriter(bufio.NewReader(wrw.conn), bufio.NewWriter(wrw.conn)), nil
+}
@@ -0,0 +1,111 @@
+package device
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	"github.com/go-kit/kit/log"
+	"github.com/gorilla/websocket"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/xmidt-org/wrp-go/v3"
+)
+
+func TestOffersCompression(t *testing.T) {
+	testData := []struct {
+		header   http.Header
+		expected bool
+	}{
+		{http.Header{}, false},
+		{http.Header{extensionsHeader: {"x-webkit-deflate-frame"}}, false},
+		{http.Header{extensionsHeader: {"permessage-deflate"}}, true},
+		{http.Header{extensionsHeader: {"permessage-deflate; client_max_window_bits"}}, true},
+		{http.Header{extensionsHeader: {"foo, Permessage-Deflate; server_no_context_takeover"}}, true},
+		{http.Header{extensionsHeader: {"foo; permessage-deflate"}}, false},
+		{http.Header{extensionsHeader: {"foo", "permessage-deflate"}}, true},
+	}
+
+	for i, record := range testData {
+		assert.Equal(t, record.expected, offersCompression(record.header), "record %d", i)
+	}
+}
+
+func TestWireResponseWriterNotHijacker(t *testing.T) {
+	assert := assert.New(t)
+	wrw := &wireResponseWriter{ResponseWriter: httptest.NewRecorder()}
+
+	c, brw, err := wrw.Hijack()
+	assert.Nil(c)
+	assert.Nil(brw)
+	assert.Equal(errNotHijacker, err)
+}
+
+func testManagerConnectCompression(t *testing.T, enableCompression, dialCompression bool) {
+	var (
+		assert      = assert.New(t)
+		require     = require.New(t)
+		connectWait = new(sync.WaitGroup)
+		devices     = make(chan Interface, 1)
+
+		options = &Options{
+			Logger:            log.NewNopLogger(),
+			EnableCompression: enableCompression,
+			CompressionLevel:  9,
+			Listeners: []Listener{
+				func(event *Event) {
+					if event.Type == Connect {
+						defer connectWait.Done()
+						devices <- event.Device
+					}
+				},
+			},
+		}
+
+		manager, server, connectURL = startWebsocketServer(options)
+		dialer                      = NewDialer(DialerOptions{WSDialer: &websocket.Dialer{EnableCompression: dialCompression}})
+	)
+
+	defer server.Close()
+	connectWait.Add(1)
+
+	deviceConnection, _, err := dialer.DialDevice(string(testDeviceIDs[0]), connectURL, nil)
+	require.NoError(err)
+	defer deviceConnection.Close()
+
+	connectWait.Wait()
+	d := <-devices
+	assert.Equal(enableCompression && dialCompression, d.Metadata().Compression())
+
+	// a highly compressible message
+	message := &wrp.Message{
+		Type:        wrp.SimpleEventMessageType,
+		Source:      "test",
+		Destination: string(testDeviceIDs[0]) + "/service",
+		Payload:     make([]byte, 4096),
+	}
+
+	_, err = manager.Route(&Request{Message: message})
+	require.NoError(err)
+
+	_, _, err = deviceConnection.ReadMessage()
+	require.NoError(err)
+
+	statistics := d.Statistics()
+	wire, ok := statistics.(WireStatistics)
+	require.True(ok)
+	assert.Equal(1, statistics.MessagesSent())
+	assert.True(statistics.BytesSent() > 4096)
+	if enableCompression && dialCompression {
+		assert.True(wire.WireBytesSent() < statistics.BytesSent())
+	} else {
+		assert.True(wire.WireBytesSent() > statistics.BytesSent())
+	}
+}
+
+func TestManagerConnectCompression(t *testing.T) {
+	t.Run("Negotiated", func(t *testing.T) { testManagerConnectCompression(t, true, true) })
+	t.Run("NotOffered", func(t *testing.T) { testManagerConnectCompression(t, true, false) })
+	t.Run("Disabled", func(t *testing.T) { testManagerConnectCompression(t, false, true) })
+}
@@ -4,6 +4,7 @@ import (
 	"bytes"
 	"encoding/json"
 	"fmt"
+	"sync"
 	"sync/atomic"
 	"time"
 
@@ -57,7 +58,7 @@ type Interface interface {
 	// but we don't want to turn away duped devices.
 	ID() ID
 
-	// Pending returns the count of pending messages for this device
+	// Pending returns the count of pending messages for this device across all lanes
 	Pending() int
 
 	// Closed tests if this device is closed.  When this method returns true,
@@ -112,7 +113,7 @@ type device struct {
 	state int32
 
 	shutdown     chan struct{}
-	messages     chan *envelope
+	lanes        [laneCount]chan *envelope
 	transactions *Transactions
 
 	c             convey.Interface
@@ -121,6 +122,25 @@ type device struct {
 
 	metadata *Metadata
 
+	// outboundLimiter is the optional rate limit on messages routed to this device
+	outboundLimiter *tokenBucket
+
+	// inboundMessageLimiter and inboundByteLimiter are the optional rate limits on frames sent by this device
+	inboundMessageLimiter *tokenBucket
+	inboundByteLimiter    *tokenBucket
+
+	// resumeWindow is the length of time this device's pending transactions are held after
+	// it disconnects.  If zero, this device's session cannot be resumed.
+	resumeWindow time.Duration
+
+	// resumed is set once another connection has taken over this device's session
+	resumed int32
+
+	// flushing is set while messages held in the offline store are being delivered to this device.
+	// Messages routed in the meantime are queued behind them, so that delivery order is preserved.
+	flushLock sync.Mutex
+	flushing  bool
+
 	closeReason atomic.Value
 }
 
@@ -129,6 +149,7 @@ type deviceOptions struct {
 	C           convey.Interface
 	Compliance  convey.Compliance
 	QueueSize   int
+	LaneSizes   [laneCount]int
 	ConnectedAt time.Time
 	Logger      log.Logger
 	Metadata    *Metadata
@@ -148,20 +169,30 @@ func newDevice(o deviceOptions) *device {
 		o.QueueSize = DefaultDeviceMessageQueueSize
 	}
 
-	return &device{
+	d := &device{
 		id:           o.ID,
 		errorLog:     logging.Error(o.Logger, "id", o.ID),
 		infoLog:      logging.Info(o.Logger, "id", o.ID),
 		debugLog:     logging.Debug(o.Logger, "id", o.ID),
-		statistics:   NewStatistics(nil, o.ConnectedAt),
 		c:            o.C,
 		compliance:   o.Compliance,
 		state:        stateOpen,
 		shutdown:     make(chan struct{}),
-		messages:     make(chan *envelope, o.QueueSize),
 		transactions: NewTransactions(),
 		metadata:     o.Metadata,
 	}
+
+	for i := range d.lanes {
+		size := o.LaneSizes[i]
+		if size < 1 {
+			size = o.QueueSize
+		}
+
+		d.lanes[i] = make(chan *envelope, size)
+	}
+
+	d.statistics = newStatistics(nil, o.ConnectedAt, d.laneDepths)
+	return d
 }
 
 // String returns the JSON representation of this device
@@ -175,7 +206,7 @@ func (d *device) MarshalJSON() ([]byte, error) {
 		&output,
 		`{"id": "%s", "pending": %d, "statistics": %s}`,
 		d.id,
-		len(d.messages),
+		d.Pending(),
 		d.statistics,
 	)
 
@@ -184,25 +215,93 @@ func (d *device) MarshalJSON() ([]byte, error) {
 
 func (d *device) requestClose(reason CloseReason) error {
 	if atomic.CompareAndSwapInt32(&d.state, stateOpen, stateClosed) {
-		close(d.shutdown)
-		d.transactions.Close()
-
+		// the reason must be available before the write pump observes the shutdown
 		if len(reason.Text) == 0 {
 			reason.Text = "unknown"
 		}
 
 		d.closeReason.Store(reason)
+		close(d.shutdown)
+
+		// the transactions of a resumable session are closed once the resume window elapses
+		if d.resumeWindow <= 0 {
+			d.transactions.Close()
+		}
 	}
 
 	return nil
 }
 
+// isResumed tests if another connection has taken over this device's session
+func (d *device) isResumed() bool {
+	return atomic.LoadInt32(&d.resumed) != 0
+}
+
+// markResumed flags this device's session as taken over by another connection.  This method
+// returns false if the session had already been taken over.
+func (d *device) markResumed() bool {
+	return atomic.CompareAndSwapInt32(&d.resumed, 0, 1)
+}
+
+// resume takes over the session of a prior connection for the same device.  The prior connection's
+// pending transactions are adopted, and its traffic counters are carried forward.  This method
+// must be called before this device is registered or its pumps are started.
+func (d *device) resume(prior *device) {
+	d.transactions = prior.transactions
+
+	ps := prior.Statistics()
+	d.statistics.AddBytesSent(ps.BytesSent())
+	d.statistics.AddMessagesSent(ps.MessagesSent())
+	d.statistics.AddBytesReceived(ps.BytesReceived())
+	d.statistics.AddMessagesReceived(ps.MessagesReceived())
+
+	current, currentOk := d.statistics.(WireStatistics)
+	previous, previousOk := ps.(WireStatistics)
+	if currentOk && previousOk {
+		current.AddWireBytesSent(previous.WireBytesSent())
+		current.AddWireBytesReceived(previous.WireBytesReceived())
+	}
+}
+
 func (d *device) ID() ID {
 	return d.id
 }
 
 func (d *device) Pending() int {
-	return len(d.messages)
+	pending := 0
+	for _, lane := range d.lanes {
+		pending += len(lane)
+	}
+
+	return pending
+}
+
+func (d *device) LanePending(l Lane) int {
+	return len(d.lanes[l.index()])
+}
+
+// laneDepths returns the current number of pending messages in each lane, keyed by lane name
+func (d *device) laneDepths() map[string]int {
+	depths := make(map[string]int, len(Lanes))
+	for i, l := range Lanes {
+		depths[l.String()] = len(d.lanes[i])
+	}
+
+	return depths
+}
+
+// next returns the highest priority envelope that is immediately available.  If all lanes
+// are empty, this method returns nil without blocking.
+func (d *device) next() *envelope {
+	for _, lane := range d.lanes {
+		select {
+		case e := <-lane:
+			return e
+		default:
+		}
+	}
+
+	return nil
 }
 
 func (d *device) Closed() bool {
@@ -230,7 +329,7 @@ func (d *device) sendRequest(request *Request) error {
 		return request.Context().Err()
 	case <-d.shutdown:
 		return ErrorDeviceClosed
-	case d.messages <- envelope:
+	case d.lanes[request.lane().index()] <- envelope:
 	}
 
 	// once enqueued, wait until the context is cancelled
@@ -249,10 +348,17 @@ func (d *device) sendRequest(request *Request) error {
 // request's transaction key.  The result channel will receive the response from the
 // read pump.
 func (d *device) awaitResponse(request *Request, result <-chan *Response) (*Response, error) {
+	// when this device's session can be resumed, a disconnection doesn't end the wait.  the
+	// transaction is either completed by a resumed connection or cancelled when the window elapses.
+	shutdown := d.shutdown
+	if d.resumeWindow > 0 {
+		shutdown = nil
+	}
+
 	select {
 	case <-request.Context().Done():
 		return nil, request.Context().Err()
-	case <-d.shutdown:
+	case <-shutdown:
 		return nil, ErrorDeviceClosed
 	case response := <-result:
 		if response == nil {
@@ -0,0 +1,179 @@
+// Package argusstore provides a devicegate.Store backed by an argus bucket.  It is kept apart from
+// devicegate so that gates which don't use argus don't depend on the argus client.
+package argusstore
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math"
+	"net/http"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-kit/kit/log"
+	"github.com/go-kit/kit/log/level"
+	"github.com/xmidt-org/argus/chrysom"
+	"github.com/xmidt-org/argus/model"
+	"github.com/xmidt-org/argus/store"
+	"github.com/xmidt-org/webpa-common/device/devicegate"
+	"github.com/xmidt-org/webpa-common/logging"
+)
+
+// Store is a devicegate.Store backed by an argus bucket, accessed through the argus chrysom client.  Each filter is
+// stored as an item whose ID is the SHA256 hash of the filter key and whose data is the JSON form of the
+// FilterRequest.  Changes are detected by the client's listener, which polls the bucket.
+type Store struct {
+	client *chrysom.Client
+	owner  string
+	logger log.Logger
+
+	lock     sync.Mutex
+	listener devicegate.FilterListener
+	last     []devicegate.FilterRequest
+}
+
+// New creates a Store using the given chrysom client configuration.  The owner is optional,
+// and is sent with each request.  Any Listener in the configuration is replaced, as Watch uses the client's
+// listener to detect changes.
+func New(config chrysom.ClientConfig, owner string) (*Store, error) {
+	s := &Store{
+		owner:  owner,
+		logger: config.Logger,
+	}
+
+	if s.logger == nil {
+		s.logger = logging.DefaultLogger()
+	}
+
+	config.Listen.Listener = chrysom.ListenerFunc(s.update)
+	client, err := chrysom.NewClient(config, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	s.client = client
+	return s, nil
+}
+
+// itemsToFilters converts argus items into filters, ordered by key
+func itemsToFilters(items chrysom.Items) ([]devicegate.FilterRequest, error) {
+	filters := make([]devicegate.FilterRequest, 0, len(items))
+	for _, item := range items {
+		data, err := json.Marshal(item.Data)
+		if err != nil {
+			return nil, err
+		}
+
+		var f devicegate.FilterRequest
+		if err := json.Unmarshal(data, &f); err != nil {
+			return nil, err
+		}
+
+		filters = append(filters, f)
+	}
+
+	sort.Slice(filters, func(i, j int) bool {
+		return filters[i].Key < filters[j].Key
+	})
+
+	return filters, nil
+}
+
+// Load returns the filters in the bucket, ordered by key
+func (s *Store) Load(ctx context.Context) ([]devicegate.FilterRequest, error) {
+	items, err := s.client.GetItems(ctx, s.owner)
+	if err != nil {
+		return nil, err
+	}
+
+	return itemsToFilters(items)
+}
+
+func (s *Store) Save(ctx context.Context, f devicegate.FilterRequest) error {
+	data, err := json.Marshal(f)
+	if err != nil {
+		return err
+	}
+
+	item := model.Item{ID: store.Sha256HexDigest(f.Key)}
+	if err := json.Unmarshal(data, &item.Data); err != nil {
+		return err
+	}
+
+	// let argus discard the item once the filter expires
+	if expires, err := f.Expiry(time.Now()); err == nil && !expires.IsZero() {
+		ttl := int64(math.Ceil(time.Until(expires).Seconds()))
+		if ttl < 1 {
+			ttl = 1
+		}
+
+		item.TTL = &ttl
+	}
+
+	_, err = s.client.PushItem(ctx, s.owner, item)
+	return err
+}
+
+func (s *Store) Remove(ctx context.Context, key string) error {
+	_, err := s.client.RemoveItem(ctx, store.Sha256HexDigest(key), s.owner)
+
+	// chrysom doesn't export an error for missing items, so the status code is matched instead
+	if err != nil && strings.HasPrefix(err.Error(), fmt.Sprintf("statusCode %d:", http.StatusNotFound)) {
+		return nil
+	}
+
+	return err
+}
+
+// update is the chrysom listener, which dispatches the polled filters to the watching listener when they change
+func (s *Store) update(items chrysom.Items) {
+	filters, err := itemsToFilters(items)
+	if err != nil {
+		s.logger.Log(level.Key(), level.ErrorValue(), logging.MessageKey(), "unable to read filters from argus", logging.ErrorKey(), err)
+		return
+	}
+
+	s.lock.Lock()
+	l := s.listener
+	if l == nil || reflect.DeepEqual(filters, s.last) {
+		s.lock.Unlock()
+		return
+	}
+
+	s.last = filters
+	s.lock.Unlock()
+	l(filters)
+}
+
+// Watch starts the chrysom client's listener.  The listener is not invoked for the filters in the bucket at the
+// time Watch is called, nor when the bucket cannot be fetched.  Only one listener may watch a Store at a time.
+func (s *Store) Watch(l devicegate.FilterListener) (func(), error) {
+	last, err := s.Load(context.Background())
+	if err != nil {
+		return nil, err
+	}
+
+	s.lock.Lock()
+	s.listener = l
+	s.last = last
+	s.lock.Unlock()
+
+	if err := s.client.Start(context.Background()); err != nil {
+		return nil, err
+	}
+
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			s.client.Stop(context.Background())
+
+			s.lock.Lock()
+			s.listener = nil
+			s.lock.Unlock()
+		})
+	}, nil
+}
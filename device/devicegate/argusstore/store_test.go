@@ -0,0 +1,156 @@
+package argusstore
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/xmidt-org/argus/chrysom"
+	"github.com/xmidt-org/argus/model"
+	"github.com/xmidt-org/argus/store"
+	"github.com/xmidt-org/webpa-common/device/devicegate"
+	"github.com/xmidt-org/webpa-common/logging"
+)
+
+// newTestArgus starts a server that implements enough of the argus store API for a Store
+func newTestArgus(t *testing.T, bucket string) *httptest.Server {
+	var (
+		lock  sync.Mutex
+		items = make(map[string]model.Item)
+	)
+
+	return httptest.NewServer(http.HandlerFunc(func(response http.ResponseWriter, request *http.Request) {
+		lock.Lock()
+		defer lock.Unlock()
+
+		// the chrysom listener polls without an owner, so only changes require one
+		owner := request.Header.Get(store.ItemOwnerHeaderKey)
+		if request.Header.Get("Authorization") != "Basic dGVzdDp0ZXN0" || (request.Method != http.MethodGet && owner != "talaria") {
+			response.WriteHeader(http.StatusForbidden)
+			return
+		}
+
+		id := strings.TrimPrefix(strings.TrimPrefix(request.URL.Path, "/api/v1/store/"+bucket), "/")
+		switch {
+		case request.Method == http.MethodGet && len(id) == 0:
+			list := make([]model.Item, 0, len(items))
+			for _, item := range items {
+				list = append(list, item)
+			}
+
+			json.NewEncoder(response).Encode(list)
+
+		case request.Method == http.MethodPut && len(id) > 0:
+			var item model.Item
+			if err := json.NewDecoder(request.Body).Decode(&item); err != nil || item.ID != id {
+				response.WriteHeader(http.StatusBadRequest)
+				return
+			}
+
+			_, existed := items[id]
+			items[id] = item
+			if existed {
+				response.WriteHeader(http.StatusOK)
+			} else {
+				response.WriteHeader(http.StatusCreated)
+			}
+
+		case request.Method == http.MethodDelete && len(id) > 0:
+			item, ok := items[id]
+			if !ok {
+				response.WriteHeader(http.StatusNotFound)
+				return
+			}
+
+			delete(items, id)
+			json.NewEncoder(response).Encode(item)
+
+		default:
+			response.WriteHeader(http.StatusBadRequest)
+		}
+	}))
+}
+
+func TestStore(t *testing.T) {
+	var (
+		assert  = assert.New(t)
+		require = require.New(t)
+
+		ctx    = context.Background()
+		trust  = devicegate.Expression{Op: devicegate.OpLT, Key: "trust", Values: []interface{}{1000.0}}
+		server = newTestArgus(t, "gate-filters")
+
+		config = chrysom.ClientConfig{
+			Address: server.URL,
+			Bucket:  "gate-filters",
+			Auth:    chrysom.Auth{Basic: "Basic dGVzdDp0ZXN0"},
+			Logger:  logging.NewTestLogger(nil, t),
+			Listen:  chrysom.ListenerConfig{PullInterval: 10 * time.Millisecond},
+		}
+	)
+
+	defer server.Close()
+	as, err := New(config, "talaria")
+	require.NoError(err)
+
+	filters, err := as.Load(ctx)
+	assert.NoError(err)
+	assert.Empty(filters)
+
+	changes := make(chan []devicegate.FilterRequest, 100)
+	stop, err := as.Watch(func(f []devicegate.FilterRequest) { changes <- f })
+	require.NoError(err)
+	defer stop()
+
+	require.NoError(as.Save(ctx, devicegate.FilterRequest{Key: "untrusted", Expression: &trust}))
+	require.NoError(as.Save(ctx, devicegate.FilterRequest{Key: "partner-id", Values: []interface{}{"comcast"}}))
+	require.NoError(as.Save(ctx, devicegate.FilterRequest{Key: "partner-id", Values: []interface{}{"cox"}}))
+
+	filters, err = as.Load(ctx)
+	assert.NoError(err)
+	assert.Equal(
+		[]devicegate.FilterRequest{
+			{Key: "partner-id", Values: []interface{}{"cox"}},
+			{Key: "untrusted", Expression: &trust},
+		},
+		filters,
+	)
+
+	require.NoError(as.Remove(ctx, "untrusted"))
+	require.NoError(as.Remove(ctx, "nosuch"))
+
+	timeout := time.After(5 * time.Second)
+	for {
+		select {
+		case filters = <-changes:
+		case <-timeout:
+			assert.Fail("The change was not detected")
+			return
+		}
+
+		if len(filters) == 1 {
+			break
+		}
+	}
+
+	assert.Equal([]devicegate.FilterRequest{{Key: "partner-id", Values: []interface{}{"cox"}}}, filters)
+
+	// argus rejects requests without the expected credentials
+	config.Auth = chrysom.Auth{}
+	unauthorized, err := New(config, "talaria")
+	require.NoError(err)
+	_, err = unauthorized.Load(ctx)
+	assert.Error(err)
+	assert.Error(unauthorized.Save(ctx, devicegate.FilterRequest{Key: "test", Values: []interface{}{"test"}}))
+	assert.Error(unauthorized.Remove(ctx, "partner-id"))
+
+	_, err = unauthorized.Watch(func([]devicegate.FilterRequest) {})
+	assert.Error(err)
+}
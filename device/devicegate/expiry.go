@@ -0,0 +1,191 @@
+package devicegate
+
+import (
+	"encoding/json"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/go-kit/kit/log/level"
+	"github.com/xmidt-org/webpa-common/logging"
+)
+
+// ErrExpiryNotSupported is returned when an expiring filter is set on a gate that is not an ExpiringGate
+var ErrExpiryNotSupported = errors.New("This gate does not support filter expiry")
+
+// ExpiringGate is implemented by a gate Interface that supports filters which are automatically removed at a
+// given time.  FilterGate implements this interface.
+type ExpiringGate interface {
+	// SetExpiry sets the time at which the filter with the given key is automatically removed.  A zero time
+	// means the filter does not expire.  Setting a filter or expression clears its expiry.  This method returns
+	// false if the key does not exist.
+	SetExpiry(key string, expires time.Time) bool
+
+	// SetFilterUntil is like SetFilter, but also sets the time at which the filter expires as part of the
+	// same update.  A zero time means the filter does not expire.
+	SetFilterUntil(key string, values []interface{}, expires time.Time) (Set, bool)
+
+	// SetExpressionUntil is like SetExpression, but also sets the time at which the expression expires as part
+	// of the same update.  A zero time means the expression does not expire.
+	SetExpressionUntil(key string, e Expression, expires time.Time) (bool, error)
+}
+
+// Expiry returns the time at which the filter described by this request expires, relative to the given
+// current time.  A zero time is returned if the request has neither a TTL nor an Expires.
+func (fr FilterRequest) Expiry(now time.Time) (time.Time, error) {
+	var expires time.Time
+	if len(fr.TTL) > 0 {
+		ttl, err := time.ParseDuration(fr.TTL)
+		if err != nil {
+			return time.Time{}, err
+		}
+
+		expires = now.Add(ttl)
+	}
+
+	if fr.Expires != nil && (expires.IsZero() || fr.Expires.Before(expires)) {
+		expires = *fr.Expires
+	}
+
+	return expires, nil
+}
+
+// FilterExpiration describes when a filter expires, for GetFilters output
+type FilterExpiration struct {
+	Expires   time.Time `json:"expires"`
+	Remaining string    `json:"remaining"`
+}
+
+func (f *FilterGate) currentTime() time.Time {
+	if f.now != nil {
+		return f.now()
+	}
+
+	return time.Now()
+}
+
+// expired tests if a filter has expired.  The caller must hold the lock.
+func (f *FilterGate) expired(key string, now time.Time) bool {
+	expires, ok := f.expirations[key]
+	return ok && !now.Before(expires)
+}
+
+func (f *FilterGate) SetExpiry(key string, expires time.Time) bool {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+
+	_, ok := f.FilterStore[key]
+	if _, expressionOK := f.Expressions[key]; !ok && !expressionOK {
+		return false
+	}
+
+	f.setExpiry(key, expires)
+	return true
+}
+
+// setExpiry sets or, for a zero time, clears the expiry of a key.  The caller must hold the lock.
+func (f *FilterGate) setExpiry(key string, expires time.Time) {
+	if expires.IsZero() {
+		delete(f.expirations, key)
+		return
+	}
+
+	if f.expirations == nil {
+		f.expirations = make(map[string]time.Time)
+	}
+
+	f.expirations[key] = expires
+}
+
+// RemoveExpired deletes the filters that have expired, logging and counting each one, and returns their keys.
+// Expired filters are ignored by AllowConnection even before they are removed.
+func (f *FilterGate) RemoveExpired() []string {
+	f.lock.Lock()
+	var (
+		now     = f.currentTime()
+		expired []string
+	)
+
+	for key, expires := range f.expirations {
+		if !now.Before(expires) {
+			expired = append(expired, key)
+			delete(f.FilterStore, key)
+			delete(f.Expressions, key)
+			delete(f.expirations, key)
+		}
+	}
+
+	f.lock.Unlock()
+
+	logger := f.Logger
+	if logger == nil {
+		logger = logging.DefaultLogger()
+	}
+
+	for _, key := range expired {
+		logger.Log(level.Key(), level.InfoValue(), logging.MessageKey(), "gate filter expired", "filterKey", key)
+		if f.Expired != nil {
+			f.Expired.Add(1.0)
+		}
+	}
+
+	return expired
+}
+
+// StartExpiry removes expired filters at the given interval until the returned function is called
+func (f *FilterGate) StartExpiry(interval time.Duration) func() {
+	var (
+		ticker   = time.NewTicker(interval)
+		shutdown = make(chan struct{})
+		once     sync.Once
+	)
+
+	go func() {
+		defer ticker.Stop()
+		for {
+			select {
+			case <-shutdown:
+				return
+			case <-ticker.C:
+				f.RemoveExpired()
+			}
+		}
+	}()
+
+	return func() { once.Do(func() { close(shutdown) }) }
+}
+
+// MarshalJSON writes the filters of this gate, including when each expiring filter will be removed
+func (f *FilterGate) MarshalJSON() ([]byte, error) {
+	f.lock.RLock()
+	defer f.lock.RUnlock()
+
+	output := map[string]interface{}{
+		"filters":        f.FilterStore,
+		"allowedFilters": f.AllowedFilters,
+	}
+
+	if len(f.Expressions) > 0 {
+		output["expressions"] = f.Expressions
+	}
+
+	if len(f.expirations) > 0 {
+		now := f.currentTime()
+		expirations := make(map[string]FilterExpiration, len(f.expirations))
+		for key, expires := range f.expirations {
+			remaining := expires.Sub(now)
+			if remaining < 0 {
+				remaining = 0
+			}
+
+			expirations[key] = FilterExpiration{
+				Expires:   expires.UTC(),
+				Remaining: remaining.Round(time.Second).String(),
+			}
+		}
+
+		output["expirations"] = expirations
+	}
+
+	return json.Marshal(output)
+}
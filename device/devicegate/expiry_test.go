@@ -0,0 +1,254 @@
+package devicegate
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/go-kit/kit/metrics/generic"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+	"github.com/xmidt-org/webpa-common/logging"
+)
+
+func TestFilterRequestExpiry(t *testing.T) {
+	var (
+		now     = time.Date(2020, time.June, 4, 12, 0, 0, 0, time.UTC)
+		soon    = now.Add(30 * time.Minute)
+		later   = now.Add(2 * time.Hour)
+		invalid = "this is not a duration"
+	)
+
+	testData := []struct {
+		description string
+		request     FilterRequest
+		expected    time.Time
+		expectErr   bool
+	}{
+		{"None", FilterRequest{Key: "test"}, time.Time{}, false},
+		{"TTL", FilterRequest{Key: "test", TTL: "1h"}, now.Add(time.Hour), false},
+		{"Expires", FilterRequest{Key: "test", Expires: &later}, later, false},
+		{"Earlier Expires", FilterRequest{Key: "test", TTL: "1h", Expires: &soon}, soon, false},
+		{"Earlier TTL", FilterRequest{Key: "test", TTL: "1h", Expires: &later}, now.Add(time.Hour), false},
+		{"Invalid TTL", FilterRequest{Key: "test", TTL: invalid}, time.Time{}, true},
+	}
+
+	for _, record := range testData {
+		t.Run(record.description, func(t *testing.T) {
+			assert := assert.New(t)
+			expires, err := record.request.Expiry(now)
+			assert.Equal(record.expected, expires)
+			assert.Equal(record.expectErr, err != nil)
+		})
+	}
+}
+
+func TestFilterGateExpiry(t *testing.T) {
+	var (
+		assert  = assert.New(t)
+		require = require.New(t)
+
+		now     = time.Date(2020, time.June, 4, 12, 0, 0, 0, time.UTC)
+		expired = generic.NewCounter("expired")
+		gate    = &FilterGate{
+			FilterStore: make(FilterStore),
+			Logger:      logging.NewTestLogger(nil, t),
+			Expired:     expired,
+			now:         func() time.Time { return now },
+		}
+	)
+
+	assert.False(gate.SetExpiry("partner-id", now.Add(time.Hour)))
+
+	gate.SetFilter("partner-id", []interface{}{"comcast"})
+	_, err := gate.SetExpression("untrusted", Expression{Op: OpLT, Key: "trust", Values: []interface{}{1000.0}})
+	require.NoError(err)
+	gate.SetFilter("permanent", []interface{}{"value"})
+
+	assert.True(gate.SetExpiry("partner-id", now.Add(time.Hour)))
+	assert.True(gate.SetExpiry("untrusted", now.Add(90*time.Minute)))
+	assert.True(gate.SetExpiry("permanent", now.Add(time.Minute)))
+
+	// setting a filter clears its expiry, as does a zero expiry
+	gate.SetFilter("permanent", []interface{}{"value"})
+	assert.True(gate.SetExpiry("partner-id", now.Add(time.Hour)))
+
+	data, err := json.Marshal(gate)
+	require.NoError(err)
+	assert.JSONEq(
+		`{
+			"filters": {"partner-id": ["comcast"], "permanent": ["value"]},
+			"allowedFilters": null,
+			"expressions": {"untrusted": {"op": "lt", "key": "trust", "values": [1000]}},
+			"expirations": {
+				"partner-id": {"expires": "2020-06-04T13:00:00Z", "remaining": "1h0m0s"},
+				"untrusted": {"expires": "2020-06-04T13:30:00Z", "remaining": "1h30m0s"}
+			}
+		}`,
+		string(data),
+	)
+
+	allow, _ := gate.AllowConnection(newExpressionTestDevice())
+	assert.False(allow)
+
+	// expired filters no longer block devices, even before they are removed
+	now = now.Add(time.Hour)
+	allow, result := gate.AllowConnection(newExpressionTestDevice())
+	assert.False(allow)
+	assert.Equal("untrusted", result.Key)
+
+	now = now.Add(30 * time.Minute)
+	allow, _ = gate.AllowConnection(newExpressionTestDevice())
+	assert.True(allow)
+
+	assert.ElementsMatch([]string{"partner-id", "untrusted"}, gate.RemoveExpired())
+	assert.Equal(2.0, expired.Value())
+	assert.Empty(gate.RemoveExpired())
+
+	_, found := gate.GetFilter("partner-id")
+	assert.False(found)
+	_, found = gate.GetExpression("untrusted")
+	assert.False(found)
+	_, found = gate.GetFilter("permanent")
+	assert.True(found)
+
+	data, err = json.Marshal(gate)
+	require.NoError(err)
+	assert.JSONEq(`{"filters": {"permanent": ["value"]}, "allowedFilters": null}`, string(data))
+}
+
+func TestFilterGateSetUntil(t *testing.T) {
+	var (
+		assert  = assert.New(t)
+		require = require.New(t)
+
+		now  = time.Date(2020, time.June, 4, 12, 0, 0, 0, time.UTC)
+		gate = &FilterGate{
+			FilterStore: make(FilterStore),
+			now:         func() time.Time { return now },
+		}
+	)
+
+	_, created := gate.SetFilterUntil("partner-id", []interface{}{"comcast"}, now.Add(time.Hour))
+	assert.True(created)
+
+	created, err := gate.SetExpressionUntil("untrusted", Expression{Op: OpLT, Key: "trust", Values: []interface{}{1000.0}}, now.Add(time.Minute))
+	require.NoError(err)
+	assert.True(created)
+
+	// a zero time clears any existing expiry
+	_, created = gate.SetFilterUntil("untrusted", []interface{}{"value"}, time.Time{})
+	assert.False(created)
+
+	_, err = gate.SetExpressionUntil("invalid", Expression{Op: "like"}, now.Add(time.Hour))
+	assert.Error(err)
+
+	gate.lock.RLock()
+	assert.Equal(map[string]time.Time{"partner-id": now.Add(time.Hour)}, gate.expirations)
+	gate.lock.RUnlock()
+}
+
+func TestFilterGateStartExpiry(t *testing.T) {
+	var (
+		assert = assert.New(t)
+		gate   = &FilterGate{FilterStore: make(FilterStore), Logger: logging.NewTestLogger(nil, t)}
+	)
+
+	gate.SetFilter("partner-id", []interface{}{"comcast"})
+	assert.True(gate.SetExpiry("partner-id", time.Now()))
+
+	stop := gate.StartExpiry(time.Millisecond)
+	defer stop()
+
+	assert.Eventually(
+		func() bool {
+			_, found := gate.GetFilter("partner-id")
+			return !found
+		},
+		5*time.Second,
+		time.Millisecond,
+	)
+
+	stop()
+}
+
+func TestUpdateFiltersExpiry(t *testing.T) {
+	var (
+		logger = logging.NewTestLogger(nil, t)
+		ctx    = logging.WithLogger(context.Background(), logger)
+	)
+
+	t.Run("TTL", func(t *testing.T) {
+		var (
+			assert = assert.New(t)
+			gate   = &FilterGate{FilterStore: make(FilterStore)}
+			f      = FilterHandler{Gate: gate}
+		)
+
+		response := httptest.NewRecorder()
+		f.UpdateFilters(response, httptest.NewRequest("POST", "/", bytes.NewBufferString(`{"key": "test", "values": ["test1"], "ttl": "1h"}`)).WithContext(ctx))
+		assert.Equal(http.StatusCreated, response.Code)
+
+		gate.lock.RLock()
+		expires, ok := gate.expirations["test"]
+		gate.lock.RUnlock()
+		assert.True(ok)
+		assert.WithinDuration(time.Now().Add(time.Hour), expires, time.Minute)
+	})
+
+	t.Run("Store", func(t *testing.T) {
+		var (
+			assert = assert.New(t)
+			store  = new(mockStore)
+			gate   = &FilterGate{FilterStore: make(FilterStore)}
+			f      = FilterHandler{Gate: gate, Store: store}
+		)
+
+		store.On("Save", mock.Anything, mock.MatchedBy(func(fr FilterRequest) bool {
+			return len(fr.TTL) == 0 && fr.Expires != nil && fr.Expires.After(time.Now().Add(59*time.Minute))
+		})).Return(error(nil)).Once()
+
+		response := httptest.NewRecorder()
+		f.UpdateFilters(response, httptest.NewRequest("POST", "/", bytes.NewBufferString(`{"key": "test", "values": ["test1"], "ttl": "1h"}`)).WithContext(ctx))
+		assert.Equal(http.StatusCreated, response.Code)
+		store.AssertExpectations(t)
+	})
+
+	t.Run("NotExpiringGate", func(t *testing.T) {
+		var (
+			assert = assert.New(t)
+			gate   = new(mockDeviceGate)
+			f      = FilterHandler{Gate: gate}
+		)
+
+		response := httptest.NewRecorder()
+		f.UpdateFilters(response, httptest.NewRequest("POST", "/", bytes.NewBufferString(`{"key": "test", "values": ["test1"], "ttl": "1h"}`)).WithContext(ctx))
+		assert.Equal(http.StatusBadRequest, response.Code)
+		gate.AssertExpectations(t)
+	})
+
+	t.Run("Invalid", func(t *testing.T) {
+		for _, body := range []string{
+			`{"key": "test", "values": ["test1"], "ttl": "this is not a duration"}`,
+			`{"key": "test", "values": ["test1"], "expires": "2020-06-04T12:00:00Z"}`,
+		} {
+			var (
+				assert = assert.New(t)
+				gate   = &FilterGate{FilterStore: make(FilterStore)}
+				f      = FilterHandler{Gate: gate}
+			)
+
+			response := httptest.NewRecorder()
+			f.UpdateFilters(response, httptest.NewRequest("POST", "/", bytes.NewBufferString(body)).WithContext(ctx))
+			assert.Equal(http.StatusBadRequest, response.Code)
+
+			_, found := gate.GetFilter("test")
+			assert.False(found)
+		}
+	})
+}
@@ -0,0 +1,432 @@
+package devicegate
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"path"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/xmidt-org/webpa-common/device"
+)
+
+const (
+	// OpIn matches when a device's value for the key is one of the expression's values.  This is the
+	// default operator, and is the same match performed by a FilterGate for a plain filter key and values.
+	OpIn = "in"
+
+	// OpAnd matches when all of the nested filters match
+	OpAnd = "and"
+
+	// OpOr matches when any of the nested filters match
+	OpOr = "or"
+
+	// OpNot matches when its single nested filter does not match
+	OpNot = "not"
+
+	// OpPrefix matches when a device's string value for the key starts with any of the expression's values
+	OpPrefix = "prefix"
+
+	// OpRegex matches when a device's string value for the key matches any of the expression's regular expressions
+	OpRegex = "regex"
+
+	// OpGlob matches when a device's string value for the key matches any of the expression's shell patterns,
+	// as defined by path.Match
+	OpGlob = "glob"
+
+	// OpEQ matches when a device's numeric value for the key equals the expression's single value
+	OpEQ = "eq"
+
+	// OpLT matches when a device's numeric value for the key is less than the expression's single value
+	OpLT = "lt"
+
+	// OpLE matches when a device's numeric value for the key is less than or equal to the expression's single value
+	OpLE = "le"
+
+	// OpGT matches when a device's numeric value for the key is greater than the expression's single value
+	OpGT = "gt"
+
+	// OpGE matches when a device's numeric value for the key is greater than or equal to the expression's single value
+	OpGE = "ge"
+)
+
+const (
+	// DeviceIDKey is the expression key that refers to a device's ID rather than to its metadata or claims.
+	// When a gate restricts its allowed filters, this key must be allowed for expressions that use it.
+	DeviceIDKey = "$id"
+
+	idLocation         = "id"
+	expressionLocation = "expression"
+)
+
+var (
+	// ErrInvalidExpression is returned when a filter expression cannot be compiled
+	ErrInvalidExpression = errors.New("Invalid filter expression")
+
+	// ErrExpressionsNotSupported is returned when a filter expression is set on a gate that is not an ExpressionGate
+	ErrExpressionsNotSupported = errors.New("This gate does not support filter expressions")
+)
+
+// Expression describes a rule that matches devices.  Leaf expressions compare the value of Key, which is looked up
+// in a device's metadata and then in its claims, against Values using Op.  The and, or, and not operators instead
+// combine the nested Filters.
+//
+// The JSON form of a leaf expression with no operator is the same as a FilterRequest's key and values.
+type Expression struct {
+	Op      string        `json:"op,omitempty"`
+	Key     string        `json:"key,omitempty"`
+	Values  []interface{} `json:"values,omitempty"`
+	Filters []Expression  `json:"filters,omitempty"`
+}
+
+// Keys returns the distinct keys referenced by this expression, including DeviceIDKey if the expression
+// matches on device IDs
+func (e Expression) Keys() []string {
+	var (
+		keys []string
+		seen = make(map[string]bool)
+	)
+
+	var visit func(Expression)
+	visit = func(e Expression) {
+		if len(e.Key) > 0 && !seen[e.Key] {
+			seen[e.Key] = true
+			keys = append(keys, e.Key)
+		}
+
+		for _, f := range e.Filters {
+			visit(f)
+		}
+	}
+
+	visit(e)
+	return keys
+}
+
+// matcher is the compiled form of an Expression
+type matcher func(device.Interface) (bool, device.MatchResult)
+
+// ExpressionFilter is a compiled Expression.  It implements device.Filter, refusing connections from devices
+// that match the expression, and can also be used as a drain filter, draining the devices that match.
+type ExpressionFilter struct {
+	expression Expression
+	match      matcher
+}
+
+// NewExpressionFilter compiles an Expression
+func NewExpressionFilter(e Expression) (*ExpressionFilter, error) {
+	m, err := compile(e)
+	if err != nil {
+		return nil, err
+	}
+
+	return &ExpressionFilter{
+		expression: e,
+		match:      m,
+	}, nil
+}
+
+// Expression returns the expression this filter was compiled from
+func (ef *ExpressionFilter) Expression() Expression {
+	return ef.expression
+}
+
+// AllowConnection returns false, along with the location and key of the value that matched, if the device
+// matches this filter's expression
+func (ef *ExpressionFilter) AllowConnection(d device.Interface) (bool, device.MatchResult) {
+	if matched, result := ef.match(d); matched {
+		return false, result
+	}
+
+	return true, device.MatchResult{}
+}
+
+// GetFilterRequest returns the FilterRequest equivalent of this filter
+func (ef *ExpressionFilter) GetFilterRequest() FilterRequest {
+	e := ef.expression
+	return FilterRequest{Expression: &e}
+}
+
+func (ef *ExpressionFilter) MarshalJSON() ([]byte, error) {
+	return json.Marshal(ef.expression)
+}
+
+func invalidExpression(format string, args ...interface{}) error {
+	return fmt.Errorf("%s: %s", ErrInvalidExpression, fmt.Sprintf(format, args...))
+}
+
+func compile(e Expression) (matcher, error) {
+	switch e.Op {
+	case OpAnd, OpOr:
+		return compileLogical(e)
+
+	case OpNot:
+		if len(e.Filters) != 1 {
+			return nil, invalidExpression("%s requires exactly one filter", e.Op)
+		}
+
+		m, err := compile(e.Filters[0])
+		if err != nil {
+			return nil, err
+		}
+
+		return func(d device.Interface) (bool, device.MatchResult) {
+			if matched, _ := m(d); matched {
+				return false, device.MatchResult{}
+			}
+
+			return true, device.MatchResult{Location: expressionLocation}
+		}, nil
+	}
+
+	if len(e.Key) == 0 {
+		return nil, invalidExpression("missing filter key")
+	}
+
+	if len(e.Values) == 0 {
+		return nil, invalidExpression("missing filter values for key %s", e.Key)
+	}
+
+	var (
+		test func(interface{}) bool
+		err  error
+	)
+
+	switch e.Op {
+	case "", OpIn:
+		test, err = compileIn(e.Values)
+	case OpPrefix:
+		test, err = compileStrings(e.Values, func(p string) (func(string) bool, error) {
+			return func(v string) bool { return strings.HasPrefix(v, p) }, nil
+		})
+	case OpRegex:
+		test, err = compileStrings(e.Values, func(p string) (func(string) bool, error) {
+			r, err := regexp.Compile(p)
+			if err != nil {
+				return nil, err
+			}
+
+			return r.MatchString, nil
+		})
+	case OpGlob:
+		test, err = compileStrings(e.Values, func(p string) (func(string) bool, error) {
+			if _, err := path.Match(p, ""); err != nil {
+				return nil, err
+			}
+
+			return func(v string) bool {
+				matched, _ := path.Match(p, v)
+				return matched
+			}, nil
+		})
+	case OpEQ, OpLT, OpLE, OpGT, OpGE:
+		test, err = compileComparison(e.Op, e.Values)
+	default:
+		return nil, invalidExpression("unsupported operator %s", e.Op)
+	}
+
+	if err != nil {
+		return nil, invalidExpression("key %s: %s", e.Key, err)
+	}
+
+	key := e.Key
+	return func(d device.Interface) (bool, device.MatchResult) {
+		val, location := lookup(key, d)
+		if val == nil {
+			return false, device.MatchResult{}
+		}
+
+		if vals, ok := val.([]interface{}); ok {
+			for _, v := range vals {
+				if test(v) {
+					return true, device.MatchResult{Location: location, Key: key}
+				}
+			}
+		} else if test(val) {
+			return true, device.MatchResult{Location: location, Key: key}
+		}
+
+		return false, device.MatchResult{}
+	}, nil
+}
+
+func compileLogical(e Expression) (matcher, error) {
+	if len(e.Filters) == 0 {
+		return nil, invalidExpression("%s requires at least one filter", e.Op)
+	}
+
+	matchers := make([]matcher, len(e.Filters))
+	for i, f := range e.Filters {
+		var err error
+		if matchers[i], err = compile(f); err != nil {
+			return nil, err
+		}
+	}
+
+	if e.Op == OpAnd {
+		return func(d device.Interface) (bool, device.MatchResult) {
+			var first device.MatchResult
+			for i, m := range matchers {
+				matched, result := m(d)
+				if !matched {
+					return false, device.MatchResult{}
+				}
+
+				if i == 0 {
+					first = result
+				}
+			}
+
+			return true, first
+		}, nil
+	}
+
+	return func(d device.Interface) (bool, device.MatchResult) {
+		for _, m := range matchers {
+			if matched, result := m(d); matched {
+				return true, result
+			}
+		}
+
+		return false, device.MatchResult{}
+	}, nil
+}
+
+// lookup finds the value of a key for a device, in the same order as a FilterGate
+func lookup(key string, d device.Interface) (interface{}, string) {
+	if key == DeviceIDKey {
+		return string(d.ID()), idLocation
+	}
+
+	m := d.Metadata()
+	if v := m.Load(key); v != nil {
+		return v, metadataMapLocation
+	}
+
+	if v, ok := m.Claims()[key]; ok {
+		return v, claimsLocation
+	}
+
+	return nil, ""
+}
+
+func compileIn(values []interface{}) (func(interface{}) bool, error) {
+	set := make(map[interface{}]bool, len(values))
+	for _, v := range values {
+		switch v.(type) {
+		case []interface{}, map[string]interface{}:
+			return nil, fmt.Errorf("%v is not a scalar value", v)
+		}
+
+		set[v] = true
+	}
+
+	return func(v interface{}) bool {
+		switch v.(type) {
+		case []interface{}, map[string]interface{}:
+			return false
+		}
+
+		return set[v]
+	}, nil
+}
+
+func compileStrings(values []interface{}, factory func(string) (func(string) bool, error)) (func(interface{}) bool, error) {
+	tests := make([]func(string) bool, len(values))
+	for i, v := range values {
+		p, ok := v.(string)
+		if !ok {
+			return nil, fmt.Errorf("%v is not a string", v)
+		}
+
+		var err error
+		if tests[i], err = factory(p); err != nil {
+			return nil, err
+		}
+	}
+
+	return func(v interface{}) bool {
+		s, ok := v.(string)
+		if !ok {
+			return false
+		}
+
+		for _, t := range tests {
+			if t(s) {
+				return true
+			}
+		}
+
+		return false
+	}, nil
+}
+
+func compileComparison(op string, values []interface{}) (func(interface{}) bool, error) {
+	if len(values) != 1 {
+		return nil, fmt.Errorf("%s requires exactly one value", op)
+	}
+
+	operand, ok := toFloat(values[0])
+	if !ok {
+		return nil, fmt.Errorf("%v is not a number", values[0])
+	}
+
+	var compare func(float64) bool
+	switch op {
+	case OpEQ:
+		compare = func(v float64) bool { return v == operand }
+	case OpLT:
+		compare = func(v float64) bool { return v < operand }
+	case OpLE:
+		compare = func(v float64) bool { return v <= operand }
+	case OpGT:
+		compare = func(v float64) bool { return v > operand }
+	default:
+		compare = func(v float64) bool { return v >= operand }
+	}
+
+	return func(v interface{}) bool {
+		f, ok := toFloat(v)
+		return ok && compare(f)
+	}, nil
+}
+
+// toFloat converts the numeric types found in metadata and claims, including numeric strings, to a float64
+func toFloat(v interface{}) (float64, bool) {
+	switch n := v.(type) {
+	case float64:
+		return n, true
+	case float32:
+		return float64(n), true
+	case int:
+		return float64(n), true
+	case int8:
+		return float64(n), true
+	case int16:
+		return float64(n), true
+	case int32:
+		return float64(n), true
+	case int64:
+		return float64(n), true
+	case uint:
+		return float64(n), true
+	case uint8:
+		return float64(n), true
+	case uint16:
+		return float64(n), true
+	case uint32:
+		return float64(n), true
+	case uint64:
+		return float64(n), true
+	case json.Number:
+		f, err := n.Float64()
+		return f, err == nil
+	case string:
+		f, err := strconv.ParseFloat(n, 64)
+		return f, err == nil
+	}
+
+	return 0, false
+}
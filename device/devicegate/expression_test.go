@@ -0,0 +1,291 @@
+package devicegate
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/xmidt-org/webpa-common/device"
+)
+
+func newExpressionTestDevice() *device.MockDevice {
+	metadata := new(device.Metadata)
+	metadata.SetClaims(map[string]interface{}{
+		"partner-id": "comcast",
+		"trust":      float64(500),
+	})
+	metadata.Store("fw-name", "TG1682_3.8p4s1_PROD_sey")
+	metadata.Store("hw-model", []interface{}{"TG1682G", "TG3482G"})
+
+	d := new(device.MockDevice)
+	d.On("ID").Return(device.ID("mac:112233445566"))
+	d.On("Metadata").Return(metadata)
+	return d
+}
+
+func TestExpressionFilter(t *testing.T) {
+	tests := []struct {
+		description string
+		expression  string
+		matched     bool
+		result      device.MatchResult
+	}{
+		{
+			description: "In Claims",
+			expression:  `{"key": "partner-id", "values": ["comcast", "cox"]}`,
+			matched:     true,
+			result:      device.MatchResult{Location: claimsLocation, Key: "partner-id"},
+		},
+		{
+			description: "In Metadata List",
+			expression:  `{"op": "in", "key": "hw-model", "values": ["TG3482G"]}`,
+			matched:     true,
+			result:      device.MatchResult{Location: metadataMapLocation, Key: "hw-model"},
+		},
+		{
+			description: "Not In",
+			expression:  `{"key": "partner-id", "values": ["cox"]}`,
+		},
+		{
+			description: "Missing Key",
+			expression:  `{"key": "nosuch", "values": ["cox"]}`,
+		},
+		{
+			description: "Prefix",
+			expression:  `{"op": "prefix", "key": "fw-name", "values": ["TG3482", "TG1682_3.8"]}`,
+			matched:     true,
+			result:      device.MatchResult{Location: metadataMapLocation, Key: "fw-name"},
+		},
+		{
+			description: "Regex",
+			expression:  `{"op": "regex", "key": "fw-name", "values": ["_PROD_"]}`,
+			matched:     true,
+			result:      device.MatchResult{Location: metadataMapLocation, Key: "fw-name"},
+		},
+		{
+			description: "Regex No Match",
+			expression:  `{"op": "regex", "key": "fw-name", "values": ["^TG3482"]}`,
+		},
+		{
+			description: "Device ID Glob",
+			expression:  `{"op": "glob", "key": "$id", "values": ["mac:1122*"]}`,
+			matched:     true,
+			result:      device.MatchResult{Location: idLocation, Key: DeviceIDKey},
+		},
+		{
+			description: "Device ID Glob No Match",
+			expression:  `{"op": "glob", "key": "$id", "values": ["dns:*"]}`,
+		},
+		{
+			description: "Less Than",
+			expression:  `{"op": "lt", "key": "trust", "values": [1000]}`,
+			matched:     true,
+			result:      device.MatchResult{Location: claimsLocation, Key: "trust"},
+		},
+		{
+			description: "Less Than No Match",
+			expression:  `{"op": "lt", "key": "trust", "values": [500]}`,
+		},
+		{
+			description: "Less Than Or Equal",
+			expression:  `{"op": "le", "key": "trust", "values": [500]}`,
+			matched:     true,
+			result:      device.MatchResult{Location: claimsLocation, Key: "trust"},
+		},
+		{
+			description: "Greater Than",
+			expression:  `{"op": "gt", "key": "trust", "values": [500]}`,
+		},
+		{
+			description: "Greater Than Or Equal",
+			expression:  `{"op": "ge", "key": "trust", "values": [500]}`,
+			matched:     true,
+			result:      device.MatchResult{Location: claimsLocation, Key: "trust"},
+		},
+		{
+			description: "Equal",
+			expression:  `{"op": "eq", "key": "trust", "values": [500]}`,
+			matched:     true,
+			result:      device.MatchResult{Location: claimsLocation, Key: "trust"},
+		},
+		{
+			description: "Comparison Not A Number",
+			expression:  `{"op": "eq", "key": "partner-id", "values": [500]}`,
+		},
+		{
+			description: "And",
+			expression: `{"op": "and", "filters": [
+				{"key": "partner-id", "values": ["comcast"]},
+				{"op": "lt", "key": "trust", "values": [1000]}
+			]}`,
+			matched: true,
+			result:  device.MatchResult{Location: claimsLocation, Key: "partner-id"},
+		},
+		{
+			description: "And No Match",
+			expression: `{"op": "and", "filters": [
+				{"key": "partner-id", "values": ["comcast"]},
+				{"op": "gt", "key": "trust", "values": [1000]}
+			]}`,
+		},
+		{
+			description: "Or",
+			expression: `{"op": "or", "filters": [
+				{"key": "partner-id", "values": ["cox"]},
+				{"op": "prefix", "key": "$id", "values": ["mac:"]}
+			]}`,
+			matched: true,
+			result:  device.MatchResult{Location: idLocation, Key: DeviceIDKey},
+		},
+		{
+			description: "Not",
+			expression:  `{"op": "not", "filters": [{"key": "partner-id", "values": ["cox"]}]}`,
+			matched:     true,
+			result:      device.MatchResult{Location: expressionLocation},
+		},
+		{
+			description: "Not No Match",
+			expression:  `{"op": "not", "filters": [{"key": "partner-id", "values": ["comcast"]}]}`,
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.description, func(t *testing.T) {
+			var (
+				assert  = assert.New(t)
+				require = require.New(t)
+
+				e Expression
+			)
+
+			require.NoError(json.Unmarshal([]byte(tc.expression), &e))
+			ef, err := NewExpressionFilter(e)
+			require.NoError(err)
+			require.NotNil(ef)
+
+			allow, result := ef.AllowConnection(newExpressionTestDevice())
+			assert.Equal(!tc.matched, allow)
+			assert.Equal(tc.result, result)
+
+			assert.Equal(e, ef.Expression())
+			assert.Equal(FilterRequest{Expression: &e}, ef.GetFilterRequest())
+
+			data, err := json.Marshal(ef)
+			require.NoError(err)
+			assert.JSONEq(tc.expression, string(data))
+		})
+	}
+}
+
+func TestNewExpressionFilterInvalid(t *testing.T) {
+	tests := []struct {
+		description string
+		expression  Expression
+	}{
+		{"Unsupported Operator", Expression{Op: "like", Key: "test", Values: []interface{}{"test"}}},
+		{"Missing Key", Expression{Values: []interface{}{"test"}}},
+		{"Missing Values", Expression{Key: "test"}},
+		{"Non Scalar Value", Expression{Key: "test", Values: []interface{}{[]interface{}{"test"}}}},
+		{"Prefix Not A String", Expression{Op: OpPrefix, Key: "test", Values: []interface{}{1.0}}},
+		{"Bad Regex", Expression{Op: OpRegex, Key: "test", Values: []interface{}{"("}}},
+		{"Bad Glob", Expression{Op: OpGlob, Key: "test", Values: []interface{}{"["}}},
+		{"Comparison Not A Number", Expression{Op: OpLT, Key: "test", Values: []interface{}{"lots"}}},
+		{"Comparison Multiple Values", Expression{Op: OpGT, Key: "test", Values: []interface{}{1.0, 2.0}}},
+		{"Empty And", Expression{Op: OpAnd}},
+		{"Empty Or", Expression{Op: OpOr}},
+		{"Not Multiple Filters", Expression{Op: OpNot, Filters: []Expression{{Key: "a", Values: []interface{}{1.0}}, {Key: "b", Values: []interface{}{1.0}}}}},
+		{"Invalid Nested Filter", Expression{Op: OpOr, Filters: []Expression{{Key: "a", Values: []interface{}{1.0}}, {Op: OpRegex, Key: "b", Values: []interface{}{"("}}}}},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.description, func(t *testing.T) {
+			assert := assert.New(t)
+			ef, err := NewExpressionFilter(tc.expression)
+			assert.Nil(ef)
+			assert.Error(err)
+		})
+	}
+}
+
+func TestExpressionKeys(t *testing.T) {
+	assert := assert.New(t)
+
+	assert.Equal([]string{DeviceIDKey}, Expression{Op: OpGlob, Key: DeviceIDKey, Values: []interface{}{"*"}}.Keys())
+	assert.Equal(
+		[]string{"partner-id", "trust", DeviceIDKey},
+		Expression{
+			Op: OpOr,
+			Filters: []Expression{
+				{Key: "partner-id", Values: []interface{}{"comcast"}},
+				{Op: OpNot, Filters: []Expression{{Op: OpLT, Key: "trust", Values: []interface{}{100.0}}}},
+				{Op: OpPrefix, Key: "partner-id", Values: []interface{}{"cox"}},
+				{Op: OpGlob, Key: DeviceIDKey, Values: []interface{}{"mac:*"}},
+			},
+		}.Keys(),
+	)
+}
+
+func TestFilterRequestToExpression(t *testing.T) {
+	assert := assert.New(t)
+	e := Expression{Op: OpLT, Key: "trust", Values: []interface{}{100.0}}
+
+	assert.Equal(e, FilterRequest{Key: "rule", Expression: &e}.ToExpression())
+	assert.Equal(
+		Expression{Op: OpIn, Key: "partner-id", Values: []interface{}{"comcast"}},
+		FilterRequest{Key: "partner-id", Values: []interface{}{"comcast"}}.ToExpression(),
+	)
+}
+
+func TestFilterGateExpressions(t *testing.T) {
+	var (
+		assert  = assert.New(t)
+		require = require.New(t)
+
+		fg = FilterGate{FilterStore: make(FilterStore)}
+		e  = Expression{Op: OpLT, Key: "trust", Values: []interface{}{1000.0}}
+	)
+
+	_, err := fg.SetExpression("rule", Expression{Op: "like"})
+	assert.Error(err)
+
+	_, found := fg.GetExpression("rule")
+	assert.False(found)
+
+	created, err := fg.SetExpression("rule", e)
+	require.NoError(err)
+	assert.True(created)
+
+	actual, found := fg.GetExpression("rule")
+	assert.True(found)
+	assert.Equal(e, actual)
+
+	allow, result := fg.AllowConnection(newExpressionTestDevice())
+	assert.False(allow)
+	assert.Equal(device.MatchResult{Location: expressionLocation, Key: "rule"}, result)
+
+	data, err := json.Marshal(&fg)
+	require.NoError(err)
+	assert.JSONEq(`{"filters": {}, "allowedFilters": null, "expressions": {"rule": {"op": "lt", "key": "trust", "values": [1000]}}}`, string(data))
+
+	// a plain filter replaces an expression with the same key
+	_, created = fg.SetFilter("rule", []interface{}{"test"})
+	assert.False(created)
+	_, found = fg.GetExpression("rule")
+	assert.False(found)
+
+	allow, _ = fg.AllowConnection(newExpressionTestDevice())
+	assert.True(allow)
+
+	created, err = fg.SetExpression("rule", e)
+	require.NoError(err)
+	assert.False(created)
+	_, found = fg.GetFilter("rule")
+	assert.False(found)
+
+	assert.True(fg.DeleteFilter("rule"))
+	assert.False(fg.DeleteFilter("rule"))
+
+	allow, _ = fg.AllowConnection(newExpressionTestDevice())
+	assert.True(allow)
+}
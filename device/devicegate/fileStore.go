@@ -0,0 +1,166 @@
+package devicegate
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// DefaultPollInterval is the interval at which a FileStore checks its file for changes when no interval is set
+const DefaultPollInterval = 5 * time.Second
+
+// FileStore is a Store backed by a JSON file holding a list of filter requests.  The file is replaced atomically
+// on each change, so it can be shared by several processes, e.g. through a mounted volume.  Changes are detected
+// by polling the file.
+type FileStore struct {
+	// Path is the location of the JSON file.  A missing file is treated as an empty store.
+	Path string
+
+	// PollInterval is how often Watch checks the file for changes.  If unset, DefaultPollInterval is used.
+	PollInterval time.Duration
+
+	lock sync.Mutex
+}
+
+func (fs *FileStore) read() ([]byte, error) {
+	data, err := ioutil.ReadFile(fs.Path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+
+	return data, err
+}
+
+func decodeFilters(data []byte) ([]FilterRequest, error) {
+	var filters []FilterRequest
+	if len(data) == 0 {
+		return filters, nil
+	}
+
+	if err := json.Unmarshal(data, &filters); err != nil {
+		return nil, err
+	}
+
+	return filters, nil
+}
+
+func (fs *FileStore) Load(context.Context) ([]FilterRequest, error) {
+	data, err := fs.read()
+	if err != nil {
+		return nil, err
+	}
+
+	return decodeFilters(data)
+}
+
+// update applies a change to the filters in the file and writes the result
+func (fs *FileStore) update(change func([]FilterRequest) []FilterRequest) error {
+	fs.lock.Lock()
+	defer fs.lock.Unlock()
+
+	filters, err := fs.Load(context.Background())
+	if err != nil {
+		return err
+	}
+
+	filters = change(filters)
+	if filters == nil {
+		filters = []FilterRequest{}
+	}
+
+	data, err := json.Marshal(filters)
+	if err != nil {
+		return err
+	}
+
+	temp, err := ioutil.TempFile(filepath.Dir(fs.Path), filepath.Base(fs.Path)+".")
+	if err != nil {
+		return err
+	}
+
+	defer os.Remove(temp.Name())
+	if _, err := temp.Write(data); err != nil {
+		temp.Close()
+		return err
+	}
+
+	if err := temp.Close(); err != nil {
+		return err
+	}
+
+	return os.Rename(temp.Name(), fs.Path)
+}
+
+func (fs *FileStore) Save(_ context.Context, f FilterRequest) error {
+	return fs.update(func(filters []FilterRequest) []FilterRequest {
+		for i := range filters {
+			if filters[i].Key == f.Key {
+				filters[i] = f
+				return filters
+			}
+		}
+
+		return append(filters, f)
+	})
+}
+
+func (fs *FileStore) Remove(_ context.Context, key string) error {
+	return fs.update(func(filters []FilterRequest) []FilterRequest {
+		kept := filters[:0]
+		for _, f := range filters {
+			if f.Key != key {
+				kept = append(kept, f)
+			}
+		}
+
+		return kept
+	})
+}
+
+// Watch polls the file for changes.  The listener is not invoked for the file's contents at the time
+// Watch is called, nor when the file cannot be read or parsed.
+func (fs *FileStore) Watch(l FilterListener) (func(), error) {
+	last, err := fs.read()
+	if err != nil {
+		return nil, err
+	}
+
+	interval := fs.PollInterval
+	if interval <= 0 {
+		interval = DefaultPollInterval
+	}
+
+	var (
+		ticker   = time.NewTicker(interval)
+		shutdown = make(chan struct{})
+		once     sync.Once
+	)
+
+	go func() {
+		defer ticker.Stop()
+		for {
+			select {
+			case <-shutdown:
+				return
+
+			case <-ticker.C:
+				data, err := fs.read()
+				if err != nil || bytes.Equal(data, last) {
+					continue
+				}
+
+				if filters, err := decodeFilters(data); err == nil {
+					last = data
+					l(filters)
+				}
+			}
+		}
+	}()
+
+	return func() { once.Do(func() { close(shutdown) }) }, nil
+}
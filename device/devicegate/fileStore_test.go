@@ -0,0 +1,80 @@
+package devicegate
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFileStore(t *testing.T) {
+	var (
+		assert  = assert.New(t)
+		require = require.New(t)
+
+		ctx   = context.Background()
+		trust = Expression{Op: OpLT, Key: "trust", Values: []interface{}{1000.0}}
+	)
+
+	dir, err := ioutil.TempDir("", "devicegate")
+	require.NoError(err)
+	defer os.RemoveAll(dir)
+
+	store := &FileStore{Path: filepath.Join(dir, "filters.json"), PollInterval: 10 * time.Millisecond}
+	filters, err := store.Load(ctx)
+	assert.Empty(filters)
+	assert.NoError(err)
+
+	changes := make(chan []FilterRequest, 10)
+	stop, err := store.Watch(func(f []FilterRequest) { changes <- f })
+	require.NoError(err)
+	defer stop()
+
+	require.NoError(store.Save(ctx, FilterRequest{Key: "partner-id", Values: []interface{}{"comcast"}}))
+	require.NoError(store.Save(ctx, FilterRequest{Key: "untrusted", Expression: &trust}))
+	require.NoError(store.Save(ctx, FilterRequest{Key: "partner-id", Values: []interface{}{"cox"}}))
+
+	expected := []FilterRequest{
+		{Key: "partner-id", Values: []interface{}{"cox"}},
+		{Key: "untrusted", Expression: &trust},
+	}
+
+	filters, err = store.Load(ctx)
+	assert.NoError(err)
+	assert.Equal(expected, filters)
+
+	// another process sharing the file sees the same filters
+	other := &FileStore{Path: store.Path}
+	filters, err = other.Load(ctx)
+	assert.NoError(err)
+	assert.Equal(expected, filters)
+
+	require.NoError(other.Remove(ctx, "partner-id"))
+	require.NoError(other.Remove(ctx, "nosuch"))
+
+	timeout := time.After(5 * time.Second)
+	for {
+		select {
+		case filters = <-changes:
+		case <-timeout:
+			assert.Fail("The change was not detected")
+			return
+		}
+
+		if len(filters) == 1 {
+			break
+		}
+	}
+
+	assert.Equal([]FilterRequest{{Key: "untrusted", Expression: &trust}}, filters)
+
+	require.NoError(ioutil.WriteFile(store.Path, []byte("this is not JSON"), 0600))
+	_, err = store.Load(ctx)
+	assert.Error(err)
+	assert.Error(store.Save(ctx, FilterRequest{Key: "test"}))
+}
@@ -3,8 +3,11 @@ package devicegate
 import (
 	"encoding/json"
 	"sync"
+	"time"
 
+	"github.com/go-kit/kit/log"
 	"github.com/xmidt-org/webpa-common/device"
+	"github.com/xmidt-org/webpa-common/xmetrics"
 )
 
 const (
@@ -39,6 +42,19 @@ type Interface interface {
 	GetAllowedFilters() (Set, bool)
 }
 
+// ExpressionGate is implemented by a gate Interface that supports filter expressions.  FilterGate implements
+// this interface.
+type ExpressionGate interface {
+	// GetExpression returns the filter expression associated with a filter key and a bool that is true if the
+	// key was found, false if it doesn't exist or is associated with a plain set of filter values.
+	GetExpression(key string) (Expression, bool)
+
+	// SetExpression saves a filter expression under a filter key, replacing any filter values or expression
+	// previously saved under that key.  It returns true if the filter key did not previously exist, and an
+	// error if the expression is invalid.
+	SetExpression(key string, e Expression) (bool, error)
+}
+
 // Set is an interface that represents a read-only hashset
 type Set interface {
 	json.Marshaler
@@ -60,15 +76,80 @@ type FilterSet struct {
 
 // FilterGate is a concrete implementation of the Interface
 type FilterGate struct {
-	FilterStore    FilterStore `json:"filters"`
-	AllowedFilters Set         `json:"allowedFilters"`
+	FilterStore    FilterStore                  `json:"filters"`
+	AllowedFilters Set                          `json:"allowedFilters"`
+	Expressions    map[string]*ExpressionFilter `json:"expressions,omitempty"`
 
-	lock sync.RWMutex
+	// Logger is used to log the removal of expired filters.  If unset, logging.DefaultLogger() is used.
+	Logger log.Logger `json:"-"`
+
+	// Expired counts the filters removed because they expired.  This field is optional.
+	Expired xmetrics.Adder `json:"-"`
+
+	lock        sync.RWMutex
+	expirations map[string]time.Time
+	now         func() time.Time
 }
 
+// FilterRequest describes a filter to set on a gate or to drain devices by.  Either Values or Expression
+// should be set.  When Expression is set, Key names the expression.
 type FilterRequest struct {
-	Key    string        `json:"key"`
-	Values []interface{} `json:"values"`
+	Key        string        `json:"key"`
+	Values     []interface{} `json:"values,omitempty"`
+	Expression *Expression   `json:"expression,omitempty"`
+
+	// TTL is the optional lifetime of the filter, as a duration string such as "2h"
+	TTL string `json:"ttl,omitempty"`
+
+	// Expires is the optional time at which the filter is removed.  If both TTL and Expires are set,
+	// the earlier expiry is used.
+	Expires *time.Time `json:"expires,omitempty"`
+}
+
+// ToExpression returns the Expression described by this request.  A request without an Expression
+// is equivalent to an OpIn expression on its key and values.
+func (fr FilterRequest) ToExpression() Expression {
+	if fr.Expression != nil {
+		return *fr.Expression
+	}
+
+	return Expression{
+		Op:     OpIn,
+		Key:    fr.Key,
+		Values: fr.Values,
+	}
+}
+
+// applyFilter sets the filter described by a request on a gate, returning true if the filter key did not
+// previously exist.  A nonzero expires is set along with the filter, in the same update.  ErrExpressionsNotSupported
+// is returned for an expression if the gate is not an ExpressionGate, and ErrExpiryNotSupported is returned for
+// an expiring filter if the gate is not an ExpiringGate.
+func applyFilter(gate Interface, fr FilterRequest, expires time.Time) (bool, error) {
+	if !expires.IsZero() {
+		eg, ok := gate.(ExpiringGate)
+		if !ok {
+			return false, ErrExpiryNotSupported
+		}
+
+		if fr.Expression == nil {
+			_, created := eg.SetFilterUntil(fr.Key, fr.Values, expires)
+			return created, nil
+		}
+
+		return eg.SetExpressionUntil(fr.Key, *fr.Expression, expires)
+	}
+
+	if fr.Expression == nil {
+		_, created := gate.SetFilter(fr.Key, fr.Values)
+		return created, nil
+	}
+
+	eg, ok := gate.(ExpressionGate)
+	if !ok {
+		return false, ErrExpressionsNotSupported
+	}
+
+	return eg.SetExpression(fr.Key, *fr.Expression)
 }
 
 func (f *FilterGate) VisitAll(visit func(string, Set) bool) int {
@@ -96,6 +177,10 @@ func (f *FilterGate) GetFilter(key string) (Set, bool) {
 }
 
 func (f *FilterGate) SetFilter(key string, values []interface{}) (Set, bool) {
+	return f.SetFilterUntil(key, values, time.Time{})
+}
+
+func (f *FilterGate) SetFilterUntil(key string, values []interface{}, expires time.Time) (Set, bool) {
 	f.lock.Lock()
 	defer f.lock.Unlock()
 
@@ -110,8 +195,12 @@ func (f *FilterGate) SetFilter(key string, values []interface{}) (Set, bool) {
 		Set: newValues,
 	}
 
+	_, replaced := f.Expressions[key]
+	delete(f.Expressions, key)
+	f.setExpiry(key, expires)
+
 	if oldValues == nil {
-		return oldValues, true
+		return oldValues, !replaced
 	}
 
 	return oldValues, false
@@ -123,26 +212,85 @@ func (f *FilterGate) DeleteFilter(key string) bool {
 	defer f.lock.Unlock()
 
 	_, ok := f.FilterStore[key]
+	_, expressionOK := f.Expressions[key]
 
-	if ok {
+	if ok || expressionOK {
 		delete(f.FilterStore, key)
+		delete(f.Expressions, key)
+		delete(f.expirations, key)
 		return true
 	}
 
 	return false
 }
 
+func (f *FilterGate) GetExpression(key string) (Expression, bool) {
+	f.lock.RLock()
+	defer f.lock.RUnlock()
+
+	if ef, ok := f.Expressions[key]; ok {
+		return ef.Expression(), true
+	}
+
+	return Expression{}, false
+}
+
+func (f *FilterGate) SetExpression(key string, e Expression) (bool, error) {
+	return f.SetExpressionUntil(key, e, time.Time{})
+}
+
+func (f *FilterGate) SetExpressionUntil(key string, e Expression, expires time.Time) (bool, error) {
+	ef, err := NewExpressionFilter(e)
+	if err != nil {
+		return false, err
+	}
+
+	f.lock.Lock()
+	defer f.lock.Unlock()
+
+	if f.Expressions == nil {
+		f.Expressions = make(map[string]*ExpressionFilter)
+	}
+
+	_, setExisted := f.FilterStore[key]
+	_, expressionExisted := f.Expressions[key]
+
+	delete(f.FilterStore, key)
+	f.setExpiry(key, expires)
+	f.Expressions[key] = ef
+
+	return !setExisted && !expressionExisted, nil
+}
+
 func (f *FilterGate) AllowConnection(d device.Interface) (bool, device.MatchResult) {
 	f.lock.RLock()
 	defer f.lock.RUnlock()
 
+	now := f.currentTime()
 	for filterKey, filterValues := range f.FilterStore {
+		if f.expired(filterKey, now) {
+			continue
+		}
+
 		// check for filter match
 		if found, result := f.FilterStore.metadataMatch(filterKey, filterValues, d.Metadata()); found {
 			return false, result
 		}
 	}
 
+	for key, ef := range f.Expressions {
+		if f.expired(key, now) {
+			continue
+		}
+
+		if allow, _ := ef.AllowConnection(d); !allow {
+			return false, device.MatchResult{
+				Location: expressionLocation,
+				Key:      key,
+			}
+		}
+	}
+
 	return true, device.MatchResult{}
 }
 
@@ -7,9 +7,11 @@ import (
 	"fmt"
 	"io/ioutil"
 	"net/http"
+	"time"
 
 	"github.com/go-kit/kit/log"
 	"github.com/go-kit/kit/log/level"
+	"github.com/xmidt-org/webpa-common/device"
 	"github.com/xmidt-org/webpa-common/logging"
 	"github.com/xmidt-org/webpa-common/xhttp"
 )
@@ -22,6 +24,17 @@ const gateKey ContextKey = "gate"
 // FilterHandler is an http.Handler that can get, add, and delete filters from a devicegate Interface
 type FilterHandler struct {
 	Gate Interface
+
+	// Store is the optional persistent backend for filters.  If set, changes are saved to the Store before they
+	// are applied to the Gate.  Other instances sharing the Store pick up the changes through Sync.
+	Store Store
+
+	// Manager is the device manager whose connected devices are evaluated by PreviewFilter
+	Manager device.Manager
+
+	// PreviewSampleSize is the number of matching device IDs PreviewFilter samples for each key.  If unset,
+	// DefaultPreviewSampleSize is used.
+	PreviewSampleSize int
 }
 
 // GateLogger is used to log extra details about the gate
@@ -54,7 +67,13 @@ func (fh *FilterHandler) UpdateFilters(response http.ResponseWriter, request *ht
 		return
 	}
 
-	if _, created := fh.Gate.SetFilter(message.Key, message.Values); created {
+	created, status, err := fh.applyRequest(request.Context(), logger, message)
+	if err != nil {
+		xhttp.WriteError(response, status, err)
+		return
+	}
+
+	if created {
 		response.WriteHeader(http.StatusCreated)
 	} else {
 		response.WriteHeader(http.StatusOK)
@@ -64,6 +83,51 @@ func (fh *FilterHandler) UpdateFilters(response http.ResponseWriter, request *ht
 	*request = *request.WithContext(newCtx)
 }
 
+// applyRequest saves a validated filter request to the Store, if there is one, and then applies it to the Gate.
+// If the filter cannot be applied, the returned status code is the one to report to the client.
+func (fh *FilterHandler) applyRequest(ctx context.Context, logger log.Logger, message FilterRequest) (bool, int, error) {
+	now := time.Now()
+	expires, err := message.Expiry(now)
+	if err != nil || (!expires.IsZero() && !expires.After(now)) {
+		if err == nil {
+			err = errors.New("filter has already expired")
+		}
+
+		logger.Log(level.Key(), level.ErrorValue(), logging.MessageKey(), "invalid filter expiry", logging.ErrorKey(), err)
+		return false, http.StatusBadRequest, err
+	}
+
+	if fh.Store != nil {
+		// store the absolute expiry, so that every instance removes the filter at the same time
+		message.TTL = ""
+		message.Expires = nil
+		if !expires.IsZero() {
+			message.Expires = &expires
+		}
+
+		if message.Expression != nil {
+			// don't persist an expression that no gate could apply
+			if _, err := NewExpressionFilter(*message.Expression); err != nil {
+				logger.Log(level.Key(), level.ErrorValue(), logging.MessageKey(), "invalid filter expression", logging.ErrorKey(), err)
+				return false, http.StatusBadRequest, err
+			}
+		}
+
+		if err := fh.Store.Save(ctx, message); err != nil {
+			logger.Log(level.Key(), level.ErrorValue(), logging.MessageKey(), "unable to save filter", logging.ErrorKey(), err)
+			return false, http.StatusInternalServerError, err
+		}
+	}
+
+	created, err := applyFilter(fh.Gate, message, expires)
+	if err != nil {
+		logger.Log(level.Key(), level.ErrorValue(), logging.MessageKey(), "invalid filter expression", logging.ErrorKey(), err)
+		return false, http.StatusBadRequest, err
+	}
+
+	return created, 0, nil
+}
+
 // DeleteFilter is a handler function used to delete a particular filter stored in the gate
 func (fh *FilterHandler) DeleteFilter(response http.ResponseWriter, request *http.Request) {
 	logger := logging.GetLogger(request.Context())
@@ -82,6 +146,14 @@ func (fh *FilterHandler) DeleteFilter(response http.ResponseWriter, request *htt
 		return
 	}
 
+	if fh.Store != nil {
+		if err := fh.Store.Remove(request.Context(), message.Key); err != nil {
+			logger.Log(level.Key(), level.ErrorValue(), logging.MessageKey(), "unable to remove filter", logging.ErrorKey(), err)
+			xhttp.WriteError(response, http.StatusInternalServerError, err)
+			return
+		}
+	}
+
 	fh.Gate.DeleteFilter(message.Key)
 	response.WriteHeader(http.StatusOK)
 
@@ -135,14 +207,30 @@ func checkRequestDetails(f FilterRequest, gate Interface, checkFilterValues bool
 	}
 
 	if checkFilterValues {
-		if len(f.Values) == 0 {
+		keys := []string{f.Key}
+		if f.Expression != nil {
+			if _, ok := gate.(ExpressionGate); !ok {
+				return false, ErrExpressionsNotSupported
+			}
+
+			// an expression's key is only its name, so the keys it filters on, including DeviceIDKey, are checked instead
+			keys = f.Expression.Keys()
+		} else if len(f.Values) == 0 {
 			return false, errors.New("missing filter values")
 		}
 
+		if len(f.TTL) > 0 || f.Expires != nil {
+			if _, ok := gate.(ExpiringGate); !ok {
+				return false, ErrExpiryNotSupported
+			}
+		}
+
 		if allowedFilters, allowedFiltersFound := gate.GetAllowedFilters(); allowedFiltersFound {
-			if !allowedFilters.Has(f.Key) {
-				allowedFiltersJSON, _ := json.Marshal(allowedFilters)
-				return false, fmt.Errorf("filter key %s is not allowed. Allowed filters: %s", f.Key, allowedFiltersJSON)
+			for _, key := range keys {
+				if !allowedFilters.Has(key) {
+					allowedFiltersJSON, _ := json.Marshal(allowedFilters)
+					return false, fmt.Errorf("filter key %s is not allowed. Allowed filters: %s", key, allowedFiltersJSON)
+				}
 			}
 		}
 	}
@@ -75,6 +75,16 @@ func TestBadRequest(t *testing.T) {
 			reqBody:            []byte(`{"key": "test", "values": ["test", "test1"]}`),
 			expectedStatusCode: http.StatusBadRequest,
 		},
+		{
+			description:        "Expression filter key not allowed",
+			reqBody:            []byte(`{"key": "rule", "expression": {"op": "not", "filters": [{"key": "test", "values": ["test"]}]}}`),
+			expectedStatusCode: http.StatusBadRequest,
+		},
+		{
+			description:        "Device ID expression not allowed",
+			reqBody:            []byte(`{"key": "rule", "expression": {"op": "not", "filters": [{"op": "glob", "key": "$id", "values": ["mac:*"]}]}}`),
+			expectedStatusCode: http.StatusBadRequest,
+		},
 	}
 
 	mockDeviceGate.On("GetAllowedFilters").Return(&FilterSet{}, true)
@@ -171,6 +181,89 @@ func TestSuccessfulAdd(t *testing.T) {
 
 }
 
+func TestUpdateExpression(t *testing.T) {
+	var (
+		logger = logging.NewTestLogger(nil, t)
+		ctx    = logging.WithLogger(context.Background(), logger)
+
+		expression = Expression{
+			Op: OpAnd,
+			Filters: []Expression{
+				{Op: OpPrefix, Key: DeviceIDKey, Values: []interface{}{"mac:11"}},
+				{Op: OpLT, Key: "trust", Values: []interface{}{1000.0}},
+			},
+		}
+	)
+
+	tests := []struct {
+		description        string
+		created            bool
+		err                error
+		expectedStatusCode int
+	}{
+		{
+			description:        "Created",
+			created:            true,
+			expectedStatusCode: http.StatusCreated,
+		},
+		{
+			description:        "Updated",
+			expectedStatusCode: http.StatusOK,
+		},
+		{
+			description:        "Invalid",
+			err:                ErrInvalidExpression,
+			expectedStatusCode: http.StatusBadRequest,
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.description, func(t *testing.T) {
+			assert := assert.New(t)
+			mockDeviceGate := new(mockDeviceGate)
+			f := FilterHandler{
+				Gate: mockDeviceGate,
+			}
+
+			mockDeviceGate.On("GetAllowedFilters").Return(&FilterSet{Set: map[interface{}]bool{"trust": true, DeviceIDKey: true}}, true).Once()
+			mockDeviceGate.On("SetExpression", "rule", expression).Return(tc.created, tc.err).Once()
+
+			response := httptest.NewRecorder()
+			f.UpdateFilters(response, httptest.NewRequest("POST", "/", bytes.NewBufferString(
+				`{"key": "rule", "expression": {"op": "and", "filters": [
+					{"op": "prefix", "key": "$id", "values": ["mac:11"]},
+					{"op": "lt", "key": "trust", "values": [1000]}
+				]}}`,
+			)).WithContext(ctx))
+
+			assert.Equal(tc.expectedStatusCode, response.Code)
+			mockDeviceGate.AssertExpectations(t)
+		})
+	}
+}
+
+func TestExpressionsNotSupported(t *testing.T) {
+	var (
+		assert   = assert.New(t)
+		logger   = logging.NewTestLogger(nil, t)
+		ctx      = logging.WithLogger(context.Background(), logger)
+		response = httptest.NewRecorder()
+
+		// hide the gate's ExpressionGate methods
+		mockDeviceGate = new(mockDeviceGate)
+		f              = FilterHandler{
+			Gate: struct{ Interface }{mockDeviceGate},
+		}
+	)
+
+	f.UpdateFilters(response, httptest.NewRequest("POST", "/", bytes.NewBufferString(
+		`{"key": "rule", "expression": {"key": "test", "values": ["test"]}}`,
+	)).WithContext(ctx))
+
+	assert.Equal(http.StatusBadRequest, response.Code)
+	mockDeviceGate.AssertExpectations(t)
+}
+
 func TestDelete(t *testing.T) {
 	var (
 		logger   = logging.NewTestLogger(nil, t)
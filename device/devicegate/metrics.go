@@ -0,0 +1,19 @@
+package devicegate
+
+import "github.com/xmidt-org/webpa-common/xmetrics"
+
+const (
+	// ExpiredFilterCounter is the count of gate filters removed because they expired
+	ExpiredFilterCounter = "gate_expired_filters"
+)
+
+// Metrics is the devicegate module function that adds default devicegate metrics
+func Metrics() []xmetrics.Metric {
+	return []xmetrics.Metric{
+		{
+			Name: ExpiredFilterCounter,
+			Type: "counter",
+			Help: "The number of gate filters removed because they expired",
+		},
+	}
+}
@@ -1,6 +1,8 @@
 package devicegate
 
 import (
+	"context"
+
 	"github.com/stretchr/testify/mock"
 	"github.com/xmidt-org/webpa-common/device"
 )
@@ -31,6 +33,17 @@ func (m *mockDeviceGate) DeleteFilter(key string) bool {
 	return args.Bool(0)
 }
 
+func (m *mockDeviceGate) GetExpression(key string) (Expression, bool) {
+	args := m.Called(key)
+	e, _ := args.Get(0).(Expression)
+	return e, args.Bool(1)
+}
+
+func (m *mockDeviceGate) SetExpression(key string, e Expression) (bool, error) {
+	args := m.Called(key, e)
+	return args.Bool(0), args.Error(1)
+}
+
 func (m *mockDeviceGate) GetAllowedFilters() (Set, bool) {
 	args := m.Called()
 	set, _ := args.Get(0).(Set)
@@ -48,3 +61,54 @@ func (m *mockDeviceGate) MarshalJSON() ([]byte, error) {
 	json, _ := args.Get(0).([]byte)
 	return json, args.Error(1)
 }
+
+type mockStore struct {
+	mock.Mock
+}
+
+func (m *mockStore) Load(ctx context.Context) ([]FilterRequest, error) {
+	args := m.Called(ctx)
+	filters, _ := args.Get(0).([]FilterRequest)
+	return filters, args.Error(1)
+}
+
+func (m *mockStore) Save(ctx context.Context, f FilterRequest) error {
+	return m.Called(ctx, f).Error(0)
+}
+
+func (m *mockStore) Remove(ctx context.Context, key string) error {
+	return m.Called(ctx, key).Error(0)
+}
+
+func (m *mockStore) Watch(l FilterListener) (func(), error) {
+	args := m.Called(l)
+	stop, _ := args.Get(0).(func())
+	return stop, args.Error(1)
+}
+
+// testManager is a device.Manager over a fixed list of devices that records disconnections
+type testManager struct {
+	device.Manager
+
+	devices      []device.Interface
+	disconnected []device.ID
+	reasons      []device.CloseReason
+}
+
+func (m *testManager) VisitAll(visit func(device.Interface) bool) int {
+	visited := 0
+	for _, d := range m.devices {
+		visited++
+		if !visit(d) {
+			break
+		}
+	}
+
+	return visited
+}
+
+func (m *testManager) Disconnect(id device.ID, reason device.CloseReason) bool {
+	m.disconnected = append(m.disconnected, id)
+	m.reasons = append(m.reasons, reason)
+	return true
+}
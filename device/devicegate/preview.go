@@ -0,0 +1,161 @@
+package devicegate
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+
+	"github.com/go-kit/kit/log/level"
+	"github.com/xmidt-org/webpa-common/device"
+	"github.com/xmidt-org/webpa-common/logging"
+	"github.com/xmidt-org/webpa-common/xhttp"
+)
+
+const (
+	// DefaultPreviewSampleSize is the number of matching device IDs sampled for each key when no size is configured
+	DefaultPreviewSampleSize = 10
+
+	// FilteredOut is the close reason for devices disconnected because a filter was enforced
+	FilteredOut = "filtered-out"
+)
+
+// KeyPreview summarizes the devices matched through a single key of a filter
+type KeyPreview struct {
+	// Count is the number of devices matched through this key
+	Count int `json:"count"`
+
+	// Sample is a subset of the IDs of the matched devices
+	Sample []device.ID `json:"sample"`
+}
+
+// Preview describes the impact a filter would have on the devices currently connected
+type Preview struct {
+	// Visited is the number of connected devices that were evaluated
+	Visited int `json:"visited"`
+
+	// Matched is the number of connected devices that the filter matches, i.e. the devices it would block
+	Matched int `json:"matched"`
+
+	// Keys groups the matched devices by the key that matched each device
+	Keys map[string]*KeyPreview `json:"keys"`
+
+	// Disconnected is the number of matched devices that were disconnected, if the filter was enforced
+	Disconnected int `json:"disconnected"`
+}
+
+// PreviewFilter evaluates a filter request against every device in a registry.  Devices whose match has no key,
+// such as those matched by a not expression, are grouped under the request's key.  The IDs of all matched
+// devices are returned along with the Preview.
+func PreviewFilter(r device.Registry, fr FilterRequest, sampleSize int) (Preview, []device.ID, error) {
+	ef, err := NewExpressionFilter(fr.ToExpression())
+	if err != nil {
+		return Preview{}, nil, err
+	}
+
+	if sampleSize < 0 {
+		sampleSize = 0
+	}
+
+	var (
+		preview = Preview{Keys: make(map[string]*KeyPreview)}
+		matched []device.ID
+	)
+
+	preview.Visited = r.VisitAll(func(d device.Interface) bool {
+		if allow, result := ef.AllowConnection(d); !allow {
+			key := result.Key
+			if len(key) == 0 {
+				key = fr.Key
+			}
+
+			kp := preview.Keys[key]
+			if kp == nil {
+				kp = &KeyPreview{Sample: []device.ID{}}
+				preview.Keys[key] = kp
+			}
+
+			kp.Count++
+			if len(kp.Sample) < sampleSize {
+				kp.Sample = append(kp.Sample, d.ID())
+			}
+
+			matched = append(matched, d.ID())
+		}
+
+		return true
+	})
+
+	preview.Matched = len(matched)
+	return preview, matched, nil
+}
+
+// PreviewFilter is a handler function that evaluates a proposed filter, given in the same form as for UpdateFilters,
+// against the devices connected to the Manager without changing the gate.  If the enforce parameter is true, the
+// filter is saved to the Store and applied to the Gate, just as UpdateFilters does, and then the connected devices
+// that match it are disconnected.
+func (fh *FilterHandler) PreviewFilter(response http.ResponseWriter, request *http.Request) {
+	logger := logging.GetLogger(request.Context())
+	if fh.Manager == nil {
+		xhttp.WriteErrorf(response, http.StatusInternalServerError, "No device manager configured")
+		return
+	}
+
+	var enforce bool
+	if v := request.URL.Query().Get("enforce"); len(v) > 0 {
+		var err error
+		if enforce, err = strconv.ParseBool(v); err != nil {
+			xhttp.WriteErrorf(response, http.StatusBadRequest, "Invalid enforce parameter: %s", v)
+			return
+		}
+	}
+
+	message, err := validateRequestBody(request)
+	if err != nil {
+		logger.Log(level.Key(), level.ErrorValue(), logging.MessageKey(), "error with request body", logging.ErrorKey(), err)
+		xhttp.WriteError(response, http.StatusBadRequest, err)
+		return
+	}
+
+	if allow, err := checkRequestDetails(message, fh.Gate, true); !allow {
+		logger.Log(level.Key(), level.ErrorValue(), logging.MessageKey(), err)
+		xhttp.WriteError(response, http.StatusBadRequest, err)
+		return
+	}
+
+	sampleSize := fh.PreviewSampleSize
+	if sampleSize == 0 {
+		sampleSize = DefaultPreviewSampleSize
+	}
+
+	preview, matched, err := PreviewFilter(fh.Manager, message, sampleSize)
+	if err != nil {
+		logger.Log(level.Key(), level.ErrorValue(), logging.MessageKey(), "invalid filter expression", logging.ErrorKey(), err)
+		xhttp.WriteError(response, http.StatusBadRequest, err)
+		return
+	}
+
+	if enforce {
+		// the filter is applied first, exactly as UpdateFilters would, so that disconnected devices can't reconnect
+		if _, status, err := fh.applyRequest(request.Context(), logger, message); err != nil {
+			xhttp.WriteError(response, status, err)
+			return
+		}
+
+		for _, id := range matched {
+			if fh.Manager.Disconnect(id, device.CloseReason{Text: FilteredOut}) {
+				preview.Disconnected++
+			}
+		}
+
+		logger.Log(level.Key(), level.InfoValue(), logging.MessageKey(), "enforced filter", "filterKey", message.Key, "disconnected", preview.Disconnected)
+	}
+
+	data, err := json.Marshal(preview)
+	if err != nil {
+		xhttp.WriteError(response, http.StatusInternalServerError, err)
+		return
+	}
+
+	response.Header().Set("Content-Type", "application/json")
+	response.Write(data)
+}
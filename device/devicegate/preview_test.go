@@ -0,0 +1,234 @@
+package devicegate
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+	"github.com/xmidt-org/webpa-common/device"
+	"github.com/xmidt-org/webpa-common/logging"
+)
+
+// newPreviewTestManager produces a manager with 10 devices, alternating between partners and with increasing trust
+func newPreviewTestManager() *testManager {
+	m := new(testManager)
+	for i := 0; i < 10; i++ {
+		partner := "comcast"
+		if i%2 == 1 {
+			partner = "cox"
+		}
+
+		metadata := new(device.Metadata)
+		metadata.SetClaims(map[string]interface{}{
+			"partner-id": partner,
+			"trust":      float64(i * 100),
+		})
+
+		d := new(device.MockDevice)
+		d.On("ID").Return(device.ID(fmt.Sprintf("mac:11223344556%d", i)))
+		d.On("Metadata").Return(metadata)
+		m.devices = append(m.devices, d)
+	}
+
+	return m
+}
+
+func TestPreviewFilter(t *testing.T) {
+	t.Run("Values", func(t *testing.T) {
+		var (
+			assert  = assert.New(t)
+			require = require.New(t)
+		)
+
+		preview, matched, err := PreviewFilter(newPreviewTestManager(), FilterRequest{Key: "partner-id", Values: []interface{}{"cox"}}, 2)
+		require.NoError(err)
+		assert.Equal(10, preview.Visited)
+		assert.Equal(5, preview.Matched)
+		assert.Len(matched, 5)
+		require.Len(preview.Keys, 1)
+		require.Contains(preview.Keys, "partner-id")
+		assert.Equal(5, preview.Keys["partner-id"].Count)
+		assert.Equal([]device.ID{"mac:112233445561", "mac:112233445563"}, preview.Keys["partner-id"].Sample)
+	})
+
+	t.Run("Expression", func(t *testing.T) {
+		var (
+			assert  = assert.New(t)
+			require = require.New(t)
+
+			e = Expression{
+				Op: OpOr,
+				Filters: []Expression{
+					{Op: OpGlob, Key: DeviceIDKey, Values: []interface{}{"*0"}},
+					{Op: OpGE, Key: "trust", Values: []interface{}{800.0}},
+					{Op: OpNot, Filters: []Expression{{Op: OpPrefix, Key: DeviceIDKey, Values: []interface{}{"mac:"}}}},
+				},
+			}
+		)
+
+		preview, matched, err := PreviewFilter(newPreviewTestManager(), FilterRequest{Key: "rule", Expression: &e}, 0)
+		require.NoError(err)
+		assert.Equal(10, preview.Visited)
+		assert.Equal(3, preview.Matched)
+		assert.Equal([]device.ID{"mac:112233445560", "mac:112233445568", "mac:112233445569"}, matched)
+		assert.Equal(
+			map[string]*KeyPreview{
+				DeviceIDKey: {Count: 1, Sample: []device.ID{}},
+				"trust":     {Count: 2, Sample: []device.ID{}},
+			},
+			preview.Keys,
+		)
+	})
+
+	t.Run("Invalid", func(t *testing.T) {
+		assert := assert.New(t)
+		_, _, err := PreviewFilter(newPreviewTestManager(), FilterRequest{Key: "rule", Expression: &Expression{Op: "like"}}, 1)
+		assert.Error(err)
+	})
+}
+
+func TestFilterHandlerPreviewFilter(t *testing.T) {
+	var (
+		logger = logging.NewTestLogger(nil, t)
+		ctx    = logging.WithLogger(context.Background(), logger)
+	)
+
+	t.Run("DryRun", func(t *testing.T) {
+		var (
+			assert = assert.New(t)
+
+			manager = newPreviewTestManager()
+			gate    = &FilterGate{FilterStore: make(FilterStore)}
+			f       = FilterHandler{Gate: gate, Manager: manager}
+
+			response = httptest.NewRecorder()
+			request  = httptest.NewRequest("POST", "/", bytes.NewBufferString(`{"key": "trust", "expression": {"op": "lt", "key": "trust", "values": [200]}}`)).WithContext(ctx)
+		)
+
+		f.PreviewFilter(response, request)
+		assert.Equal(http.StatusOK, response.Code)
+		assert.Equal("application/json", response.Header().Get("Content-Type"))
+		assert.JSONEq(
+			`{"visited": 10, "matched": 2, "disconnected": 0, "keys": {"trust": {"count": 2, "sample": ["mac:112233445560", "mac:112233445561"]}}}`,
+			response.Body.String(),
+		)
+
+		assert.Empty(manager.disconnected)
+		_, found := gate.GetExpression("trust")
+		assert.False(found)
+	})
+
+	t.Run("Enforce", func(t *testing.T) {
+		var (
+			assert = assert.New(t)
+
+			manager = newPreviewTestManager()
+			store   = new(mockStore)
+			gate    = &FilterGate{FilterStore: make(FilterStore)}
+			f       = FilterHandler{Gate: gate, Store: store, Manager: manager, PreviewSampleSize: 1}
+
+			response = httptest.NewRecorder()
+			request  = httptest.NewRequest("POST", "/?enforce=true", bytes.NewBufferString(`{"key": "partner-id", "values": ["comcast"]}`)).WithContext(ctx)
+		)
+
+		store.On("Save", mock.Anything, FilterRequest{Key: "partner-id", Values: []interface{}{"comcast"}}).Return(error(nil)).Once()
+		f.PreviewFilter(response, request)
+		store.AssertExpectations(t)
+		assert.Equal(http.StatusOK, response.Code)
+		assert.JSONEq(
+			`{"visited": 10, "matched": 5, "disconnected": 5, "keys": {"partner-id": {"count": 5, "sample": ["mac:112233445560"]}}}`,
+			response.Body.String(),
+		)
+
+		assert.Equal(
+			[]device.ID{"mac:112233445560", "mac:112233445562", "mac:112233445564", "mac:112233445566", "mac:112233445568"},
+			manager.disconnected,
+		)
+
+		for _, reason := range manager.reasons {
+			assert.Equal(FilteredOut, reason.Text)
+		}
+
+		// the enforced filter refuses the disconnected devices when they reconnect
+		for _, d := range manager.devices {
+			allow, _ := gate.AllowConnection(d)
+			assert.Equal(d.Metadata().Claims()["partner-id"] != "comcast", allow)
+		}
+	})
+
+	t.Run("EnforceStoreError", func(t *testing.T) {
+		var (
+			assert = assert.New(t)
+
+			manager = newPreviewTestManager()
+			store   = new(mockStore)
+			gate    = &FilterGate{FilterStore: make(FilterStore)}
+			f       = FilterHandler{Gate: gate, Store: store, Manager: manager}
+
+			response = httptest.NewRecorder()
+			request  = httptest.NewRequest("POST", "/?enforce=true", bytes.NewBufferString(`{"key": "partner-id", "values": ["comcast"]}`)).WithContext(ctx)
+		)
+
+		store.On("Save", mock.Anything, mock.Anything).Return(errors.New("expected")).Once()
+		f.PreviewFilter(response, request)
+		assert.Equal(http.StatusInternalServerError, response.Code)
+		assert.Empty(manager.disconnected, "devices should not be disconnected unless the filter was applied")
+		assert.Empty(gate.FilterStore)
+		store.AssertExpectations(t)
+	})
+
+	t.Run("BadRequest", func(t *testing.T) {
+		testData := []struct {
+			description string
+			uri         string
+			body        string
+		}{
+			{"Invalid Enforce", "/?enforce=sometimes", `{"key": "partner-id", "values": ["comcast"]}`},
+			{"Invalid Body", "/", `this is not a filter request`},
+			{"Missing Values", "/", `{"key": "partner-id"}`},
+			{"Key Not Allowed", "/", `{"key": "trust", "values": [100]}`},
+			{"Invalid Expression", "/", `{"key": "rule", "expression": {"op": "regex", "key": "partner-id", "values": ["("]}}`},
+		}
+
+		for _, record := range testData {
+			t.Run(record.description, func(t *testing.T) {
+				var (
+					assert = assert.New(t)
+
+					manager = newPreviewTestManager()
+					f       = FilterHandler{
+						Gate: &FilterGate{
+							FilterStore:    make(FilterStore),
+							AllowedFilters: &FilterSet{Set: map[interface{}]bool{"partner-id": true}},
+						},
+						Manager: manager,
+					}
+
+					response = httptest.NewRecorder()
+				)
+
+				f.PreviewFilter(response, httptest.NewRequest("POST", record.uri, bytes.NewBufferString(record.body)).WithContext(ctx))
+				assert.Equal(http.StatusBadRequest, response.Code)
+				assert.Empty(manager.disconnected)
+			})
+		}
+	})
+
+	t.Run("NoManager", func(t *testing.T) {
+		var (
+			assert   = assert.New(t)
+			f        = FilterHandler{Gate: &FilterGate{FilterStore: make(FilterStore)}}
+			response = httptest.NewRecorder()
+		)
+
+		f.PreviewFilter(response, httptest.NewRequest("POST", "/", bytes.NewBufferString(`{"key": "partner-id", "values": ["comcast"]}`)).WithContext(ctx))
+		assert.Equal(http.StatusInternalServerError, response.Code)
+	})
+}
@@ -0,0 +1,129 @@
+package devicegate
+
+import (
+	"context"
+	"reflect"
+	"sync"
+	"time"
+
+	"github.com/go-kit/kit/log"
+	"github.com/go-kit/kit/log/level"
+	"github.com/xmidt-org/webpa-common/logging"
+)
+
+// FilterListener receives the complete list of filters held by a Store whenever that list changes
+type FilterListener func([]FilterRequest)
+
+// Store is a persistent, and possibly shared, backend for gate filters.  Each filter is keyed by its
+// FilterRequest.Key.
+type Store interface {
+	// Load returns all the filters in this store
+	Load(context.Context) ([]FilterRequest, error)
+
+	// Save adds a filter to this store, replacing any filter with the same key
+	Save(context.Context, FilterRequest) error
+
+	// Remove deletes the filter with the given key.  Removing a key that does not exist is not an error.
+	Remove(ctx context.Context, key string) error
+
+	// Watch registers a listener that is invoked with the filters in this store each time they change,
+	// including changes made by other processes.  The returned function stops the listener.
+	Watch(FilterListener) (func(), error)
+}
+
+// Sync loads the filters in a Store into a gate, then keeps the gate up to date with changes to the Store
+// until the returned function is called.  Filters set directly on the gate, rather than through the Store,
+// are left alone.  Stored filters that have already expired are not applied, and are removed from the Store.
+func Sync(gate Interface, store Store, logger log.Logger) (func(), error) {
+	if logger == nil {
+		logger = logging.DefaultLogger()
+	}
+
+	s := &syncer{
+		gate:    gate,
+		store:   store,
+		logger:  logger,
+		current: make(map[string]FilterRequest),
+	}
+
+	filters, err := store.Load(context.Background())
+	if err != nil {
+		return nil, err
+	}
+
+	s.apply(filters)
+	return store.Watch(s.apply)
+}
+
+// syncer applies snapshots of a Store to a gate
+type syncer struct {
+	gate   Interface
+	store  Store
+	logger log.Logger
+
+	lock    sync.Mutex
+	current map[string]FilterRequest
+}
+
+func (s *syncer) apply(filters []FilterRequest) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	var (
+		now     = time.Now()
+		next    = make(map[string]FilterRequest, len(filters))
+		expired []string
+	)
+
+	for _, f := range filters {
+		expires, err := f.Expiry(now)
+		if err != nil {
+			s.logger.Log(level.Key(), level.ErrorValue(), logging.MessageKey(), "invalid stored filter expiry", "filterKey", f.Key, logging.ErrorKey(), err)
+			continue
+		}
+
+		if !expires.IsZero() && !now.Before(expires) {
+			// leaving the filter out of next also deletes it from the gate, if it was applied earlier
+			expired = append(expired, f.Key)
+			continue
+		}
+
+		next[f.Key] = f
+		if previous, ok := s.current[f.Key]; ok && reflect.DeepEqual(previous, f) {
+			continue
+		}
+
+		if _, err := applyFilter(s.gate, f, expires); err != nil {
+			s.logger.Log(level.Key(), level.ErrorValue(), logging.MessageKey(), "unable to apply stored filter", "filterKey", f.Key, logging.ErrorKey(), err)
+			delete(next, f.Key)
+			continue
+		}
+
+		s.logger.Log(level.Key(), level.InfoValue(), logging.MessageKey(), "applied stored filter", "filterKey", f.Key)
+	}
+
+	for key := range s.current {
+		if _, ok := next[key]; !ok {
+			s.gate.DeleteFilter(key)
+			s.logger.Log(level.Key(), level.InfoValue(), logging.MessageKey(), "removed stored filter", "filterKey", key)
+		}
+	}
+
+	s.current = next
+	if len(expired) > 0 {
+		// a Store may notify its listeners from within Remove, so this must not hold the lock
+		go s.removeExpired(expired)
+	}
+}
+
+// removeExpired deletes expired filters from the Store.  Every instance sharing the Store may do this, since
+// removing a key that does not exist is not an error.
+func (s *syncer) removeExpired(keys []string) {
+	for _, key := range keys {
+		if err := s.store.Remove(context.Background(), key); err != nil {
+			s.logger.Log(level.Key(), level.ErrorValue(), logging.MessageKey(), "unable to remove expired stored filter", "filterKey", key, logging.ErrorKey(), err)
+		} else {
+			s.logger.Log(level.Key(), level.InfoValue(), logging.MessageKey(), "removed expired stored filter", "filterKey", key)
+		}
+	}
+}
@@ -0,0 +1,247 @@
+package devicegate
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+	"github.com/xmidt-org/webpa-common/logging"
+)
+
+func TestSync(t *testing.T) {
+	var (
+		assert  = assert.New(t)
+		require = require.New(t)
+
+		store    = new(mockStore)
+		gate     = &FilterGate{FilterStore: make(FilterStore)}
+		stopped  bool
+		listener FilterListener
+
+		trust = Expression{Op: OpLT, Key: "trust", Values: []interface{}{1000.0}}
+	)
+
+	// filters set directly on the gate are not touched
+	gate.SetFilter("local", []interface{}{"value"})
+
+	store.On("Load", mock.Anything).Return(
+		[]FilterRequest{
+			{Key: "partner-id", Values: []interface{}{"comcast"}},
+			{Key: "untrusted", Expression: &trust},
+			{Key: "invalid", Expression: &Expression{Op: "like"}},
+		},
+		error(nil),
+	).Once()
+
+	store.On("Watch", mock.Anything).Return(func() { stopped = true }, error(nil)).Once().Run(func(args mock.Arguments) {
+		listener = args.Get(0).(FilterListener)
+	})
+
+	stop, err := Sync(gate, store, logging.NewTestLogger(nil, t))
+	require.NoError(err)
+	require.NotNil(stop)
+	require.NotNil(listener)
+
+	partners, ok := gate.GetFilter("partner-id")
+	require.True(ok)
+	assert.True(partners.Has("comcast"))
+
+	actual, ok := gate.GetExpression("untrusted")
+	assert.True(ok)
+	assert.Equal(trust, actual)
+
+	_, ok = gate.GetExpression("invalid")
+	assert.False(ok)
+
+	listener([]FilterRequest{
+		{Key: "partner-id", Values: []interface{}{"cox"}},
+	})
+
+	partners, ok = gate.GetFilter("partner-id")
+	require.True(ok)
+	assert.True(partners.Has("cox"))
+	assert.False(partners.Has("comcast"))
+
+	_, ok = gate.GetExpression("untrusted")
+	assert.False(ok)
+
+	_, ok = gate.GetFilter("local")
+	assert.True(ok)
+
+	stop()
+	assert.True(stopped)
+	store.AssertExpectations(t)
+}
+
+func TestSyncExpired(t *testing.T) {
+	var (
+		assert  = assert.New(t)
+		require = require.New(t)
+
+		store    = new(mockStore)
+		gate     = &FilterGate{FilterStore: make(FilterStore)}
+		listener FilterListener
+		removed  = make(chan string, 1)
+
+		past   = time.Now().Add(-time.Minute)
+		future = time.Now().Add(time.Hour)
+	)
+
+	store.On("Load", mock.Anything).Return(
+		[]FilterRequest{
+			{Key: "partner-id", Values: []interface{}{"comcast"}, Expires: &future},
+		},
+		error(nil),
+	).Once()
+
+	store.On("Watch", mock.Anything).Return(func() {}, error(nil)).Once().Run(func(args mock.Arguments) {
+		listener = args.Get(0).(FilterListener)
+	})
+
+	store.On("Remove", mock.Anything, "partner-id").Return(error(nil)).Once().Run(func(args mock.Arguments) {
+		removed <- args.String(1)
+	})
+
+	stop, err := Sync(gate, store, logging.NewTestLogger(nil, t))
+	require.NoError(err)
+	defer stop()
+
+	_, ok := gate.GetFilter("partner-id")
+	require.True(ok)
+
+	gate.lock.RLock()
+	assert.Equal(future, gate.expirations["partner-id"])
+	gate.lock.RUnlock()
+
+	// an expired stored filter is deleted from the gate and removed from the store
+	listener([]FilterRequest{
+		{Key: "partner-id", Values: []interface{}{"comcast"}, Expires: &past},
+	})
+
+	_, ok = gate.GetFilter("partner-id")
+	assert.False(ok)
+
+	select {
+	case key := <-removed:
+		assert.Equal("partner-id", key)
+	case <-time.After(5 * time.Second):
+		assert.Fail("The expired filter was not removed from the store")
+	}
+
+	store.AssertExpectations(t)
+}
+
+func TestSyncLoadError(t *testing.T) {
+	var (
+		assert   = assert.New(t)
+		store    = new(mockStore)
+		expected = errors.New("expected")
+	)
+
+	store.On("Load", mock.Anything).Return(nil, expected).Once()
+	stop, err := Sync(&FilterGate{FilterStore: make(FilterStore)}, store, nil)
+	assert.Nil(stop)
+	assert.Equal(expected, err)
+	store.AssertExpectations(t)
+}
+
+func TestFilterHandlerStore(t *testing.T) {
+	var (
+		logger = logging.NewTestLogger(nil, t)
+		ctx    = logging.WithLogger(context.Background(), logger)
+	)
+
+	t.Run("Update", func(t *testing.T) {
+		var (
+			assert = assert.New(t)
+			store  = new(mockStore)
+			gate   = &FilterGate{FilterStore: make(FilterStore)}
+			f      = FilterHandler{Gate: gate, Store: store}
+		)
+
+		store.On("Save", mock.Anything, FilterRequest{Key: "test", Values: []interface{}{"test1"}}).Return(error(nil)).Once()
+		response := httptest.NewRecorder()
+		f.UpdateFilters(response, httptest.NewRequest("POST", "/", bytes.NewBufferString(`{"key": "test", "values": ["test1"]}`)).WithContext(ctx))
+		assert.Equal(http.StatusCreated, response.Code)
+
+		_, ok := gate.GetFilter("test")
+		assert.True(ok)
+		store.AssertExpectations(t)
+	})
+
+	t.Run("UpdateError", func(t *testing.T) {
+		var (
+			assert = assert.New(t)
+			store  = new(mockStore)
+			gate   = &FilterGate{FilterStore: make(FilterStore)}
+			f      = FilterHandler{Gate: gate, Store: store}
+		)
+
+		store.On("Save", mock.Anything, mock.Anything).Return(errors.New("expected")).Once()
+		response := httptest.NewRecorder()
+		f.UpdateFilters(response, httptest.NewRequest("POST", "/", bytes.NewBufferString(`{"key": "test", "values": ["test1"]}`)).WithContext(ctx))
+		assert.Equal(http.StatusInternalServerError, response.Code)
+
+		_, ok := gate.GetFilter("test")
+		assert.False(ok)
+		store.AssertExpectations(t)
+	})
+
+	t.Run("InvalidExpression", func(t *testing.T) {
+		var (
+			assert = assert.New(t)
+			store  = new(mockStore)
+			f      = FilterHandler{Gate: &FilterGate{FilterStore: make(FilterStore)}, Store: store}
+		)
+
+		response := httptest.NewRecorder()
+		f.UpdateFilters(response, httptest.NewRequest("POST", "/", bytes.NewBufferString(`{"key": "test", "expression": {"op": "regex", "key": "test", "values": ["("]}}`)).WithContext(ctx))
+		assert.Equal(http.StatusBadRequest, response.Code)
+		store.AssertExpectations(t)
+	})
+
+	t.Run("Delete", func(t *testing.T) {
+		var (
+			assert = assert.New(t)
+			store  = new(mockStore)
+			gate   = &FilterGate{FilterStore: make(FilterStore)}
+			f      = FilterHandler{Gate: gate, Store: store}
+		)
+
+		gate.SetFilter("test", []interface{}{"test1"})
+		store.On("Remove", mock.Anything, "test").Return(error(nil)).Once()
+		response := httptest.NewRecorder()
+		f.DeleteFilter(response, httptest.NewRequest("DELETE", "/", bytes.NewBufferString(`{"key": "test"}`)).WithContext(ctx))
+		assert.Equal(http.StatusOK, response.Code)
+
+		_, ok := gate.GetFilter("test")
+		assert.False(ok)
+		store.AssertExpectations(t)
+	})
+
+	t.Run("DeleteError", func(t *testing.T) {
+		var (
+			assert = assert.New(t)
+			store  = new(mockStore)
+			gate   = &FilterGate{FilterStore: make(FilterStore)}
+			f      = FilterHandler{Gate: gate, Store: store}
+		)
+
+		gate.SetFilter("test", []interface{}{"test1"})
+		store.On("Remove", mock.Anything, "test").Return(errors.New("expected")).Once()
+		response := httptest.NewRecorder()
+		f.DeleteFilter(response, httptest.NewRequest("DELETE", "/", bytes.NewBufferString(`{"key": "test"}`)).WithContext(ctx))
+		assert.Equal(http.StatusInternalServerError, response.Code)
+
+		_, ok := gate.GetFilter("test")
+		assert.True(ok)
+		store.AssertExpectations(t)
+	})
+}
@@ -8,7 +8,7 @@ type Cancel struct {
 }
 
 func (c *Cancel) ServeHTTP(response http.ResponseWriter, request *http.Request) {
-	done, err := c.Drainer.Cancel()
+	done, err := cancelBy(c.Drainer, Requester(request.Context()))
 	if err != nil {
 		response.WriteHeader(http.StatusConflict)
 		return
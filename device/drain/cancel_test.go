@@ -21,7 +21,7 @@ func testCancelNotActive(t *testing.T) {
 		request  = httptest.NewRequest("GET", "/", nil)
 	)
 
-	d.On("Cancel").Return((<-chan struct{})(nil), ErrNotActive).Once()
+	d.On("CancelBy", "").Return((<-chan struct{})(nil), ErrNotActive).Once()
 	cancel.ServeHTTP(response, request)
 	assert.Equal(http.StatusConflict, response.Code)
 
@@ -42,7 +42,7 @@ func testCancelSuccess(t *testing.T) {
 		request  = httptest.NewRequest("GET", "/", nil)
 	)
 
-	d.On("Cancel").WaitUntil(cancelWait).Return((<-chan struct{})(done), error(nil)).Once()
+	d.On("CancelBy", "").WaitUntil(cancelWait).Return((<-chan struct{})(done), error(nil)).Once()
 
 	go func() {
 		defer close(serveHTTP)
@@ -78,7 +78,7 @@ func testCancelTimeout(t *testing.T) {
 		request        = httptest.NewRequest("GET", "/", nil).WithContext(ctx)
 	)
 
-	d.On("Cancel").WaitUntil(cancelWait).Return((<-chan struct{})(done), error(nil)).Once()
+	d.On("CancelBy", "").WaitUntil(cancelWait).Return((<-chan struct{})(done), error(nil)).Once()
 
 	go func() {
 		defer close(serveHTTP)
@@ -13,12 +13,14 @@ import (
 	"github.com/xmidt-org/webpa-common/device"
 	"github.com/xmidt-org/webpa-common/device/devicegate"
 	"github.com/xmidt-org/webpa-common/logging"
+	"github.com/xmidt-org/webpa-common/service"
 	"github.com/xmidt-org/webpa-common/xmetrics"
 )
 
 var (
-	ErrActive    error = errors.New("A drain operation is already running")
-	ErrNotActive error = errors.New("No drain operation is running")
+	ErrActive             error = errors.New("A drain operation is already running")
+	ErrNotActive          error = errors.New("No drain operation is running")
+	ErrNoRedirectAccessor error = errors.New("A redirecting drain requires a redirect service.Accessor to be configured")
 )
 
 const (
@@ -98,6 +100,41 @@ func WithDrainCounter(a xmetrics.Adder) Option {
 	}
 }
 
+// WithFeedback configures the Feedback used by adaptive drain jobs
+func WithFeedback(f Feedback) Option {
+	return func(dr *drainer) {
+		dr.feedback = f
+	}
+}
+
+// WithHistorySize sets the number of finished drain jobs retained in the history.  If nonpositive,
+// DefaultHistorySize is used.
+func WithHistorySize(n int) Option {
+	return func(dr *drainer) {
+		if n > 0 {
+			dr.historySize = n
+		} else {
+			dr.historySize = DefaultHistorySize
+		}
+	}
+}
+
+// WithAuditLogger emits each JobRecord added to the history as a structured log record.  By default, no
+// audit records are logged.
+func WithAuditLogger(l log.Logger) Option {
+	return func(dr *drainer) {
+		dr.auditLogger = l
+	}
+}
+
+// WithRedirectAccessor configures the service.Accessor used to choose the instance that each device is redirected
+// to by drain jobs with Redirect set.  The accessor is keyed by device ID, and should not include this instance.
+func WithRedirectAccessor(a service.Accessor) Option {
+	return func(dr *drainer) {
+		dr.redirector = a
+	}
+}
+
 // DrainFilter contains the filter information for a drain job
 type DrainFilter interface {
 	device.Filter
@@ -123,6 +160,30 @@ type Job struct {
 	// a tick of 1 second is used as the default.
 	Tick time.Duration `json:"tick,omitempty" schema:"tick"`
 
+	// Adaptive indicates that the Rate should be adjusted each tick using the drainer's Feedback.  The rate is
+	// increased by MinRate while the Feedback reports healthy, and halved when it does not.  The Feedback is
+	// consulted in the background, and the rate is held on any tick for which it has not yet answered.  Rate is
+	// the initial rate for an adaptive job.
+	Adaptive bool `json:"adaptive,omitempty" schema:"adaptive"`
+
+	// MinRate is the lower bound for the rate of an adaptive job.  If unset, a minimum of 1 device per tick is used.
+	MinRate int `json:"minRate,omitempty" schema:"minRate"`
+
+	// MaxRate is the upper bound for the rate of an adaptive job.  If unset, Rate is used as the upper bound.
+	MaxRate int `json:"maxRate,omitempty" schema:"maxRate"`
+
+	// Redirect indicates that each drained device should be sent a redirect to the instance chosen for it by the
+	// drainer's redirect service.Accessor.  Only cooperating clients honor redirects.
+	Redirect bool `json:"redirect,omitempty" schema:"redirect"`
+
+	// Target is an optional URL of the instance all drained devices should be redirected to.  If set, this field
+	// takes precedence over Redirect.
+	Target string `json:"target,omitempty" schema:"target"`
+
+	// Requester identifies who requested this job, e.g. the principal of the request that started it.
+	// It is recorded in the drain history.
+	Requester string `json:"requester,omitempty" schema:"-"`
+
 	// DrainFilter holds the filter to drain devices by. If this is set for the job, only devices that match the filter will be drained
 	DrainFilter DrainFilter `json:"filter,omitempty" schema:"filter"`
 }
@@ -146,6 +207,22 @@ func (j Job) ToMap() map[string]interface{} {
 		m["tick"] = j.Tick.String()
 	}
 
+	if j.Adaptive {
+		m["adaptive"] = true
+		m["minRate"] = j.MinRate
+		m["maxRate"] = j.MaxRate
+	}
+
+	if len(j.Target) > 0 {
+		m["target"] = j.Target
+	} else if j.Redirect {
+		m["redirect"] = true
+	}
+
+	if len(j.Requester) > 0 {
+		m["requester"] = j.Requester
+	}
+
 	if j.DrainFilter != nil {
 		m["filter"] = j.DrainFilter.GetFilterRequest()
 	}
@@ -161,6 +238,29 @@ func (j *Job) normalize(deviceCount int) {
 		j.Count = deviceCount
 	}
 
+	if j.Adaptive {
+		if j.MinRate <= 0 {
+			j.MinRate = 1
+		}
+
+		if j.MaxRate <= 0 {
+			j.MaxRate = j.Rate
+		}
+
+		if j.MaxRate < j.MinRate {
+			j.MaxRate = j.MinRate
+		}
+
+		if j.Rate < j.MinRate {
+			j.Rate = j.MinRate
+		} else if j.Rate > j.MaxRate {
+			j.Rate = j.MaxRate
+		}
+	} else {
+		j.MinRate = 0
+		j.MaxRate = 0
+	}
+
 	if j.Rate > 0 {
 		if j.Tick <= 0 {
 			j.Tick = time.Second
@@ -191,6 +291,26 @@ type Interface interface {
 	Cancel() (<-chan struct{}, error)
 }
 
+// Auditor is implemented by a drain Interface which records who cancels drain jobs and keeps a history of
+// finished jobs.  The Interface returned by New implements Auditor.
+type Auditor interface {
+	// CancelBy is like Cancel, but records the given requester as having cancelled the job
+	CancelBy(requester string) (<-chan struct{}, error)
+
+	// History returns the records of finished drain jobs, as well as jobs that failed to start, oldest first.
+	// Only the most recent jobs are retained.
+	History() []JobRecord
+}
+
+// cancelBy cancels any running job, recording the requester if the drainer is an Auditor
+func cancelBy(d Interface, requester string) (<-chan struct{}, error) {
+	if a, ok := d.(Auditor); ok {
+		return a.CancelBy(requester)
+	}
+
+	return d.Cancel()
+}
+
 func defaultNewTicker(d time.Duration) (<-chan time.Time, func()) {
 	ticker := time.NewTicker(d)
 	return ticker.C, ticker.Stop
@@ -199,9 +319,10 @@ func defaultNewTicker(d time.Duration) (<-chan time.Time, func()) {
 // New constructs a drainer using the supplied options
 func New(options ...Option) Interface {
 	dr := &drainer{
-		logger:    logging.DefaultLogger(),
-		now:       time.Now,
-		newTicker: defaultNewTicker,
+		logger:      logging.DefaultLogger(),
+		now:         time.Now,
+		newTicker:   defaultNewTicker,
+		historySize: DefaultHistorySize,
 		m: metrics{
 			state:   discard.NewGauge(),
 			counter: discard.NewCounter(),
@@ -244,12 +365,19 @@ type jobContext struct {
 
 // drainer is the internal implementation of Interface
 type drainer struct {
-	logger    log.Logger
-	connector device.Connector
-	registry  device.Registry
-	now       func() time.Time
-	newTicker func(time.Duration) (<-chan time.Time, func())
-	m         metrics
+	logger     log.Logger
+	connector  device.Connector
+	registry   device.Registry
+	now        func() time.Time
+	newTicker  func(time.Duration) (<-chan time.Time, func())
+	feedback   Feedback
+	redirector service.Accessor
+	m          metrics
+
+	auditLogger log.Logger
+	historySize int
+	historyLock sync.Mutex
+	history     []JobRecord
 
 	controlLock sync.RWMutex
 	active      uint32
@@ -274,6 +402,23 @@ func (df *drainFilter) AllowConnection(d device.Interface) (bool, device.MatchRe
 	return df.filter.AllowConnection(d)
 }
 
+// closeReason produces the reason a device is disconnected by a job, including any redirect
+func (dr *drainer) closeReason(jc jobContext, id device.ID) device.CloseReason {
+	reason := device.CloseReason{Text: Drained}
+	if len(jc.j.Target) > 0 {
+		reason.Redirect = jc.j.Target
+	} else if jc.j.Redirect {
+		instance, err := dr.redirector.Get([]byte(id))
+		if err != nil {
+			jc.logger.Log(level.Key(), level.DebugValue(), logging.MessageKey(), "unable to choose redirect", "deviceID", id, logging.ErrorKey(), err)
+		} else {
+			reason.Redirect = instance
+		}
+	}
+
+	return reason
+}
+
 // nextBatch grabs a batch of devices, bounded by the size of the supplied batch channel, and attempts
 // to disconnect each of them.  This method is sensitive to the jc.cancel channel.  If canceled, or if
 // no more devices are available, this method returns false.
@@ -314,7 +459,7 @@ func (dr *drainer) nextBatch(jc jobContext, batch chan device.ID) (more bool, vi
 		for finished := false; more && !finished; {
 			select {
 			case id := <-batch:
-				if dr.connector.Disconnect(id, device.CloseReason{Text: Drained}) {
+				if dr.connector.Disconnect(id, dr.closeReason(jc, id)) {
 					drained++
 				}
 			case <-jc.cancel:
@@ -353,13 +498,52 @@ func (dr *drainer) jobFinished(jc jobContext) {
 
 	dr.controlLock.Unlock()
 
+	p := jc.t.Progress()
+	record := JobRecord{
+		ID:       jc.id,
+		State:    JobCompleted,
+		Job:      jc.j,
+		Progress: p,
+	}
+
+	select {
+	case <-jc.cancel:
+		record.State = JobCancelled
+		record.CancelledBy = jc.t.cancelledBy()
+	default:
+	}
+
+	dr.record(record)
+
 	// only close the done channel when all cleanup is complete
 	close(jc.done)
 
-	p := jc.t.Progress()
 	jc.logger.Log(level.Key(), level.InfoValue(), logging.MessageKey(), "drain complete", "visited", p.Visited, "drained", p.Drained)
 }
 
+// adapt computes the next rate of an adaptive job from the latest result of the drainer's Feedback
+func (dr *drainer) adapt(jc jobContext, rate int, result feedbackResult) int {
+	healthy, err := result.healthy, result.err
+	if err != nil {
+		jc.logger.Log(level.Key(), level.WarnValue(), logging.MessageKey(), "drain feedback failed", logging.ErrorKey(), err)
+	}
+
+	if healthy && err == nil {
+		rate += jc.j.MinRate
+		if rate > jc.j.MaxRate {
+			rate = jc.j.MaxRate
+		}
+	} else {
+		rate /= 2
+		if rate < jc.j.MinRate {
+			rate = jc.j.MinRate
+		}
+	}
+
+	jc.logger.Log(level.Key(), level.DebugValue(), logging.MessageKey(), "drain rate adapted", "healthy", healthy, "rate", rate)
+	return rate
+}
+
 // drain is run as a goroutine to drain devices at a particular rate
 func (dr *drainer) drain(jc jobContext) {
 	defer dr.jobFinished(jc)
@@ -370,12 +554,28 @@ func (dr *drainer) drain(jc jobContext) {
 		visited   = 0
 		skipped   = 0
 		more      = true
-		batch     = make(chan device.ID, jc.j.Rate)
+		rate      = jc.j.Rate
+		batch     = make(chan device.ID, rate)
+		probe     *feedbackProbe
 	)
 
+	if jc.j.Adaptive {
+		stop := make(chan struct{})
+		defer close(stop)
+
+		probe = newFeedbackProbe(dr.feedback)
+		go probe.run(stop)
+		probe.request()
+	}
+
 	for more && remaining > 0 {
-		if remaining < jc.j.Rate {
-			batch = make(chan device.ID, remaining)
+		size := rate
+		if remaining < size {
+			size = remaining
+		}
+
+		if cap(batch) != size {
+			batch = make(chan device.ID, size)
 		}
 
 		select {
@@ -388,6 +588,16 @@ func (dr *drainer) drain(jc jobContext) {
 			if skipped == dr.registry.Len() {
 				more = false
 			}
+
+			if more && probe != nil {
+				// the rate is held until the Feedback has answered
+				if result := probe.latest(); result != nil {
+					rate = dr.adapt(jc, rate, *result)
+					jc.t.setRate(rate)
+				}
+
+				probe.request()
+			}
 		case <-jc.cancel:
 			jc.logger.Log(level.Key(), level.ErrorValue(), logging.MessageKey(), "job canceled")
 			more = false
@@ -418,12 +628,23 @@ func (dr *drainer) disconnect(jc jobContext) {
 }
 
 func (dr *drainer) Start(j Job) (<-chan struct{}, Job, error) {
+	if j.Adaptive && dr.feedback == nil {
+		dr.recordFailure(j, ErrNoFeedback)
+		return nil, Job{}, ErrNoFeedback
+	}
+
+	if j.Redirect && len(j.Target) == 0 && dr.redirector == nil {
+		dr.recordFailure(j, ErrNoRedirectAccessor)
+		return nil, Job{}, ErrNoRedirectAccessor
+	}
+
 	j.normalize(dr.registry.Len())
 
 	defer dr.controlLock.Unlock()
 	dr.controlLock.Lock()
 
 	if !atomic.CompareAndSwapUint32(&dr.active, StateNotActive, StateActive) {
+		dr.recordFailure(j, ErrActive)
 		return nil, Job{}, ErrActive
 	}
 
@@ -440,6 +661,10 @@ func (dr *drainer) Start(j Job) (<-chan struct{}, Job, error) {
 		done:   make(chan struct{}),
 	}
 
+	if j.Adaptive {
+		jc.t.setRate(j.Rate)
+	}
+
 	if jc.j.Rate > 0 {
 		jc.ticker, jc.stop = dr.newTicker(j.Tick)
 		go dr.drain(jc)
@@ -468,6 +693,10 @@ func (dr *drainer) Status() (bool, Job, Progress) {
 }
 
 func (dr *drainer) Cancel() (<-chan struct{}, error) {
+	return dr.CancelBy("")
+}
+
+func (dr *drainer) CancelBy(requester string) (<-chan struct{}, error) {
 	defer dr.controlLock.Unlock()
 	dr.controlLock.Lock()
 
@@ -477,6 +706,7 @@ func (dr *drainer) Cancel() (<-chan struct{}, error) {
 
 	dr.m.state.Set(MetricNotDraining)
 	jc := dr.current.Load().(jobContext)
+	jc.t.cancel(requester)
 	close(jc.cancel)
 	return jc.done, nil
 }
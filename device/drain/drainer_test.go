@@ -1,8 +1,10 @@
 package drain
 
 import (
+	"errors"
 	"fmt"
 	"strconv"
+	"sync"
 	"testing"
 	"time"
 
@@ -12,6 +14,7 @@ import (
 	"github.com/stretchr/testify/require"
 	"github.com/xmidt-org/webpa-common/device/devicegate"
 	"github.com/xmidt-org/webpa-common/logging"
+	"github.com/xmidt-org/webpa-common/service"
 	"github.com/xmidt-org/webpa-common/xmetrics/xmetricstest"
 )
 
@@ -49,6 +52,11 @@ func testJobNormalize(t *testing.T) {
 		{123752, Job{Percent: 17}, Job{Count: 21037, Percent: 17}},
 		{73, Job{Percent: 100}, Job{Count: 73, Percent: 100}},
 		{90, Job{DrainFilter: testDrainFilter}, Job{Count: 90, DrainFilter: testDrainFilter}},
+		{100, Job{MinRate: 5, MaxRate: 10}, Job{Count: 100}},
+		{100, Job{Adaptive: true}, Job{Count: 100, Adaptive: true, Rate: 1, Tick: time.Second, MinRate: 1, MaxRate: 1}},
+		{100, Job{Adaptive: true, MinRate: 5, MaxRate: 50}, Job{Count: 100, Adaptive: true, Rate: 5, Tick: time.Second, MinRate: 5, MaxRate: 50}},
+		{100, Job{Adaptive: true, Rate: 20, MaxRate: 10, Tick: time.Minute}, Job{Count: 100, Adaptive: true, Rate: 10, Tick: time.Minute, MinRate: 1, MaxRate: 10}},
+		{100, Job{Adaptive: true, Rate: 20}, Job{Count: 100, Adaptive: true, Rate: 20, Tick: time.Second, MinRate: 1, MaxRate: 20}},
 	}
 
 	for i, record := range testData {
@@ -627,6 +635,220 @@ func TestDrainer(t *testing.T) {
 	t.Run("VisitCancel", testDrainerVisitCancel)
 	t.Run("DisconnectCancel", testDrainerDisconnectCancel)
 	t.Run("DrainCancel", testDrainerDrainCancel)
+	t.Run("Adaptive", testDrainerAdaptive)
+	t.Run("AdaptiveSlowFeedback", testDrainerAdaptiveSlowFeedback)
+	t.Run("AdaptiveNoFeedback", testDrainerAdaptiveNoFeedback)
+	t.Run("Redirect", testDrainerRedirect)
+	t.Run("RedirectNoAccessor", testDrainerRedirectNoAccessor)
+}
+
+func testDrainerRedirect(t *testing.T) {
+	var (
+		assert = assert.New(t)
+		logger = logging.NewTestLogger(nil, t)
+
+		failing  = device.IntToMAC(1)
+		accessor = service.AccessorFunc(func(key []byte) (string, error) {
+			if string(key) == string(failing) {
+				return "", errors.New("expected")
+			}
+
+			return "https://peer.example.com/" + string(key), nil
+		})
+
+		dr = New(WithLogger(logger), WithManager(generateManager(assert, 0)), WithRedirectAccessor(accessor)).(*drainer)
+		jc = jobContext{logger: logger}
+	)
+
+	id := device.IntToMAC(2)
+	assert.Equal(device.CloseReason{Text: Drained}, dr.closeReason(jc, id))
+
+	jc.j.Redirect = true
+	assert.Equal(device.CloseReason{Text: Drained, Redirect: "https://peer.example.com/" + string(id)}, dr.closeReason(jc, id))
+	assert.Equal(device.CloseReason{Text: Drained}, dr.closeReason(jc, failing))
+
+	jc.j.Target = "https://target.example.com"
+	assert.Equal(device.CloseReason{Text: Drained, Redirect: "https://target.example.com"}, dr.closeReason(jc, id))
+	assert.Equal(
+		map[string]interface{}{"count": 0, "target": "https://target.example.com"},
+		jc.j.ToMap(),
+	)
+}
+
+func testDrainerRedirectNoAccessor(t *testing.T) {
+	var (
+		assert  = assert.New(t)
+		manager = generateManager(assert, 0)
+		d       = New(WithLogger(logging.NewTestLogger(nil, t)), WithManager(manager))
+	)
+
+	done, job, err := d.Start(Job{Redirect: true})
+	assert.Nil(done)
+	assert.Equal(Job{}, job)
+	assert.Equal(ErrNoRedirectAccessor, err)
+
+	// an explicit target does not require an accessor
+	done, job, err = d.Start(Job{Redirect: true, Target: "https://target.example.com"})
+	assert.NoError(err)
+	assert.Equal("https://target.example.com", job.Target)
+	close(manager.pauseVisit)
+	close(manager.pauseDisconnect)
+	<-done
+}
+
+func testDrainerAdaptive(t *testing.T) {
+	testData := []struct {
+		description string
+		healthy     bool
+		rate        int
+	}{
+		{"Healthy", true, 10},
+		{"Unhealthy", false, 30},
+	}
+
+	for _, record := range testData {
+		record := record
+		t.Run(record.description, func(t *testing.T) {
+			var (
+				assert  = assert.New(t)
+				require = require.New(t)
+
+				manager = generateManager(assert, 200)
+				ticker  = make(chan time.Time)
+
+				ratesLock sync.Mutex
+				rates     []int
+				d         Interface
+			)
+
+			d = New(
+				WithLogger(logging.NewTestLogger(nil, t)),
+				WithManager(manager),
+				WithFeedback(FeedbackFunc(func() (bool, error) {
+					_, _, progress := d.Status()
+					ratesLock.Lock()
+					rates = append(rates, progress.Rate)
+					ratesLock.Unlock()
+
+					if record.healthy {
+						return true, nil
+					}
+
+					return false, errors.New("expected")
+				})),
+			)
+
+			d.(*drainer).newTicker = func(time.Duration) (<-chan time.Time, func()) {
+				return ticker, func() {}
+			}
+
+			done, job, err := d.Start(Job{Adaptive: true, Rate: record.rate, MinRate: 10, MaxRate: 30})
+			require.NoError(err)
+			assert.Equal(Job{Count: 200, Adaptive: true, Rate: record.rate, Tick: time.Second, MinRate: 10, MaxRate: 30}, job)
+
+			close(manager.pauseDisconnect)
+			close(manager.pauseVisit)
+			go func() {
+				for {
+					select {
+					case ticker <- time.Time{}:
+						// give the probe a chance to answer before the next tick
+						time.Sleep(time.Millisecond)
+					case <-done:
+						return
+					}
+				}
+			}()
+
+			select {
+			case <-done:
+			case <-time.After(5 * time.Second):
+				assert.Fail("Drain failed to complete")
+				return
+			}
+
+			_, _, progress := d.Status()
+			assert.Equal(200, progress.Visited)
+			assert.Empty(manager.devices)
+
+			ratesLock.Lock()
+			defer ratesLock.Unlock()
+			require.NotEmpty(rates)
+			assert.Equal(record.rate, rates[0])
+			for i := 1; i < len(rates); i++ {
+				if record.healthy {
+					assert.True(rates[i-1] <= rates[i] && rates[i] <= 30, "rates should increase up to MaxRate: %v", rates)
+				} else {
+					assert.True(rates[i-1] >= rates[i] && rates[i] >= 10, "rates should decrease down to MinRate: %v", rates)
+				}
+			}
+		})
+	}
+}
+
+func testDrainerAdaptiveSlowFeedback(t *testing.T) {
+	var (
+		assert  = assert.New(t)
+		require = require.New(t)
+
+		manager = generateManager(assert, 100)
+		ticker  = make(chan time.Time)
+		release = make(chan struct{})
+		d       = New(
+			WithLogger(logging.NewTestLogger(nil, t)),
+			WithManager(manager),
+			WithFeedback(FeedbackFunc(func() (bool, error) {
+				<-release
+				return true, nil
+			})),
+		)
+	)
+
+	defer close(release)
+	d.(*drainer).newTicker = func(time.Duration) (<-chan time.Time, func()) {
+		return ticker, func() {}
+	}
+
+	done, _, err := d.Start(Job{Adaptive: true, Rate: 10, MinRate: 10, MaxRate: 30})
+	require.NoError(err)
+	close(manager.pauseDisconnect)
+	close(manager.pauseVisit)
+
+	// every tick is taken even though the Feedback never answers, and the rate is held
+	for i := 0; i < 10; i++ {
+		select {
+		case ticker <- time.Time{}:
+		case <-time.After(5 * time.Second):
+			assert.Fail("The drain did not take a tick while the Feedback was blocked")
+			return
+		}
+	}
+
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		assert.Fail("Drain failed to complete")
+		return
+	}
+
+	_, _, progress := d.Status()
+	assert.Equal(100, progress.Visited)
+	assert.Equal(10, progress.Rate)
+}
+
+func testDrainerAdaptiveNoFeedback(t *testing.T) {
+	var (
+		assert = assert.New(t)
+		d      = New(WithLogger(logging.NewTestLogger(nil, t)), WithManager(generateManager(assert, 10)))
+	)
+
+	done, job, err := d.Start(Job{Adaptive: true})
+	assert.Nil(done)
+	assert.Equal(Job{}, job)
+	assert.Equal(ErrNoFeedback, err)
+
+	active, _, _ := d.Status()
+	assert.False(active)
 }
 
 func testDrainFilter(t *testing.T, deviceTypeOne deviceInfo, deviceTypeTwo deviceInfo, df DrainFilter, expectedSkipped int, count int) {
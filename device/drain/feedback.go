@@ -0,0 +1,206 @@
+package drain
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/xmidt-org/webpa-common/device"
+)
+
+// ErrNoFeedback is returned when an adaptive drain job is started on a drainer without a Feedback
+var ErrNoFeedback = errors.New("An adaptive drain requires a Feedback to be configured")
+
+// Feedback supplies the health signal used to adjust the rate of an adaptive drain job.  It is consulted
+// in the background, at most once per tick, so a slow Feedback delays rate changes rather than the job itself.
+type Feedback interface {
+	// Healthy reports whether downstream systems can absorb more reconnecting devices.  An error
+	// is treated as unhealthy.
+	Healthy() (bool, error)
+}
+
+// FeedbackFunc is a function type that implements Feedback
+type FeedbackFunc func() (bool, error)
+
+func (ff FeedbackFunc) Healthy() (bool, error) {
+	return ff()
+}
+
+// feedbackResult is the outcome of a single call to Feedback.Healthy
+type feedbackResult struct {
+	healthy bool
+	err     error
+}
+
+// feedbackProbe consults a Feedback in its own goroutine, keeping only the latest result
+type feedbackProbe struct {
+	feedback Feedback
+	requests chan struct{}
+
+	lock   sync.Mutex
+	result *feedbackResult
+}
+
+func newFeedbackProbe(f Feedback) *feedbackProbe {
+	return &feedbackProbe{
+		feedback: f,
+		requests: make(chan struct{}, 1),
+	}
+}
+
+// run calls the Feedback once for each request until the stop channel is closed
+func (fp *feedbackProbe) run(stop <-chan struct{}) {
+	for {
+		select {
+		case <-stop:
+			return
+		case <-fp.requests:
+			healthy, err := fp.feedback.Healthy()
+			fp.lock.Lock()
+			fp.result = &feedbackResult{healthy: healthy, err: err}
+			fp.lock.Unlock()
+		}
+	}
+}
+
+// request asks for the Feedback to be consulted.  Requests made while one is already pending are dropped.
+func (fp *feedbackProbe) request() {
+	select {
+	case fp.requests <- struct{}{}:
+	default:
+	}
+}
+
+// latest returns the most recent result, or nil if there has been no result since the last call
+func (fp *feedbackProbe) latest() *feedbackResult {
+	fp.lock.Lock()
+	defer fp.lock.Unlock()
+
+	result := fp.result
+	fp.result = nil
+	return result
+}
+
+// ThresholdFeedback is healthy as long as a sampled value, such as a metric gauge, does not exceed a maximum
+type ThresholdFeedback struct {
+	// Value samples the signal
+	Value func() (float64, error)
+
+	// Max is the largest healthy value
+	Max float64
+}
+
+func (tf ThresholdFeedback) Healthy() (bool, error) {
+	v, err := tf.Value()
+	if err != nil {
+		return false, err
+	}
+
+	return v <= tf.Max, nil
+}
+
+// HTTPFeedback probes the health endpoints of peers, and is healthy only if every peer responds with a 2xx status
+type HTTPFeedback struct {
+	// Client is the HTTP client used to probe peers.  If unset, http.DefaultClient is used.
+	Client *http.Client
+
+	// URLs are the health endpoints to probe
+	URLs []string
+
+	// Timeout bounds each probe.  If unset, the client's own timeout applies.
+	Timeout time.Duration
+}
+
+func (hf HTTPFeedback) probe(url string) error {
+	ctx := context.Background()
+	if hf.Timeout > 0 {
+		var cancel func()
+		ctx, cancel = context.WithTimeout(ctx, hf.Timeout)
+		defer cancel()
+	}
+
+	request, err := http.NewRequest("GET", url, nil)
+	if err != nil {
+		return err
+	}
+
+	client := hf.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+
+	response, err := client.Do(request.WithContext(ctx))
+	if err != nil {
+		return err
+	}
+
+	response.Body.Close()
+	if response.StatusCode < 200 || response.StatusCode > 299 {
+		return fmt.Errorf("Peer %s responded with status %d", url, response.StatusCode)
+	}
+
+	return nil
+}
+
+func (hf HTTPFeedback) Healthy() (bool, error) {
+	for _, url := range hf.URLs {
+		if err := hf.probe(url); err != nil {
+			return false, err
+		}
+	}
+
+	return true, nil
+}
+
+// ConnectRateFeedback is healthy as long as the local rate of device connections stays at or below a maximum.
+// Its Listen method must be registered as a device.Listener.
+type ConnectRateFeedback struct {
+	// MaxRate is the largest healthy number of connections per second
+	MaxRate float64
+
+	lock     sync.Mutex
+	connects int
+	since    time.Time
+	now      func() time.Time
+}
+
+func (crf *ConnectRateFeedback) _now() time.Time {
+	if crf.now != nil {
+		return crf.now()
+	}
+
+	return time.Now()
+}
+
+// Listen is a device.Listener which counts connections
+func (crf *ConnectRateFeedback) Listen(e *device.Event) {
+	if e.Type == device.Connect {
+		crf.lock.Lock()
+		crf.connects++
+		crf.lock.Unlock()
+	}
+}
+
+// Healthy computes the connection rate since the previous call.  The first call always reports healthy.
+func (crf *ConnectRateFeedback) Healthy() (bool, error) {
+	defer crf.lock.Unlock()
+	crf.lock.Lock()
+
+	var (
+		now      = crf._now()
+		elapsed  = now.Sub(crf.since)
+		connects = crf.connects
+		first    = crf.since.IsZero()
+	)
+
+	crf.connects = 0
+	crf.since = now
+	if first || elapsed <= 0 {
+		return true, nil
+	}
+
+	return float64(connects)/elapsed.Seconds() <= crf.MaxRate, nil
+}
@@ -0,0 +1,167 @@
+package drain
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/xmidt-org/webpa-common/device"
+)
+
+func TestFeedbackFunc(t *testing.T) {
+	var (
+		assert   = assert.New(t)
+		expected = errors.New("expected")
+	)
+
+	healthy, err := FeedbackFunc(func() (bool, error) { return false, expected }).Healthy()
+	assert.False(healthy)
+	assert.Equal(expected, err)
+}
+
+func TestFeedbackProbe(t *testing.T) {
+	var (
+		assert  = assert.New(t)
+		require = require.New(t)
+
+		calls    = make(chan struct{})
+		answers  = make(chan bool)
+		expected = errors.New("expected")
+		probe    = newFeedbackProbe(FeedbackFunc(func() (bool, error) {
+			calls <- struct{}{}
+			if <-answers {
+				return true, nil
+			}
+
+			return false, expected
+		}))
+
+		stop = make(chan struct{})
+	)
+
+	defer close(stop)
+	go probe.run(stop)
+	assert.Nil(probe.latest())
+
+	probe.request()
+	<-calls
+
+	// requests made while the Feedback is busy are coalesced
+	probe.request()
+	probe.request()
+	assert.Nil(probe.latest())
+	answers <- true
+
+	// the second call can only begin once the first result is stored
+	<-calls
+	result := probe.latest()
+	require.NotNil(result)
+	assert.Equal(feedbackResult{healthy: true}, *result)
+	assert.Nil(probe.latest())
+
+	answers <- false
+	require.Eventually(
+		func() bool {
+			result = probe.latest()
+			return result != nil
+		},
+		5*time.Second,
+		time.Millisecond,
+	)
+
+	assert.Equal(feedbackResult{healthy: false, err: expected}, *result)
+}
+
+func TestThresholdFeedback(t *testing.T) {
+	var (
+		assert   = assert.New(t)
+		value    = 5.0
+		valueErr error
+		tf       = ThresholdFeedback{
+			Value: func() (float64, error) { return value, valueErr },
+			Max:   10.0,
+		}
+	)
+
+	healthy, err := tf.Healthy()
+	assert.True(healthy)
+	assert.NoError(err)
+
+	value = 10.5
+	healthy, err = tf.Healthy()
+	assert.False(healthy)
+	assert.NoError(err)
+
+	valueErr = errors.New("expected")
+	healthy, err = tf.Healthy()
+	assert.False(healthy)
+	assert.Equal(valueErr, err)
+}
+
+func TestHTTPFeedback(t *testing.T) {
+	var (
+		assert = assert.New(t)
+
+		healthy = httptest.NewServer(http.HandlerFunc(func(response http.ResponseWriter, _ *http.Request) {
+			response.WriteHeader(http.StatusNoContent)
+		}))
+
+		unhealthy = httptest.NewServer(http.HandlerFunc(func(response http.ResponseWriter, _ *http.Request) {
+			response.WriteHeader(http.StatusServiceUnavailable)
+		}))
+	)
+
+	defer healthy.Close()
+	defer unhealthy.Close()
+
+	result, err := HTTPFeedback{URLs: []string{healthy.URL, healthy.URL}, Timeout: 5 * time.Second}.Healthy()
+	assert.True(result)
+	assert.NoError(err)
+
+	result, err = HTTPFeedback{Client: healthy.Client(), URLs: []string{healthy.URL, unhealthy.URL}}.Healthy()
+	assert.False(result)
+	assert.Error(err)
+
+	result, err = HTTPFeedback{URLs: []string{"this is not a URL\x7f"}}.Healthy()
+	assert.False(result)
+	assert.Error(err)
+}
+
+func TestConnectRateFeedback(t *testing.T) {
+	var (
+		assert = assert.New(t)
+		now    = time.Now()
+		crf    = &ConnectRateFeedback{
+			MaxRate: 2.0,
+			now:     func() time.Time { return now },
+		}
+	)
+
+	// the first sample only establishes the start of the window
+	healthy, err := crf.Healthy()
+	assert.True(healthy)
+	assert.NoError(err)
+
+	for i := 0; i < 10; i++ {
+		crf.Listen(&device.Event{Type: device.Connect})
+		crf.Listen(&device.Event{Type: device.Disconnect})
+	}
+
+	now = now.Add(5 * time.Second)
+	healthy, err = crf.Healthy()
+	assert.True(healthy)
+	assert.NoError(err)
+
+	for i := 0; i < 11; i++ {
+		crf.Listen(&device.Event{Type: device.Connect})
+	}
+
+	now = now.Add(5 * time.Second)
+	healthy, err = crf.Healthy()
+	assert.False(healthy)
+	assert.NoError(err)
+}
@@ -0,0 +1,191 @@
+package drain
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/go-kit/kit/log/level"
+	"github.com/xmidt-org/bascule"
+	"github.com/xmidt-org/webpa-common/logging"
+	"github.com/xmidt-org/webpa-common/xhttp"
+)
+
+// DefaultHistorySize is the default number of finished drain jobs retained by a drainer
+const DefaultHistorySize = 100
+
+// JobState describes how a drain job ended
+type JobState string
+
+const (
+	// JobCompleted indicates that a drain job ran to completion
+	JobCompleted JobState = "completed"
+
+	// JobCancelled indicates that a drain job was cancelled before it completed
+	JobCancelled JobState = "cancelled"
+
+	// JobFailed indicates that a drain job could not be started
+	JobFailed JobState = "failed"
+)
+
+// JobRecord is the audit record of a finished drain job
+type JobRecord struct {
+	// ID is the drainer's identifier for the job.  Jobs that failed to start have no ID.
+	ID uint32
+
+	State JobState
+
+	// Job is the normalized job.  Its Requester is the identity that started the job.
+	Job Job
+
+	// Progress is the final progress of the job, including its start and finish times
+	Progress Progress
+
+	// CancelledBy is the identity that cancelled the job, if known
+	CancelledBy string
+
+	// Error is the reason a job failed to start
+	Error string
+}
+
+func (jr JobRecord) MarshalJSON() ([]byte, error) {
+	output := map[string]interface{}{
+		"state":    jr.State,
+		"job":      jr.Job.ToMap(),
+		"progress": jr.Progress,
+	}
+
+	if jr.ID > 0 {
+		output["id"] = jr.ID
+	}
+
+	if len(jr.CancelledBy) > 0 {
+		output["cancelledBy"] = jr.CancelledBy
+	}
+
+	if len(jr.Error) > 0 {
+		output["error"] = jr.Error
+	}
+
+	return json.Marshal(output)
+}
+
+// Requester returns the identity of the caller of a request, which is the principal of any bascule
+// Authentication in the context.  If there is no authenticated principal, this function returns the empty string.
+func Requester(ctx context.Context) string {
+	if auth, ok := bascule.FromContext(ctx); ok && auth.Token != nil {
+		return auth.Token.Principal()
+	}
+
+	return ""
+}
+
+// recordFailure adds a job that could not be started to the history
+func (dr *drainer) recordFailure(j Job, err error) {
+	now := dr.now().UTC()
+	dr.record(JobRecord{
+		State:    JobFailed,
+		Job:      j,
+		Progress: Progress{Started: now, Finished: &now},
+		Error:    err.Error(),
+	})
+}
+
+// record adds a finished job to the history, discarding the oldest record if the history is full
+func (dr *drainer) record(jr JobRecord) {
+	dr.historyLock.Lock()
+	dr.history = append(dr.history, jr)
+	if excess := len(dr.history) - dr.historySize; excess > 0 {
+		dr.history = append(dr.history[:0], dr.history[excess:]...)
+	}
+
+	dr.historyLock.Unlock()
+
+	if dr.auditLogger != nil {
+		var finished time.Time
+		if jr.Progress.Finished != nil {
+			finished = *jr.Progress.Finished
+		}
+
+		dr.auditLogger.Log(
+			level.Key(), level.InfoValue(),
+			logging.MessageKey(), "drain job audit",
+			"drainJobID", jr.ID,
+			"state", jr.State,
+			"requester", jr.Job.Requester,
+			"cancelledBy", jr.CancelledBy,
+			"count", jr.Job.Count,
+			"percent", jr.Job.Percent,
+			"rate", jr.Job.Rate,
+			"tick", jr.Job.Tick,
+			"visited", jr.Progress.Visited,
+			"drained", jr.Progress.Drained,
+			"started", jr.Progress.Started,
+			"finished", finished,
+			"error", jr.Error,
+		)
+	}
+}
+
+func (dr *drainer) History() []JobRecord {
+	dr.historyLock.Lock()
+	history := make([]JobRecord, len(dr.history))
+	copy(history, dr.history)
+	dr.historyLock.Unlock()
+
+	return history
+}
+
+// History is an HTTP handler that returns the drain job history as JSON, most recent first.  The results
+// can be restricted with the state and requester parameters, and the limit parameter bounds the number of records.
+// If the Drainer is not an Auditor, this handler responds with http.StatusNotImplemented.
+type History struct {
+	Drainer Interface
+}
+
+func (h *History) ServeHTTP(response http.ResponseWriter, request *http.Request) {
+	auditor, ok := h.Drainer.(Auditor)
+	if !ok {
+		xhttp.WriteErrorf(response, http.StatusNotImplemented, "This drainer does not keep a job history")
+		return
+	}
+
+	var (
+		state     = JobState(request.FormValue("state"))
+		requester = request.FormValue("requester")
+		limit     = -1
+	)
+
+	if v := request.FormValue("limit"); len(v) > 0 {
+		var err error
+		if limit, err = strconv.Atoi(v); err != nil || limit < 0 {
+			xhttp.WriteErrorf(response, http.StatusBadRequest, "Invalid limit: %s", v)
+			return
+		}
+	}
+
+	var (
+		history = auditor.History()
+		records = make([]JobRecord, 0, len(history))
+	)
+
+	for i := len(history) - 1; i >= 0 && limit != 0; i-- {
+		jr := history[i]
+		if len(state) > 0 && jr.State != state {
+			continue
+		}
+
+		if len(requester) > 0 && jr.Job.Requester != requester && jr.CancelledBy != requester {
+			continue
+		}
+
+		records = append(records, jr)
+		limit--
+	}
+
+	writeJSON(response, map[string]interface{}{
+		"history": records,
+	})
+}
@@ -0,0 +1,277 @@
+package drain
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/go-kit/kit/log"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/xmidt-org/bascule"
+	"github.com/xmidt-org/webpa-common/logging"
+)
+
+func testContextWithPrincipal(principal string) context.Context {
+	return bascule.WithAuthentication(
+		context.Background(),
+		bascule.Authentication{Token: bascule.NewToken("jwt", principal, nil)},
+	)
+}
+
+func TestRequester(t *testing.T) {
+	assert := assert.New(t)
+	assert.Empty(Requester(context.Background()))
+	assert.Empty(Requester(bascule.WithAuthentication(context.Background(), bascule.Authentication{})))
+	assert.Equal("alice", Requester(testContextWithPrincipal("alice")))
+}
+
+func TestDrainerHistory(t *testing.T) {
+	var (
+		assert  = assert.New(t)
+		require = require.New(t)
+
+		manager = generateManager(assert, 10)
+
+		auditLock sync.Mutex
+		audits    []map[interface{}]interface{}
+		audit     = log.LoggerFunc(func(keyvals ...interface{}) error {
+			record := make(map[interface{}]interface{})
+			for i := 0; i < len(keyvals); i += 2 {
+				record[keyvals[i]] = keyvals[i+1]
+			}
+
+			auditLock.Lock()
+			audits = append(audits, record)
+			auditLock.Unlock()
+			return nil
+		})
+
+		d = New(
+			WithLogger(logging.NewTestLogger(nil, t)),
+			WithManager(manager),
+			WithHistorySize(2),
+			WithAuditLogger(audit),
+		).(*drainer)
+	)
+
+	assert.Empty(d.History())
+
+	done, _, err := d.Start(Job{Requester: "alice"})
+	require.NoError(err)
+
+	_, _, err = d.Start(Job{Count: 5, Requester: "bob"})
+	assert.Equal(ErrActive, err)
+
+	_, err = d.CancelBy("carol")
+	require.NoError(err)
+	close(manager.pauseDisconnect)
+	close(manager.pauseVisit)
+
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		assert.Fail("Drain failed to complete")
+		return
+	}
+
+	history := d.History()
+	require.Len(history, 2)
+
+	assert.Equal(JobFailed, history[0].State)
+	assert.Equal("bob", history[0].Job.Requester)
+	assert.Equal(ErrActive.Error(), history[0].Error)
+	assert.Zero(history[0].ID)
+	assert.NotNil(history[0].Progress.Finished)
+
+	assert.Equal(JobCancelled, history[1].State)
+	assert.Equal(uint32(1), history[1].ID)
+	assert.Equal(Job{Count: 10, Requester: "alice"}, history[1].Job)
+	assert.Equal("carol", history[1].CancelledBy)
+	assert.NotNil(history[1].Progress.Finished)
+
+	done, _, err = d.Start(Job{Requester: "dave"})
+	require.NoError(err)
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		assert.Fail("Drain failed to complete")
+		return
+	}
+
+	// the oldest record is discarded
+	history = d.History()
+	require.Len(history, 2)
+	assert.Equal(JobCancelled, history[0].State)
+	assert.Equal(JobCompleted, history[1].State)
+	assert.Equal(uint32(2), history[1].ID)
+	assert.Equal("dave", history[1].Job.Requester)
+	assert.Empty(history[1].CancelledBy)
+
+	auditLock.Lock()
+	defer auditLock.Unlock()
+	require.Len(audits, 3)
+	assert.Equal(JobFailed, audits[0]["state"])
+	assert.Equal("bob", audits[0]["requester"])
+	assert.Equal(JobCancelled, audits[1]["state"])
+	assert.Equal("carol", audits[1]["cancelledBy"])
+	assert.Equal(JobCompleted, audits[2]["state"])
+}
+
+func testHistoryServeHTTPValid(t *testing.T) {
+	var (
+		started  = time.Date(2020, time.June, 4, 0, 0, 0, 0, time.UTC)
+		finished = started.Add(time.Minute)
+
+		history = []JobRecord{
+			{ID: 1, State: JobCompleted, Job: Job{Count: 10, Requester: "alice"}, Progress: Progress{Visited: 10, Drained: 10, Started: started, Finished: &finished}},
+			{State: JobFailed, Job: Job{Count: 5, Requester: "bob"}, Progress: Progress{Started: started, Finished: &started}, Error: "expected"},
+			{ID: 2, State: JobCancelled, Job: Job{Count: 20, Requester: "bob"}, Progress: Progress{Visited: 3, Drained: 2, Started: started, Finished: &finished}, CancelledBy: "alice"},
+		}
+	)
+
+	testData := []struct {
+		uri      string
+		expected string
+	}{
+		{
+			"/",
+			`{"history": [
+				{"id": 2, "state": "cancelled", "job": {"count": 20, "requester": "bob"}, "cancelledBy": "alice",
+					"progress": {"visited": 3, "drained": 2, "started": "2020-06-04T00:00:00Z", "finished": "2020-06-04T00:01:00Z"}},
+				{"state": "failed", "job": {"count": 5, "requester": "bob"}, "error": "expected",
+					"progress": {"visited": 0, "drained": 0, "started": "2020-06-04T00:00:00Z", "finished": "2020-06-04T00:00:00Z"}},
+				{"id": 1, "state": "completed", "job": {"count": 10, "requester": "alice"},
+					"progress": {"visited": 10, "drained": 10, "started": "2020-06-04T00:00:00Z", "finished": "2020-06-04T00:01:00Z"}}
+			]}`,
+		},
+		{
+			"/?state=completed",
+			`{"history": [
+				{"id": 1, "state": "completed", "job": {"count": 10, "requester": "alice"},
+					"progress": {"visited": 10, "drained": 10, "started": "2020-06-04T00:00:00Z", "finished": "2020-06-04T00:01:00Z"}}
+			]}`,
+		},
+		{
+			"/?requester=alice&limit=1",
+			`{"history": [
+				{"id": 2, "state": "cancelled", "job": {"count": 20, "requester": "bob"}, "cancelledBy": "alice",
+					"progress": {"visited": 3, "drained": 2, "started": "2020-06-04T00:00:00Z", "finished": "2020-06-04T00:01:00Z"}}
+			]}`,
+		},
+		{
+			"/?state=failed&requester=alice",
+			`{"history": []}`,
+		},
+	}
+
+	for _, record := range testData {
+		t.Run(record.uri, func(t *testing.T) {
+			var (
+				assert = assert.New(t)
+
+				d        = new(mockDrainer)
+				handler  = History{d}
+				response = httptest.NewRecorder()
+			)
+
+			d.On("History").Return(history).Once()
+			handler.ServeHTTP(response, httptest.NewRequest("GET", record.uri, nil))
+			assert.Equal(http.StatusOK, response.Code)
+			assert.Equal("application/json", response.Header().Get("Content-Type"))
+			assert.JSONEq(record.expected, response.Body.String())
+			d.AssertExpectations(t)
+		})
+	}
+}
+
+func testHistoryServeHTTPInvalid(t *testing.T) {
+	for _, limit := range []string{"lots", "-1"} {
+		t.Run(limit, func(t *testing.T) {
+			var (
+				assert = assert.New(t)
+
+				d        = new(mockDrainer)
+				handler  = History{d}
+				response = httptest.NewRecorder()
+			)
+
+			handler.ServeHTTP(response, httptest.NewRequest("GET", "/?limit="+limit, nil))
+			assert.Equal(http.StatusBadRequest, response.Code)
+			d.AssertExpectations(t)
+		})
+	}
+}
+
+func testHistoryStartRequester(t *testing.T) {
+	var (
+		assert = assert.New(t)
+
+		d        = new(mockDrainer)
+		start    = Start{d}
+		response = httptest.NewRecorder()
+		request  = httptest.NewRequest("POST", "/", nil).WithContext(testContextWithPrincipal("alice"))
+	)
+
+	d.On("Start", Job{Requester: "alice"}).Return((<-chan struct{})(make(chan struct{})), Job{Count: 10, Requester: "alice"}, error(nil)).Once()
+	start.ServeHTTP(response, request)
+	assert.Equal(http.StatusOK, response.Code)
+	assert.JSONEq(`{"count": 10, "requester": "alice"}`, response.Body.String())
+	d.AssertExpectations(t)
+}
+
+func testHistoryCancelRequester(t *testing.T) {
+	var (
+		assert = assert.New(t)
+
+		d        = new(mockDrainer)
+		cancel   = Cancel{d}
+		done     = make(chan struct{})
+		response = httptest.NewRecorder()
+		request  = httptest.NewRequest("POST", "/", nil).WithContext(testContextWithPrincipal("carol"))
+	)
+
+	close(done)
+	d.On("CancelBy", "carol").Return((<-chan struct{})(done), error(nil)).Once()
+	cancel.ServeHTTP(response, request)
+	assert.Equal(http.StatusOK, response.Code)
+	d.AssertExpectations(t)
+}
+
+func testHistoryNotAuditor(t *testing.T) {
+	var (
+		assert = assert.New(t)
+
+		// hide the drainer's Auditor methods
+		d        = new(mockDrainer)
+		cancel   = Cancel{struct{ Interface }{d}}
+		history  = History{struct{ Interface }{d}}
+		done     = make(chan struct{})
+		response = httptest.NewRecorder()
+		request  = httptest.NewRequest("POST", "/", nil).WithContext(testContextWithPrincipal("carol"))
+	)
+
+	close(done)
+	d.On("Cancel").Return((<-chan struct{})(done), error(nil)).Once()
+	cancel.ServeHTTP(response, request)
+	assert.Equal(http.StatusOK, response.Code)
+
+	response = httptest.NewRecorder()
+	history.ServeHTTP(response, httptest.NewRequest("GET", "/", nil))
+	assert.Equal(http.StatusNotImplemented, response.Code)
+	d.AssertExpectations(t)
+}
+
+func TestHistory(t *testing.T) {
+	t.Run("ServeHTTP", func(t *testing.T) {
+		t.Run("Valid", testHistoryServeHTTPValid)
+		t.Run("Invalid", testHistoryServeHTTPInvalid)
+	})
+
+	t.Run("StartRequester", testHistoryStartRequester)
+	t.Run("CancelRequester", testHistoryCancelRequester)
+	t.Run("NotAuditor", testHistoryNotAuditor)
+}
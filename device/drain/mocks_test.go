@@ -28,6 +28,36 @@ func (m *mockDrainer) Cancel() (<-chan struct{}, error) {
 	return arguments.Get(0).(<-chan struct{}), arguments.Error(1)
 }
 
+func (m *mockDrainer) CancelBy(requester string) (<-chan struct{}, error) {
+	arguments := m.Called(requester)
+	return arguments.Get(0).(<-chan struct{}), arguments.Error(1)
+}
+
+func (m *mockDrainer) History() []JobRecord {
+	return m.Called().Get(0).([]JobRecord)
+}
+
+type mockScheduler struct {
+	mock.Mock
+}
+
+func (m *mockScheduler) Schedule(sj ScheduledJob) (ScheduledJob, error) {
+	arguments := m.Called(sj)
+	return arguments.Get(0).(ScheduledJob), arguments.Error(1)
+}
+
+func (m *mockScheduler) Unschedule(id string) error {
+	return m.Called(id).Error(0)
+}
+
+func (m *mockScheduler) Scheduled() []ScheduledJob {
+	return m.Called().Get(0).([]ScheduledJob)
+}
+
+func (m *mockScheduler) Stop() {
+	m.Called()
+}
+
 type stubManager struct {
 	lock    sync.RWMutex
 	assert  *assert.Assertions
@@ -0,0 +1,186 @@
+package drain
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ErrInvalidRecurrence indicates that a recurrence specification could not be parsed
+var ErrInvalidRecurrence = errors.New("Invalid recurrence specification")
+
+// recurrenceHorizon is how far into the future a recurrence is searched for its next occurrence
+const recurrenceHorizon = 5
+
+// Recurrence describes how a scheduled drain job repeats
+type Recurrence interface {
+	// Next returns the first occurrence strictly after the given time, or the zero time if
+	// there are no further occurrences.
+	Next(time.Time) time.Time
+}
+
+var recurrenceDescriptors = map[string]string{
+	"@yearly":   "0 0 1 1 *",
+	"@annually": "0 0 1 1 *",
+	"@monthly":  "0 0 1 * *",
+	"@weekly":   "0 0 * * 0",
+	"@daily":    "0 0 * * *",
+	"@midnight": "0 0 * * *",
+	"@hourly":   "0 * * * *",
+}
+
+// cronField describes the legal range of one field in a cron specification
+type cronField struct {
+	name     string
+	min, max int
+}
+
+var cronFields = [5]cronField{
+	{"minute", 0, 59},
+	{"hour", 0, 23},
+	{"day of month", 1, 31},
+	{"month", 1, 12},
+	{"day of week", 0, 7},
+}
+
+// cronRecurrence is a Recurrence using the traditional 5-field cron format.  Each field
+// is a bitset of the values that match.
+type cronRecurrence struct {
+	minute, hour, dom, month, dow uint64
+
+	// domStar and dowStar record unrestricted day fields.  As with cron, when both day fields
+	// are restricted a day matches if either field matches.
+	domStar, dowStar bool
+}
+
+// ParseRecurrence parses a cron-like recurrence specification.  The standard 5 fields (minute, hour,
+// day of month, month, day of week) are supported, with each field allowing "*", single values, ranges,
+// steps, and comma-separated lists, e.g. "0 1-3 * * 1-5" or "*/15 * * * *".  Sunday may be given as either
+// 0 or 7 in the day of week field.  The descriptors @yearly, @annually, @monthly, @weekly, @daily,
+// @midnight, and @hourly are also supported.
+//
+// Occurrences are computed in the location of the time passed to Next.
+func ParseRecurrence(spec string) (Recurrence, error) {
+	spec = strings.TrimSpace(spec)
+	if expanded, ok := recurrenceDescriptors[strings.ToLower(spec)]; ok {
+		spec = expanded
+	}
+
+	fields := strings.Fields(spec)
+	if len(fields) != len(cronFields) {
+		return nil, fmt.Errorf("%s: expected %d fields in %q", ErrInvalidRecurrence, len(cronFields), spec)
+	}
+
+	var (
+		cr   = new(cronRecurrence)
+		sets = [5]*uint64{&cr.minute, &cr.hour, &cr.dom, &cr.month, &cr.dow}
+	)
+
+	for i, f := range fields {
+		bits, err := parseCronField(f, cronFields[i])
+		if err != nil {
+			return nil, err
+		}
+
+		*sets[i] = bits
+	}
+
+	// normalize Sunday
+	if cr.dow&(1<<7) != 0 {
+		cr.dow |= 1
+	}
+
+	cr.domStar = fields[2] == "*"
+	cr.dowStar = fields[4] == "*"
+	return cr, nil
+}
+
+func parseCronField(value string, field cronField) (uint64, error) {
+	var bits uint64
+	for _, term := range strings.Split(value, ",") {
+		var (
+			low, high = field.min, field.max
+			step      = 1
+			err       error
+		)
+
+		if i := strings.IndexByte(term, '/'); i >= 0 {
+			if step, err = strconv.Atoi(term[i+1:]); err != nil || step < 1 {
+				return 0, fmt.Errorf("%s: invalid step in %s field %q", ErrInvalidRecurrence, field.name, value)
+			}
+
+			term = term[:i]
+		}
+
+		if term != "*" {
+			bounds := strings.SplitN(term, "-", 2)
+			if low, err = strconv.Atoi(bounds[0]); err != nil {
+				return 0, fmt.Errorf("%s: invalid %s field %q", ErrInvalidRecurrence, field.name, value)
+			}
+
+			high = low
+			if len(bounds) > 1 {
+				if high, err = strconv.Atoi(bounds[1]); err != nil {
+					return 0, fmt.Errorf("%s: invalid %s field %q", ErrInvalidRecurrence, field.name, value)
+				}
+			} else if step > 1 {
+				// as with cron, "5/10" means "5-max/10"
+				high = field.max
+			}
+		}
+
+		if low < field.min || high > field.max || low > high {
+			return 0, fmt.Errorf("%s: %s field %q is out of range", ErrInvalidRecurrence, field.name, value)
+		}
+
+		for v := low; v <= high; v += step {
+			bits |= 1 << uint(v)
+		}
+	}
+
+	return bits, nil
+}
+
+func (cr *cronRecurrence) dayMatches(t time.Time) bool {
+	var (
+		domMatch = cr.dom&(1<<uint(t.Day())) != 0
+		dowMatch = cr.dow&(1<<uint(t.Weekday())) != 0
+	)
+
+	if cr.domStar || cr.dowStar {
+		return domMatch && dowMatch
+	}
+
+	return domMatch || dowMatch
+}
+
+func (cr *cronRecurrence) Next(after time.Time) time.Time {
+	var (
+		loc   = after.Location()
+		t     = time.Date(after.Year(), after.Month(), after.Day(), after.Hour(), after.Minute(), 0, 0, loc).Add(time.Minute)
+		limit = t.AddDate(recurrenceHorizon, 0, 0)
+	)
+
+	for t.Before(limit) {
+		switch {
+		case cr.month&(1<<uint(t.Month())) == 0:
+			t = time.Date(t.Year(), t.Month()+1, 1, 0, 0, 0, 0, loc)
+
+		case !cr.dayMatches(t):
+			t = time.Date(t.Year(), t.Month(), t.Day()+1, 0, 0, 0, 0, loc)
+
+		case cr.hour&(1<<uint(t.Hour())) == 0:
+			t = time.Date(t.Year(), t.Month(), t.Day(), t.Hour()+1, 0, 0, 0, loc)
+
+		case cr.minute&(1<<uint(t.Minute())) == 0:
+			t = t.Add(time.Minute)
+
+		default:
+			return t
+		}
+	}
+
+	return time.Time{}
+}
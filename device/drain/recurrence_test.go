@@ -0,0 +1,110 @@
+package drain
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func testParseRecurrenceValid(t *testing.T) {
+	// a Thursday
+	after := time.Date(2020, time.June, 4, 10, 30, 15, 0, time.UTC)
+
+	testData := []struct {
+		spec     string
+		expected []time.Time
+	}{
+		{
+			"@daily",
+			[]time.Time{
+				time.Date(2020, time.June, 5, 0, 0, 0, 0, time.UTC),
+				time.Date(2020, time.June, 6, 0, 0, 0, 0, time.UTC),
+			},
+		},
+		{
+			"@Hourly",
+			[]time.Time{
+				time.Date(2020, time.June, 4, 11, 0, 0, 0, time.UTC),
+				time.Date(2020, time.June, 4, 12, 0, 0, 0, time.UTC),
+			},
+		},
+		{
+			"*/20 * * * *",
+			[]time.Time{
+				time.Date(2020, time.June, 4, 10, 40, 0, 0, time.UTC),
+				time.Date(2020, time.June, 4, 11, 0, 0, 0, time.UTC),
+			},
+		},
+		{
+			"15 2-3 * * 1-5",
+			[]time.Time{
+				time.Date(2020, time.June, 5, 2, 15, 0, 0, time.UTC),
+				time.Date(2020, time.June, 5, 3, 15, 0, 0, time.UTC),
+				time.Date(2020, time.June, 8, 2, 15, 0, 0, time.UTC),
+			},
+		},
+		{
+			"0 0 * * 7",
+			[]time.Time{
+				time.Date(2020, time.June, 7, 0, 0, 0, 0, time.UTC),
+				time.Date(2020, time.June, 14, 0, 0, 0, 0, time.UTC),
+			},
+		},
+		{
+			// either day field matches when both are restricted
+			"0 0 13 * 6",
+			[]time.Time{
+				time.Date(2020, time.June, 6, 0, 0, 0, 0, time.UTC),
+				time.Date(2020, time.June, 13, 0, 0, 0, 0, time.UTC),
+				time.Date(2020, time.June, 20, 0, 0, 0, 0, time.UTC),
+			},
+		},
+		{
+			"0 0 29 2 *",
+			[]time.Time{
+				time.Date(2024, time.February, 29, 0, 0, 0, 0, time.UTC),
+				time.Date(2028, time.February, 29, 0, 0, 0, 0, time.UTC),
+			},
+		},
+		{
+			"0 0 31 2 *",
+			[]time.Time{{}},
+		},
+	}
+
+	for _, record := range testData {
+		t.Run(record.spec, func(t *testing.T) {
+			var (
+				assert  = assert.New(t)
+				require = require.New(t)
+			)
+
+			r, err := ParseRecurrence(record.spec)
+			require.NoError(err)
+			require.NotNil(r)
+
+			current := after
+			for _, expected := range record.expected {
+				current = r.Next(current)
+				assert.Equal(expected, current)
+			}
+		})
+	}
+}
+
+func testParseRecurrenceInvalid(t *testing.T) {
+	for _, spec := range []string{"", "@sometimes", "* * * *", "60 * * * *", "* 24 * * *", "* * 0 * *", "* * * 13 *", "* * * * 8", "5-1 * * * *", "*/0 * * * *", "a * * * *"} {
+		t.Run(spec, func(t *testing.T) {
+			r, err := ParseRecurrence(spec)
+			assert.Nil(t, r)
+			assert.Error(t, err)
+		})
+	}
+}
+
+func TestParseRecurrence(t *testing.T) {
+	t.Run("Valid", testParseRecurrenceValid)
+	t.Run("Invalid", testParseRecurrenceInvalid)
+}
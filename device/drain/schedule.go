@@ -0,0 +1,113 @@
+package drain
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/go-kit/kit/log/level"
+	"github.com/xmidt-org/webpa-common/logging"
+	"github.com/xmidt-org/webpa-common/xhttp"
+)
+
+// writeJSON writes a JSON response, or an internal server error if the value cannot be marshaled
+func writeJSON(response http.ResponseWriter, v interface{}) {
+	message, err := json.Marshal(v)
+	if err != nil {
+		xhttp.WriteError(response, http.StatusInternalServerError, err)
+		return
+	}
+
+	response.Header().Set("Content-Type", "application/json")
+	response.WriteHeader(http.StatusOK)
+	response.Write(message)
+}
+
+// Schedule is an HTTP handler that adds a drain job to a Scheduler.  The job is described by the same form
+// parameters and body as Start, along with the start and end parameters bounding the maintenance window, which
+// are RFC3339 timestamps, and an optional recurrence parameter.
+type Schedule struct {
+	Scheduler Scheduler
+}
+
+func (s *Schedule) ServeHTTP(response http.ResponseWriter, request *http.Request) {
+	logger := logging.GetLogger(request.Context())
+	if err := request.ParseForm(); err != nil {
+		logger.Log(level.Key(), level.ErrorValue(), logging.MessageKey(), "unable to parse form", logging.ErrorKey(), err)
+		xhttp.WriteError(response, http.StatusBadRequest, err)
+		return
+	}
+
+	var (
+		sj     ScheduledJob
+		values = make(url.Values, len(request.Form))
+	)
+
+	for name, v := range request.Form {
+		values[name] = v
+	}
+
+	for name, t := range map[string]*time.Time{"start": &sj.Start, "end": &sj.End} {
+		if v := values.Get(name); len(v) > 0 {
+			var err error
+			if *t, err = time.Parse(time.RFC3339, v); err != nil {
+				logger.Log(level.Key(), level.ErrorValue(), logging.MessageKey(), "unable to parse schedule", logging.ErrorKey(), err)
+				xhttp.WriteError(response, http.StatusBadRequest, err)
+				return
+			}
+		}
+
+		delete(values, name)
+	}
+
+	sj.Recurrence = values.Get("recurrence")
+	delete(values, "recurrence")
+
+	defer request.Body.Close()
+	job, err := decodeJob(logger, values, request.Body)
+	if err != nil {
+		xhttp.WriteError(response, http.StatusBadRequest, err)
+		return
+	}
+
+	sj.Job = job
+	sj.Job.Requester = Requester(request.Context())
+	output, err := s.Scheduler.Schedule(sj)
+	if err != nil {
+		logger.Log(level.Key(), level.ErrorValue(), logging.MessageKey(), "unable to schedule drain job", logging.ErrorKey(), err)
+		xhttp.WriteError(response, http.StatusBadRequest, err)
+		return
+	}
+
+	writeJSON(response, output)
+}
+
+// Scheduled is an HTTP handler that lists the drain jobs queued in a Scheduler
+type Scheduled struct {
+	Scheduler Scheduler
+}
+
+func (s *Scheduled) ServeHTTP(response http.ResponseWriter, request *http.Request) {
+	writeJSON(response, map[string]interface{}{
+		"scheduled": s.Scheduler.Scheduled(),
+	})
+}
+
+// Unschedule is an HTTP handler that removes a drain job, identified by the id parameter, from a Scheduler
+type Unschedule struct {
+	Scheduler Scheduler
+}
+
+func (u *Unschedule) ServeHTTP(response http.ResponseWriter, request *http.Request) {
+	switch err := u.Scheduler.Unschedule(request.FormValue("id")); err {
+	case nil:
+		response.WriteHeader(http.StatusOK)
+
+	case ErrScheduleNotFound:
+		xhttp.WriteError(response, http.StatusNotFound, err)
+
+	default:
+		xhttp.WriteError(response, http.StatusInternalServerError, err)
+	}
+}
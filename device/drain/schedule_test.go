@@ -0,0 +1,160 @@
+package drain
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/xmidt-org/webpa-common/device/devicegate"
+	"github.com/xmidt-org/webpa-common/logging"
+)
+
+func testScheduleServeHTTPValid(t *testing.T) {
+	filter, err := newDrainFilter(devicegate.FilterRequest{Key: "partner-id", Values: []interface{}{"comcast"}})
+	require.NoError(t, err)
+
+	var (
+		assert = assert.New(t)
+
+		s        = new(mockScheduler)
+		schedule = Schedule{s}
+		start    = time.Date(2020, time.June, 4, 0, 0, 0, 0, time.UTC)
+
+		ctx      = logging.WithLogger(context.Background(), logging.NewTestLogger(nil, t))
+		response = httptest.NewRecorder()
+		request  = httptest.NewRequest(
+			"POST",
+			"/foo?count=100&rate=10&tick=1m&start=2020-06-04T00:00:00Z&end=2020-06-04T02:00:00Z&recurrence=@daily",
+			bytes.NewBufferString(`{"key": "partner-id", "values": ["comcast"]}`),
+		).WithContext(ctx)
+
+		expected = ScheduledJob{
+			Job: Job{
+				Count:       100,
+				Rate:        10,
+				Tick:        time.Minute,
+				DrainFilter: filter,
+			},
+			Start:      start,
+			End:        start.Add(2 * time.Hour),
+			Recurrence: "@daily",
+		}
+	)
+
+	output := expected
+	output.ID = "abc"
+	output.Next = start
+
+	s.On("Schedule", expected).Return(output, error(nil)).Once()
+	schedule.ServeHTTP(response, request)
+	assert.Equal(http.StatusOK, response.Code)
+	assert.Equal("application/json", response.Header().Get("Content-Type"))
+	assert.JSONEq(
+		`{
+			"id": "abc",
+			"job": {"count": 100, "rate": 10, "tick": "1m0s", "filter": {"key": "partner-id", "values": ["comcast"]}},
+			"start": "2020-06-04T00:00:00Z",
+			"end": "2020-06-04T02:00:00Z",
+			"recurrence": "@daily",
+			"next": "2020-06-04T00:00:00Z"
+		}`,
+		response.Body.String(),
+	)
+
+	s.AssertExpectations(t)
+}
+
+func testScheduleServeHTTPInvalid(t *testing.T) {
+	for _, uri := range []string{"/foo?start=tomorrow", "/foo?end=never", "/foo?count=lots", "/foo?start=2020-06-04T00:00:00Z&nosuch=1"} {
+		t.Run(uri, func(t *testing.T) {
+			var (
+				assert = assert.New(t)
+
+				s        = new(mockScheduler)
+				schedule = Schedule{s}
+				response = httptest.NewRecorder()
+			)
+
+			schedule.ServeHTTP(response, httptest.NewRequest("POST", uri, nil))
+			assert.Equal(http.StatusBadRequest, response.Code)
+			s.AssertExpectations(t)
+		})
+	}
+
+	t.Run("ScheduleError", func(t *testing.T) {
+		var (
+			assert = assert.New(t)
+
+			s        = new(mockScheduler)
+			schedule = Schedule{s}
+			response = httptest.NewRecorder()
+		)
+
+		s.On("Schedule", ScheduledJob{}).Return(ScheduledJob{}, ErrInvalidSchedule).Once()
+		schedule.ServeHTTP(response, httptest.NewRequest("POST", "/foo", nil))
+		assert.Equal(http.StatusBadRequest, response.Code)
+		s.AssertExpectations(t)
+	})
+}
+
+func TestSchedule(t *testing.T) {
+	t.Run("ServeHTTP", func(t *testing.T) {
+		t.Run("Valid", testScheduleServeHTTPValid)
+		t.Run("Invalid", testScheduleServeHTTPInvalid)
+	})
+}
+
+func TestScheduled(t *testing.T) {
+	var (
+		assert = assert.New(t)
+
+		s         = new(mockScheduler)
+		scheduled = Scheduled{s}
+		response  = httptest.NewRecorder()
+		start     = time.Date(2020, time.June, 4, 0, 0, 0, 0, time.UTC)
+	)
+
+	s.On("Scheduled").Return([]ScheduledJob{{ID: "abc", Job: Job{Percent: 10}, Start: start, Next: start}}).Once()
+	scheduled.ServeHTTP(response, httptest.NewRequest("GET", "/", nil))
+	assert.Equal(http.StatusOK, response.Code)
+	assert.JSONEq(
+		`{"scheduled": [{"id": "abc", "job": {"count": 0, "percent": 10}, "start": "2020-06-04T00:00:00Z", "next": "2020-06-04T00:00:00Z"}]}`,
+		response.Body.String(),
+	)
+
+	s.AssertExpectations(t)
+}
+
+func TestUnschedule(t *testing.T) {
+	testData := []struct {
+		err      error
+		expected int
+	}{
+		{nil, http.StatusOK},
+		{ErrScheduleNotFound, http.StatusNotFound},
+		{errors.New("expected"), http.StatusInternalServerError},
+	}
+
+	for _, record := range testData {
+		t.Run(http.StatusText(record.expected), func(t *testing.T) {
+			var (
+				assert = assert.New(t)
+
+				s          = new(mockScheduler)
+				unschedule = Unschedule{s}
+				response   = httptest.NewRecorder()
+			)
+
+			s.On("Unschedule", "abc").Return(record.err).Once()
+			unschedule.ServeHTTP(response, httptest.NewRequest("DELETE", "/?id=abc", nil))
+			assert.Equal(record.expected, response.Code)
+			s.AssertExpectations(t)
+		})
+	}
+}
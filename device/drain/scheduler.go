@@ -0,0 +1,603 @@
+package drain
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/go-kit/kit/log"
+	"github.com/go-kit/kit/log/level"
+
+	"github.com/xmidt-org/webpa-common/device/devicegate"
+	"github.com/xmidt-org/webpa-common/logging"
+)
+
+var (
+	ErrScheduleNotFound error = errors.New("No such scheduled drain job")
+	ErrInvalidSchedule  error = errors.New("A scheduled drain job requires a start time, and its window must end after it starts")
+	ErrScheduleClosed   error = errors.New("The maintenance window for the scheduled drain job has already closed")
+)
+
+// DefaultScheduleRetry is the default interval at which a scheduled job is retried when it
+// cannot be started, e.g. because another drain job is active
+const DefaultScheduleRetry time.Duration = time.Minute
+
+// SchedulerRequester is the requester recorded when a Scheduler cancels a drain job at the end of its maintenance window
+const SchedulerRequester = "scheduler"
+
+// ScheduledJob is a drain Job that runs at a later time, optionally within a maintenance window
+// and optionally recurring.
+type ScheduledJob struct {
+	// ID uniquely identifies this scheduled job.  It is assigned by the Scheduler.
+	ID string
+
+	// Job describes the drain to run.  It is normalized against the connected devices each time it starts.
+	Job Job
+
+	// Start is the time of the first run
+	Start time.Time
+
+	// End is the optional end of the first maintenance window.  If set, a drain still running at this time
+	// is cancelled, and a run that cannot begin before this time is skipped.
+	End time.Time
+
+	// Recurrence is an optional specification, as accepted by ParseRecurrence, which causes this job to run
+	// repeatedly.  Each recurring run has a maintenance window of the same length as the first.
+	Recurrence string
+
+	// Next is the time of the next run.  It is maintained by the Scheduler.
+	Next time.Time
+
+	recurrence Recurrence
+	retryAt    time.Time
+}
+
+// windowEnd returns the end of the maintenance window for the next run, or the zero time if there is no window
+func (sj *ScheduledJob) windowEnd() time.Time {
+	if sj.End.IsZero() {
+		return time.Time{}
+	}
+
+	return sj.Next.Add(sj.End.Sub(sj.Start))
+}
+
+// due returns the time at which this job should next be attempted
+func (sj *ScheduledJob) due() time.Time {
+	if !sj.retryAt.IsZero() {
+		return sj.retryAt
+	}
+
+	return sj.Next
+}
+
+// validate checks the schedule and parses any recurrence
+func (sj *ScheduledJob) validate() (err error) {
+	if sj.Start.IsZero() || (!sj.End.IsZero() && !sj.End.After(sj.Start)) {
+		return ErrInvalidSchedule
+	}
+
+	sj.recurrence = nil
+	if len(sj.Recurrence) > 0 {
+		sj.recurrence, err = ParseRecurrence(sj.Recurrence)
+	}
+
+	return
+}
+
+func (sj ScheduledJob) MarshalJSON() ([]byte, error) {
+	output := map[string]interface{}{
+		"id":    sj.ID,
+		"job":   sj.Job.ToMap(),
+		"start": sj.Start,
+		"next":  sj.Next,
+	}
+
+	if !sj.End.IsZero() {
+		output["end"] = sj.End
+	}
+
+	if len(sj.Recurrence) > 0 {
+		output["recurrence"] = sj.Recurrence
+	}
+
+	return json.Marshal(output)
+}
+
+func (sj *ScheduledJob) UnmarshalJSON(data []byte) error {
+	var input struct {
+		ID  string `json:"id"`
+		Job struct {
+			Count     int                       `json:"count"`
+			Percent   int                       `json:"percent"`
+			Rate      int                       `json:"rate"`
+			Tick      string                    `json:"tick"`
+			Adaptive  bool                      `json:"adaptive"`
+			MinRate   int                       `json:"minRate"`
+			MaxRate   int                       `json:"maxRate"`
+			Redirect  bool                      `json:"redirect"`
+			Target    string                    `json:"target"`
+			Requester string                    `json:"requester"`
+			Filter    *devicegate.FilterRequest `json:"filter"`
+		} `json:"job"`
+		Start      time.Time `json:"start"`
+		End        time.Time `json:"end"`
+		Recurrence string    `json:"recurrence"`
+		Next       time.Time `json:"next"`
+	}
+
+	if err := json.Unmarshal(data, &input); err != nil {
+		return err
+	}
+
+	*sj = ScheduledJob{
+		ID: input.ID,
+		Job: Job{
+			Count:     input.Job.Count,
+			Percent:   input.Job.Percent,
+			Rate:      input.Job.Rate,
+			Adaptive:  input.Job.Adaptive,
+			MinRate:   input.Job.MinRate,
+			MaxRate:   input.Job.MaxRate,
+			Redirect:  input.Job.Redirect,
+			Target:    input.Job.Target,
+			Requester: input.Job.Requester,
+		},
+		Start:      input.Start,
+		End:        input.End,
+		Recurrence: input.Recurrence,
+		Next:       input.Next,
+	}
+
+	if len(input.Job.Tick) > 0 {
+		tick, err := time.ParseDuration(input.Job.Tick)
+		if err != nil {
+			return err
+		}
+
+		sj.Job.Tick = tick
+	}
+
+	if input.Job.Filter != nil {
+		filter, err := newDrainFilter(*input.Job.Filter)
+		if err != nil {
+			return err
+		}
+
+		sj.Job.DrainFilter = filter
+	}
+
+	return nil
+}
+
+// ScheduleStore persists the queue of scheduled drain jobs so that it survives restarts
+type ScheduleStore interface {
+	// Load returns the previously saved scheduled jobs.  If nothing has been saved, this method
+	// returns an empty slice and no error.
+	Load() ([]ScheduledJob, error)
+
+	// Save replaces any previously saved scheduled jobs
+	Save([]ScheduledJob) error
+}
+
+// FileScheduleStore is a ScheduleStore backed by a JSON file at the given path.  The file is
+// replaced atomically on each save.
+type FileScheduleStore string
+
+func (fss FileScheduleStore) Load() ([]ScheduledJob, error) {
+	data, err := ioutil.ReadFile(string(fss))
+	if os.IsNotExist(err) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	var jobs []ScheduledJob
+	if err := json.Unmarshal(data, &jobs); err != nil {
+		return nil, err
+	}
+
+	return jobs, nil
+}
+
+func (fss FileScheduleStore) Save(jobs []ScheduledJob) error {
+	if jobs == nil {
+		jobs = []ScheduledJob{}
+	}
+
+	data, err := json.Marshal(jobs)
+	if err != nil {
+		return err
+	}
+
+	temp, err := ioutil.TempFile(filepath.Dir(string(fss)), filepath.Base(string(fss))+".")
+	if err != nil {
+		return err
+	}
+
+	defer os.Remove(temp.Name())
+	if _, err := temp.Write(data); err != nil {
+		temp.Close()
+		return err
+	}
+
+	if err := temp.Close(); err != nil {
+		return err
+	}
+
+	return os.Rename(temp.Name(), string(fss))
+}
+
+// Scheduler runs drain jobs at scheduled times through a drain Interface
+type Scheduler interface {
+	// Schedule adds a job to the queue.  The returned ScheduledJob has its ID and Next fields set.
+	Schedule(ScheduledJob) (ScheduledJob, error)
+
+	// Unschedule removes a job from the queue.  A drain already started by the job is unaffected.
+	Unschedule(id string) error
+
+	// Scheduled returns the queued jobs, ordered by their next run
+	Scheduled() []ScheduledJob
+
+	// Stop halts this scheduler.  No further jobs are started, and maintenance windows are no longer enforced.
+	Stop()
+}
+
+type SchedulerOption func(*scheduler)
+
+func WithSchedulerLogger(l log.Logger) SchedulerOption {
+	return func(s *scheduler) {
+		if l != nil {
+			s.logger = l
+		} else {
+			s.logger = logging.DefaultLogger()
+		}
+	}
+}
+
+// WithScheduleStore persists the scheduled jobs.  By default, scheduled jobs are held only in memory.
+func WithScheduleStore(store ScheduleStore) SchedulerOption {
+	return func(s *scheduler) {
+		s.store = store
+	}
+}
+
+// WithScheduleRetry sets the interval at which a job that cannot be started is retried within its maintenance window
+func WithScheduleRetry(d time.Duration) SchedulerOption {
+	return func(s *scheduler) {
+		if d > 0 {
+			s.retry = d
+		} else {
+			s.retry = DefaultScheduleRetry
+		}
+	}
+}
+
+func defaultNewTimer(d time.Duration) (<-chan time.Time, func() bool) {
+	timer := time.NewTimer(d)
+	return timer.C, timer.Stop
+}
+
+// NewScheduler constructs a Scheduler which starts jobs using the given drainer.  If a ScheduleStore is configured,
+// the previously saved jobs are loaded and resumed.
+func NewScheduler(d Interface, options ...SchedulerOption) (Scheduler, error) {
+	if d == nil {
+		panic("A drain Interface is required")
+	}
+
+	s := &scheduler{
+		logger:   logging.DefaultLogger(),
+		drainer:  d,
+		retry:    DefaultScheduleRetry,
+		now:      time.Now,
+		newTimer: defaultNewTimer,
+		jobs:     make(map[string]*ScheduledJob),
+		changed:  make(chan struct{}, 1),
+		shutdown: make(chan struct{}),
+	}
+
+	for _, f := range options {
+		f(s)
+	}
+
+	if err := s.load(); err != nil {
+		return nil, err
+	}
+
+	go s.run()
+	return s, nil
+}
+
+// scheduler is the internal implementation of Scheduler
+type scheduler struct {
+	logger   log.Logger
+	drainer  Interface
+	store    ScheduleStore
+	retry    time.Duration
+	now      func() time.Time
+	newTimer func(time.Duration) (<-chan time.Time, func() bool)
+
+	lock     sync.Mutex
+	jobs     map[string]*ScheduledJob
+	changed  chan struct{}
+	shutdown chan struct{}
+	stopOnce sync.Once
+}
+
+func (s *scheduler) load() error {
+	if s.store == nil {
+		return nil
+	}
+
+	jobs, err := s.store.Load()
+	if err != nil {
+		return err
+	}
+
+	for i := range jobs {
+		sj := jobs[i]
+		if err := sj.validate(); err != nil {
+			return err
+		}
+
+		if sj.Next.IsZero() {
+			sj.Next = sj.Start
+		}
+
+		s.jobs[sj.ID] = &sj
+	}
+
+	return nil
+}
+
+// save persists the current jobs.  This method must be called under the lock.
+func (s *scheduler) save() error {
+	if s.store == nil {
+		return nil
+	}
+
+	return s.store.Save(s.list())
+}
+
+// list returns the sorted jobs.  This method must be called under the lock.
+func (s *scheduler) list() []ScheduledJob {
+	jobs := make([]ScheduledJob, 0, len(s.jobs))
+	for _, sj := range s.jobs {
+		jobs = append(jobs, *sj)
+	}
+
+	sort.Slice(jobs, func(i, j int) bool {
+		if jobs[i].Next.Equal(jobs[j].Next) {
+			return jobs[i].ID < jobs[j].ID
+		}
+
+		return jobs[i].Next.Before(jobs[j].Next)
+	})
+
+	return jobs
+}
+
+// notify wakes up the run loop so that it recomputes its wait
+func (s *scheduler) notify() {
+	select {
+	case s.changed <- struct{}{}:
+	default:
+	}
+}
+
+func newScheduleID() string {
+	id := make([]byte, 8)
+	rand.Read(id)
+	return hex.EncodeToString(id)
+}
+
+func (s *scheduler) Schedule(sj ScheduledJob) (ScheduledJob, error) {
+	if err := sj.validate(); err != nil {
+		return ScheduledJob{}, err
+	}
+
+	if sj.recurrence == nil && !sj.End.IsZero() && !sj.End.After(s.now()) {
+		return ScheduledJob{}, ErrScheduleClosed
+	}
+
+	sj.ID = newScheduleID()
+	sj.Next = sj.Start
+	sj.retryAt = time.Time{}
+
+	defer s.lock.Unlock()
+	s.lock.Lock()
+
+	s.jobs[sj.ID] = &sj
+	if err := s.save(); err != nil {
+		delete(s.jobs, sj.ID)
+		return ScheduledJob{}, err
+	}
+
+	s.logger.Log(level.Key(), level.InfoValue(), logging.MessageKey(), "drain job scheduled", "scheduleID", sj.ID, "start", sj.Start, "end", sj.End, "recurrence", sj.Recurrence)
+	s.notify()
+	return sj, nil
+}
+
+func (s *scheduler) Unschedule(id string) error {
+	defer s.lock.Unlock()
+	s.lock.Lock()
+
+	sj, ok := s.jobs[id]
+	if !ok {
+		return ErrScheduleNotFound
+	}
+
+	delete(s.jobs, id)
+	if err := s.save(); err != nil {
+		s.jobs[id] = sj
+		return err
+	}
+
+	s.logger.Log(level.Key(), level.InfoValue(), logging.MessageKey(), "drain job unscheduled", "scheduleID", id)
+	s.notify()
+	return nil
+}
+
+func (s *scheduler) Scheduled() []ScheduledJob {
+	defer s.lock.Unlock()
+	s.lock.Lock()
+	return s.list()
+}
+
+func (s *scheduler) Stop() {
+	s.stopOnce.Do(func() {
+		close(s.shutdown)
+	})
+}
+
+// nextWait computes the time until the earliest due job
+func (s *scheduler) nextWait() (time.Duration, bool) {
+	defer s.lock.Unlock()
+	s.lock.Lock()
+
+	var earliest time.Time
+	for _, sj := range s.jobs {
+		if due := sj.due(); earliest.IsZero() || due.Before(earliest) {
+			earliest = due
+		}
+	}
+
+	if earliest.IsZero() {
+		return 0, false
+	}
+
+	wait := earliest.Sub(s.now())
+	if wait < 0 {
+		wait = 0
+	}
+
+	return wait, true
+}
+
+func (s *scheduler) run() {
+	for {
+		var (
+			wait, ok = s.nextWait()
+			timer    <-chan time.Time
+			stop     = func() bool { return true }
+		)
+
+		if ok {
+			timer, stop = s.newTimer(wait)
+		}
+
+		select {
+		case <-s.shutdown:
+			stop()
+			return
+
+		case <-s.changed:
+			stop()
+
+		case <-timer:
+			s.fire()
+		}
+	}
+}
+
+// fire runs each job that is due
+func (s *scheduler) fire() {
+	defer s.lock.Unlock()
+	s.lock.Lock()
+
+	now := s.now()
+	for id, sj := range s.jobs {
+		if sj.due().After(now) {
+			continue
+		}
+
+		if !s.runJob(sj, now) {
+			delete(s.jobs, id)
+		}
+	}
+
+	if err := s.save(); err != nil {
+		s.logger.Log(level.Key(), level.ErrorValue(), logging.MessageKey(), "unable to save scheduled drain jobs", logging.ErrorKey(), err)
+	}
+}
+
+// runJob attempts to start a due job, and returns false if the job has no further runs.  This method must
+// be called under the lock.
+func (s *scheduler) runJob(sj *ScheduledJob, now time.Time) bool {
+	var (
+		logger    = log.With(s.logger, "scheduleID", sj.ID)
+		windowEnd = sj.windowEnd()
+	)
+
+	if !windowEnd.IsZero() && !now.Before(windowEnd) {
+		logger.Log(level.Key(), level.WarnValue(), logging.MessageKey(), "maintenance window closed before the scheduled drain job could start", "next", sj.Next, "end", windowEnd)
+		return s.advance(sj, now)
+	}
+
+	done, job, err := s.drainer.Start(sj.Job)
+	if err != nil {
+		if !windowEnd.IsZero() && now.Add(s.retry).Before(windowEnd) {
+			logger.Log(level.Key(), level.WarnValue(), logging.MessageKey(), "unable to start scheduled drain job, retrying", logging.ErrorKey(), err, "retry", s.retry)
+			sj.retryAt = now.Add(s.retry)
+			return true
+		}
+
+		logger.Log(level.Key(), level.ErrorValue(), logging.MessageKey(), "unable to start scheduled drain job", logging.ErrorKey(), err)
+		return s.advance(sj, now)
+	}
+
+	logger.Log(level.Key(), level.InfoValue(), logging.MessageKey(), "scheduled drain job started", "count", job.Count, "rate", job.Rate, "tick", job.Tick, "end", windowEnd)
+	if !windowEnd.IsZero() {
+		go s.enforceWindow(logger, done, windowEnd.Sub(now))
+	}
+
+	return s.advance(sj, now)
+}
+
+// advance moves a job to its next run, returning false if there is none
+func (s *scheduler) advance(sj *ScheduledJob, now time.Time) bool {
+	sj.retryAt = time.Time{}
+	if sj.recurrence == nil {
+		return false
+	}
+
+	next := sj.recurrence.Next(sj.Next)
+	if !next.IsZero() && !next.After(now) {
+		// runs were missed, e.g. because this process was down, so skip to the next one in the future
+		next = sj.recurrence.Next(now)
+	}
+
+	if next.IsZero() {
+		return false
+	}
+
+	sj.Next = next
+	return true
+}
+
+// enforceWindow cancels a drain that is still running when its maintenance window closes
+func (s *scheduler) enforceWindow(logger log.Logger, done <-chan struct{}, remaining time.Duration) {
+	timer, stop := s.newTimer(remaining)
+	defer stop()
+
+	select {
+	case <-done:
+	case <-s.shutdown:
+	case <-timer:
+		select {
+		case <-done:
+			return
+		default:
+		}
+
+		if _, err := cancelBy(s.drainer, SchedulerRequester); err == nil {
+			logger.Log(level.Key(), level.InfoValue(), logging.MessageKey(), "maintenance window closed, scheduled drain job cancelled")
+		}
+	}
+}
@@ -0,0 +1,385 @@
+package drain
+
+import (
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+	"github.com/xmidt-org/webpa-common/device/devicegate"
+	"github.com/xmidt-org/webpa-common/logging"
+)
+
+var testScheduleEpoch = time.Date(2020, time.June, 4, 0, 0, 0, 0, time.UTC)
+
+// testClock is a settable clock that is safe for concurrent use
+type testClock struct {
+	lock    sync.Mutex
+	current time.Time
+}
+
+func newTestClock() *testClock {
+	return &testClock{current: testScheduleEpoch}
+}
+
+func (tc *testClock) now() time.Time {
+	tc.lock.Lock()
+	defer tc.lock.Unlock()
+	return tc.current
+}
+
+func (tc *testClock) set(t time.Time) {
+	tc.lock.Lock()
+	tc.current = t
+	tc.lock.Unlock()
+}
+
+// testTimers is a controllable timer factory for schedulers
+type testTimers struct {
+	lock      sync.Mutex
+	durations []time.Duration
+	timers    []chan time.Time
+}
+
+func (tt *testTimers) newTimer(d time.Duration) (<-chan time.Time, func() bool) {
+	tt.lock.Lock()
+	defer tt.lock.Unlock()
+
+	c := make(chan time.Time, 1)
+	tt.durations = append(tt.durations, d)
+	tt.timers = append(tt.timers, c)
+	return c, func() bool { return true }
+}
+
+// fire triggers the most recently created timer with the given duration
+func (tt *testTimers) fire(d time.Duration) bool {
+	tt.lock.Lock()
+	defer tt.lock.Unlock()
+
+	for i := len(tt.durations) - 1; i >= 0; i-- {
+		if tt.durations[i] == d {
+			tt.timers[i] <- time.Time{}
+			return true
+		}
+	}
+
+	return false
+}
+
+// newTestScheduler creates a scheduler whose clock and timers are controlled by the test
+func newTestScheduler(t *testing.T, d Interface, clock *testClock, options ...SchedulerOption) (*scheduler, *testTimers) {
+	timers := new(testTimers)
+	options = append(
+		[]SchedulerOption{
+			WithSchedulerLogger(logging.NewTestLogger(nil, t)),
+			func(s *scheduler) {
+				s.now = clock.now
+				s.newTimer = timers.newTimer
+			},
+		},
+		options...,
+	)
+
+	s, err := NewScheduler(d, options...)
+	require.NoError(t, err)
+	require.NotNil(t, s)
+	return s.(*scheduler), timers
+}
+
+func testSchedulerInvalid(t *testing.T) {
+	var (
+		assert = assert.New(t)
+		clock  = newTestClock()
+		now    = clock.now()
+		s, _   = newTestScheduler(t, new(mockDrainer), clock)
+	)
+
+	defer s.Stop()
+
+	_, err := s.Schedule(ScheduledJob{})
+	assert.Equal(ErrInvalidSchedule, err)
+
+	_, err = s.Schedule(ScheduledJob{Start: now, End: now})
+	assert.Equal(ErrInvalidSchedule, err)
+
+	_, err = s.Schedule(ScheduledJob{Start: now, Recurrence: "@sometimes"})
+	assert.Error(err)
+
+	_, err = s.Schedule(ScheduledJob{Start: now.Add(-2 * time.Hour), End: now.Add(-time.Hour)})
+	assert.Equal(ErrScheduleClosed, err)
+
+	assert.Empty(s.Scheduled())
+	assert.Equal(ErrScheduleNotFound, s.Unschedule("nosuch"))
+}
+
+func testSchedulerOnce(t *testing.T) {
+	var (
+		assert  = assert.New(t)
+		require = require.New(t)
+
+		clock    = newTestClock()
+		now      = clock.now()
+		d        = new(mockDrainer)
+		s, _     = newTestScheduler(t, d, clock)
+		done     = make(chan struct{})
+		expected = Job{Count: 100, Rate: 10}
+	)
+
+	defer s.Stop()
+	d.On("Start", expected).Return((<-chan struct{})(done), expected, error(nil)).Once()
+
+	later, err := s.Schedule(ScheduledJob{Job: expected, Start: now.Add(2 * time.Hour)})
+	require.NoError(err)
+	sooner, err := s.Schedule(ScheduledJob{Job: Job{Count: 1}, Start: now.Add(time.Hour)})
+	require.NoError(err)
+
+	assert.NotEmpty(later.ID)
+	assert.Equal(now.Add(2*time.Hour), later.Next)
+	assert.Equal([]ScheduledJob{sooner, later}, s.Scheduled())
+	require.NoError(s.Unschedule(sooner.ID))
+
+	// nothing is due yet
+	now = now.Add(time.Hour)
+	clock.set(now)
+	s.fire()
+	assert.Len(s.Scheduled(), 1)
+
+	now = now.Add(time.Hour)
+	clock.set(now)
+	s.fire()
+	assert.Empty(s.Scheduled())
+	d.AssertExpectations(t)
+}
+
+func testSchedulerWindow(t *testing.T) {
+	var (
+		assert  = assert.New(t)
+		require = require.New(t)
+
+		clock     = newTestClock()
+		now       = clock.now()
+		d         = new(mockDrainer)
+		s, timers = newTestScheduler(t, d, clock, WithScheduleRetry(10*time.Minute))
+		done      = make(chan struct{})
+		cancelled = make(chan struct{})
+	)
+
+	defer s.Stop()
+	d.On("Start", Job{}).Return((<-chan struct{})(nil), Job{}, ErrActive).Once()
+	d.On("Start", Job{}).Return((<-chan struct{})(done), Job{}, error(nil)).Once()
+	d.On("CancelBy", SchedulerRequester).Return((<-chan struct{})(done), error(nil)).Once().Run(func(mock.Arguments) { close(cancelled) })
+
+	_, err := s.Schedule(ScheduledJob{Start: now, End: now.Add(time.Hour)})
+	require.NoError(err)
+
+	// another drain is active, so the job is retried
+	s.fire()
+	scheduled := s.Scheduled()
+	require.Len(scheduled, 1)
+	assert.Equal(now.Add(10*time.Minute), scheduled[0].due())
+
+	now = now.Add(10 * time.Minute)
+	clock.set(now)
+	s.fire()
+	assert.Empty(s.Scheduled())
+
+	// the drain is still running when the window closes
+	for deadline := time.Now().Add(5 * time.Second); !timers.fire(50 * time.Minute); time.Sleep(time.Millisecond) {
+		require.True(time.Now().Before(deadline), "The maintenance window was not enforced")
+	}
+
+	select {
+	case <-cancelled:
+	case <-time.After(5 * time.Second):
+		assert.Fail("The drain was not cancelled at the end of its window")
+	}
+
+	d.AssertExpectations(t)
+}
+
+func testSchedulerRecurring(t *testing.T) {
+	var (
+		assert  = assert.New(t)
+		require = require.New(t)
+
+		clock = newTestClock()
+		now   = clock.now()
+		d     = new(mockDrainer)
+		s, _  = newTestScheduler(t, d, clock)
+		done  = make(chan struct{})
+	)
+
+	defer s.Stop()
+	close(done)
+	d.On("Start", Job{}).Return((<-chan struct{})(done), Job{}, error(nil)).Once()
+
+	sj, err := s.Schedule(ScheduledJob{Start: now, End: now.Add(time.Hour), Recurrence: "@daily"})
+	require.NoError(err)
+
+	s.fire()
+	scheduled := s.Scheduled()
+	require.Len(scheduled, 1)
+	assert.Equal(sj.ID, scheduled[0].ID)
+	assert.Equal(now.AddDate(0, 0, 1), scheduled[0].Next)
+
+	// the next run's window is missed, so it is skipped
+	now = now.AddDate(0, 0, 1).Add(90 * time.Minute)
+	clock.set(now)
+	s.fire()
+	scheduled = s.Scheduled()
+	require.Len(scheduled, 1)
+	assert.Equal(testScheduleEpoch.AddDate(0, 0, 2), scheduled[0].Next)
+
+	// runs missed while down are skipped as well
+	clock.set(testScheduleEpoch.AddDate(0, 0, 5).Add(time.Minute))
+	s.fire()
+	scheduled = s.Scheduled()
+	require.Len(scheduled, 1)
+	assert.Equal(testScheduleEpoch.AddDate(0, 0, 6), scheduled[0].Next)
+
+	d.AssertExpectations(t)
+}
+
+func testSchedulerRun(t *testing.T) {
+	var (
+		assert  = assert.New(t)
+		require = require.New(t)
+
+		d       = new(mockDrainer)
+		started = make(chan struct{})
+	)
+
+	d.On("Start", Job{Count: 5}).Return((<-chan struct{})(nil), Job{Count: 5}, error(nil)).Once().Run(func(mock.Arguments) { close(started) })
+
+	s, err := NewScheduler(d, WithSchedulerLogger(logging.NewTestLogger(nil, t)))
+	require.NoError(err)
+	defer s.Stop()
+
+	_, err = s.Schedule(ScheduledJob{Job: Job{Count: 5}, Start: time.Now().Add(10 * time.Millisecond)})
+	require.NoError(err)
+
+	select {
+	case <-started:
+	case <-time.After(5 * time.Second):
+		assert.Fail("The scheduled job did not start")
+	}
+
+	d.AssertExpectations(t)
+}
+
+type testScheduleStore struct {
+	saved []ScheduledJob
+	err   error
+}
+
+func (tss *testScheduleStore) Load() ([]ScheduledJob, error) {
+	return tss.saved, tss.err
+}
+
+func (tss *testScheduleStore) Save(jobs []ScheduledJob) error {
+	if tss.err == nil {
+		tss.saved = jobs
+	}
+
+	return tss.err
+}
+
+func testSchedulerStore(t *testing.T) {
+	var (
+		assert  = assert.New(t)
+		require = require.New(t)
+
+		clock = newTestClock()
+		now   = clock.now()
+		store = new(testScheduleStore)
+		s, _  = newTestScheduler(t, new(mockDrainer), clock, WithScheduleStore(store))
+	)
+
+	sj, err := s.Schedule(ScheduledJob{Start: now.Add(time.Hour), Recurrence: "@hourly"})
+	require.NoError(err)
+	assert.Equal([]ScheduledJob{sj}, store.saved)
+	s.Stop()
+
+	// a new scheduler resumes the saved jobs
+	s, _ = newTestScheduler(t, new(mockDrainer), clock, WithScheduleStore(store))
+	defer s.Stop()
+	assert.Equal([]ScheduledJob{sj}, s.Scheduled())
+
+	store.err = errors.New("expected")
+	_, err = s.Schedule(ScheduledJob{Start: now})
+	assert.Equal(store.err, err)
+	assert.Equal(store.err, s.Unschedule(sj.ID))
+	assert.Equal([]ScheduledJob{sj}, s.Scheduled())
+
+	_, err = NewScheduler(new(mockDrainer), WithScheduleStore(store))
+	assert.Equal(store.err, err)
+}
+
+func TestScheduler(t *testing.T) {
+	t.Run("Invalid", testSchedulerInvalid)
+	t.Run("Once", testSchedulerOnce)
+	t.Run("Window", testSchedulerWindow)
+	t.Run("Recurring", testSchedulerRecurring)
+	t.Run("Run", testSchedulerRun)
+	t.Run("Store", testSchedulerStore)
+}
+
+func TestFileScheduleStore(t *testing.T) {
+	var (
+		assert  = assert.New(t)
+		require = require.New(t)
+	)
+
+	dir, err := ioutil.TempDir("", "schedule")
+	require.NoError(err)
+	defer os.RemoveAll(dir)
+
+	store := FileScheduleStore(filepath.Join(dir, "schedule.json"))
+	jobs, err := store.Load()
+	assert.Empty(jobs)
+	assert.NoError(err)
+
+	filterRequest := devicegate.FilterRequest{Key: "partner-id", Values: []interface{}{"comcast"}}
+	filter, err := newDrainFilter(filterRequest)
+	require.NoError(err)
+
+	expected := []ScheduledJob{
+		{
+			ID:         "1",
+			Job:        Job{Count: 10, Rate: 5, Tick: time.Minute, DrainFilter: filter},
+			Start:      testScheduleEpoch,
+			End:        testScheduleEpoch.Add(time.Hour),
+			Recurrence: "0 0 * * *",
+			Next:       testScheduleEpoch.AddDate(0, 0, 1),
+		},
+		{
+			ID:    "2",
+			Job:   Job{Percent: 20},
+			Start: testScheduleEpoch,
+			Next:  testScheduleEpoch,
+		},
+	}
+
+	require.NoError(store.Save(expected))
+	jobs, err = store.Load()
+	require.NoError(err)
+	require.Len(jobs, 2)
+
+	expectedJSON, err := json.Marshal(expected)
+	require.NoError(err)
+	actualJSON, err := json.Marshal(jobs)
+	require.NoError(err)
+	assert.JSONEq(string(expectedJSON), string(actualJSON))
+	assert.Equal(filterRequest, jobs[0].Job.DrainFilter.GetFilterRequest())
+
+	require.NoError(ioutil.WriteFile(string(store), []byte("this is not JSON"), 0600))
+	_, err = store.Load()
+	assert.Error(err)
+}
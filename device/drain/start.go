@@ -2,10 +2,13 @@ package drain
 
 import (
 	"encoding/json"
+	"io"
 	"io/ioutil"
 	"net/http"
+	"net/url"
 	"time"
 
+	"github.com/go-kit/kit/log"
 	"github.com/go-kit/kit/log/level"
 	"github.com/gorilla/schema"
 	"github.com/xmidt-org/webpa-common/device/devicegate"
@@ -14,18 +17,28 @@ import (
 	"github.com/xmidt-org/webpa-common/xhttp/converter"
 )
 
-type Start struct {
-	Drainer Interface
-}
+// newDrainFilter produces a DrainFilter from a filter request.  A request with an expression produces a
+// devicegate.ExpressionFilter.  Otherwise, if the request does not have both a key and values, this function returns nil.
+func newDrainFilter(fr devicegate.FilterRequest) (DrainFilter, error) {
+	if fr.Expression != nil {
+		return devicegate.NewExpressionFilter(*fr.Expression)
+	}
 
-func (s *Start) ServeHTTP(response http.ResponseWriter, request *http.Request) {
-	logger := logging.GetLogger(request.Context())
-	if err := request.ParseForm(); err != nil {
-		logger.Log(level.Key(), level.ErrorValue(), logging.MessageKey(), "unable to parse form", logging.ErrorKey(), err)
-		xhttp.WriteError(response, http.StatusBadRequest, err)
-		return
+	if len(fr.Key) == 0 || len(fr.Values) == 0 {
+		return nil, nil
 	}
 
+	fg := devicegate.FilterGate{FilterStore: make(devicegate.FilterStore)}
+	fg.SetFilter(fr.Key, fr.Values)
+
+	return &drainFilter{
+		filter:        &fg,
+		filterRequest: fr,
+	}, nil
+}
+
+// decodeJob produces a Job from form values together with an optional JSON filter request in the body
+func decodeJob(logger log.Logger, values url.Values, body io.Reader) (Job, error) {
 	var (
 		decoder = schema.NewDecoder()
 		input   Job
@@ -33,39 +46,52 @@ func (s *Start) ServeHTTP(response http.ResponseWriter, request *http.Request) {
 	)
 
 	decoder.RegisterConverter(time.Duration(0), converter.Duration)
-	if err := decoder.Decode(&input, request.Form); err != nil {
+	if err := decoder.Decode(&input, values); err != nil {
 		logger.Log(level.Key(), level.ErrorValue(), logging.MessageKey(), "unable to decode request", logging.ErrorKey(), err)
-		xhttp.WriteError(response, http.StatusBadRequest, err)
-		return
+		return Job{}, err
 	}
 
-	msgBytes, e := ioutil.ReadAll(request.Body)
-	defer request.Body.Close()
-
-	if e != nil {
-		logger.Log(level.Key(), level.ErrorValue(), logging.MessageKey(), "unable to read request body", logging.ErrorKey(), e)
-		xhttp.WriteError(response, http.StatusBadRequest, e)
-		return
+	msgBytes, err := ioutil.ReadAll(body)
+	if err != nil {
+		logger.Log(level.Key(), level.ErrorValue(), logging.MessageKey(), "unable to read request body", logging.ErrorKey(), err)
+		return Job{}, err
 	}
 
 	if len(msgBytes) > 0 {
 		if err := json.Unmarshal(msgBytes, &reqBody); err != nil {
 			logger.Log(level.Key(), level.ErrorValue(), logging.MessageKey(), "unable to unmarshal request body", logging.ErrorKey(), err)
-			xhttp.WriteError(response, http.StatusBadRequest, err)
-			return
+			return Job{}, err
 		}
 
-		if len(reqBody.Key) > 0 && len(reqBody.Values) > 0 {
-			fg := devicegate.FilterGate{FilterStore: make(devicegate.FilterStore)}
-			fg.SetFilter(reqBody.Key, reqBody.Values)
-
-			input.DrainFilter = &drainFilter{
-				filter:        &fg,
-				filterRequest: reqBody,
-			}
+		if input.DrainFilter, err = newDrainFilter(reqBody); err != nil {
+			logger.Log(level.Key(), level.ErrorValue(), logging.MessageKey(), "invalid filter", logging.ErrorKey(), err)
+			return Job{}, err
 		}
 	}
 
+	return input, nil
+}
+
+type Start struct {
+	Drainer Interface
+}
+
+func (s *Start) ServeHTTP(response http.ResponseWriter, request *http.Request) {
+	logger := logging.GetLogger(request.Context())
+	if err := request.ParseForm(); err != nil {
+		logger.Log(level.Key(), level.ErrorValue(), logging.MessageKey(), "unable to parse form", logging.ErrorKey(), err)
+		xhttp.WriteError(response, http.StatusBadRequest, err)
+		return
+	}
+
+	defer request.Body.Close()
+	input, err := decodeJob(logger, request.Form, request.Body)
+	if err != nil {
+		xhttp.WriteError(response, http.StatusBadRequest, err)
+		return
+	}
+
+	input.Requester = Requester(request.Context())
 	_, output, err := s.Drainer.Start(input)
 	if err != nil {
 		logger.Log(level.Key(), level.ErrorValue(), logging.MessageKey(), "unable to start drain job", logging.ErrorKey(), err)
@@ -12,6 +12,8 @@ import (
 	"github.com/xmidt-org/webpa-common/device/devicegate"
 
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
 	"github.com/xmidt-org/webpa-common/logging"
 )
 
@@ -64,6 +66,10 @@ func testStartServeHTTPValid(t *testing.T) {
 			uri:      "/foo?count=22&rate=10&tick=20s",
 			expected: Job{Count: 22, Rate: 10, Tick: 20 * time.Second},
 		},
+		{
+			uri:      "/foo?adaptive=true&minRate=5&maxRate=50",
+			expected: Job{Adaptive: true, MinRate: 5, MaxRate: 50},
+		},
 	}
 
 	for _, record := range testData {
@@ -192,6 +198,73 @@ func testStartServeHTTPWithBody(t *testing.T) {
 
 }
 
+func testStartServeHTTPWithExpression(t *testing.T) {
+	t.Run("Valid", func(t *testing.T) {
+		var (
+			assert = assert.New(t)
+
+			d                     = new(mockDrainer)
+			done  <-chan struct{} = make(chan struct{})
+			start                 = Start{d}
+
+			expected = devicegate.Expression{
+				Op: devicegate.OpAnd,
+				Filters: []devicegate.Expression{
+					{Op: devicegate.OpGlob, Key: devicegate.DeviceIDKey, Values: []interface{}{"mac:11*"}},
+					{Op: devicegate.OpLT, Key: "trust", Values: []interface{}{1000.0}},
+				},
+			}
+
+			ctx      = logging.WithLogger(context.Background(), logging.NewTestLogger(nil, t))
+			response = httptest.NewRecorder()
+			request  = httptest.NewRequest("POST", "/foo?count=22", bytes.NewBufferString(
+				`{"expression": {"op": "and", "filters": [
+					{"op": "glob", "key": "$id", "values": ["mac:11*"]},
+					{"op": "lt", "key": "trust", "values": [1000]}
+				]}}`,
+			)).WithContext(ctx)
+		)
+
+		ef, err := devicegate.NewExpressionFilter(expected)
+		require.NoError(t, err)
+
+		d.On("Start", mock.MatchedBy(func(j Job) bool {
+			actual, ok := j.DrainFilter.(*devicegate.ExpressionFilter)
+			return j.Count == 22 && ok && assert.Equal(expected, actual.Expression())
+		})).Return(done, Job{Count: 22, DrainFilter: ef}, error(nil)).Once()
+
+		start.ServeHTTP(response, request)
+		assert.Equal(http.StatusOK, response.Code)
+		assert.JSONEq(
+			`{"count": 22, "filter": {"key": "", "expression": {"op": "and", "filters": [
+				{"op": "glob", "key": "$id", "values": ["mac:11*"]},
+				{"op": "lt", "key": "trust", "values": [1000]}
+			]}}}`,
+			response.Body.String(),
+		)
+
+		d.AssertExpectations(t)
+	})
+
+	t.Run("Invalid", func(t *testing.T) {
+		var (
+			assert = assert.New(t)
+
+			d        = new(mockDrainer)
+			start    = Start{d}
+			ctx      = logging.WithLogger(context.Background(), logging.NewTestLogger(nil, t))
+			response = httptest.NewRecorder()
+			request  = httptest.NewRequest("POST", "/foo", bytes.NewBufferString(
+				`{"expression": {"op": "regex", "key": "fw-name", "values": ["("]}}`,
+			)).WithContext(ctx)
+		)
+
+		start.ServeHTTP(response, request)
+		assert.Equal(http.StatusBadRequest, response.Code)
+		d.AssertExpectations(t)
+	})
+}
+
 func testStartServeHTTPParseFormError(t *testing.T) {
 	var (
 		assert = assert.New(t)
@@ -251,6 +324,7 @@ func TestStart(t *testing.T) {
 		t.Run("DefaultLogger", testStartServeHTTPDefaultLogger)
 		t.Run("Valid", testStartServeHTTPValid)
 		t.Run("WithBody", testStartServeHTTPWithBody)
+		t.Run("WithExpression", testStartServeHTTPWithExpression)
 		t.Run("ParseFormError", testStartServeHTTPParseFormError)
 		t.Run("InvalidQuery", testStartServeHTTPInvalidQuery)
 		t.Run("StartError", testStartServeHTTPStartError)
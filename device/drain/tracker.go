@@ -24,13 +24,19 @@ type Progress struct {
 	// Finished is the UTC system time at which the drain job finished or was canceled.
 	// If the job is running, this field will be nil.
 	Finished *time.Time `json:"finished,omitempty"`
+
+	// Rate is the current effective rate of an adaptive drain job, in devices per tick.  This field is
+	// unset for other jobs.
+	Rate int `json:"rate,omitempty"`
 }
 
 type tracker struct {
 	visited  int32
 	drained  int32
+	rate     int32
 	started  time.Time
 	finished atomic.Value
+	canceler atomic.Value
 	counter  xmetrics.Adder
 }
 
@@ -39,6 +45,7 @@ func (t *tracker) Progress() Progress {
 		Visited: int(atomic.LoadInt32(&t.visited)),
 		Drained: int(atomic.LoadInt32(&t.drained)),
 		Started: t.started,
+		Rate:    int(atomic.LoadInt32(&t.rate)),
 	}
 
 	if finished, ok := t.finished.Load().(time.Time); ok && !finished.IsZero() {
@@ -57,6 +64,19 @@ func (t *tracker) addDrained(delta int) {
 	t.counter.Add(float64(delta))
 }
 
+func (t *tracker) setRate(rate int) {
+	atomic.StoreInt32(&t.rate, int32(rate))
+}
+
+func (t *tracker) cancel(requester string) {
+	t.canceler.Store(requester)
+}
+
+func (t *tracker) cancelledBy() string {
+	requester, _ := t.canceler.Load().(string)
+	return requester
+}
+
 func (t *tracker) done(timestamp time.Time) {
 	t.finished.Store(timestamp)
 }
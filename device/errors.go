@@ -25,4 +25,6 @@ var (
 	ErrorTransactionsClosed           = errors.New("Transactions are closed for that device")
 	ErrorTransactionsAlreadyClosed    = errors.New("That Transactions is already closed")
 	ErrorDeviceFilteredOut            = errors.New("Device blocked from connecting due to filters")
+	ErrorRateLimited                  = errors.New("Too many messages have been sent to that device")
+	ErrorOfflineStoreFull             = errors.New("The offline store is full")
 )
@@ -0,0 +1,318 @@
+package device
+
+import (
+	"encoding/json"
+	"net/http"
+	"path"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/go-kit/kit/log"
+	"github.com/go-kit/kit/log/level"
+	"github.com/xmidt-org/webpa-common/logging"
+	"github.com/xmidt-org/webpa-common/xhttp"
+	"github.com/xmidt-org/wrp-go/v3"
+)
+
+const (
+	// DefaultEventStreamBufferSize is the default number of events buffered for each subscriber
+	DefaultEventStreamBufferSize = 100
+
+	// DefaultEventStreamKeepAlive is the default interval between keep-alive comments sent to
+	// subscribers using Server-Sent Events
+	DefaultEventStreamKeepAlive time.Duration = 30 * time.Second
+
+	eventStreamContentType = "text/event-stream"
+	jsonLinesContentType   = "application/x-ndjson"
+)
+
+// ParseEventType produces the EventType with the given name, as returned by EventType.String.
+// The comparison is case-insensitive.
+func ParseEventType(name string) (EventType, bool) {
+	for et := Connect; et.String() != InvalidEventString; et++ {
+		if strings.EqualFold(name, et.String()) {
+			return et, true
+		}
+	}
+
+	return 0, false
+}
+
+// streamFrame is a single encoded event queued for a subscriber
+type streamFrame struct {
+	name string
+	data []byte
+}
+
+// eventSubscriber is a single HTTP client of an EventStreamHandler
+type eventSubscriber struct {
+	types     map[EventType]bool
+	idPattern string
+	frames    chan streamFrame
+	dropped   uint64
+}
+
+// matches tests if this subscriber is interested in the given event
+func (es *eventSubscriber) matches(e *Event) bool {
+	if len(es.types) > 0 && !es.types[e.Type] {
+		return false
+	}
+
+	if len(es.idPattern) > 0 {
+		if e.Device == nil {
+			return false
+		}
+
+		matched, _ := path.Match(es.idPattern, string(e.Device.ID()))
+		return matched
+	}
+
+	return true
+}
+
+// streamedEvent is the JSON representation of an Event sent to subscribers
+type streamedEvent struct {
+	Type    string       `json:"type"`
+	ID      ID           `json:"id,omitempty"`
+	Time    time.Time    `json:"time"`
+	Message *wrp.Message `json:"message,omitempty"`
+	Error   string       `json:"error,omitempty"`
+}
+
+// EventStreamHandler publishes device events to HTTP subscribers, either as Server-Sent Events or as
+// JSON lines depending on the request's Accept header.  Its Listen method must be registered as a Listener,
+// typically via Options.Listeners.
+//
+// Subscribers may restrict the events they receive with the type query parameter, which may be repeated and
+// holds EventType names, and the id query parameter, which is a glob pattern such as "mac:112233*" matched against
+// device IDs.  Events are never allowed to block the device infrastructure:  an event that arrives when a subscriber's
+// buffer is full is dropped, and the total number of events dropped for that subscriber is reported in a
+// "dropped" event (or a JSON line with a dropped field) once the subscriber catches up.
+type EventStreamHandler struct {
+	Logger log.Logger
+
+	// BufferSize is the number of events buffered for each subscriber.  If unset, DefaultEventStreamBufferSize is used.
+	BufferSize int
+
+	// KeepAlive is the interval between keep-alive comments for Server-Sent Events subscribers.  If unset,
+	// DefaultEventStreamKeepAlive is used.
+	KeepAlive time.Duration
+
+	lock        sync.RWMutex
+	subscribers map[*eventSubscriber]bool
+
+	now func() time.Time
+}
+
+func (esh *EventStreamHandler) logger() log.Logger {
+	if esh.Logger != nil {
+		return esh.Logger
+	}
+
+	return logging.DefaultLogger()
+}
+
+func (esh *EventStreamHandler) bufferSize() int {
+	if esh.BufferSize > 0 {
+		return esh.BufferSize
+	}
+
+	return DefaultEventStreamBufferSize
+}
+
+func (esh *EventStreamHandler) keepAlive() time.Duration {
+	if esh.KeepAlive > 0 {
+		return esh.KeepAlive
+	}
+
+	return DefaultEventStreamKeepAlive
+}
+
+func (esh *EventStreamHandler) _now() time.Time {
+	if esh.now != nil {
+		return esh.now()
+	}
+
+	return time.Now()
+}
+
+// Len returns the number of current subscribers
+func (esh *EventStreamHandler) Len() int {
+	esh.lock.RLock()
+	l := len(esh.subscribers)
+	esh.lock.RUnlock()
+
+	return l
+}
+
+// Listen is a Listener which publishes events to any interested subscribers.  An event is
+// only encoded if at least one subscriber is interested in it.
+func (esh *EventStreamHandler) Listen(e *Event) {
+	defer esh.lock.RUnlock()
+	esh.lock.RLock()
+
+	var frame streamFrame
+	for s := range esh.subscribers {
+		if !s.matches(e) {
+			continue
+		}
+
+		if frame.data == nil {
+			frame = streamFrame{name: e.Type.String(), data: esh.encode(e)}
+		}
+
+		select {
+		case s.frames <- frame:
+		default:
+			atomic.AddUint64(&s.dropped, 1)
+		}
+	}
+}
+
+// encode produces the JSON form of an event.  This must happen within the listener call, as events are reused.
+func (esh *EventStreamHandler) encode(e *Event) []byte {
+	se := streamedEvent{
+		Type: e.Type.String(),
+		Time: esh._now().UTC(),
+	}
+
+	if e.Device != nil {
+		se.ID = e.Device.ID()
+	}
+
+	if message, ok := e.Message.(*wrp.Message); ok {
+		se.Message = message
+	}
+
+	if e.Error != nil {
+		se.Error = e.Error.Error()
+	}
+
+	data, err := json.Marshal(se)
+	if err != nil {
+		data, _ = json.Marshal(streamedEvent{Type: se.Type, ID: se.ID, Time: se.Time, Error: err.Error()})
+	}
+
+	return data
+}
+
+func (esh *EventStreamHandler) subscribe(s *eventSubscriber) {
+	esh.lock.Lock()
+	if esh.subscribers == nil {
+		esh.subscribers = make(map[*eventSubscriber]bool)
+	}
+
+	esh.subscribers[s] = true
+	esh.lock.Unlock()
+}
+
+func (esh *EventStreamHandler) unsubscribe(s *eventSubscriber) {
+	esh.lock.Lock()
+	delete(esh.subscribers, s)
+	esh.lock.Unlock()
+}
+
+func (esh *EventStreamHandler) ServeHTTP(response http.ResponseWriter, request *http.Request) {
+	s := &eventSubscriber{
+		idPattern: request.URL.Query().Get("id"),
+	}
+
+	if _, err := path.Match(s.idPattern, ""); err != nil {
+		xhttp.WriteErrorf(response, http.StatusBadRequest, "Invalid device ID pattern: %s", err)
+		return
+	}
+
+	for _, name := range request.URL.Query()["type"] {
+		et, ok := ParseEventType(name)
+		if !ok {
+			xhttp.WriteErrorf(response, http.StatusBadRequest, "Invalid event type: %s", name)
+			return
+		}
+
+		if s.types == nil {
+			s.types = make(map[EventType]bool)
+		}
+
+		s.types[et] = true
+	}
+
+	var (
+		sse        = strings.Contains(request.Header.Get("Accept"), eventStreamContentType)
+		flusher, _ = response.(http.Flusher)
+		reported   uint64
+	)
+
+	if sse {
+		response.Header().Set("Content-Type", eventStreamContentType)
+		response.Header().Set("Cache-Control", "no-cache")
+	} else {
+		response.Header().Set("Content-Type", jsonLinesContentType)
+	}
+
+	s.frames = make(chan streamFrame, esh.bufferSize())
+	esh.subscribe(s)
+	defer esh.unsubscribe(s)
+
+	esh.logger().Log(level.Key(), level.DebugValue(), logging.MessageKey(), "event stream subscribed", "id", s.idPattern, "sse", sse)
+	response.WriteHeader(http.StatusOK)
+	if flusher != nil {
+		flusher.Flush()
+	}
+
+	keepAlive := time.NewTicker(esh.keepAlive())
+	defer keepAlive.Stop()
+
+	write := func(name string, data []byte) bool {
+		var err error
+		if sse {
+			_, err = response.Write([]byte("event: " + name + "\ndata: " + string(data) + "\n\n"))
+		} else {
+			// the encoded event is shared across subscribers, so it must not be appended to
+			line := make([]byte, len(data)+1)
+			copy(line, data)
+			line[len(data)] = '\n'
+			_, err = response.Write(line)
+		}
+
+		if err != nil {
+			esh.logger().Log(level.Key(), level.DebugValue(), logging.MessageKey(), "event stream closed", logging.ErrorKey(), err)
+			return false
+		}
+
+		return true
+	}
+
+	for {
+		select {
+		case <-request.Context().Done():
+			return
+
+		case <-keepAlive.C:
+			if sse {
+				if _, err := response.Write([]byte(":\n\n")); err != nil {
+					return
+				}
+			}
+
+		case frame := <-s.frames:
+			if !write(frame.name, frame.data) {
+				return
+			}
+		}
+
+		// report any drops once this subscriber has drained its buffer
+		if dropped := atomic.LoadUint64(&s.dropped); dropped != reported && len(s.frames) == 0 {
+			reported = dropped
+			report, _ := json.Marshal(map[string]uint64{"dropped": dropped})
+			if !write("dropped", report) {
+				return
+			}
+		}
+
+		if flusher != nil {
+			flusher.Flush()
+		}
+	}
+}
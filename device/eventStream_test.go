@@ -0,0 +1,225 @@
+package device
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/xmidt-org/webpa-common/logging"
+	"github.com/xmidt-org/wrp-go/v3"
+)
+
+func TestParseEventType(t *testing.T) {
+	assert := assert.New(t)
+	for et := Connect; et <= InboundRateExceeded; et++ {
+		actual, ok := ParseEventType(strings.ToLower(et.String()))
+		assert.True(ok)
+		assert.Equal(et, actual)
+	}
+
+	_, ok := ParseEventType("nosuch")
+	assert.False(ok)
+}
+
+func testEventStreamHandlerBadRequest(t *testing.T) {
+	for _, rawQuery := range []string{"type=nosuch", "id=mac:[1"} {
+		var (
+			assert   = assert.New(t)
+			handler  = EventStreamHandler{Logger: logging.NewTestLogger(nil, t)}
+			response = httptest.NewRecorder()
+		)
+
+		handler.ServeHTTP(response, httptest.NewRequest("GET", "/events?"+rawQuery, nil))
+		assert.Equal(http.StatusBadRequest, response.Code, rawQuery)
+		assert.Zero(handler.Len())
+	}
+}
+
+// waitForSubscribers waits until an EventStreamHandler has the given number of subscribers
+func waitForSubscribers(t *testing.T, handler *EventStreamHandler, expected int) {
+	for deadline := time.Now().Add(5 * time.Second); handler.Len() != expected; {
+		if time.Now().After(deadline) {
+			require.Fail(t, "Subscribers did not change as expected")
+		}
+
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func testEventStreamHandlerStream(t *testing.T, accept string) {
+	var (
+		assert  = assert.New(t)
+		require = require.New(t)
+		logger  = logging.NewTestLogger(nil, t)
+		handler = &EventStreamHandler{Logger: logger}
+		server  = httptest.NewServer(handler)
+
+		matching = newDevice(deviceOptions{ID: ID("mac:112233445566"), Logger: logger})
+		other    = newDevice(deviceOptions{ID: ID("mac:665544332211"), Logger: logger})
+	)
+
+	defer server.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	request, err := http.NewRequest("GET", server.URL+"?type=Connect&type=messageFailed&id=mac:1122*", nil)
+	require.NoError(err)
+	request.Header.Set("Accept", accept)
+
+	response, err := http.DefaultClient.Do(request.WithContext(ctx))
+	require.NoError(err)
+	defer response.Body.Close()
+
+	assert.Equal(http.StatusOK, response.StatusCode)
+	waitForSubscribers(t, handler, 1)
+
+	handler.Listen(&Event{Type: Connect, Device: other})
+	handler.Listen(&Event{Type: Disconnect, Device: matching})
+	handler.Listen(&Event{Type: MessageQueued})
+	handler.Listen(&Event{Type: Connect, Device: matching})
+	handler.Listen(&Event{
+		Type:    MessageFailed,
+		Device:  matching,
+		Message: &wrp.Message{Type: wrp.SimpleEventMessageType, Destination: string(matching.ID())},
+		Error:   errors.New("expected"),
+	})
+
+	var (
+		reader = bufio.NewReader(response.Body)
+		events []streamedEvent
+	)
+
+	for len(events) < 2 {
+		line, err := reader.ReadString('\n')
+		require.NoError(err)
+		line = strings.TrimSpace(line)
+
+		if strings.HasPrefix(line, "event: ") {
+			assert.Equal(eventStreamContentType, response.Header.Get("Content-Type"))
+			continue
+		} else if strings.HasPrefix(line, "data: ") {
+			line = strings.TrimPrefix(line, "data: ")
+		} else if len(line) == 0 {
+			continue
+		} else {
+			assert.Equal(jsonLinesContentType, response.Header.Get("Content-Type"))
+		}
+
+		var event streamedEvent
+		require.NoError(json.Unmarshal([]byte(line), &event))
+		events = append(events, event)
+	}
+
+	assert.Equal("Connect", events[0].Type)
+	assert.Equal(matching.ID(), events[0].ID)
+	assert.Nil(events[0].Message)
+
+	assert.Equal("MessageFailed", events[1].Type)
+	assert.Equal("expected", events[1].Error)
+	require.NotNil(events[1].Message)
+	assert.Equal(string(matching.ID()), events[1].Message.Destination)
+
+	cancel()
+	waitForSubscribers(t, handler, 0)
+}
+
+// gatedResponseWriter blocks its first Write until released
+type gatedResponseWriter struct {
+	*httptest.ResponseRecorder
+	writing chan struct{}
+	release chan struct{}
+}
+
+func (grw *gatedResponseWriter) Write(p []byte) (int, error) {
+	if grw.writing != nil {
+		close(grw.writing)
+		grw.writing = nil
+		<-grw.release
+	}
+
+	return grw.ResponseRecorder.Write(p)
+}
+
+func testEventStreamHandlerDropped(t *testing.T) {
+	var (
+		assert  = assert.New(t)
+		logger  = logging.NewTestLogger(nil, t)
+		handler = &EventStreamHandler{Logger: logger, BufferSize: 1}
+		d       = newDevice(deviceOptions{ID: ID("mac:112233445566"), Logger: logger})
+
+		writing  = make(chan struct{})
+		response = &gatedResponseWriter{
+			ResponseRecorder: httptest.NewRecorder(),
+			writing:          writing,
+			release:          make(chan struct{}),
+		}
+
+		ctx, cancel = context.WithCancel(context.Background())
+		done        = make(chan struct{})
+	)
+
+	defer cancel()
+	go func() {
+		defer close(done)
+		handler.ServeHTTP(response, httptest.NewRequest("GET", "/events", nil).WithContext(ctx))
+	}()
+
+	waitForSubscribers(t, handler, 1)
+
+	// the first event blocks the subscriber, the second is buffered, and the rest are dropped
+	handler.Listen(&Event{Type: Connect, Device: d})
+	<-writing
+	handler.Listen(&Event{Type: MessageSent, Device: d})
+	handler.Listen(&Event{Type: MessageReceived, Device: d})
+	handler.Listen(&Event{Type: Disconnect, Device: d})
+	close(response.release)
+
+	waitForDropReport := time.After(5 * time.Second)
+	for {
+		handler.lock.RLock()
+		frames := 0
+		for s := range handler.subscribers {
+			frames = len(s.frames)
+		}
+
+		handler.lock.RUnlock()
+		if frames == 0 {
+			break
+		}
+
+		select {
+		case <-waitForDropReport:
+			assert.Fail("The subscriber did not drain its buffer")
+			return
+		case <-time.After(time.Millisecond):
+		}
+	}
+
+	// give the subscriber a chance to write the drop report, then shut it down
+	time.Sleep(50 * time.Millisecond)
+	cancel()
+	<-done
+
+	lines := strings.Split(strings.TrimSpace(response.Body.String()), "\n")
+	if assert.Len(lines, 3) {
+		assert.Contains(lines[0], `"type":"Connect"`)
+		assert.Contains(lines[1], `"type":"MessageSent"`)
+		assert.JSONEq(`{"dropped": 2}`, lines[2])
+	}
+}
+
+func TestEventStreamHandler(t *testing.T) {
+	t.Run("BadRequest", testEventStreamHandlerBadRequest)
+	t.Run("JSONLines", func(t *testing.T) { testEventStreamHandlerStream(t, "application/json") })
+	t.Run("ServerSentEvents", func(t *testing.T) { testEventStreamHandlerStream(t, eventStreamContentType) })
+	t.Run("Dropped", testEventStreamHandlerDropped)
+}
@@ -3,8 +3,10 @@ package device
 import (
 	"bytes"
 	"context"
+	"encoding/json"
 	"fmt"
 	"net/http"
+	"strconv"
 	"sync"
 	"time"
 
@@ -180,6 +182,8 @@ func (mh *MessageHandler) ServeHTTP(httpResponse http.ResponseWriter, httpReques
 			code = http.StatusBadRequest
 		case ErrorTransactionAlreadyRegistered:
 			code = http.StatusBadRequest
+		case ErrorRateLimited:
+			code = http.StatusTooManyRequests
 		}
 
 		mh.logger().Log(level.Key(), level.ErrorValue(), logging.MessageKey(), "Could not process device request", logging.ErrorKey(), err, "code", code)
@@ -201,6 +205,91 @@ func (mh *MessageHandler) ServeHTTP(httpResponse http.ResponseWriter, httpReques
 	// they do not expect responses.
 }
 
+// MulticastHandler is a configurable http.Handler which sends a single inbound WRP message to a set
+// of devices.  The message is decoded from the request body exactly as with MessageHandler, while the
+// target devices are described by URL parameters as documented by ParseMulticastTarget.  The optional
+// concurrency parameter limits how many devices are sent the message at once.  The response is the JSON
+// form of the MulticastResult.
+type MulticastHandler struct {
+	// Logger is the sink for logging output.  If not set, logging will be sent to a NOP logger
+	Logger log.Logger
+
+	// Multicaster delivers messages to the targeted devices.  This field is required, and is
+	// typically a Manager.
+	Multicaster Multicaster
+
+	// MaxConcurrency caps the concurrency a request may ask for.  If unset, DefaultMulticastConcurrency is used.
+	MaxConcurrency int
+}
+
+func (mh *MulticastHandler) logger() log.Logger {
+	if mh.Logger != nil {
+		return mh.Logger
+	}
+
+	return logging.DefaultLogger()
+}
+
+func (mh *MulticastHandler) maxConcurrency() int {
+	if mh.MaxConcurrency > 0 {
+		return mh.MaxConcurrency
+	}
+
+	return DefaultMulticastConcurrency
+}
+
+func (mh *MulticastHandler) ServeHTTP(httpResponse http.ResponseWriter, httpRequest *http.Request) {
+	target, err := ParseMulticastTarget(httpRequest.URL.Query())
+	if err != nil {
+		xhttp.WriteErrorf(httpResponse, http.StatusBadRequest, "Invalid multicast target: %s", err)
+		return
+	}
+
+	concurrency := mh.maxConcurrency()
+	if v := httpRequest.URL.Query().Get("concurrency"); len(v) > 0 {
+		requested, err := strconv.Atoi(v)
+		if err != nil || requested < 1 {
+			xhttp.WriteErrorf(httpResponse, http.StatusBadRequest, "Invalid concurrency: %s", v)
+			return
+		}
+
+		if requested < concurrency {
+			concurrency = requested
+		}
+	}
+
+	format, err := wrp.FormatFromContentType(httpRequest.Header.Get("Content-Type"), wrp.Msgpack)
+	if err != nil {
+		xhttp.WriteErrorf(httpResponse, http.StatusBadRequest, "Unable to decode request: %s", err)
+		return
+	}
+
+	deviceRequest, err := DecodeRequest(httpRequest.Body, format)
+	if err != nil {
+		mh.logger().Log(level.Key(), level.ErrorValue(), logging.MessageKey(), "Unable to decode request", logging.ErrorKey(), err)
+		xhttp.WriteErrorf(httpResponse, http.StatusBadRequest, "Unable to decode request: %s", err)
+		return
+	}
+
+	result, err := mh.Multicaster.Multicast(MulticastRequest{
+		Request:     deviceRequest.WithContext(httpRequest.Context()),
+		Target:      target,
+		Concurrency: concurrency,
+	})
+
+	if err != nil {
+		mh.logger().Log(level.Key(), level.ErrorValue(), logging.MessageKey(), "Could not multicast device request", logging.ErrorKey(), err)
+		xhttp.WriteErrorf(httpResponse, http.StatusBadRequest, "Could not multicast device request: %s", err)
+		return
+	}
+
+	mh.logger().Log(level.Key(), level.DebugValue(), logging.MessageKey(), "Multicast device request", "succeeded", result.Succeeded, "failed", result.Failed)
+	httpResponse.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(httpResponse).Encode(result); err != nil {
+		mh.logger().Log(level.Key(), level.ErrorValue(), logging.MessageKey(), "Error while writing multicast result", logging.ErrorKey(), err)
+	}
+}
+
 // ConnectHandler is used to initiate a concurrent connection between a Talaria and a device by upgrading a http connection to a websocket
 type ConnectHandler struct {
 	Logger         log.Logger
@@ -308,6 +397,73 @@ func (lh *ListHandler) ServeHTTP(response http.ResponseWriter, request *http.Req
 	}
 }
 
+// NextCursorHeader is the HTTP response header which carries the cursor for the next page of query results
+const NextCursorHeader = "X-Xmidt-Next-Cursor"
+
+// QueryHandler is an http.Handler which returns the devices matching a query, described by URL
+// parameters as documented by ParseQuery.  Matching devices are streamed as JSON lines, one device per
+// line, and the cursor for the next page, if any, is returned in the NextCursorHeader.  If the Registry
+// implements Querier, it executes the queries.  Otherwise, RunQuery is used.
+type QueryHandler struct {
+	Logger   log.Logger
+	Registry Registry
+
+	// MaxLimit caps the number of devices returned by any one request.  If unset, DefaultQueryLimit is used.
+	MaxLimit int
+}
+
+func (qh *QueryHandler) maxLimit() int {
+	if qh.MaxLimit > 0 {
+		return qh.MaxLimit
+	}
+
+	return DefaultQueryLimit
+}
+
+func (qh *QueryHandler) ServeHTTP(response http.ResponseWriter, request *http.Request) {
+	qh.Logger.Log(level.Key(), level.DebugValue(), "handler", "QueryHandler", logging.MessageKey(), "ServeHTTP")
+	q, err := ParseQuery(request.URL.Query())
+	if err != nil {
+		xhttp.WriteErrorf(response, http.StatusBadRequest, "Invalid query: %s", err)
+		return
+	}
+
+	if q.Limit <= 0 || q.Limit > qh.maxLimit() {
+		q.Limit = qh.maxLimit()
+	}
+
+	var result QueryResult
+	if querier, ok := qh.Registry.(Querier); ok {
+		result, err = querier.Query(q)
+	} else {
+		result, err = RunQuery(qh.Registry, q, nil)
+	}
+
+	if err != nil {
+		xhttp.WriteErrorf(response, http.StatusBadRequest, "Invalid query: %s", err)
+		return
+	}
+
+	response.Header().Set("Content-Type", "application/x-ndjson")
+	if len(result.NextCursor) > 0 {
+		response.Header().Set(NextCursorHeader, result.NextCursor)
+	}
+
+	response.WriteHeader(http.StatusOK)
+	for _, d := range result.Devices {
+		data, err := d.MarshalJSON()
+		if err != nil {
+			data, _ = json.Marshal(map[string]string{"id": string(d.ID()), "error": err.Error()})
+		}
+
+		data = append(data, '\n')
+		if _, err := response.Write(data); err != nil {
+			qh.Logger.Log(level.Key(), level.ErrorValue(), logging.MessageKey(), "unable to write query results", logging.ErrorKey(), err)
+			return
+		}
+	}
+}
+
 // StatHandler is an http.Handler that returns device statistics.  The device name is specified
 // as a gorilla path variable.
 type StatHandler struct {
@@ -8,6 +8,7 @@ import (
 	"io/ioutil"
 	"net/http"
 	"net/http/httptest"
+	"strings"
 	"testing"
 	"time"
 
@@ -512,6 +513,7 @@ func TestMessageHandler(t *testing.T) {
 			testMessageHandlerServeHTTPRouteError(t, ErrorNonUniqueID, http.StatusBadRequest)
 			testMessageHandlerServeHTTPRouteError(t, ErrorInvalidTransactionKey, http.StatusBadRequest)
 			testMessageHandlerServeHTTPRouteError(t, ErrorTransactionAlreadyRegistered, http.StatusBadRequest)
+			testMessageHandlerServeHTTPRouteError(t, ErrorRateLimited, http.StatusTooManyRequests)
 			testMessageHandlerServeHTTPRouteError(t, errors.New("random error"), http.StatusGatewayTimeout)
 		})
 
@@ -531,6 +533,75 @@ func TestMessageHandler(t *testing.T) {
 	})
 }
 
+func testMulticastHandlerServeHTTP(t *testing.T) {
+	var (
+		assert  = assert.New(t)
+		require = require.New(t)
+		router  = new(mockRouter)
+
+		handler = MulticastHandler{
+			Logger:         logging.NewTestLogger(nil, t),
+			Multicaster:    router,
+			MaxConcurrency: 5,
+		}
+
+		message = wrp.Message{Type: wrp.SimpleEventMessageType, Source: "test", Destination: "mac:*/config"}
+		body    bytes.Buffer
+	)
+
+	require.NoError(wrp.NewEncoder(&body, wrp.JSON).Encode(&message))
+	router.On("Multicast", mock.MatchedBy(func(mr MulticastRequest) bool {
+		return mr.Concurrency == 2 &&
+			mr.Target.IDPrefix == "mac:11" &&
+			mr.Request.Message.(*wrp.Message).Destination == message.Destination
+	})).Return(
+		MulticastResult{
+			Results:   []MulticastDeviceResult{{ID: ID("mac:112233445566")}, {ID: ID("mac:110000000000"), Err: ErrorDeviceBusy}},
+			Succeeded: 1,
+			Failed:    1,
+		},
+		error(nil),
+	).Once()
+
+	request := httptest.NewRequest("POST", "/multicast?idPrefix=mac:11&concurrency=2", &body)
+	request.Header.Set("Content-Type", wrp.JSON.ContentType())
+	response := httptest.NewRecorder()
+	handler.ServeHTTP(response, request)
+
+	assert.Equal(http.StatusOK, response.Code)
+	assert.JSONEq(
+		`{"results": [{"id": "mac:112233445566"}, {"id": "mac:110000000000", "error": "That device is busy"}], "succeeded": 1, "failed": 1}`,
+		response.Body.String(),
+	)
+
+	router.AssertExpectations(t)
+}
+
+func testMulticastHandlerBadRequest(t *testing.T, target string, body string) {
+	var (
+		assert  = assert.New(t)
+		router  = new(mockRouter)
+		handler = MulticastHandler{Multicaster: router}
+
+		request  = httptest.NewRequest("POST", target, strings.NewReader(body))
+		response = httptest.NewRecorder()
+	)
+
+	request.Header.Set("Content-Type", wrp.JSON.ContentType())
+	handler.ServeHTTP(response, request)
+	assert.Equal(http.StatusBadRequest, response.Code)
+	router.AssertExpectations(t)
+}
+
+func TestMulticastHandler(t *testing.T) {
+	t.Run("ServeHTTP", testMulticastHandlerServeHTTP)
+	t.Run("NoTarget", func(t *testing.T) { testMulticastHandlerBadRequest(t, "/multicast", `{"msg_type": 4}`) })
+	t.Run("InvalidConcurrency", func(t *testing.T) {
+		testMulticastHandlerBadRequest(t, "/multicast?all=true&concurrency=0", `{"msg_type": 4}`)
+	})
+	t.Run("DecodeError", func(t *testing.T) { testMulticastHandlerBadRequest(t, "/multicast?all=true", `this is not JSON`) })
+}
+
 func testConnectHandlerLogger(t *testing.T) {
 	var (
 		assert = assert.New(t)
@@ -715,6 +786,115 @@ func TestListHandler(t *testing.T) {
 	t.Run("ServeHTTP", testListHandlerServeHTTP)
 }
 
+func testQueryHandlerServeHTTP(t *testing.T) {
+	var (
+		assert   = assert.New(t)
+		require  = require.New(t)
+		registry = newTestQueryRegistry(t)
+
+		handler = QueryHandler{
+			Logger:   logging.NewTestLogger(nil, t),
+			Registry: registry,
+			MaxLimit: 3,
+		}
+
+		request  = httptest.NewRequest("GET", "/devices?metadata.partner-id=even&sort=bytesSent&order=desc&limit=100", nil)
+		response = httptest.NewRecorder()
+	)
+
+	handler.ServeHTTP(response, request)
+	assert.Equal(http.StatusOK, response.Code)
+	assert.Equal("application/x-ndjson", response.HeaderMap.Get("Content-Type"))
+	cursor := response.HeaderMap.Get(NextCursorHeader)
+	assert.NotEmpty(cursor)
+
+	lines := strings.Split(strings.TrimSuffix(response.Body.String(), "\n"), "\n")
+	require.Len(lines, 3)
+	for i, expected := range []ID{IntToMAC(8), IntToMAC(6), IntToMAC(4)} {
+		var line map[string]interface{}
+		require.NoError(json.Unmarshal([]byte(lines[i]), &line))
+		assert.Equal(string(expected), line["id"])
+	}
+
+	request = httptest.NewRequest("GET", "/devices?metadata.partner-id=even&sort=bytesSent&order=desc&cursor="+cursor, nil)
+	response = httptest.NewRecorder()
+	handler.ServeHTTP(response, request)
+	assert.Equal(http.StatusOK, response.Code)
+	assert.Empty(response.HeaderMap.Get(NextCursorHeader))
+	assert.Equal(2, strings.Count(response.Body.String(), "\n"))
+}
+
+func testQueryHandlerNotQuerier(t *testing.T) {
+	var (
+		assert = assert.New(t)
+
+		// hide the registry's Query method, so that the handler falls back to RunQuery
+		handler = QueryHandler{
+			Logger:   logging.NewTestLogger(nil, t),
+			Registry: struct{ Registry }{newTestQueryRegistry(t)},
+		}
+
+		request  = httptest.NewRequest("GET", "/devices?metadata.partner-id=odd", nil)
+		response = httptest.NewRecorder()
+	)
+
+	handler.ServeHTTP(response, request)
+	assert.Equal(http.StatusOK, response.Code)
+	assert.Equal(5, strings.Count(response.Body.String(), "\n"))
+}
+
+func testQueryHandlerMarshalError(t *testing.T) {
+	var (
+		assert  = assert.New(t)
+		require = require.New(t)
+		d       = new(MockDevice)
+
+		handler = QueryHandler{
+			Logger:   logging.NewTestLogger(nil, t),
+			Registry: testQueryRegistry{d},
+		}
+
+		request  = httptest.NewRequest("GET", "/devices", nil)
+		response = httptest.NewRecorder()
+	)
+
+	d.On("ID").Return(ID(`mac:"112233445566"`))
+	d.On("Statistics").Return(NewStatistics(nil, time.Now()))
+	d.On("MarshalJSON").Return([]byte(nil), errors.New(`unable to "marshal"`))
+
+	handler.ServeHTTP(response, request)
+	assert.Equal(http.StatusOK, response.Code)
+
+	var line map[string]string
+	require.NoError(json.Unmarshal(response.Body.Bytes(), &line))
+	assert.Equal(map[string]string{"id": `mac:"112233445566"`, "error": `unable to "marshal"`}, line)
+	d.AssertExpectations(t)
+}
+
+func testQueryHandlerBadRequest(t *testing.T, rawQuery string) {
+	var (
+		assert  = assert.New(t)
+		handler = QueryHandler{
+			Logger:   logging.NewTestLogger(nil, t),
+			Registry: newTestQueryRegistry(t),
+		}
+
+		request  = httptest.NewRequest("GET", "/devices?"+rawQuery, nil)
+		response = httptest.NewRecorder()
+	)
+
+	handler.ServeHTTP(response, request)
+	assert.Equal(http.StatusBadRequest, response.Code)
+}
+
+func TestQueryHandler(t *testing.T) {
+	t.Run("ServeHTTP", testQueryHandlerServeHTTP)
+	t.Run("NotQuerier", testQueryHandlerNotQuerier)
+	t.Run("MarshalError", testQueryHandlerMarshalError)
+	t.Run("InvalidQuery", func(t *testing.T) { testQueryHandlerBadRequest(t, "sort=nosuch") })
+	t.Run("InvalidCursor", func(t *testing.T) { testQueryHandlerBadRequest(t, "cursor=nosuch") })
+}
+
 func testStatHandlerNoPathVariables(t *testing.T) {
 	var (
 		assert   = assert.New(t)
@@ -0,0 +1,77 @@
+package device
+
+import (
+	"github.com/xmidt-org/wrp-go/v3"
+)
+
+// Lane identifies one of the outbound priority queues for a device.  The write pump
+// for a device always drains higher priority lanes before lower priority ones.
+type Lane uint8
+
+const (
+	// AutoLane indicates that the lane for a request should be chosen based on the type
+	// of its WRP message.  This is the zero value, and is the default for requests.
+	AutoLane Lane = iota
+
+	// RequestResponseLane is the highest priority lane.  Latency-sensitive request/response
+	// and CRUD messages are sent through this lane.
+	RequestResponseLane
+
+	// EventLane is the lane for events and any other message which is not request/response.
+	EventLane
+
+	// BulkLane is the lowest priority lane.  Messages are only sent through this lane when
+	// explicitly requested via Request.Lane.
+	BulkLane
+
+	// laneCount is the number of actual lanes, which doesn't include AutoLane
+	laneCount = int(BulkLane)
+
+	InvalidLaneString string = "!!INVALID LANE!!"
+)
+
+// Lanes is the set of actual lanes in priority order, highest priority first
+var Lanes = [laneCount]Lane{RequestResponseLane, EventLane, BulkLane}
+
+// LanePender is implemented by devices that report the depth of each of their outbound lanes.
+// Every device created by a Manager implements this interface, so callers can type assert an
+// Interface to obtain lane depths.
+type LanePender interface {
+	// LanePending returns the count of pending messages in the given outbound lane
+	LanePending(Lane) int
+}
+
+func (l Lane) String() string {
+	switch l {
+	case AutoLane:
+		return "auto"
+	case RequestResponseLane:
+		return "requestResponse"
+	case EventLane:
+		return "event"
+	case BulkLane:
+		return "bulk"
+	default:
+		return InvalidLaneString
+	}
+}
+
+// index returns the zero-based position of this lane within Lanes.  AutoLane and
+// invalid lanes are treated as EventLane.
+func (l Lane) index() int {
+	if l < RequestResponseLane || l > BulkLane {
+		return int(EventLane) - 1
+	}
+
+	return int(l) - 1
+}
+
+// laneOf chooses the lane for a WRP message type
+func laneOf(t wrp.MessageType) Lane {
+	switch t {
+	case wrp.SimpleRequestResponseMessageType, wrp.CreateMessageType, wrp.RetrieveMessageType, wrp.UpdateMessageType, wrp.DeleteMessageType:
+		return RequestResponseLane
+	default:
+		return EventLane
+	}
+}
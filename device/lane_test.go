@@ -0,0 +1,99 @@
+package device
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/xmidt-org/webpa-common/logging"
+	"github.com/xmidt-org/wrp-go/v3"
+)
+
+func testLaneString(t *testing.T) {
+	var (
+		assert = assert.New(t)
+		values = make(map[string]bool)
+	)
+
+	for _, l := range append([]Lane{AutoLane}, Lanes[:]...) {
+		value := l.String()
+		assert.NotEqual(InvalidLaneString, value)
+		assert.NotContains(values, value)
+		values[value] = true
+	}
+
+	assert.Equal(InvalidLaneString, Lane(255).String())
+}
+
+func testLaneIndex(t *testing.T) {
+	assert := assert.New(t)
+	for i, l := range Lanes {
+		assert.Equal(i, l.index())
+	}
+
+	assert.Equal(EventLane.index(), AutoLane.index())
+	assert.Equal(EventLane.index(), Lane(255).index())
+}
+
+func testLaneRequest(t *testing.T) {
+	testData := []struct {
+		request  Request
+		expected Lane
+	}{
+		{Request{}, EventLane},
+		{Request{Message: &wrp.Message{Type: wrp.SimpleEventMessageType}}, EventLane},
+		{Request{Message: &wrp.Message{Type: wrp.SimpleRequestResponseMessageType}}, RequestResponseLane},
+		{Request{Message: &wrp.Message{Type: wrp.RetrieveMessageType}}, RequestResponseLane},
+		{Request{Message: &wrp.Message{Type: wrp.ServiceAliveMessageType}}, EventLane},
+		{Request{Message: &wrp.Message{Type: wrp.SimpleEventMessageType}, Lane: BulkLane}, BulkLane},
+		{Request{Message: &wrp.Message{Type: wrp.SimpleRequestResponseMessageType}, Lane: BulkLane}, BulkLane},
+	}
+
+	for i, record := range testData {
+		assert.Equal(t, record.expected, record.request.lane(), "record %d", i)
+	}
+}
+
+func testLanePriority(t *testing.T) {
+	var (
+		assert = assert.New(t)
+		d      = newDevice(deviceOptions{
+			ID:        ID("test"),
+			QueueSize: 5,
+			LaneSizes: [laneCount]int{0, 0, 1},
+			Logger:    logging.NewTestLogger(nil, t),
+		})
+	)
+
+	assert.Equal(5, cap(d.lanes[RequestResponseLane.index()]))
+	assert.Equal(5, cap(d.lanes[EventLane.index()]))
+	assert.Equal(1, cap(d.lanes[BulkLane.index()]))
+	assert.Nil(d.next())
+
+	for _, l := range []Lane{BulkLane, EventLane, RequestResponseLane, EventLane} {
+		d.lanes[l.index()] <- &envelope{request: &Request{Lane: l}}
+	}
+
+	var lp LanePender = d
+	assert.Equal(4, d.Pending())
+	assert.Equal(1, lp.LanePending(RequestResponseLane))
+	assert.Equal(2, lp.LanePending(EventLane))
+	assert.Equal(1, lp.LanePending(BulkLane))
+	assert.Equal(map[string]int{"requestResponse": 1, "event": 2, "bulk": 1}, d.laneDepths())
+
+	for _, expected := range []Lane{RequestResponseLane, EventLane, EventLane, BulkLane} {
+		e := d.next()
+		if assert.NotNil(e) {
+			assert.Equal(expected, e.request.Lane)
+		}
+	}
+
+	assert.Nil(d.next())
+	assert.Zero(d.Pending())
+}
+
+func TestLane(t *testing.T) {
+	t.Run("String", testLaneString)
+	t.Run("Index", testLaneIndex)
+	t.Run("Request", testLaneRequest)
+	t.Run("Priority", testLanePriority)
+}
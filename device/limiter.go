@@ -0,0 +1,151 @@
+package device
+
+import (
+	"math"
+	"sync"
+	"time"
+)
+
+// RateLimitPolicy describes what happens to a message that exceeds a device's outbound rate limit
+type RateLimitPolicy string
+
+const (
+	// RateLimitReject fails any message that exceeds the rate limit with ErrorRateLimited.
+	// This is the default policy.
+	RateLimitReject RateLimitPolicy = "reject"
+
+	// RateLimitDelay holds the caller until the message can be sent within the rate limit,
+	// subject to the maximum delay and the request's context.
+	RateLimitDelay RateLimitPolicy = "delay"
+
+	// RateLimitQueue accepts messages that do not expect a response immediately, sending them
+	// in the background once the rate limit allows.  Transactional messages are delayed as
+	// with RateLimitDelay.
+	RateLimitQueue RateLimitPolicy = "queue"
+
+	// RateLimitDrop discards any inbound message that exceeds the rate limit.  This is the
+	// default policy for inbound limits.
+	RateLimitDrop RateLimitPolicy = "drop"
+
+	// RateLimitLog processes inbound messages that exceed the rate limit normally, but logs and
+	// reports the violation.
+	RateLimitLog RateLimitPolicy = "log"
+
+	// RateLimitDisconnect disconnects any device which exceeds its inbound rate limit.
+	RateLimitDisconnect RateLimitPolicy = "disconnect"
+)
+
+// DefaultRateLimitMaxDelay is the default longest time a message is held waiting on a rate limit
+const DefaultRateLimitMaxDelay time.Duration = 5 * time.Second
+
+// RateLimit describes a token bucket
+type RateLimit struct {
+	// Rate is the sustained number of messages allowed per second.  If nonpositive,
+	// messages are not limited.
+	Rate float64
+
+	// Burst is the maximum number of messages allowed at once.  If nonpositive, the
+	// rate rounded up to the next whole number is used.
+	Burst int
+}
+
+// newTokenBucket produces a token bucket for this limit.  If this limit is unlimited,
+// this method returns nil.
+func (rl RateLimit) newTokenBucket(now func() time.Time) *tokenBucket {
+	if rl.Rate <= 0.0 {
+		return nil
+	}
+
+	burst := float64(rl.Burst)
+	if burst < 1.0 {
+		burst = math.Ceil(rl.Rate)
+	}
+
+	if now == nil {
+		now = time.Now
+	}
+
+	return &tokenBucket{
+		rate:   rl.Rate,
+		burst:  burst,
+		tokens: burst,
+		last:   now(),
+		now:    now,
+	}
+}
+
+// tokenBucket is a simple token bucket limiter.  Tokens may be reserved ahead of time,
+// allowing callers to wait for a bounded period for a token to become available.
+type tokenBucket struct {
+	lock   sync.Mutex
+	rate   float64
+	burst  float64
+	tokens float64
+	last   time.Time
+	now    func() time.Time
+}
+
+// reserve attempts to take a token from this bucket.  If a token would be available within
+// maxDelay, it is taken and the delay until it is available is returned along with true.
+// Otherwise, no token is taken and this method returns false.
+func (tb *tokenBucket) reserve(maxDelay time.Duration) (time.Duration, bool) {
+	return tb.reserveN(1.0, maxDelay)
+}
+
+// peekN tests if n tokens are available right now, without taking them.  Since a bucket never
+// holds more than its burst, a request for more than the burst is allowed whenever the bucket is full.
+func (tb *tokenBucket) peekN(n float64) bool {
+	defer tb.lock.Unlock()
+	tb.lock.Lock()
+
+	tb.refill()
+	return tb.tokens >= math.Min(n, tb.burst)
+}
+
+// takeN unconditionally takes n tokens.  Taking more tokens than are available leaves this bucket
+// in debt, which must be repaid at the bucket's rate before more tokens are available.
+func (tb *tokenBucket) takeN(n float64) {
+	tb.lock.Lock()
+	tb.refill()
+	tb.tokens -= n
+	tb.lock.Unlock()
+}
+
+// refill adds the tokens accumulated since the last refill.  This method must be called under the lock.
+func (tb *tokenBucket) refill() {
+	now := tb.now()
+	if elapsed := now.Sub(tb.last).Seconds(); elapsed > 0.0 {
+		tb.tokens = math.Min(tb.burst, tb.tokens+elapsed*tb.rate)
+		tb.last = now
+	}
+}
+
+// reserveN is the general form of reserve, taking n tokens at once
+func (tb *tokenBucket) reserveN(n float64, maxDelay time.Duration) (time.Duration, bool) {
+	defer tb.lock.Unlock()
+	tb.lock.Lock()
+
+	tb.refill()
+	var (
+		remaining = tb.tokens - n
+		delay     time.Duration
+	)
+
+	if remaining < 0.0 {
+		delay = time.Duration(-remaining / tb.rate * float64(time.Second))
+	}
+
+	if delay > maxDelay {
+		return delay, false
+	}
+
+	tb.tokens = remaining
+	return delay, true
+}
+
+// release returns a previously reserved token that was never used
+func (tb *tokenBucket) release() {
+	tb.lock.Lock()
+	tb.tokens = math.Min(tb.burst, tb.tokens+1.0)
+	tb.lock.Unlock()
+}
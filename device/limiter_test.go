@@ -0,0 +1,102 @@
+package device
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func testRateLimitUnlimited(t *testing.T) {
+	assert := assert.New(t)
+	assert.Nil(RateLimit{}.newTokenBucket(nil))
+	assert.Nil(RateLimit{Rate: -1.0, Burst: 10}.newTokenBucket(nil))
+}
+
+func testRateLimitDefaultBurst(t *testing.T) {
+	var (
+		assert  = assert.New(t)
+		require = require.New(t)
+		tb      = RateLimit{Rate: 2.5}.newTokenBucket(nil)
+	)
+
+	require.NotNil(tb)
+	assert.Equal(3.0, tb.burst)
+	assert.Equal(3.0, tb.tokens)
+}
+
+func testTokenBucketReserve(t *testing.T) {
+	var (
+		assert  = assert.New(t)
+		require = require.New(t)
+		current = time.Now()
+		tb      = RateLimit{Rate: 2.0, Burst: 2}.newTokenBucket(func() time.Time { return current })
+	)
+
+	require.NotNil(tb)
+	for i := 0; i < 2; i++ {
+		delay, ok := tb.reserve(0)
+		assert.True(ok)
+		assert.Zero(delay)
+	}
+
+	delay, ok := tb.reserve(0)
+	assert.False(ok)
+	assert.Equal(500*time.Millisecond, delay)
+
+	delay, ok = tb.reserve(time.Second)
+	assert.True(ok)
+	assert.Equal(500*time.Millisecond, delay)
+
+	delay, ok = tb.reserve(time.Second)
+	assert.True(ok)
+	assert.Equal(time.Second, delay)
+
+	tb.release()
+	delay, ok = tb.reserve(time.Second)
+	assert.True(ok)
+	assert.Equal(time.Second, delay)
+
+	current = current.Add(time.Hour)
+	delay, ok = tb.reserve(0)
+	assert.True(ok)
+	assert.Zero(delay)
+	assert.Equal(1.0, tb.tokens, "tokens should never exceed the burst")
+}
+
+func testTokenBucketPeekTake(t *testing.T) {
+	var (
+		assert  = assert.New(t)
+		current = time.Now()
+		tb      = RateLimit{Rate: 100.0, Burst: 250}.newTokenBucket(func() time.Time { return current })
+	)
+
+	assert.True(tb.peekN(200))
+	tb.takeN(200)
+	assert.False(tb.peekN(51))
+	assert.True(tb.peekN(50))
+	tb.takeN(50)
+	assert.False(tb.peekN(1))
+
+	current = current.Add(500 * time.Millisecond)
+	assert.True(tb.peekN(50))
+	assert.False(tb.peekN(251))
+
+	current = current.Add(2 * time.Second)
+	assert.True(tb.peekN(1000), "a full bucket should allow more than its burst")
+	tb.takeN(1000)
+	assert.Equal(-750.0, tb.tokens, "taking more than the burst should leave the bucket in debt")
+
+	current = current.Add(7 * time.Second)
+	assert.False(tb.peekN(1))
+	current = current.Add(time.Second)
+	assert.True(tb.peekN(50))
+}
+
+func TestRateLimit(t *testing.T) {
+	t.Run("Unlimited", testRateLimitUnlimited)
+	t.Run("DefaultBurst", testRateLimitDefaultBurst)
+	t.Run("Reserve", testTokenBucketReserve)
+	t.Run("PeekTake", testTokenBucketPeekTake)
+}
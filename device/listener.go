@@ -36,6 +36,22 @@ const (
 	// was no waiting transaction
 	TransactionBroken
 
+	// MessageQueued indicates that a message addressed to a device that was not connected has been
+	// placed into the configured OfflineStore.  The Device field is nil if the device was not known at all.
+	MessageQueued
+
+	// MessageExpired indicates that a message held in the OfflineStore expired or was evicted before it
+	// could be delivered.  The Device field is nil unless the expiry was detected as the device connected.
+	MessageExpired
+
+	// MessageFlushed indicates that a message held in the OfflineStore has been delivered to a device
+	// after that device connected.
+	MessageFlushed
+
+	// InboundRateExceeded indicates that a device sent a message which exceeded its inbound message
+	// or byte rate limit.  The Contents field holds the raw frame sent by the device.
+	InboundRateExceeded
+
 	InvalidEventString string = "!!INVALID DEVICE EVENT TYPE!!"
 )
 
@@ -60,6 +76,14 @@ func (et EventType) String() string {
 		return "TransactionComplete"
 	case TransactionBroken:
 		return "TransactionBroken"
+	case MessageQueued:
+		return "MessageQueued"
+	case MessageExpired:
+		return "MessageExpired"
+	case MessageFlushed:
+		return "MessageFlushed"
+	case InboundRateExceeded:
+		return "InboundRateExceeded"
 	default:
 		return InvalidEventString
 	}
@@ -74,7 +98,8 @@ type Event struct {
 	Type EventType
 
 	// Device refers to the device, possibly disconnected, for which this event is being set.
-	// This field is always set.
+	// This field is always set, except for MessageQueued and MessageExpired events that concern
+	// devices which are not connected.
 	Device Interface
 
 	// Message is the WRP message relevant to this event.
@@ -18,6 +18,10 @@ func testEventString(t *testing.T) {
 			MessageFailed,
 			TransactionComplete,
 			TransactionBroken,
+			MessageQueued,
+			MessageExpired,
+			MessageFlushed,
+			InboundRateExceeded,
 		}
 	)
 
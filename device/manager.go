@@ -1,12 +1,15 @@
 package device
 
 import (
+	"context"
 	"encoding/json"
 	"io"
+	"math"
 	"net/http"
 	"strconv"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/xmidt-org/webpa-common/convey"
@@ -119,17 +122,19 @@ func NewManager(o *Options) Manager {
 
 	debugLogger.Log(logging.MessageKey(), "source check configuration", "type", wrpCheck.Type)
 
-	return &manager{
+	m := &manager{
 		logger:           logger,
 		errorLog:         logging.Error(logger),
 		debugLog:         debugLogger,
 		readDeadline:     NewDeadline(o.idlePeriod(), o.now()),
 		writeDeadline:    NewDeadline(o.writeTimeout(), o.now()),
 		upgrader:         o.upgrader(),
+		compressionLevel: o.compressionLevel(),
 		conveyTranslator: conveyhttp.NewHeaderTranslator("", nil),
 		devices: newRegistry(registryOptions{
 			Logger:   logger,
 			Limit:    o.maxDevices(),
+			Shards:   o.registryShards(),
 			Measures: measures,
 		}),
 		conveyHWMetric: conveymetric.NewConveyMetric(measures.Models, []conveymetric.TagLabelPair{
@@ -143,14 +148,35 @@ func NewManager(o *Options) Manager {
 			}}...),
 
 		deviceMessageQueueSize: o.deviceMessageQueueSize(),
+		laneQueueSizes:         o.laneQueueSizes(),
 		pingPeriod:             o.pingPeriod(),
 
 		listeners:             o.listeners(),
 		measures:              measures,
 		enforceWRPSourceCheck: wrpCheck.Type == CheckTypeEnforce,
 		filter:                o.filter(),
+
+		now:                o.now(),
+		offlineStore:       o.offlineStore(),
+		offlineSweepPeriod: o.offlineSweepPeriod(),
+
+		outboundRateLimit:         o.outboundRateLimit,
+		outboundRateLimitPolicy:   o.outboundRateLimitPolicy(),
+		outboundRateLimitMaxDelay: o.outboundRateLimitMaxDelay(),
+
+		inboundRateLimit:       o.inboundRateLimit(),
+		inboundByteRateLimit:   o.inboundByteRateLimit(),
+		inboundRateLimitPolicy: o.inboundRateLimitPolicy(),
+
+		sessionResumeWindow: o.sessionResumeWindow(),
 	}
 
+	if m.sessionResumeWindow > 0 {
+		m.sessions = newSessions(m.sessionResumeWindow)
+	}
+
+	return m
+
 }
 
 // manager is the internal Manager implementation.
@@ -162,12 +188,14 @@ type manager struct {
 	readDeadline     func() time.Time
 	writeDeadline    func() time.Time
 	upgrader         *websocket.Upgrader
+	compressionLevel int
 	conveyTranslator conveyhttp.HeaderTranslator
 
 	devices        *registry
 	conveyHWMetric conveymetric.Interface
 
 	deviceMessageQueueSize int
+	laneQueueSizes         [laneCount]int
 	pingPeriod             time.Duration
 
 	listeners             []Listener
@@ -175,6 +203,22 @@ type manager struct {
 	enforceWRPSourceCheck bool
 
 	filter Filter
+
+	now                func() time.Time
+	offlineStore       OfflineStore
+	offlineSweepPeriod time.Duration
+	lastOfflineSweep   int64
+
+	outboundRateLimit         func(*Metadata) RateLimit
+	outboundRateLimitPolicy   RateLimitPolicy
+	outboundRateLimitMaxDelay time.Duration
+
+	inboundRateLimit       RateLimit
+	inboundByteRateLimit   RateLimit
+	inboundRateLimitPolicy RateLimitPolicy
+
+	sessionResumeWindow time.Duration
+	sessions            *sessions
 }
 
 func (m *manager) Connect(response http.ResponseWriter, request *http.Request, responseHeader http.Header) (Interface, error) {
@@ -202,10 +246,19 @@ func (m *manager) Connect(response http.ResponseWriter, request *http.Request, r
 		C:          cvy,
 		Compliance: convey.GetCompliance(cvyErr),
 		QueueSize:  m.deviceMessageQueueSize,
+		LaneSizes:  m.laneQueueSizes,
 		Metadata:   metadata,
 		Logger:     m.logger,
 	})
 
+	if m.sessions != nil && len(metadata.SessionID()) > 0 {
+		d.resumeWindow = m.sessionResumeWindow
+	}
+
+	d.outboundLimiter = m.outboundRateLimit(metadata).newTokenBucket(m.now)
+	d.inboundMessageLimiter = m.inboundRateLimit.newTokenBucket(m.now)
+	d.inboundByteLimiter = m.inboundByteRateLimit.newTokenBucket(m.now)
+
 	if allow, matchResults := m.filter.AllowConnection(d); !allow {
 		d.infoLog.Log("filter", "filter match found,", "location", matchResults.Location, "key", matchResults.Key)
 		return nil, ErrorDeviceFilteredOut
@@ -221,13 +274,39 @@ func (m *manager) Connect(response http.ResponseWriter, request *http.Request, r
 		d.errorLog.Log(logging.MessageKey(), "bad or missing convey data", logging.ErrorKey(), cvyErr)
 	}
 
-	c, err := m.upgrader.Upgrade(response, request, responseHeader)
+	if d.resumeWindow > 0 {
+		// let the device know the token it can use to resume this session.  the supplied
+		// header is frequently shared across connections, so it must not be modified.
+		header := make(http.Header, len(responseHeader)+1)
+		for name, values := range responseHeader {
+			header[name] = values
+		}
+
+		header.Set(SessionIDHeader, metadata.SessionID())
+		responseHeader = header
+	}
+
+	wire := &wireResponseWriter{ResponseWriter: response}
+	c, err := m.upgrader.Upgrade(wire, request, responseHeader)
 	if err != nil {
 		d.errorLog.Log(logging.MessageKey(), "failed websocket upgrade", logging.ErrorKey(), err)
 		return nil, err
 	}
 
-	d.debugLog.Log(logging.MessageKey(), "websocket upgrade complete", "localAddress", c.LocalAddr().String())
+	if ws, ok := d.statistics.(WireStatistics); ok && wire.conn != nil {
+		// start counting wire bytes now that the handshake is complete
+		wire.conn.statistics = ws
+	}
+
+	compression := m.upgrader.EnableCompression && offersCompression(request.Header)
+	metadata.SetCompression(compression)
+	if compression && m.compressionLevel != 0 {
+		if err := c.SetCompressionLevel(m.compressionLevel); err != nil {
+			d.errorLog.Log(logging.MessageKey(), "invalid compression level", "compressionLevel", m.compressionLevel, logging.ErrorKey(), err)
+		}
+	}
+
+	d.debugLog.Log(logging.MessageKey(), "websocket upgrade complete", "localAddress", c.LocalAddr().String(), "compression", compression)
 
 	pinger, err := NewPinger(c, m.measures.Ping, []byte(d.ID()), m.writeDeadline)
 	if err != nil {
@@ -236,8 +315,17 @@ func (m *manager) Connect(response http.ResponseWriter, request *http.Request, r
 		return nil, err
 	}
 
+	resumed := m.resumeSession(d, request.Header.Get(ResumeTokenHeader))
+
+	// the flush is marked before the device becomes routable, so that nothing routed to
+	// this device can overtake the messages held for it
+	d.flushing = m.offlineStore != nil
 	if err := m.devices.add(d); err != nil {
 		d.errorLog.Log(logging.MessageKey(), "unable to register device", logging.ErrorKey(), err)
+		if resumed {
+			d.transactions.Close()
+		}
+
 		c.Close()
 		return nil, err
 	}
@@ -269,9 +357,39 @@ func (m *manager) Connect(response http.ResponseWriter, request *http.Request, r
 	go m.readPump(d, InstrumentReader(c, d.statistics), closeOnce)
 	go m.writePump(d, InstrumentWriter(c, d.statistics), pinger, closeOnce)
 
+	if m.offlineStore != nil {
+		go m.flushOffline(d)
+	}
+
 	return d, nil
 }
 
+// resumeSession attempts to take over the session of a prior connection for the same device,
+// using the resume token sent by the device.  The prior connection may be parked, or it may still
+// be registered if the disconnection has not yet been noticed.  This method returns true if a session
+// was resumed.
+func (m *manager) resumeSession(d *device, token string) bool {
+	if m.sessions == nil || d.resumeWindow <= 0 || len(token) == 0 {
+		return false
+	}
+
+	prior, ok := m.sessions.resume(d.id, token)
+	if !ok {
+		if existing, found := m.devices.get(d.id); found && existing.resumeWindow > 0 &&
+			existing.Metadata().SessionID() == token && existing.markResumed() {
+			prior, ok = existing, true
+		}
+	}
+
+	if ok {
+		d.resume(prior)
+		m.measures.SessionResumed.Inc()
+		d.infoLog.Log(logging.MessageKey(), "resumed session", "resumeToken", token, "pendingTransactions", d.transactions.Len())
+	}
+
+	return ok
+}
+
 func (m *manager) dispatch(e *Event) {
 	for _, listener := range m.listeners {
 		listener(e)
@@ -286,13 +404,17 @@ func (m *manager) dispatch(e *Event) {
 // dispatches message failed events for any messages that were waiting to be delivered
 // at the time of pump closure.
 func (m *manager) pumpClose(d *device, c io.Closer, reason CloseReason) {
-	// remove will invoke requestClose()
-	m.devices.remove(d.id, reason)
+	// removeDevice will invoke requestClose()
+	m.devices.removeDevice(d, reason)
+
+	if m.sessions != nil && d.resumeWindow > 0 {
+		m.sessions.park(d)
+	}
 
 	closeError := c.Close()
 
 	d.errorLog.Log(logging.MessageKey(), "Closed device connection",
-		"closeError", closeError, "reasonError", reason.Err, "reason", reason.Text,
+		"closeError", closeError, "reasonError", reason.Err, "reason", reason.Text, "redirect", reason.Redirect,
 		"finalStatistics", d.Statistics().String())
 
 	m.dispatch(
@@ -357,6 +479,7 @@ func (m *manager) readPump(d *device, r ReadCloser, closeOnce *sync.Once) {
 
 	var (
 		readError error
+		closeText = "readerror"
 		decoder   = wrp.NewDecoder(nil, wrp.Msgpack)
 		encoder   = wrp.NewEncoder(nil, wrp.Msgpack)
 	)
@@ -364,7 +487,7 @@ func (m *manager) readPump(d *device, r ReadCloser, closeOnce *sync.Once) {
 	// all the read pump has to do is ensure the device and the connection are closed
 	// it is the write pump's responsibility to do further cleanup
 	defer func() {
-		closeOnce.Do(func() { m.pumpClose(d, r, CloseReason{Err: readError, Text: "readerror"}) })
+		closeOnce.Do(func() { m.pumpClose(d, r, CloseReason{Err: readError, Text: closeText}) })
 	}()
 
 	for {
@@ -374,6 +497,13 @@ func (m *manager) readPump(d *device, r ReadCloser, closeOnce *sync.Once) {
 			return
 		}
 
+		if process, disconnect := m.limitInbound(d, data); disconnect {
+			closeText = CloseReasonInboundRateExceeded
+			return
+		} else if !process {
+			continue
+		}
+
 		if messageType != websocket.BinaryMessage {
 			d.errorLog.Log(logging.MessageKey(), "skipping non-binary frame", "messageType", messageType)
 			continue
@@ -444,6 +574,52 @@ func (m *manager) readPump(d *device, r ReadCloser, closeOnce *sync.Once) {
 	}
 }
 
+// limitInbound checks a frame read from a device against that device's inbound rate limits.
+// The returned flags indicate whether the frame should be processed and whether the device
+// should be disconnected.  Tokens are only taken from the limiters when the frame is within both limits.
+func (m *manager) limitInbound(d *device, frame []byte) (process bool, disconnect bool) {
+	var (
+		limit  string
+		length = float64(len(frame))
+	)
+
+	if d.inboundMessageLimiter != nil && !d.inboundMessageLimiter.peekN(1.0) {
+		limit = "messages"
+	} else if d.inboundByteLimiter != nil && !d.inboundByteLimiter.peekN(length) {
+		limit = "bytes"
+	} else {
+		// frames are read by a single goroutine per device, so the limiters cannot change between the check and the take
+		if d.inboundMessageLimiter != nil {
+			d.inboundMessageLimiter.takeN(1.0)
+		}
+
+		if d.inboundByteLimiter != nil {
+			d.inboundByteLimiter.takeN(length)
+		}
+
+		return true, false
+	}
+
+	policy := m.inboundRateLimitPolicy
+	d.errorLog.Log(logging.MessageKey(), "inbound rate limit exceeded", "limit", limit, "policy", policy, "frameLength", len(frame))
+	m.measures.InboundRateLimited.With("partnerid", d.Metadata().PartnerIDClaim(), "limit", limit, "policy", string(policy)).Add(1.0)
+	m.dispatch(&Event{
+		Type:     InboundRateExceeded,
+		Device:   d,
+		Format:   wrp.Msgpack,
+		Contents: frame,
+	})
+
+	switch policy {
+	case RateLimitLog:
+		return true, false
+	case RateLimitDisconnect:
+		return false, true
+	default:
+		return false, false
+	}
+}
+
 // writePump is the goroutine which services messages addressed to the device.
 // this goroutine exits when either an explicit shutdown is requested or any
 // error occurs on the connection.
@@ -484,70 +660,104 @@ func (m *manager) writePump(d *device, w WriteCloser, pinger func() error, close
 		//
 		// Nil is passed explicitly as the error to indicate that these messages failed due
 		// to the device disconnecting, not due to an actual I/O error.
-		for {
-			select {
-			case undeliverable := <-d.messages:
-				d.errorLog.Log(logging.MessageKey(), "undeliverable message", "deviceMessage", undeliverable)
-				m.dispatch(&Event{
-					Type:     MessageFailed,
-					Device:   d,
-					Message:  undeliverable.request.Message,
-					Format:   undeliverable.request.Format,
-					Contents: undeliverable.request.Contents,
-					Error:    writeError,
-				})
-			default:
-				return
-			}
+		for undeliverable := d.next(); undeliverable != nil; undeliverable = d.next() {
+			d.errorLog.Log(logging.MessageKey(), "undeliverable message", "deviceMessage", undeliverable)
+			m.dispatch(&Event{
+				Type:     MessageFailed,
+				Device:   d,
+				Message:  undeliverable.request.Message,
+				Format:   undeliverable.request.Format,
+				Contents: undeliverable.request.Contents,
+				Error:    writeError,
+			})
 		}
 	}()
 
 	for writeError == nil {
 		envelope = nil
 
+		// shutdown and pings always take precedence over queued messages
 		select {
 		case <-d.shutdown:
 			d.debugLog.Log(logging.MessageKey(), "explicit shutdown")
+			m.writeRedirect(d, w)
 			writeError = w.Close()
 			return
 
-		case envelope = <-d.messages:
-			var frameContents []byte
-			if envelope.request.Format == wrp.Msgpack && len(envelope.request.Contents) > 0 {
-				frameContents = envelope.request.Contents
-			} else {
-				// if the request was in a format other than Msgpack, or if the caller did not pass
-				// Contents, then do the encoding here.
-				encoder.ResetBytes(&frameContents)
-				writeError = encoder.Encode(envelope.request.Message)
-				encoder.ResetBytes(nil)
-			}
+		case <-pingTicker.C:
+			writeError = pinger()
+			continue
 
-			if writeError == nil {
-				writeError = w.WriteMessage(websocket.BinaryMessage, frameContents)
-			}
+		default:
+		}
 
-			event := Event{
-				Device:   d,
-				Message:  envelope.request.Message,
-				Format:   envelope.request.Format,
-				Contents: envelope.request.Contents,
-				Error:    writeError,
-			}
+		// drain higher priority lanes first, only blocking when every lane is empty
+		if envelope = d.next(); envelope == nil {
+			select {
+			case <-d.shutdown:
+				d.debugLog.Log(logging.MessageKey(), "explicit shutdown")
+				m.writeRedirect(d, w)
+				writeError = w.Close()
+				return
 
-			if writeError != nil {
-				envelope.complete <- writeError
-				event.Type = MessageFailed
-			} else {
-				event.Type = MessageSent
+			case <-pingTicker.C:
+				writeError = pinger()
+				continue
+
+			case envelope = <-d.lanes[RequestResponseLane.index()]:
+			case envelope = <-d.lanes[EventLane.index()]:
+			case envelope = <-d.lanes[BulkLane.index()]:
 			}
+		}
+
+		var frameContents []byte
+		if envelope.request.Format == wrp.Msgpack && len(envelope.request.Contents) > 0 {
+			frameContents = envelope.request.Contents
+		} else {
+			// if the request was in a format other than Msgpack, or if the caller did not pass
+			// Contents, then do the encoding here.
+			encoder.ResetBytes(&frameContents)
+			writeError = encoder.Encode(envelope.request.Message)
+			encoder.ResetBytes(nil)
+		}
 
-			close(envelope.complete)
-			m.dispatch(&event)
+		if writeError == nil {
+			writeError = w.WriteMessage(websocket.BinaryMessage, frameContents)
+		}
 
-		case <-pingTicker.C:
-			writeError = pinger()
+		event := Event{
+			Device:   d,
+			Message:  envelope.request.Message,
+			Format:   envelope.request.Format,
+			Contents: envelope.request.Contents,
+			Error:    writeError,
+		}
+
+		if writeError != nil {
+			envelope.complete <- writeError
+			event.Type = MessageFailed
+		} else {
+			event.Type = MessageSent
 		}
+
+		close(envelope.complete)
+		m.dispatch(&event)
+	}
+}
+
+// writeRedirect sends a close frame carrying the redirect, if any, from a device's close reason
+func (m *manager) writeRedirect(d *device, w Writer) {
+	reason := d.CloseReason()
+	if len(reason.Redirect) == 0 {
+		return
+	} else if len(reason.Redirect) > maxCloseText {
+		d.errorLog.Log(logging.MessageKey(), "redirect is too long for a close frame", "redirect", reason.Redirect)
+		return
+	}
+
+	w.SetWriteDeadline(m.writeDeadline())
+	if err := w.WriteMessage(websocket.CloseMessage, websocket.FormatCloseMessage(RedirectCloseCode, reason.Redirect)); err != nil {
+		d.errorLog.Log(logging.MessageKey(), "unable to send redirect", "redirect", reason.Redirect, logging.ErrorKey(), err)
 	}
 }
 
@@ -590,12 +800,329 @@ func (m *manager) VisitAll(visitor func(Interface) bool) int {
 	})
 }
 
+func (m *manager) Query(q Query) (QueryResult, error) {
+	return RunQuery(m, q, m.now)
+}
+
+func (m *manager) Multicast(mr MulticastRequest) (MulticastResult, error) {
+	if mr.Request == nil {
+		return MulticastResult{}, ErrorInvalidMulticast
+	} else if mr.Target.empty() {
+		return MulticastResult{}, ErrorNoMulticastTarget
+	}
+
+	targets := mr.Target.IDs
+	if len(targets) == 0 {
+		m.devices.visit(func(d *device) bool {
+			if mr.Target.matches(d) {
+				targets = append(targets, d.id)
+			}
+
+			return true
+		})
+	}
+
+	return multicast(m, mr, targets)
+}
+
 func (m *manager) Route(request *Request) (*Response, error) {
-	if destination, err := request.ID(); err != nil {
+	destination, err := request.ID()
+	if err != nil {
 		return nil, err
-	} else if d, ok := m.devices.get(destination); ok {
+	}
+
+	d, ok := m.devices.get(destination)
+	if !ok {
+		return nil, m.queueOffline(destination, nil, request, ErrorDeviceNotFound)
+	}
+
+	if m.queueBehindFlush(d, request) {
+		return nil, nil
+	}
+
+	response, err := m.send(d, request)
+	if err == ErrorDeviceClosed {
+		return nil, m.queueOffline(destination, d, request, err)
+	}
+
+	return response, err
+}
+
+// send delivers a request to a connected device, honoring that device's outbound rate limit
+// according to the configured policy.
+func (m *manager) send(d *device, request *Request) (*Response, error) {
+	if d.outboundLimiter == nil {
 		return d.Send(request)
-	} else {
-		return nil, ErrorDeviceNotFound
+	}
+
+	maxDelay := m.outboundRateLimitMaxDelay
+	if m.outboundRateLimitPolicy == RateLimitReject {
+		maxDelay = 0
+	}
+
+	delay, ok := d.outboundLimiter.reserve(maxDelay)
+	if !ok {
+		m.measures.OutboundRateLimited.With("partnerid", d.Metadata().PartnerIDClaim()).Add(1.0)
+		return nil, ErrorRateLimited
+	} else if delay <= 0 {
+		return d.Send(request)
+	}
+
+	if _, transactional := request.Transactional(); m.outboundRateLimitPolicy == RateLimitQueue && !transactional {
+		// the caller's context is typically cancelled as soon as we return, so
+		// queued messages are sent independently of it.  The caller's request is
+		// left untouched.
+		queued := *request
+		queued.ctx = context.Background()
+		go func() {
+			err := m.awaitOutboundLimit(d, &queued, delay)
+			if err == nil {
+				_, err = d.Send(&queued)
+			}
+
+			if err == ErrorDeviceClosed {
+				// the device disconnected while this message waited, so hold onto it if possible
+				err = m.queueOffline(d.id, d, &queued, err)
+			}
+
+			if err != nil {
+				d.errorLog.Log(logging.MessageKey(), "unable to send queued message", logging.ErrorKey(), err)
+			}
+		}()
+
+		return nil, nil
+	}
+
+	if err := m.awaitOutboundLimit(d, request, delay); err != nil {
+		return nil, err
+	}
+
+	return d.Send(request)
+}
+
+// awaitOutboundLimit waits for a reserved outbound token to become available.  If the request
+// is cancelled or the device disconnects first, the token is released.
+func (m *manager) awaitOutboundLimit(d *device, request *Request, delay time.Duration) error {
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+
+	select {
+	case <-request.Context().Done():
+		d.outboundLimiter.release()
+		return request.Context().Err()
+	case <-d.shutdown:
+		d.outboundLimiter.release()
+		return ErrorDeviceClosed
+	case <-timer.C:
+		return nil
+	}
+}
+
+// dispatchOffline dispatches an event of the given type for each offline message.  The device
+// may be nil, as offline messages are frequently addressed to devices that are not connected.
+func (m *manager) dispatchOffline(eventType EventType, d Interface, messages []OfflineMessage) {
+	for _, om := range messages {
+		event := &Event{
+			Type:     eventType,
+			Device:   d,
+			Format:   wrp.Msgpack,
+			Contents: om.Contents,
+		}
+
+		if request, err := om.Request(); err == nil {
+			event.Message = request.Message
+		}
+
+		m.dispatch(event)
+	}
+}
+
+// enqueueOffline attempts to place a request into the offline store.  If there is no offline
+// store, or if the request is transactional, the cause is returned unchanged.  Transactional
+// requests are never queued, as the caller is waiting synchronously on a response.
+func (m *manager) enqueueOffline(id ID, d Interface, request *Request, cause error) error {
+	if m.offlineStore == nil {
+		return cause
+	}
+
+	if _, transactional := request.Transactional(); transactional {
+		return cause
+	}
+
+	contents := request.Contents
+	if request.Format != wrp.Msgpack || len(contents) == 0 {
+		if err := wrp.NewEncoderBytes(&contents, wrp.Msgpack).Encode(request.Message); err != nil {
+			m.errorLog.Log(logging.MessageKey(), "unable to encode offline message", "id", id, logging.ErrorKey(), err)
+			return cause
+		}
+	}
+
+	om := OfflineMessage{Contents: contents}
+	evicted, err := m.offlineStore.Enqueue(id, om)
+	if err != nil {
+		m.errorLog.Log(logging.MessageKey(), "unable to queue offline message", "id", id, logging.ErrorKey(), err)
+		return cause
+	}
+
+	m.dispatchOffline(MessageQueued, d, []OfflineMessage{om})
+	m.dispatchOffline(MessageExpired, d, evicted)
+	m.sweepOffline()
+	return nil
+}
+
+// sweepOffline removes expired messages from the offline store, provided that the sweep period
+// has elapsed since the last sweep.  Sweeps happen lazily as messages are queued.
+func (m *manager) sweepOffline() {
+	var (
+		now  = m.now().UnixNano()
+		last = atomic.LoadInt64(&m.lastOfflineSweep)
+	)
+
+	if now-last < int64(m.offlineSweepPeriod) || !atomic.CompareAndSwapInt64(&m.lastOfflineSweep, last, now) {
+		return
+	}
+
+	expired, err := m.offlineStore.Sweep()
+	if err != nil {
+		m.errorLog.Log(logging.MessageKey(), "unable to sweep offline messages", logging.ErrorKey(), err)
+	}
+
+	m.dispatchOffline(MessageExpired, nil, expired)
+}
+
+// queueOffline places a request into the offline store for a device that was either not found or
+// closed.  The device may have connected, or been replaced, in the meantime, in which case nothing
+// else would deliver the queued request until the next reconnect.  So the registry is checked again
+// and, if a different device is now registered for the id, a flush to that device is started.
+func (m *manager) queueOffline(id ID, previous *device, request *Request, cause error) error {
+	var d Interface
+	if previous != nil {
+		d = previous
+	}
+
+	if err := m.enqueueOffline(id, d, request, cause); err != nil {
+		return err
+	}
+
+	if current, ok := m.devices.get(id); ok && current != previous {
+		m.startFlush(current)
+	}
+
+	return nil
+}
+
+// queueBehindFlush places a request into the offline store if messages held there are currently
+// being delivered to the device.  This method returns true if the request was queued, in which case
+// the flush in progress will deliver it.
+func (m *manager) queueBehindFlush(d *device, request *Request) bool {
+	if m.offlineStore == nil {
+		return false
+	}
+
+	if _, transactional := request.Transactional(); transactional {
+		return false
+	}
+
+	d.flushLock.Lock()
+	defer d.flushLock.Unlock()
+	return d.flushing && m.enqueueOffline(d.id, d, request, ErrorDeviceBusy) == nil
+}
+
+// startFlush begins delivering the messages held in the offline store to a device, unless a flush
+// is already in progress or the device has since closed.
+func (m *manager) startFlush(d *device) {
+	d.flushLock.Lock()
+	defer d.flushLock.Unlock()
+	if d.flushing || d.Closed() {
+		return
+	}
+
+	d.flushing = true
+	go m.flushOffline(d)
+}
+
+// flushOffline delivers any messages held in the offline store to a newly connected device.  Each
+// message waits for the device's outbound rate limit rather than being rejected or queued in the
+// background, so messages are delivered in order and MessageFlushed is only dispatched once a message
+// has actually been sent.  Messages queued while the flush is in progress are delivered as well.
+// Should the device disconnect, any undelivered messages are returned to the store.
+func (m *manager) flushOffline(d *device) {
+	for {
+		d.flushLock.Lock()
+		pending, expired, err := m.offlineStore.Dequeue(d.id)
+		if err != nil || len(pending) == 0 {
+			d.flushing = false
+		}
+
+		d.flushLock.Unlock()
+		if err != nil {
+			d.errorLog.Log(logging.MessageKey(), "unable to dequeue offline messages", logging.ErrorKey(), err)
+			return
+		}
+
+		m.dispatchOffline(MessageExpired, d, expired)
+		if len(pending) == 0 {
+			return
+		}
+
+		for i, om := range pending {
+			request, err := om.Request()
+			if err != nil {
+				d.errorLog.Log(logging.MessageKey(), "skipping malformed offline message", logging.ErrorKey(), err)
+				continue
+			}
+
+			if err := m.sendOffline(d, request); err != nil {
+				d.errorLog.Log(logging.MessageKey(), "unable to flush offline messages", "remaining", len(pending)-i, logging.ErrorKey(), err)
+				m.requeueOffline(d, pending[i:])
+				return
+			}
+
+			m.dispatchOffline(MessageFlushed, d, []OfflineMessage{om})
+		}
+	}
+}
+
+// sendOffline delivers a single offline message to a device, waiting as long as necessary
+// for the device's outbound rate limit.
+func (m *manager) sendOffline(d *device, request *Request) error {
+	if d.outboundLimiter != nil {
+		if delay, _ := d.outboundLimiter.reserve(time.Duration(math.MaxInt64)); delay > 0 {
+			if err := m.awaitOutboundLimit(d, request, delay); err != nil {
+				return err
+			}
+		}
+	}
+
+	_, err := d.Send(request)
+	return err
+}
+
+// requeueOffline returns undelivered messages to the offline store, ahead of any messages queued
+// while they were being flushed.  If another device has since registered with the same id, a flush
+// to that device is started.
+func (m *manager) requeueOffline(d *device, remaining []OfflineMessage) {
+	d.flushLock.Lock()
+	newer, expired, err := m.offlineStore.Dequeue(d.id)
+	if err != nil {
+		d.errorLog.Log(logging.MessageKey(), "unable to dequeue offline messages", logging.ErrorKey(), err)
+	}
+
+	for _, om := range append(remaining, newer...) {
+		evicted, err := m.offlineStore.Enqueue(d.id, om)
+		if err != nil {
+			d.errorLog.Log(logging.MessageKey(), "unable to return offline message", logging.ErrorKey(), err)
+			continue
+		}
+
+		expired = append(expired, evicted...)
+	}
+
+	d.flushing = false
+	d.flushLock.Unlock()
+
+	m.dispatchOffline(MessageExpired, d, expired)
+	if current, ok := m.devices.get(d.id); ok && current != d {
+		m.startFlush(current)
 	}
 }
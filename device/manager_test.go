@@ -1,6 +1,7 @@
 package device
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"net/http"
@@ -12,6 +13,7 @@ import (
 
 	"github.com/go-kit/kit/log"
 	"github.com/go-kit/kit/metrics"
+	"github.com/gorilla/websocket"
 
 	"github.com/xmidt-org/webpa-common/convey"
 	"github.com/xmidt-org/webpa-common/xmetrics"
@@ -231,6 +233,42 @@ func testManagerDisconnect(t *testing.T) {
 	assert.Equal(len(testDeviceIDs), deviceSet.len())
 }
 
+func testManagerDisconnectRedirect(t *testing.T) {
+	var (
+		assert  = assert.New(t)
+		require = require.New(t)
+
+		manager, server, connectURL = startWebsocketServer(&Options{Logger: logging.NewTestLogger(nil, t)})
+		redirect                    = "https://talaria-2.example.com:8080"
+	)
+
+	defer server.Close()
+
+	testDevices := connectTestDevices(t, DefaultDialer(), connectURL)
+	defer closeTestDevices(assert, testDevices)
+
+	for deadline := time.Now().Add(5 * time.Second); manager.Len() < len(testDeviceIDs); time.Sleep(time.Millisecond) {
+		require.True(time.Now().Before(deadline), "Devices did not connect")
+	}
+
+	assert.True(manager.Disconnect(testDeviceIDs[0], CloseReason{Text: "drained", Redirect: redirect}))
+	assert.True(manager.Disconnect(testDeviceIDs[1], CloseReason{Text: "drained"}))
+
+	redirected := testDevices[testDeviceIDs[0]]
+	redirected.SetReadDeadline(time.Now().Add(5 * time.Second))
+	_, _, err := redirected.ReadMessage()
+	require.Error(err)
+	assert.True(websocket.IsCloseError(err, RedirectCloseCode), err.Error())
+	assert.Equal(redirect, err.(*websocket.CloseError).Text)
+
+	// without a redirect, no close frame is sent
+	other := testDevices[testDeviceIDs[1]]
+	other.SetReadDeadline(time.Now().Add(5 * time.Second))
+	_, _, err = other.ReadMessage()
+	require.Error(err)
+	assert.True(websocket.IsCloseError(err, websocket.CloseAbnormalClosure), err.Error())
+}
+
 func testManagerDisconnectIf(t *testing.T) {
 	assert := assert.New(t)
 	connectWait := new(sync.WaitGroup)
@@ -317,6 +355,409 @@ func testManagerRouteDeviceNotFound(t *testing.T) {
 	assert.Equal(ErrorDeviceNotFound, err)
 }
 
+func testManagerRouteOffline(t *testing.T) {
+	var (
+		assert  = assert.New(t)
+		require = require.New(t)
+		events  = make(chan EventType, 10)
+
+		options = &Options{
+			Logger:       log.NewNopLogger(),
+			OfflineStore: NewMemoryOfflineStore(nil),
+			Listeners: []Listener{
+				func(event *Event) {
+					switch event.Type {
+					case MessageQueued, MessageFlushed:
+						events <- event.Type
+					}
+				},
+			},
+		}
+
+		manager, server, connectURL = startWebsocketServer(options)
+	)
+
+	defer server.Close()
+
+	response, err := manager.Route(&Request{
+		Message: &wrp.Message{
+			Type:            wrp.SimpleRequestResponseMessageType,
+			Destination:     string(testDeviceIDs[0]) + "/service",
+			TransactionUUID: "test-transaction",
+		},
+	})
+
+	assert.Nil(response)
+	assert.Equal(ErrorDeviceNotFound, err, "transactional requests should never be queued")
+
+	response, err = manager.Route(&Request{
+		Message: &wrp.Message{
+			Type:        wrp.SimpleEventMessageType,
+			Source:      "test",
+			Destination: string(testDeviceIDs[0]) + "/service",
+		},
+		Format: wrp.JSON,
+	})
+
+	assert.Nil(response)
+	assert.NoError(err)
+	assert.Equal(MessageQueued, <-events)
+
+	deviceConnection, _, err := DefaultDialer().DialDevice(string(testDeviceIDs[0]), connectURL, nil)
+	require.NoError(err)
+	defer deviceConnection.Close()
+
+	var (
+		message           = new(wrp.Message)
+		_, frame, readErr = deviceConnection.ReadMessage()
+	)
+
+	require.NoError(readErr)
+	require.NoError(wrp.NewDecoderBytes(frame, wrp.Msgpack).Decode(message))
+	assert.Equal(string(testDeviceIDs[0])+"/service", message.Destination)
+
+	select {
+	case eventType := <-events:
+		assert.Equal(MessageFlushed, eventType)
+	case <-time.After(10 * time.Second):
+		assert.Fail("No flush event occurred within the timeout")
+	}
+}
+
+func testManagerRouteRateLimited(t *testing.T) {
+	var (
+		assert   = assert.New(t)
+		counter  = newTestCounter()
+		manager  = NewManager(&Options{Logger: log.NewNopLogger()}).(*manager)
+		metadata = new(Metadata)
+		d        = newDevice(deviceOptions{ID: testDeviceIDs[0], Metadata: metadata, Logger: log.NewNopLogger()})
+	)
+
+	metadata.SetClaims(map[string]interface{}{PartnerIDClaimKey: "comcast"})
+	d.outboundLimiter = RateLimit{Rate: 0.001, Burst: 1}.newTokenBucket(nil)
+	d.outboundLimiter.tokens = 0.0
+	manager.measures.OutboundRateLimited = counter
+
+	response, err := manager.send(d, &Request{Message: &wrp.Message{Type: wrp.SimpleEventMessageType}})
+	assert.Nil(response)
+	assert.Equal(ErrorRateLimited, err)
+	assert.Equal(1.0, counter.count)
+	assert.Equal(map[string]string{"partnerid": "comcast"}, counter.labelPairs)
+}
+
+func testManagerRouteRateLimitQueued(t *testing.T) {
+	var (
+		assert      = assert.New(t)
+		manager     = NewManager(&Options{Logger: log.NewNopLogger(), OutboundRateLimitPolicy: RateLimitQueue}).(*manager)
+		d           = newDevice(deviceOptions{ID: testDeviceIDs[0], Metadata: new(Metadata), Logger: log.NewNopLogger()})
+		ctx, cancel = context.WithCancel(context.Background())
+		request     = (&Request{Message: &wrp.Message{Type: wrp.SimpleEventMessageType}}).WithContext(ctx)
+	)
+
+	defer d.requestClose(CloseReason{Text: "test"})
+	defer cancel()
+	d.outboundLimiter = RateLimit{Rate: 10.0, Burst: 1}.newTokenBucket(nil)
+	d.outboundLimiter.tokens = 0.0
+
+	response, err := manager.send(d, request)
+	assert.Nil(response)
+	assert.NoError(err)
+	assert.Equal(ctx, request.Context(), "the caller's request should not be modified")
+}
+
+func testManagerRouteRateLimitQueuedClosed(t *testing.T) {
+	var (
+		assert  = assert.New(t)
+		require = require.New(t)
+		store   = NewMemoryOfflineStore(nil)
+		queued  = make(chan struct{}, 1)
+		manager = NewManager(&Options{
+			Logger:                    log.NewNopLogger(),
+			OfflineStore:              store,
+			OutboundRateLimitPolicy:   RateLimitQueue,
+			OutboundRateLimitMaxDelay: time.Hour,
+			Listeners: []Listener{
+				func(event *Event) {
+					if event.Type == MessageQueued {
+						queued <- struct{}{}
+					}
+				},
+			},
+		}).(*manager)
+
+		d = newDevice(deviceOptions{ID: testDeviceIDs[0], Metadata: new(Metadata), Logger: log.NewNopLogger()})
+	)
+
+	d.outboundLimiter = RateLimit{Rate: 0.001, Burst: 1}.newTokenBucket(nil)
+	d.outboundLimiter.tokens = 0.0
+
+	response, err := manager.send(d, &Request{
+		Message: &wrp.Message{
+			Type:        wrp.SimpleEventMessageType,
+			Source:      "test",
+			Destination: string(d.id) + "/service",
+		},
+		Format: wrp.JSON,
+	})
+
+	assert.Nil(response)
+	assert.NoError(err)
+
+	d.requestClose(CloseReason{Text: "test"})
+	select {
+	case <-queued:
+	case <-time.After(5 * time.Second):
+		require.Fail("a queued message should be held offline when its device disconnects")
+	}
+
+	assert.Zero(d.Pending())
+	pending, _, err := store.Dequeue(d.id)
+	require.NoError(err)
+	assert.Len(pending, 1)
+}
+
+// testDeliveries accepts every message enqueued on a device, as a write pump would, and reports
+// the destination of each one
+func testDeliveries(d *device) <-chan string {
+	delivered := make(chan string, 10)
+	go func() {
+		for {
+			var e *envelope
+			select {
+			case <-d.shutdown:
+				return
+			case e = <-d.lanes[RequestResponseLane.index()]:
+			case e = <-d.lanes[EventLane.index()]:
+			case e = <-d.lanes[BulkLane.index()]:
+			}
+
+			delivered <- e.request.Message.(wrp.Routable).To()
+			e.complete <- nil
+		}
+	}()
+
+	return delivered
+}
+
+func testManagerFlushOfflineRateLimited(t *testing.T) {
+	var (
+		assert  = assert.New(t)
+		require = require.New(t)
+		store   = NewMemoryOfflineStore(nil)
+		flushed = make(chan struct{}, 1)
+		manager = NewManager(&Options{
+			Logger:       log.NewNopLogger(),
+			OfflineStore: store,
+			Listeners: []Listener{
+				func(event *Event) {
+					if event.Type == MessageFlushed {
+						flushed <- struct{}{}
+					}
+				},
+			},
+		}).(*manager)
+
+		d    = newDevice(deviceOptions{ID: testDeviceIDs[0], Metadata: new(Metadata), Logger: log.NewNopLogger()})
+		done = make(chan struct{})
+	)
+
+	d.outboundLimiter = RateLimit{Rate: 0.001, Burst: 1}.newTokenBucket(nil)
+	d.outboundLimiter.tokens = 0.0
+	_, err := store.Enqueue(d.id, testOfflineMessage(t, string(d.id)+"/service"))
+	require.NoError(err)
+
+	d.flushing = true
+	go func() {
+		defer close(done)
+		manager.flushOffline(d)
+	}()
+
+	select {
+	case <-done:
+		assert.Fail("the flush should wait for the rate limit")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	d.requestClose(CloseReason{Text: "test"})
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		require.Fail("the flush did not stop when the device closed")
+	}
+
+	assert.Zero(d.Pending())
+	assert.Empty(flushed, "undelivered messages should not be reported as flushed")
+	assert.False(d.flushing)
+
+	pending, _, err := store.Dequeue(d.id)
+	require.NoError(err)
+	assert.Len(pending, 1, "undelivered messages should be returned to the store")
+}
+
+func testManagerFlushOfflineOrder(t *testing.T) {
+	var (
+		assert  = assert.New(t)
+		require = require.New(t)
+		store   = NewMemoryOfflineStore(nil)
+		manager = NewManager(&Options{Logger: log.NewNopLogger(), OfflineStore: store}).(*manager)
+		d       = newDevice(deviceOptions{ID: testDeviceIDs[0], Metadata: new(Metadata), Logger: log.NewNopLogger()})
+
+		delivered = testDeliveries(d)
+	)
+
+	defer d.requestClose(CloseReason{Text: "test"})
+	d.outboundLimiter = RateLimit{Rate: 20.0, Burst: 1}.newTokenBucket(nil)
+	d.outboundLimiter.tokens = 0.0
+	for _, service := range []string{"/first", "/second"} {
+		_, err := store.Enqueue(d.id, testOfflineMessage(t, string(d.id)+service))
+		require.NoError(err)
+	}
+
+	d.flushing = true
+	require.NoError(manager.devices.add(d))
+	go manager.flushOffline(d)
+
+	response, err := manager.Route(&Request{
+		Message: &wrp.Message{
+			Type:        wrp.SimpleEventMessageType,
+			Source:      "test",
+			Destination: string(d.id) + "/third",
+		},
+		Format: wrp.JSON,
+	})
+
+	assert.Nil(response)
+	assert.NoError(err)
+	for _, service := range []string{"/first", "/second", "/third"} {
+		select {
+		case destination := <-delivered:
+			assert.Equal(string(d.id)+service, destination, "messages routed during a flush should be delivered after it")
+		case <-time.After(5 * time.Second):
+			require.Fail("no message delivered", "expected: %s", service)
+		}
+	}
+}
+
+func testManagerQueueOfflineReplaced(t *testing.T) {
+	var (
+		assert   = assert.New(t)
+		require  = require.New(t)
+		store    = NewMemoryOfflineStore(nil)
+		manager  = NewManager(&Options{Logger: log.NewNopLogger(), OfflineStore: store}).(*manager)
+		previous = newDevice(deviceOptions{ID: testDeviceIDs[0], Metadata: new(Metadata), Logger: log.NewNopLogger()})
+		current  = newDevice(deviceOptions{ID: testDeviceIDs[0], Metadata: new(Metadata), Logger: log.NewNopLogger()})
+
+		delivered = testDeliveries(current)
+	)
+
+	defer current.requestClose(CloseReason{Text: "test"})
+	previous.requestClose(CloseReason{Text: "test"})
+	require.NoError(manager.devices.add(current))
+
+	// the previous device was closed after it was looked up, and the current device has already
+	// flushed the offline store
+	request := &Request{
+		Message: &wrp.Message{
+			Type:        wrp.SimpleEventMessageType,
+			Source:      "test",
+			Destination: string(current.id) + "/service",
+		},
+		Format: wrp.JSON,
+	}
+
+	_, err := previous.Send(request)
+	require.Equal(ErrorDeviceClosed, err)
+	assert.NoError(manager.queueOffline(current.id, previous, request, err))
+
+	select {
+	case destination := <-delivered:
+		assert.Equal(string(current.id)+"/service", destination)
+	case <-time.After(5 * time.Second):
+		assert.Fail("a message queued for a replaced device should be flushed to its replacement")
+	}
+}
+
+func TestManagerLimitInbound(t *testing.T) {
+	testData := []struct {
+		policy             RateLimitPolicy
+		expectedProcess    bool
+		expectedDisconnect bool
+	}{
+		{RateLimitDrop, false, false},
+		{RateLimitLog, true, false},
+		{RateLimitDisconnect, false, true},
+	}
+
+	for _, record := range testData {
+		t.Run(string(record.policy), func(t *testing.T) {
+			var (
+				assert  = assert.New(t)
+				counter = newTestCounter()
+				events  []EventType
+				manager = NewManager(&Options{
+					Logger:                 log.NewNopLogger(),
+					InboundRateLimitPolicy: record.policy,
+					Listeners: []Listener{
+						func(e *Event) { events = append(events, e.Type) },
+					},
+				}).(*manager)
+
+				d = newDevice(deviceOptions{ID: testDeviceIDs[0], Metadata: new(Metadata), Logger: log.NewNopLogger()})
+			)
+
+			manager.measures.InboundRateLimited = counter
+			d.inboundMessageLimiter = RateLimit{Rate: 0.001, Burst: 2}.newTokenBucket(nil)
+			d.inboundByteLimiter = RateLimit{Rate: 0.001, Burst: 10}.newTokenBucket(nil)
+
+			process, disconnect := manager.limitInbound(d, make([]byte, 5))
+			assert.True(process)
+			assert.False(disconnect)
+			assert.Empty(events)
+
+			process, disconnect = manager.limitInbound(d, make([]byte, 6))
+			assert.Equal(record.expectedProcess, process)
+			assert.Equal(record.expectedDisconnect, disconnect)
+			assert.Equal([]EventType{InboundRateExceeded}, events)
+			assert.Equal(map[string]string{"partnerid": UnknownPartner, "limit": "bytes", "policy": string(record.policy)}, counter.labelPairs)
+
+			process, _ = manager.limitInbound(d, nil)
+			assert.True(process, "a frame rejected by the byte limit should not use a message token")
+			assert.Equal(1.0, counter.count)
+
+			manager.limitInbound(d, nil)
+			assert.Equal("messages", counter.labelPairs["limit"])
+			assert.Equal(2.0, counter.count)
+		})
+	}
+
+	t.Run("LargeFrame", func(t *testing.T) {
+		var (
+			assert  = assert.New(t)
+			current = time.Now()
+			now     = func() time.Time { return current }
+			manager = NewManager(&Options{Logger: log.NewNopLogger(), InboundRateLimitPolicy: RateLimitDisconnect}).(*manager)
+			d       = newDevice(deviceOptions{ID: testDeviceIDs[0], Metadata: new(Metadata), Logger: log.NewNopLogger()})
+		)
+
+		manager.measures.InboundRateLimited = newTestCounter()
+		d.inboundByteLimiter = RateLimit{Rate: 10.0}.newTokenBucket(now)
+
+		process, disconnect := manager.limitInbound(d, make([]byte, 100))
+		assert.True(process, "a frame larger than the burst should be allowed by an idle device")
+		assert.False(disconnect)
+
+		current = current.Add(5 * time.Second)
+		process, disconnect = manager.limitInbound(d, make([]byte, 1))
+		assert.False(process, "the large frame should be paid for at the byte rate")
+		assert.True(disconnect)
+
+		current = current.Add(5 * time.Second)
+		process, disconnect = manager.limitInbound(d, make([]byte, 100))
+		assert.True(process)
+		assert.False(disconnect)
+	})
+}
+
 func testManagerConnectIncludesConvey(t *testing.T) {
 	var (
 		assert      = assert.New(t)
@@ -380,6 +821,86 @@ func testManagerConnectIncludesConvey(t *testing.T) {
 	assert.Equal("WebPA-1.6", convey["webpa-protocol"])
 }
 
+func testManagerConnectResumeSession(t *testing.T) {
+	var (
+		assert  = assert.New(t)
+		require = require.New(t)
+
+		sessionCount int
+		sessionLock  sync.Mutex
+
+		options = &Options{
+			Logger:              logging.NewTestLogger(nil, t),
+			SessionResumeWindow: time.Minute,
+		}
+
+		manager = NewManager(options)
+		server  = httptest.NewServer(
+			alice.New(Timeout(options), UseID.FromHeader).Then(
+				http.HandlerFunc(func(response http.ResponseWriter, request *http.Request) {
+					sessionLock.Lock()
+					sessionCount++
+					metadata := new(Metadata)
+					metadata.SetSessionID(fmt.Sprintf("session-%d", sessionCount))
+					sessionLock.Unlock()
+
+					(&ConnectHandler{Logger: options.logger(), Connector: manager}).ServeHTTP(
+						response,
+						request.WithContext(WithDeviceMetadata(request.Context(), metadata)),
+					)
+				}),
+			),
+		)
+
+		dialer   = DefaultDialer()
+		id       = testDeviceIDs[0]
+		request  = wrp.Message{Type: wrp.SimpleRequestResponseMessageType, Source: "test", Destination: string(id), TransactionUUID: "resume-transaction"}
+		contents []byte
+	)
+
+	defer server.Close()
+	connectURL := "ws" + server.URL[len("http"):]
+	require.NoError(wrp.NewEncoderBytes(&contents, wrp.Msgpack).Encode(&request))
+
+	first, response, err := dialer.DialDevice(string(id), connectURL, nil)
+	require.NoError(err)
+	assert.Equal("session-1", response.Header.Get(SessionIDHeader))
+
+	routeResult := make(chan *Response, 1)
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+
+		response, err := manager.Route((&Request{Message: &request, Contents: contents}).WithContext(ctx))
+		assert.NoError(err)
+		routeResult <- response
+	}()
+
+	// the device drops its connection after receiving the request, but before responding
+	_, _, err = first.ReadMessage()
+	require.NoError(err)
+	first.Close()
+
+	second, response, err := dialer.DialDevice(string(id), connectURL, http.Header{ResumeTokenHeader: {"session-1"}})
+	require.NoError(err)
+	defer second.Close()
+	assert.Equal("session-2", response.Header.Get(SessionIDHeader))
+
+	reply := request
+	reply.Source, reply.Destination = reply.Destination, reply.Source
+	var replyContents []byte
+	require.NoError(wrp.NewEncoderBytes(&replyContents, wrp.Msgpack).Encode(&reply))
+	require.NoError(second.WriteMessage(websocket.BinaryMessage, replyContents))
+
+	select {
+	case response := <-routeResult:
+		require.NotNil(response)
+		assert.Equal("resume-transaction", response.Message.TransactionUUID)
+	case <-time.After(10 * time.Second):
+		assert.Fail("The transaction was not completed through the resumed session")
+	}
+}
+
 func TestManager(t *testing.T) {
 	t.Run("Connect", func(t *testing.T) {
 		t.Run("MissingDeviceContext", testManagerConnectMissingDeviceContext)
@@ -387,14 +908,23 @@ func TestManager(t *testing.T) {
 		t.Run("UpgradeError", testManagerConnectUpgradeError)
 		t.Run("Visit", testManagerConnectVisit)
 		t.Run("IncludesConvey", testManagerConnectIncludesConvey)
+		t.Run("ResumeSession", testManagerConnectResumeSession)
 	})
 
 	t.Run("Route", func(t *testing.T) {
 		t.Run("BadDestination", testManagerRouteBadDestination)
 		t.Run("DeviceNotFound", testManagerRouteDeviceNotFound)
+		t.Run("Offline", testManagerRouteOffline)
+		t.Run("RateLimited", testManagerRouteRateLimited)
+		t.Run("RateLimitQueued", testManagerRouteRateLimitQueued)
+		t.Run("RateLimitQueuedClosed", testManagerRouteRateLimitQueuedClosed)
+		t.Run("FlushOfflineRateLimited", testManagerFlushOfflineRateLimited)
+		t.Run("FlushOfflineOrder", testManagerFlushOfflineOrder)
+		t.Run("QueueOfflineReplaced", testManagerQueueOfflineReplaced)
 	})
 
 	t.Run("Disconnect", testManagerDisconnect)
+	t.Run("DisconnectRedirect", testManagerDisconnectRedirect)
 	t.Run("DisconnectIf", testManagerDisconnectIf)
 }
 
@@ -10,8 +10,9 @@ import (
 
 // Reserved metadata keys
 const (
-	JWTClaimsKey = "jwt-claims"
-	SessionIDKey = "session-id"
+	JWTClaimsKey   = "jwt-claims"
+	SessionIDKey   = "session-id"
+	CompressionKey = "compression"
 )
 
 // Top level JWTClaim keys
@@ -26,7 +27,7 @@ const (
 )
 
 var reservedMetadataKeys = map[string]bool{
-	JWTClaimsKey: true, SessionIDKey: true,
+	JWTClaimsKey: true, SessionIDKey: true, CompressionKey: true,
 }
 
 func init() {
@@ -59,6 +60,19 @@ func (m *Metadata) SetSessionID(sessionID string) {
 	})
 }
 
+// Compression returns whether permessage-deflate compression was negotiated for the
+// device's websocket connection.  The zero value is returned as default.
+func (m *Metadata) Compression() (compression bool) {
+	compression, _ = m.loadData()[CompressionKey].(bool)
+	return
+}
+
+// SetCompression records whether permessage-deflate compression was negotiated
+// for the device's websocket connection.
+func (m *Metadata) SetCompression(compression bool) {
+	m.copyAndStore(CompressionKey, compression)
+}
+
 // Load returns the value associated with the given key in the metadata map.
 // It is not recommended modifying values returned by reference.
 func (m *Metadata) Load(key string) interface{} {
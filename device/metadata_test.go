@@ -48,6 +48,7 @@ func TestDeviceMetadataDefaultValues(t *testing.T) {
 
 	assert.Empty(m.Claims())
 	assert.Empty(m.SessionID())
+	assert.False(m.Compression())
 	assert.Equal(UnknownPartner, m.PartnerIDClaim())
 	assert.Zero(m.TrustClaim())
 	assert.Nil(m.Load("not-exists"))
@@ -77,6 +78,17 @@ func TestDeviceMetadataSessionID(t *testing.T) {
 	assert.Equal("uuid:123abc", m.SessionID())
 }
 
+func TestDeviceMetadataCompression(t *testing.T) {
+	assert := assert.New(t)
+	m := new(Metadata)
+
+	assert.False(m.Compression())
+	m.SetCompression(true)
+	assert.True(m.Compression())
+	m.SetCompression(false)
+	assert.False(m.Compression())
+}
+
 func TestDeviceMetadataReadUpdateClaims(t *testing.T) {
 	assert := assert.New(t)
 	m := new(Metadata)
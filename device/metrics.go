@@ -7,16 +7,19 @@ import (
 )
 
 const (
-	DeviceCounter             = "device_count"
-	DuplicatesCounter         = "duplicate_count"
-	RequestResponseCounter    = "request_response_count"
-	PingCounter               = "ping_count"
-	PongCounter               = "pong_count"
-	ConnectCounter            = "connect_count"
-	DisconnectCounter         = "disconnect_count"
-	DeviceLimitReachedCounter = "device_limit_reached_count"
-	ModelGauge                = "hardware_model"
-	WRPSourceCheck            = "wrp_source_check"
+	DeviceCounter              = "device_count"
+	DuplicatesCounter          = "duplicate_count"
+	RequestResponseCounter     = "request_response_count"
+	PingCounter                = "ping_count"
+	PongCounter                = "pong_count"
+	ConnectCounter             = "connect_count"
+	DisconnectCounter          = "disconnect_count"
+	DeviceLimitReachedCounter  = "device_limit_reached_count"
+	ModelGauge                 = "hardware_model"
+	WRPSourceCheck             = "wrp_source_check"
+	OutboundRateLimitedCounter = "outbound_rate_limited_count"
+	InboundRateLimitedCounter  = "inbound_rate_limited_count"
+	SessionResumedCounter      = "session_resumed_count"
 )
 
 // Metrics is the device module function that adds default device metrics
@@ -64,6 +67,20 @@ func Metrics() []xmetrics.Metric {
 			Type:       "counter",
 			LabelNames: []string{"outcome", "reason"},
 		},
+		{
+			Name:       OutboundRateLimitedCounter,
+			Type:       "counter",
+			LabelNames: []string{"partnerid"},
+		},
+		{
+			Name:       InboundRateLimitedCounter,
+			Type:       "counter",
+			LabelNames: []string{"partnerid", "limit", "policy"},
+		},
+		{
+			Name: SessionResumedCounter,
+			Type: "counter",
+		},
 	}
 }
 
@@ -79,6 +96,10 @@ type Measures struct {
 	Disconnect      xmetrics.Adder
 	Models          metrics.Gauge
 	WRPSourceCheck  metrics.Counter
+
+	OutboundRateLimited metrics.Counter
+	InboundRateLimited  metrics.Counter
+	SessionResumed      xmetrics.Incrementer
 }
 
 // NewMeasures constructs a Measures given a go-kit metrics Provider
@@ -94,5 +115,9 @@ func NewMeasures(p provider.Provider) Measures {
 		Disconnect:      p.NewCounter(DisconnectCounter),
 		Models:          p.NewGauge(ModelGauge),
 		WRPSourceCheck:  p.NewCounter(WRPSourceCheck),
+
+		OutboundRateLimited: p.NewCounter(OutboundRateLimitedCounter),
+		InboundRateLimited:  p.NewCounter(InboundRateLimitedCounter),
+		SessionResumed:      xmetrics.NewIncrementer(p.NewCounter(SessionResumedCounter)),
 	}
 }
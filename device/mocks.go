@@ -55,6 +55,11 @@ func (m *MockRegistry) VisitAll(f func(Interface) bool) int {
 	return m.Called(f).Int(0)
 }
 
+func (m *MockRegistry) Query(q Query) (QueryResult, error) {
+	arguments := m.Called(q)
+	return arguments.Get(0).(QueryResult), arguments.Error(1)
+}
+
 type MockDevice struct {
 	mock.Mock
 }
@@ -76,6 +81,10 @@ func (m *MockDevice) Pending() int {
 	return m.Called().Int(0)
 }
 
+func (m *MockDevice) LanePending(l Lane) int {
+	return m.Called(l).Int(0)
+}
+
 func (m *MockDevice) Close() error {
 	return m.Called().Error(0)
 }
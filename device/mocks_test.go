@@ -167,6 +167,11 @@ func (m *mockRouter) Route(request *Request) (*Response, error) {
 	return first, arguments.Error(1)
 }
 
+func (m *mockRouter) Multicast(request MulticastRequest) (MulticastResult, error) {
+	arguments := m.Called(request)
+	return arguments.Get(0).(MulticastResult), arguments.Error(1)
+}
+
 func TestMockConnector(t *testing.T) {
 	var (
 		assert = assert.New(t)
@@ -0,0 +1,246 @@
+package device
+
+import (
+	"encoding/json"
+	"errors"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/xmidt-org/wrp-go/v3"
+)
+
+// DefaultMulticastConcurrency is the default number of devices that a multicast message is sent to at once
+const DefaultMulticastConcurrency = 10
+
+var (
+	ErrorNoMulticastTarget  = errors.New("A multicast requires at least one target criterion, or an explicit broadcast")
+	ErrorInvalidMulticast   = errors.New("Multicast messages must be decoded WRP messages")
+	ErrorMulticastCancelled = errors.New("The multicast was cancelled before the message was sent to that device")
+)
+
+// Multicaster is implemented by a Router that can deliver a single message to many devices.  The
+// Manager created by NewManager implements this interface.
+type Multicaster interface {
+	// Multicast dispatches a single WRP request to each device selected by the request's target,
+	// routing to at most MulticastRequest.Concurrency devices at once.  The returned result holds
+	// the outcome for every targeted device.
+	Multicast(MulticastRequest) (MulticastResult, error)
+}
+
+// MulticastTarget selects the devices that receive a multicast message.  If IDs is set, exactly those
+// devices are targeted, whether or not they are connected.  Otherwise, the connected devices matching
+// all of the other criteria are targeted.
+type MulticastTarget struct {
+	// All targets every connected device, and must be set to broadcast a message.  This prevents an
+	// empty target from accidentally matching the whole fleet.
+	All bool
+
+	// IDs is an explicit list of devices
+	IDs []ID
+
+	// IDPrefix restricts the target to devices whose IDs begin with this string, e.g. "mac:112233"
+	IDPrefix string
+
+	// Metadata restricts the target to devices with matching metadata or claims, using the same
+	// semantics as Query.Metadata
+	Metadata map[string][]interface{}
+}
+
+// empty tests if this target has no criteria at all
+func (mt *MulticastTarget) empty() bool {
+	return !mt.All && len(mt.IDs) == 0 && len(mt.IDPrefix) == 0 && len(mt.Metadata) == 0
+}
+
+// matches tests if a connected device falls within this target
+func (mt *MulticastTarget) matches(d Interface) bool {
+	if len(mt.IDPrefix) > 0 && !strings.HasPrefix(string(d.ID()), mt.IDPrefix) {
+		return false
+	}
+
+	if len(mt.Metadata) > 0 {
+		q := Query{Metadata: mt.Metadata}
+		return q.matches(d, d.Statistics().ConnectedAt())
+	}
+
+	return true
+}
+
+// MulticastRequest describes a single WRP message to be delivered to a set of devices
+type MulticastRequest struct {
+	// Request carries the message and the context for the entire multicast.  Its Message must be
+	// a *wrp.Message.  Each device receives a copy of the message addressed to that device.
+	Request *Request
+
+	// Target selects the devices that receive the message
+	Target MulticastTarget
+
+	// Concurrency is the maximum number of devices the message is sent to at once.  If
+	// nonpositive, DefaultMulticastConcurrency is used.
+	Concurrency int
+}
+
+func (mr *MulticastRequest) concurrency() int {
+	if mr.Concurrency > 0 {
+		return mr.Concurrency
+	}
+
+	return DefaultMulticastConcurrency
+}
+
+// MulticastDeviceResult is the outcome of delivering a multicast message to one device
+type MulticastDeviceResult struct {
+	ID ID
+
+	// Response is the device's response, if the message was part of a transaction
+	Response *Response
+
+	// Err is the error, if any, that occurred while routing the message to the device
+	Err error
+}
+
+func (mdr MulticastDeviceResult) MarshalJSON() ([]byte, error) {
+	output := struct {
+		ID       ID           `json:"id"`
+		Error    string       `json:"error,omitempty"`
+		Response *wrp.Message `json:"response,omitempty"`
+	}{
+		ID: mdr.ID,
+	}
+
+	if mdr.Err != nil {
+		output.Error = mdr.Err.Error()
+	}
+
+	if mdr.Response != nil {
+		output.Response = mdr.Response.Message
+	}
+
+	return json.Marshal(output)
+}
+
+// MulticastResult aggregates the outcomes of a multicast
+type MulticastResult struct {
+	// Results holds the outcome for each targeted device, in the order the devices were targeted
+	Results []MulticastDeviceResult `json:"results"`
+
+	// Succeeded is the count of devices the message was successfully routed to
+	Succeeded int `json:"succeeded"`
+
+	// Failed is the count of devices for which routing failed
+	Failed int `json:"failed"`
+}
+
+// ParseMulticastTarget produces a MulticastTarget from URL query parameters.  The id parameter may be
+// repeated to list devices explicitly, idPrefix restricts the target by ID, parameters prefixed with
+// MetadataQueryPrefix match metadata and claims as with ParseQuery, and all=true broadcasts to every device.
+func ParseMulticastTarget(values url.Values) (mt MulticastTarget, err error) {
+	for _, v := range values["id"] {
+		id, err := ParseID(v)
+		if err != nil {
+			return MulticastTarget{}, err
+		}
+
+		mt.IDs = append(mt.IDs, id)
+	}
+
+	mt.IDPrefix = values.Get("idPrefix")
+	for name, v := range values {
+		if strings.HasPrefix(name, MetadataQueryPrefix) {
+			if mt.Metadata == nil {
+				mt.Metadata = make(map[string][]interface{})
+			}
+
+			key := strings.TrimPrefix(name, MetadataQueryPrefix)
+			for _, value := range v {
+				mt.Metadata[key] = append(mt.Metadata[key], value)
+			}
+		}
+	}
+
+	if v := values.Get("all"); len(v) > 0 {
+		if mt.All, err = strconv.ParseBool(v); err != nil {
+			return MulticastTarget{}, err
+		}
+	}
+
+	if mt.empty() {
+		return MulticastTarget{}, ErrorNoMulticastTarget
+	}
+
+	return
+}
+
+// addressedTo returns a copy of a request whose message is addressed to the given device.  Any service
+// portion of the original destination, e.g. "/config" in "mac:*/config", is preserved.
+func addressedTo(request *Request, message *wrp.Message, id ID) *Request {
+	addressed := *message
+	addressed.Destination = string(id)
+	if i := strings.IndexByte(message.Destination, '/'); i >= 0 {
+		addressed.Destination += message.Destination[i:]
+	}
+
+	return (&Request{
+		Message: &addressed,
+		Format:  request.Format,
+		Lane:    request.Lane,
+	}).WithContext(request.Context())
+}
+
+// multicast routes a request to each of the given devices through a Router, with bounded concurrency
+func multicast(router Router, mr MulticastRequest, targets []ID) (MulticastResult, error) {
+	message, ok := mr.Request.Message.(*wrp.Message)
+	if !ok {
+		return MulticastResult{}, ErrorInvalidMulticast
+	}
+
+	var (
+		ctx     = mr.Request.Context()
+		result  = MulticastResult{Results: make([]MulticastDeviceResult, len(targets))}
+		indices = make(chan int)
+		wg      sync.WaitGroup
+	)
+
+	workers := mr.concurrency()
+	if workers > len(targets) {
+		workers = len(targets)
+	}
+
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range indices {
+				result.Results[i].Response, result.Results[i].Err = router.Route(addressedTo(mr.Request, message, targets[i]))
+			}
+		}()
+	}
+
+	for i, id := range targets {
+		result.Results[i].ID = id
+		if ctx.Err() != nil {
+			result.Results[i].Err = ErrorMulticastCancelled
+			continue
+		}
+
+		select {
+		case indices <- i:
+		case <-ctx.Done():
+			result.Results[i].Err = ErrorMulticastCancelled
+		}
+	}
+
+	close(indices)
+	wg.Wait()
+
+	for _, r := range result.Results {
+		if r.Err != nil {
+			result.Failed++
+		} else {
+			result.Succeeded++
+		}
+	}
+
+	return result, nil
+}
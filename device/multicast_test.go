@@ -0,0 +1,242 @@
+package device
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/url"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/go-kit/kit/log"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/xmidt-org/wrp-go/v3"
+)
+
+// testMulticastRouter is a Router that routes single requests through a closure
+type testMulticastRouter func(*Request) (*Response, error)
+
+func (tmr testMulticastRouter) Route(request *Request) (*Response, error) {
+	return tmr(request)
+}
+
+func (tmr testMulticastRouter) Multicast(MulticastRequest) (MulticastResult, error) {
+	panic("Multicast should not be called")
+}
+
+func testMulticastRequest() *Request {
+	return (&Request{
+		Message: &wrp.Message{
+			Type:        wrp.SimpleEventMessageType,
+			Source:      "test",
+			Destination: "mac:*/config",
+		},
+		Format: wrp.Msgpack,
+	}).WithContext(context.Background())
+}
+
+func testMulticastConcurrency(t *testing.T) {
+	var (
+		assert  = assert.New(t)
+		require = require.New(t)
+
+		inFlight, maxInFlight int32
+		lock                  sync.Mutex
+		destinations          = make(map[string]bool)
+		failure               = errors.New("expected")
+
+		targets = []ID{IntToMAC(1), IntToMAC(2), IntToMAC(3), IntToMAC(4), IntToMAC(5), IntToMAC(6)}
+
+		router = testMulticastRouter(func(request *Request) (*Response, error) {
+			current := atomic.AddInt32(&inFlight, 1)
+			defer atomic.AddInt32(&inFlight, -1)
+			for {
+				previous := atomic.LoadInt32(&maxInFlight)
+				if current <= previous || atomic.CompareAndSwapInt32(&maxInFlight, previous, current) {
+					break
+				}
+			}
+
+			time.Sleep(10 * time.Millisecond)
+			message := request.Message.(*wrp.Message)
+			lock.Lock()
+			destinations[message.Destination] = true
+			lock.Unlock()
+
+			if message.Destination == string(IntToMAC(4))+"/config" {
+				return nil, failure
+			}
+
+			return &Response{Message: &wrp.Message{Source: message.Destination}}, nil
+		})
+	)
+
+	result, err := multicast(router, MulticastRequest{Request: testMulticastRequest(), Concurrency: 2}, targets)
+	require.NoError(err)
+	assert.Equal(5, result.Succeeded)
+	assert.Equal(1, result.Failed)
+	assert.True(atomic.LoadInt32(&maxInFlight) <= 2)
+	require.Len(result.Results, len(targets))
+
+	for i, id := range targets {
+		assert.Equal(id, result.Results[i].ID)
+		assert.True(destinations[string(id)+"/config"])
+		if id == IntToMAC(4) {
+			assert.Equal(failure, result.Results[i].Err)
+			assert.Nil(result.Results[i].Response)
+		} else {
+			assert.NoError(result.Results[i].Err)
+			require.NotNil(result.Results[i].Response)
+		}
+	}
+
+	// the original message must not be modified
+	assert.Equal("mac:*/config", testMulticastRequest().Message.(*wrp.Message).Destination)
+
+	data, err := json.Marshal(result)
+	require.NoError(err)
+	assert.Contains(string(data), `"failed":1`)
+	assert.Contains(string(data), `"error":"expected"`)
+}
+
+func testMulticastCancelled(t *testing.T) {
+	var (
+		assert      = assert.New(t)
+		require     = require.New(t)
+		ctx, cancel = context.WithCancel(context.Background())
+		routed      int32
+
+		router = testMulticastRouter(func(request *Request) (*Response, error) {
+			atomic.AddInt32(&routed, 1)
+			cancel()
+			return nil, nil
+		})
+	)
+
+	result, err := multicast(
+		router,
+		MulticastRequest{Request: testMulticastRequest().WithContext(ctx), Concurrency: 1},
+		[]ID{IntToMAC(1), IntToMAC(2), IntToMAC(3)},
+	)
+
+	require.NoError(err)
+	assert.Equal(int32(1), atomic.LoadInt32(&routed))
+	assert.Equal(1, result.Succeeded)
+	assert.Equal(2, result.Failed)
+	assert.Equal(ErrorMulticastCancelled, result.Results[2].Err)
+}
+
+func testMulticastInvalidMessage(t *testing.T) {
+	assert := assert.New(t)
+	_, err := multicast(
+		testMulticastRouter(func(*Request) (*Response, error) { return nil, nil }),
+		MulticastRequest{Request: &Request{Message: new(wrp.SimpleEvent)}},
+		[]ID{IntToMAC(1)},
+	)
+
+	assert.Equal(ErrorInvalidMulticast, err)
+}
+
+func testMulticastManager(t *testing.T) {
+	var (
+		assert  = assert.New(t)
+		require = require.New(t)
+
+		m, server, connectURL = startWebsocketServer(&Options{Logger: log.NewNopLogger()})
+	)
+
+	defer server.Close()
+	manager, ok := m.(Multicaster)
+	require.True(ok, "a Manager should be a Multicaster")
+
+	connections := connectTestDevices(t, DefaultDialer(), connectURL)
+	defer closeTestDevices(assert, connections)
+
+	_, err := manager.Multicast(MulticastRequest{Request: testMulticastRequest()})
+	assert.Equal(ErrorNoMulticastTarget, err)
+
+	result, err := manager.Multicast(MulticastRequest{Request: testMulticastRequest(), Target: MulticastTarget{All: true}})
+	require.NoError(err)
+	assert.Equal(len(testDeviceIDs), result.Succeeded)
+
+	result, err = manager.Multicast(MulticastRequest{
+		Request: testMulticastRequest(),
+		Target:  MulticastTarget{IDPrefix: string(testDeviceIDs[1])},
+	})
+
+	require.NoError(err)
+	require.Len(result.Results, 1)
+	assert.Equal(testDeviceIDs[1], result.Results[0].ID)
+
+	result, err = manager.Multicast(MulticastRequest{
+		Request: testMulticastRequest(),
+		Target:  MulticastTarget{IDs: []ID{testDeviceIDs[0], IntToMAC(0x999)}},
+	})
+
+	require.NoError(err)
+	assert.Equal(1, result.Succeeded)
+	assert.Equal(ErrorDeviceNotFound, result.Results[1].Err)
+
+	for _, id := range []ID{testDeviceIDs[0], testDeviceIDs[1]} {
+		var (
+			connection = connections[id]
+			message    wrp.Message
+		)
+
+		for i := 0; i < 2; i++ {
+			connection.SetReadDeadline(time.Now().Add(5 * time.Second))
+			_, data, err := connection.ReadMessage()
+			require.NoError(err)
+			require.NoError(wrp.NewDecoderBytes(data, wrp.Msgpack).Decode(&message))
+			assert.Equal(string(id)+"/config", message.Destination)
+		}
+	}
+}
+
+func TestMulticast(t *testing.T) {
+	t.Run("Concurrency", testMulticastConcurrency)
+	t.Run("Cancelled", testMulticastCancelled)
+	t.Run("InvalidMessage", testMulticastInvalidMessage)
+	t.Run("Manager", testMulticastManager)
+}
+
+func TestParseMulticastTarget(t *testing.T) {
+	var (
+		assert  = assert.New(t)
+		require = require.New(t)
+	)
+
+	mt, err := ParseMulticastTarget(url.Values{
+		"id":                  {"mac:112233445566", "uuid:1234"},
+		"idPrefix":            {"mac:11"},
+		"metadata.partner-id": {"comcast"},
+		"all":                 {"false"},
+	})
+
+	require.NoError(err)
+	assert.Equal(
+		MulticastTarget{
+			IDs:      []ID{ID("mac:112233445566"), ID("uuid:1234")},
+			IDPrefix: "mac:11",
+			Metadata: map[string][]interface{}{"partner-id": {"comcast"}},
+		},
+		mt,
+	)
+
+	mt, err = ParseMulticastTarget(url.Values{"all": {"true"}})
+	require.NoError(err)
+	assert.True(mt.All)
+
+	for _, values := range []url.Values{
+		{},
+		{"all": {"false"}},
+		{"all": {"sometimes"}},
+		{"id": {"this is not a device"}},
+	} {
+		_, err := ParseMulticastTarget(values)
+		assert.Error(err, values.Encode())
+	}
+}
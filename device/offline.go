@@ -0,0 +1,240 @@
+package device
+
+import (
+	"sync"
+	"time"
+
+	"github.com/xmidt-org/wrp-go/v3"
+)
+
+const (
+	DefaultOfflineMaxMessages                    = 10
+	DefaultOfflineMaxTotalMessages               = 100000
+	DefaultOfflineTTL              time.Duration = 5 * time.Minute
+	DefaultOfflineSweepPeriod      time.Duration = time.Minute
+)
+
+// OfflineMessage is a single WRP message held on behalf of a device that was not connected
+// at the time the message was routed.
+type OfflineMessage struct {
+	// ID is the device to which this message is addressed
+	ID ID `json:"id"`
+
+	// Contents is the Msgpack encoding of the WRP message
+	Contents []byte `json:"contents"`
+
+	// QueuedAt is the time at which this message was placed into an OfflineStore
+	QueuedAt time.Time `json:"queuedAt"`
+
+	// ExpiresAt is the time after which this message will no longer be delivered.  If zero,
+	// this message never expires.
+	ExpiresAt time.Time `json:"expiresAt,omitempty"`
+}
+
+// Expired tests if this message has expired relative to the given time
+func (om OfflineMessage) Expired(now time.Time) bool {
+	return !om.ExpiresAt.IsZero() && !now.Before(om.ExpiresAt)
+}
+
+// Request decodes this message into a device Request suitable for sending to a device.
+func (om OfflineMessage) Request() (*Request, error) {
+	message := new(wrp.Message)
+	if err := wrp.NewDecoderBytes(om.Contents, wrp.Msgpack).Decode(message); err != nil {
+		return nil, err
+	}
+
+	return &Request{
+		Message:  message,
+		Format:   wrp.Msgpack,
+		Contents: om.Contents,
+	}, nil
+}
+
+// OfflineStore is a strategy for holding messages addressed to devices that are not currently
+// connected.  A Manager flushes any messages held for a device once that device connects.
+//
+// Implementations are responsible for enforcing their own bounds and expiration, and must
+// be safe for concurrent access.
+type OfflineStore interface {
+	// Enqueue stores a message for later delivery to the given device.  Any messages evicted
+	// as a result, either because they expired or because the device's queue was full, are returned.
+	Enqueue(ID, OfflineMessage) ([]OfflineMessage, error)
+
+	// Dequeue removes all messages held for the given device.  Messages that are still deliverable
+	// are returned first, in the order they were enqueued, followed by any messages that have expired.
+	Dequeue(ID) ([]OfflineMessage, []OfflineMessage, error)
+
+	// Sweep removes and returns all expired messages, regardless of device.
+	Sweep() ([]OfflineMessage, error)
+}
+
+// OfflineOptions configures the standard OfflineStore implementations in this package
+type OfflineOptions struct {
+	// MaxMessages is the maximum number of messages held for any one device.  When a device's
+	// queue is full, the oldest message is evicted.  If unset, DefaultOfflineMaxMessages is used.
+	MaxMessages int
+
+	// MaxTotalMessages is the maximum number of messages held across all devices by an in-memory store.
+	// Once the store is full, messages are rejected with ErrorOfflineStoreFull until messages are dequeued
+	// or expire.  If unset, DefaultOfflineMaxTotalMessages is used.
+	MaxTotalMessages int
+
+	// TTL is the length of time a message is held before it expires.  If unset, DefaultOfflineTTL is used.
+	TTL time.Duration
+
+	// Now is the closure used to determine the current time.  If not set, time.Now is used.
+	Now func() time.Time
+}
+
+func (o *OfflineOptions) maxMessages() int {
+	if o != nil && o.MaxMessages > 0 {
+		return o.MaxMessages
+	}
+
+	return DefaultOfflineMaxMessages
+}
+
+func (o *OfflineOptions) maxTotalMessages() int {
+	if o != nil && o.MaxTotalMessages > 0 {
+		return o.MaxTotalMessages
+	}
+
+	return DefaultOfflineMaxTotalMessages
+}
+
+func (o *OfflineOptions) ttl() time.Duration {
+	if o != nil && o.TTL > 0 {
+		return o.TTL
+	}
+
+	return DefaultOfflineTTL
+}
+
+func (o *OfflineOptions) now() func() time.Time {
+	if o != nil && o.Now != nil {
+		return o.Now
+	}
+
+	return time.Now
+}
+
+// offlineQueue holds the bounds and expiration policy shared by the standard OfflineStore implementations
+type offlineQueue struct {
+	maxMessages int
+	ttl         time.Duration
+	now         func() time.Time
+}
+
+func newOfflineQueue(o *OfflineOptions) offlineQueue {
+	return offlineQueue{
+		maxMessages: o.maxMessages(),
+		ttl:         o.ttl(),
+		now:         o.now(),
+	}
+}
+
+// split separates a queue into its unexpired and expired messages, preserving order
+func (oq offlineQueue) split(queue []OfflineMessage, now time.Time) (kept []OfflineMessage, expired []OfflineMessage) {
+	for _, om := range queue {
+		if om.Expired(now) {
+			expired = append(expired, om)
+		} else {
+			kept = append(kept, om)
+		}
+	}
+
+	return
+}
+
+// push appends a message to a queue, stamping it with this policy's timestamps.  The new queue
+// is returned along with any evicted messages.
+func (oq offlineQueue) push(queue []OfflineMessage, id ID, om OfflineMessage) ([]OfflineMessage, []OfflineMessage) {
+	now := oq.now()
+	om.ID = id
+	if om.QueuedAt.IsZero() {
+		om.QueuedAt = now
+	}
+
+	if om.ExpiresAt.IsZero() {
+		om.ExpiresAt = om.QueuedAt.Add(oq.ttl)
+	}
+
+	kept, evicted := oq.split(queue, now)
+	if overflow := len(kept) + 1 - oq.maxMessages; overflow > 0 {
+		evicted = append(evicted, kept[:overflow]...)
+		kept = kept[overflow:]
+	}
+
+	return append(kept, om), evicted
+}
+
+// memoryOfflineStore is an OfflineStore that holds messages in process memory
+type memoryOfflineStore struct {
+	offlineQueue
+	maxTotalMessages int
+
+	lock   sync.Mutex
+	queues map[ID][]OfflineMessage
+	total  int
+}
+
+// NewMemoryOfflineStore creates an OfflineStore that keeps messages in memory.  Messages held
+// by the returned store do not survive a restart of the process.  The total number of messages
+// held across all devices is bounded by the MaxTotalMessages option.
+func NewMemoryOfflineStore(o *OfflineOptions) OfflineStore {
+	return &memoryOfflineStore{
+		offlineQueue:     newOfflineQueue(o),
+		maxTotalMessages: o.maxTotalMessages(),
+		queues:           make(map[ID][]OfflineMessage),
+	}
+}
+
+func (mos *memoryOfflineStore) Enqueue(id ID, om OfflineMessage) ([]OfflineMessage, error) {
+	mos.lock.Lock()
+	defer mos.lock.Unlock()
+
+	previous := mos.queues[id]
+	queue, evicted := mos.push(previous, id, om)
+	total := mos.total + len(queue) - len(previous)
+	if total > mos.maxTotalMessages {
+		return nil, ErrorOfflineStoreFull
+	}
+
+	mos.queues[id] = queue
+	mos.total = total
+	return evicted, nil
+}
+
+func (mos *memoryOfflineStore) Dequeue(id ID) ([]OfflineMessage, []OfflineMessage, error) {
+	mos.lock.Lock()
+	queue := mos.queues[id]
+	delete(mos.queues, id)
+	mos.total -= len(queue)
+	mos.lock.Unlock()
+
+	pending, expired := mos.split(queue, mos.now())
+	return pending, expired, nil
+}
+
+func (mos *memoryOfflineStore) Sweep() ([]OfflineMessage, error) {
+	var (
+		now     = mos.now()
+		expired []OfflineMessage
+	)
+
+	mos.lock.Lock()
+	for id, queue := range mos.queues {
+		kept, e := mos.split(queue, now)
+		if len(kept) > 0 {
+			mos.queues[id] = kept
+		} else {
+			delete(mos.queues, id)
+		}
+
+		mos.total -= len(e)
+		expired = append(expired, e...)
+	}
+
+	mos.lock.Unlock()
+	return expired, nil
+}
@@ -0,0 +1,169 @@
+package device
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+const offlineFileSuffix = ".json"
+
+// fileOfflineStore is an OfflineStore that keeps each device's queue in its own file
+// within a directory.  This allows queued messages to survive process restarts.
+type fileOfflineStore struct {
+	offlineQueue
+
+	lock      sync.Mutex
+	directory string
+}
+
+// NewFileOfflineStore creates an OfflineStore backed by files in the given directory.  The
+// directory is created if it does not exist.
+func NewFileOfflineStore(directory string, o *OfflineOptions) (OfflineStore, error) {
+	if err := os.MkdirAll(directory, 0700); err != nil {
+		return nil, err
+	}
+
+	return &fileOfflineStore{
+		offlineQueue: newOfflineQueue(o),
+		directory:    directory,
+	}, nil
+}
+
+// path returns the file which holds the given device's queue.  Device identifiers
+// are hex encoded, since they can contain characters that are not valid in file names.
+func (fos *fileOfflineStore) path(id ID) string {
+	return filepath.Join(fos.directory, hex.EncodeToString([]byte(id))+offlineFileSuffix)
+}
+
+func (fos *fileOfflineStore) read(path string) ([]OfflineMessage, error) {
+	data, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	var queue []OfflineMessage
+	if err := json.Unmarshal(data, &queue); err != nil {
+		return nil, err
+	}
+
+	return queue, nil
+}
+
+// write atomically replaces the file at the given path with the given queue.  An empty queue
+// removes the file.
+func (fos *fileOfflineStore) write(path string, queue []OfflineMessage) error {
+	if len(queue) == 0 {
+		if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+
+		return nil
+	}
+
+	data, err := json.Marshal(queue)
+	if err != nil {
+		return err
+	}
+
+	temp, err := ioutil.TempFile(fos.directory, ".offline-")
+	if err != nil {
+		return err
+	}
+
+	_, err = temp.Write(data)
+	if closeErr := temp.Close(); err == nil {
+		err = closeErr
+	}
+
+	if err == nil {
+		err = os.Rename(temp.Name(), path)
+	}
+
+	if err != nil {
+		os.Remove(temp.Name())
+	}
+
+	return err
+}
+
+func (fos *fileOfflineStore) Enqueue(id ID, om OfflineMessage) ([]OfflineMessage, error) {
+	defer fos.lock.Unlock()
+	fos.lock.Lock()
+
+	path := fos.path(id)
+	queue, err := fos.read(path)
+	if err != nil {
+		return nil, err
+	}
+
+	queue, evicted := fos.push(queue, id, om)
+	if err := fos.write(path, queue); err != nil {
+		return nil, err
+	}
+
+	return evicted, nil
+}
+
+func (fos *fileOfflineStore) Dequeue(id ID) ([]OfflineMessage, []OfflineMessage, error) {
+	fos.lock.Lock()
+	path := fos.path(id)
+	queue, err := fos.read(path)
+	if err == nil {
+		err = fos.write(path, nil)
+	}
+
+	fos.lock.Unlock()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	pending, expired := fos.split(queue, fos.now())
+	return pending, expired, nil
+}
+
+func (fos *fileOfflineStore) Sweep() ([]OfflineMessage, error) {
+	defer fos.lock.Unlock()
+	fos.lock.Lock()
+
+	entries, err := ioutil.ReadDir(fos.directory)
+	if err != nil {
+		return nil, err
+	}
+
+	var (
+		now     = fos.now()
+		expired []OfflineMessage
+	)
+
+	for _, entry := range entries {
+		if entry.IsDir() || !strings.HasSuffix(entry.Name(), offlineFileSuffix) {
+			continue
+		}
+
+		path := filepath.Join(fos.directory, entry.Name())
+		queue, err := fos.read(path)
+		if err != nil {
+			return expired, err
+		}
+
+		kept, e := fos.split(queue, now)
+		if len(e) == 0 {
+			continue
+		}
+
+		if err := fos.write(path, kept); err != nil {
+			return expired, err
+		}
+
+		expired = append(expired, e...)
+	}
+
+	return expired, nil
+}
@@ -0,0 +1,66 @@
+package device
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFileOfflineStore(t *testing.T) {
+	directory, err := ioutil.TempDir("", "offline")
+	require.NoError(t, err)
+	defer os.RemoveAll(directory)
+
+	testOfflineStore(t, func(o *OfflineOptions) OfflineStore {
+		store, err := NewFileOfflineStore(directory, o)
+		require.NoError(t, err)
+		return store
+	})
+
+	t.Run("Persistent", func(t *testing.T) {
+		var (
+			assert  = assert.New(t)
+			require = require.New(t)
+			id      = ID("mac:112233445566")
+		)
+
+		first, err := NewFileOfflineStore(directory, nil)
+		require.NoError(err)
+		_, err = first.Enqueue(id, testOfflineMessage(t, string(id)))
+		require.NoError(err)
+
+		second, err := NewFileOfflineStore(directory, nil)
+		require.NoError(err)
+		pending, expired, err := second.Dequeue(id)
+		require.NoError(err)
+		assert.Empty(expired)
+		assert.Len(pending, 1)
+
+		entries, err := ioutil.ReadDir(directory)
+		require.NoError(err)
+		assert.Empty(entries)
+	})
+
+	t.Run("Corrupt", func(t *testing.T) {
+		var (
+			assert  = assert.New(t)
+			require = require.New(t)
+			id      = ID("mac:112233445566")
+		)
+
+		store, err := NewFileOfflineStore(directory, nil)
+		require.NoError(err)
+		path := store.(*fileOfflineStore).path(id)
+		require.NoError(ioutil.WriteFile(path, []byte("this is not JSON"), 0600))
+		defer os.Remove(path)
+
+		_, err = store.Enqueue(id, testOfflineMessage(t, string(id)))
+		assert.Error(err)
+
+		_, err = store.Sweep()
+		assert.Error(err)
+	})
+}
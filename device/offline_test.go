@@ -0,0 +1,166 @@
+package device
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/xmidt-org/wrp-go/v3"
+)
+
+// testOfflineClock is a manually advanced clock for offline store tests
+type testOfflineClock struct {
+	current time.Time
+}
+
+func (c *testOfflineClock) now() time.Time {
+	return c.current
+}
+
+func testOfflineMessage(t *testing.T, destination string) OfflineMessage {
+	var contents []byte
+	require.NoError(t, wrp.NewEncoderBytes(&contents, wrp.Msgpack).Encode(
+		&wrp.Message{
+			Type:        wrp.SimpleEventMessageType,
+			Source:      "test",
+			Destination: destination,
+		},
+	))
+
+	return OfflineMessage{Contents: contents}
+}
+
+func testOfflineStore(t *testing.T, factory func(*OfflineOptions) OfflineStore) {
+	t.Run("Bounded", func(t *testing.T) {
+		var (
+			assert  = assert.New(t)
+			require = require.New(t)
+			clock   = &testOfflineClock{current: time.Now()}
+			store   = factory(&OfflineOptions{MaxMessages: 2, TTL: time.Minute, Now: clock.now})
+			id      = ID("mac:112233445566")
+		)
+
+		for i := 0; i < 2; i++ {
+			evicted, err := store.Enqueue(id, testOfflineMessage(t, "mac:112233445566/first"))
+			require.NoError(err)
+			assert.Empty(evicted)
+		}
+
+		evicted, err := store.Enqueue(id, testOfflineMessage(t, "mac:112233445566/second"))
+		require.NoError(err)
+		require.Len(evicted, 1)
+		assert.Equal(id, evicted[0].ID)
+
+		pending, expired, err := store.Dequeue(id)
+		require.NoError(err)
+		assert.Empty(expired)
+		require.Len(pending, 2)
+
+		request, err := pending[1].Request()
+		require.NoError(err)
+		actualID, err := request.ID()
+		require.NoError(err)
+		assert.Equal(id, actualID)
+		assert.Equal("mac:112233445566/second", request.Message.(*wrp.Message).Destination)
+
+		pending, expired, err = store.Dequeue(id)
+		assert.NoError(err)
+		assert.Empty(pending)
+		assert.Empty(expired)
+	})
+
+	t.Run("Expiry", func(t *testing.T) {
+		var (
+			assert  = assert.New(t)
+			require = require.New(t)
+			clock   = &testOfflineClock{current: time.Now()}
+			store   = factory(&OfflineOptions{TTL: time.Minute, Now: clock.now})
+			first   = ID("mac:112233445566")
+			second  = ID("mac:665544332211")
+		)
+
+		_, err := store.Enqueue(first, testOfflineMessage(t, string(first)))
+		require.NoError(err)
+		_, err = store.Enqueue(second, testOfflineMessage(t, string(second)))
+		require.NoError(err)
+
+		clock.current = clock.current.Add(30 * time.Second)
+		_, err = store.Enqueue(second, testOfflineMessage(t, string(second)))
+		require.NoError(err)
+
+		clock.current = clock.current.Add(45 * time.Second)
+		expired, err := store.Sweep()
+		require.NoError(err)
+		assert.Len(expired, 2)
+
+		pending, expired, err := store.Dequeue(first)
+		require.NoError(err)
+		assert.Empty(pending)
+		assert.Empty(expired)
+
+		clock.current = clock.current.Add(time.Minute)
+		pending, expired, err = store.Dequeue(second)
+		require.NoError(err)
+		assert.Empty(pending)
+		require.Len(expired, 1)
+		assert.True(expired[0].Expired(clock.current))
+	})
+}
+
+func TestMemoryOfflineStore(t *testing.T) {
+	testOfflineStore(t, NewMemoryOfflineStore)
+
+	t.Run("TotalBounded", func(t *testing.T) {
+		var (
+			assert  = assert.New(t)
+			require = require.New(t)
+			clock   = &testOfflineClock{current: time.Now()}
+			store   = NewMemoryOfflineStore(&OfflineOptions{MaxMessages: 2, MaxTotalMessages: 3, TTL: time.Minute, Now: clock.now})
+			first   = ID("mac:112233445566")
+			second  = ID("mac:665544332211")
+			third   = ID("mac:aabbccddeeff")
+		)
+
+		for _, id := range []ID{first, first, second} {
+			_, err := store.Enqueue(id, testOfflineMessage(t, string(id)))
+			require.NoError(err)
+		}
+
+		evicted, err := store.Enqueue(third, testOfflineMessage(t, string(third)))
+		assert.Equal(ErrorOfflineStoreFull, err)
+		assert.Empty(evicted)
+
+		// replacing a device's oldest message does not grow the store
+		evicted, err = store.Enqueue(first, testOfflineMessage(t, string(first)))
+		require.NoError(err)
+		assert.Len(evicted, 1)
+
+		pending, _, err := store.Dequeue(first)
+		require.NoError(err)
+		assert.Len(pending, 2)
+
+		_, err = store.Enqueue(third, testOfflineMessage(t, string(third)))
+		assert.NoError(err)
+
+		clock.current = clock.current.Add(2 * time.Minute)
+		expired, err := store.Sweep()
+		require.NoError(err)
+		assert.Len(expired, 2)
+
+		for _, id := range []ID{first, first, second} {
+			_, err := store.Enqueue(id, testOfflineMessage(t, string(id)))
+			assert.NoError(err)
+		}
+	})
+}
+
+func TestOfflineOptionsDefault(t *testing.T) {
+	assert := assert.New(t)
+	for _, o := range []*OfflineOptions{nil, new(OfflineOptions)} {
+		assert.Equal(DefaultOfflineMaxMessages, o.maxMessages())
+		assert.Equal(DefaultOfflineMaxTotalMessages, o.maxTotalMessages())
+		assert.Equal(DefaultOfflineTTL, o.ttl())
+		assert.NotNil(o.now())
+	}
+}
@@ -47,14 +47,40 @@ type Options struct {
 	// Upgrader is the gorilla websocket.Upgrader injected into these options.
 	Upgrader websocket.Upgrader
 
+	// EnableCompression enables negotiation of permessage-deflate compression with devices.
+	// Setting Upgrader.EnableCompression has the same effect.
+	EnableCompression bool
+
+	// CompressionLevel is the flate compression level used for messages sent to devices that
+	// negotiated compression.  Valid values range from -2 (Huffman only) to 9 (best compression).
+	// If unset (i.e. zero), the websocket package's default level is used.
+	CompressionLevel int
+
 	// MaxDevices is the maximum number of devices allowed to connect to any one Manager.
 	// If unset (i.e. zero), math.MaxUint32 is used as the maximum.
 	MaxDevices int
 
+	// RegistryShards is the number of independently locked partitions of the device registry.  Iterating
+	// over devices, e.g. during a drain, only locks one shard at a time, so more shards reduce the impact
+	// of such operations on connecting devices.  If unset, DefaultRegistryShards is used.
+	RegistryShards int
+
 	// DeviceMessageQueueSize is the capacity of the channel which stores messages waiting
 	// to be transmitted to a device.  If not supplied, DefaultDeviceMessageQueueSize is used.
 	DeviceMessageQueueSize int
 
+	// RequestResponseQueueSize is the capacity of the highest priority outbound lane, which carries
+	// request/response and CRUD messages.  If not supplied, DeviceMessageQueueSize is used.
+	RequestResponseQueueSize int
+
+	// EventQueueSize is the capacity of the outbound lane which carries events and any other
+	// messages that are not request/response.  If not supplied, DeviceMessageQueueSize is used.
+	EventQueueSize int
+
+	// BulkQueueSize is the capacity of the lowest priority outbound lane.  If not supplied,
+	// DeviceMessageQueueSize is used.
+	BulkQueueSize int
+
 	// PingPeriod is the time between pings sent to each device
 	PingPeriod time.Duration
 
@@ -93,17 +119,74 @@ type Options struct {
 
 	// Filter determines whether or not a device should be able to connect to talaria based on the filters in place
 	Filter Filter
+
+	// OfflineStore is the optional store for messages routed to devices that are not connected.  Such
+	// messages are delivered once the device connects.  If not set, routing to a device that is not
+	// connected fails immediately.
+	OfflineStore OfflineStore
+
+	// OfflineSweepPeriod is the minimum time between sweeps of the OfflineStore for expired messages.
+	// If not supplied, DefaultOfflineSweepPeriod is used.
+	OfflineSweepPeriod time.Duration
+
+	// OutboundRateLimit is the token bucket applied to messages routed to each device.  If its
+	// Rate is unset, messages routed to devices are not limited.
+	OutboundRateLimit RateLimit
+
+	// PartnerOutboundRateLimits overrides OutboundRateLimit for devices whose partner ID claim
+	// matches a key in this map.
+	PartnerOutboundRateLimits map[string]RateLimit
+
+	// OutboundRateLimitPolicy determines what happens to messages that exceed a device's outbound
+	// rate limit.  If not supplied, RateLimitReject is used.
+	OutboundRateLimitPolicy RateLimitPolicy
+
+	// OutboundRateLimitMaxDelay is the longest time a message will wait on a device's outbound rate
+	// limit under the delay and queue policies.  Messages that would wait longer are rejected.
+	// If not supplied, DefaultRateLimitMaxDelay is used.
+	OutboundRateLimitMaxDelay time.Duration
+
+	// InboundRateLimit limits the number of messages each device may send per second.  If its
+	// Rate is unset, the number of inbound messages is not limited.
+	InboundRateLimit RateLimit
+
+	// InboundByteRateLimit limits the number of bytes each device may send per second.  Its Burst
+	// is expressed in bytes.  A frame larger than the Burst is allowed once the device has accumulated
+	// a full burst, and is then paid for at Rate before more frames are allowed.  If its Rate is unset,
+	// inbound bytes are not limited.
+	InboundByteRateLimit RateLimit
+
+	// InboundRateLimitPolicy determines what happens when a device exceeds either inbound limit.
+	// Valid values are RateLimitDrop, RateLimitLog, and RateLimitDisconnect.  If not supplied,
+	// RateLimitDrop is used.
+	InboundRateLimitPolicy RateLimitPolicy
+
+	// SessionResumeWindow is the length of time after a device disconnects during which a new connection
+	// from that device may resume its session, taking over any pending transactions and traffic counters.
+	// Only devices whose Metadata carries a session ID can resume, which they do by sending their prior
+	// session ID in the ResumeTokenHeader.  If unset, sessions are never resumed and pending transactions
+	// fail as soon as a device disconnects.
+	SessionResumeWindow time.Duration
 }
 
 func (o *Options) upgrader() *websocket.Upgrader {
 	upgrader := new(websocket.Upgrader)
 	if o != nil {
 		*upgrader = o.Upgrader
+		upgrader.EnableCompression = upgrader.EnableCompression || o.EnableCompression
 	}
 
 	return upgrader
 }
 
+func (o *Options) compressionLevel() int {
+	if o != nil {
+		return o.CompressionLevel
+	}
+
+	return 0
+}
+
 func (o *Options) deviceMessageQueueSize() int {
 	if o != nil && o.DeviceMessageQueueSize > 0 {
 		return o.DeviceMessageQueueSize
@@ -112,6 +195,18 @@ func (o *Options) deviceMessageQueueSize() int {
 	return DefaultDeviceMessageQueueSize
 }
 
+// laneQueueSizes returns the capacity of each outbound lane, in priority order.  A nonpositive
+// capacity indicates that deviceMessageQueueSize should be used.
+func (o *Options) laneQueueSizes() (sizes [laneCount]int) {
+	if o != nil {
+		sizes[RequestResponseLane.index()] = o.RequestResponseQueueSize
+		sizes[EventLane.index()] = o.EventQueueSize
+		sizes[BulkLane.index()] = o.BulkQueueSize
+	}
+
+	return
+}
+
 func (o *Options) maxDevices() int {
 	if o != nil && o.MaxDevices > 0 {
 		return o.MaxDevices
@@ -120,6 +215,14 @@ func (o *Options) maxDevices() int {
 	return 0
 }
 
+func (o *Options) registryShards() int {
+	if o != nil && o.RegistryShards > 0 {
+		return o.RegistryShards
+	}
+
+	return DefaultRegistryShards
+}
+
 func (o *Options) idlePeriod() time.Duration {
 	if o != nil && o.IdlePeriod > 0 {
 		return o.IdlePeriod
@@ -192,6 +295,89 @@ func (o *Options) filter() Filter {
 	return defaultFilterFunc()
 }
 
+func (o *Options) offlineStore() OfflineStore {
+	if o != nil {
+		return o.OfflineStore
+	}
+
+	return nil
+}
+
+func (o *Options) offlineSweepPeriod() time.Duration {
+	if o != nil && o.OfflineSweepPeriod > 0 {
+		return o.OfflineSweepPeriod
+	}
+
+	return DefaultOfflineSweepPeriod
+}
+
+// outboundRateLimit returns the outbound rate limit for a device with the given metadata
+func (o *Options) outboundRateLimit(metadata *Metadata) RateLimit {
+	if o == nil {
+		return RateLimit{}
+	}
+
+	if limit, ok := o.PartnerOutboundRateLimits[metadata.PartnerIDClaim()]; ok {
+		return limit
+	}
+
+	return o.OutboundRateLimit
+}
+
+func (o *Options) outboundRateLimitPolicy() RateLimitPolicy {
+	if o != nil {
+		switch o.OutboundRateLimitPolicy {
+		case RateLimitDelay, RateLimitQueue:
+			return o.OutboundRateLimitPolicy
+		}
+	}
+
+	return RateLimitReject
+}
+
+func (o *Options) outboundRateLimitMaxDelay() time.Duration {
+	if o != nil && o.OutboundRateLimitMaxDelay > 0 {
+		return o.OutboundRateLimitMaxDelay
+	}
+
+	return DefaultRateLimitMaxDelay
+}
+
+func (o *Options) inboundRateLimit() RateLimit {
+	if o != nil {
+		return o.InboundRateLimit
+	}
+
+	return RateLimit{}
+}
+
+func (o *Options) inboundByteRateLimit() RateLimit {
+	if o != nil {
+		return o.InboundByteRateLimit
+	}
+
+	return RateLimit{}
+}
+
+func (o *Options) inboundRateLimitPolicy() RateLimitPolicy {
+	if o != nil {
+		switch o.InboundRateLimitPolicy {
+		case RateLimitLog, RateLimitDisconnect:
+			return o.InboundRateLimitPolicy
+		}
+	}
+
+	return RateLimitDrop
+}
+
+func (o *Options) sessionResumeWindow() time.Duration {
+	if o != nil && o.SessionResumeWindow > 0 {
+		return o.SessionResumeWindow
+	}
+
+	return 0
+}
+
 func (o *Options) wrpCheck() wrpSourceCheckConfig {
 	if o != nil && oneOf(o.WRPSourceCheck.Type, CheckTypeEnforce, CheckTypeMonitor) {
 		return o.WRPSourceCheck
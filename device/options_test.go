@@ -25,6 +25,19 @@ func TestOptionsDefault(t *testing.T) {
 		assert.NotNil(o.logger())
 		assert.Empty(o.listeners())
 		assert.Equal(provider.NewDiscardProvider(), o.metricsProvider())
+		assert.False(o.upgrader().EnableCompression)
+		assert.Zero(o.compressionLevel())
+		assert.Equal([laneCount]int{}, o.laneQueueSizes())
+		assert.Nil(o.offlineStore())
+		assert.Equal(DefaultOfflineSweepPeriod, o.offlineSweepPeriod())
+		assert.Equal(RateLimit{}, o.outboundRateLimit(new(Metadata)))
+		assert.Equal(RateLimitReject, o.outboundRateLimitPolicy())
+		assert.Equal(DefaultRateLimitMaxDelay, o.outboundRateLimitMaxDelay())
+		assert.Equal(RateLimit{}, o.inboundRateLimit())
+		assert.Equal(RateLimit{}, o.inboundByteRateLimit())
+		assert.Equal(RateLimitDrop, o.inboundRateLimitPolicy())
+		assert.Zero(o.sessionResumeWindow())
+		assert.Equal(DefaultRegistryShards, o.registryShards())
 	}
 }
 
@@ -33,6 +46,7 @@ func TestOptions(t *testing.T) {
 		assert                  = assert.New(t)
 		expectedLogger          = logging.DefaultLogger()
 		expectedMetricsProvider = provider.NewPrometheusProvider("test", "test")
+		expectedOfflineStore    = NewMemoryOfflineStore(nil)
 
 		o = Options{
 			Upgrader: websocket.Upgrader{
@@ -41,28 +55,50 @@ func TestOptions(t *testing.T) {
 				WriteBufferSize:  DefaultWriteBufferSize + 926,
 				Subprotocols:     []string{"foobar"},
 			},
-			MaxDevices:             20000,
-			DeviceMessageQueueSize: DefaultDeviceMessageQueueSize + 287342,
-			IdlePeriod:             DefaultIdlePeriod + 3472*time.Minute,
-			PingPeriod:             DefaultPingPeriod + 384*time.Millisecond,
-			WriteTimeout:           DefaultWriteTimeout + 327193*time.Second,
-			Logger:                 expectedLogger,
-			Listeners:              []Listener{func(*Event) {}},
-			MetricsProvider:        expectedMetricsProvider,
+			EnableCompression:        true,
+			CompressionLevel:         6,
+			MaxDevices:               20000,
+			DeviceMessageQueueSize:   DefaultDeviceMessageQueueSize + 287342,
+			RequestResponseQueueSize: 17,
+			EventQueueSize:           243,
+			BulkQueueSize:            1000,
+			IdlePeriod:               DefaultIdlePeriod + 3472*time.Minute,
+			PingPeriod:               DefaultPingPeriod + 384*time.Millisecond,
+			WriteTimeout:             DefaultWriteTimeout + 327193*time.Second,
+			Logger:                   expectedLogger,
+			Listeners:                []Listener{func(*Event) {}},
+			MetricsProvider:          expectedMetricsProvider,
+			OfflineStore:             expectedOfflineStore,
+			OfflineSweepPeriod:       DefaultOfflineSweepPeriod + 17*time.Second,
+			OutboundRateLimit:        RateLimit{Rate: 10.0, Burst: 20},
+			PartnerOutboundRateLimits: map[string]RateLimit{
+				"comcast": {Rate: 100.0},
+			},
+			OutboundRateLimitPolicy:   RateLimitQueue,
+			OutboundRateLimitMaxDelay: 17 * time.Minute,
+			InboundRateLimit:          RateLimit{Rate: 5.0},
+			InboundByteRateLimit:      RateLimit{Rate: 1024.0, Burst: 4096},
+			InboundRateLimitPolicy:    RateLimitDisconnect,
+			SessionResumeWindow:       90 * time.Second,
+			RegistryShards:            7,
 		}
 	)
 
 	assert.Equal(o.DeviceMessageQueueSize, o.deviceMessageQueueSize())
 	assert.Equal(
 		websocket.Upgrader{
-			HandshakeTimeout: 12377123 * time.Second,
-			ReadBufferSize:   DefaultReadBufferSize + 48729,
-			WriteBufferSize:  DefaultWriteBufferSize + 926,
-			Subprotocols:     []string{"foobar"},
+			HandshakeTimeout:  12377123 * time.Second,
+			ReadBufferSize:    DefaultReadBufferSize + 48729,
+			WriteBufferSize:   DefaultWriteBufferSize + 926,
+			Subprotocols:      []string{"foobar"},
+			EnableCompression: true,
 		},
 		*o.upgrader(),
 	)
 
+	assert.Equal(6, o.compressionLevel())
+
+	assert.Equal([laneCount]int{17, 243, 1000}, o.laneQueueSizes())
 	assert.Equal(20000, o.maxDevices())
 	assert.Equal(o.IdlePeriod, o.idlePeriod())
 	assert.Equal(o.PingPeriod, o.pingPeriod())
@@ -70,4 +106,18 @@ func TestOptions(t *testing.T) {
 	assert.Equal(expectedLogger, o.logger())
 	assert.Equal(o.Listeners, o.listeners())
 	assert.Equal(expectedMetricsProvider, o.metricsProvider())
+	assert.Equal(expectedOfflineStore, o.offlineStore())
+	assert.Equal(o.OfflineSweepPeriod, o.offlineSweepPeriod())
+	assert.Equal(o.OutboundRateLimitPolicy, o.outboundRateLimitPolicy())
+	assert.Equal(o.OutboundRateLimitMaxDelay, o.outboundRateLimitMaxDelay())
+	assert.Equal(o.InboundRateLimit, o.inboundRateLimit())
+	assert.Equal(o.InboundByteRateLimit, o.inboundByteRateLimit())
+	assert.Equal(o.InboundRateLimitPolicy, o.inboundRateLimitPolicy())
+	assert.Equal(o.SessionResumeWindow, o.sessionResumeWindow())
+	assert.Equal(7, o.registryShards())
+
+	assert.Equal(RateLimit{Rate: 10.0, Burst: 20}, o.outboundRateLimit(new(Metadata)))
+	partnerMetadata := new(Metadata)
+	partnerMetadata.SetClaims(map[string]interface{}{PartnerIDClaimKey: "comcast"})
+	assert.Equal(RateLimit{Rate: 100.0}, o.outboundRateLimit(partnerMetadata))
 }
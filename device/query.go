@@ -0,0 +1,450 @@
+package device
+
+import (
+	"container/heap"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// QuerySort identifies the field by which query results are ordered
+type QuerySort string
+
+const (
+	// SortByID orders devices by their ID.  This is the default.
+	SortByID QuerySort = "id"
+
+	// SortByConnectedAt orders devices by the time they connected
+	SortByConnectedAt QuerySort = "connectedAt"
+
+	// SortByUpTime orders devices by how long they have been connected
+	SortByUpTime QuerySort = "upTime"
+
+	// SortByBytesSent orders devices by the number of bytes sent to them
+	SortByBytesSent QuerySort = "bytesSent"
+
+	// SortByBytesReceived orders devices by the number of bytes received from them
+	SortByBytesReceived QuerySort = "bytesReceived"
+)
+
+// DefaultQueryLimit is the maximum number of devices returned by a query that does not specify a limit
+const DefaultQueryLimit = 1000
+
+var (
+	ErrorInvalidQuerySort = errors.New("Invalid query sort field")
+	ErrorInvalidCursor    = errors.New("Invalid query cursor")
+)
+
+// Query describes a subset of connected devices.  All of the supplied criteria must match
+// for a device to be included in the results.  Zero values impose no restriction.
+type Query struct {
+	// Metadata restricts results to devices having, for each key, at least one of the given values.
+	// As with devicegate filters, keys are first looked up in the device's metadata and then in its
+	// JWT claims, and a multivalued attribute matches if any of its elements match.  Values are compared
+	// by their string forms, so that values taken from URLs match typed claims.
+	Metadata map[string][]interface{}
+
+	// Convey restricts results to devices whose convey has, for each key, one of the given values
+	Convey map[string][]interface{}
+
+	// ConnectedSince restricts results to devices that connected at or after this time
+	ConnectedSince time.Time
+
+	// MinUpTime and MaxUpTime bound how long devices have been connected
+	MinUpTime time.Duration
+	MaxUpTime time.Duration
+
+	// MinBytesSent and MaxBytesSent bound the number of bytes sent to devices
+	MinBytesSent int
+	MaxBytesSent int
+
+	// MinBytesReceived and MaxBytesReceived bound the number of bytes received from devices
+	MinBytesReceived int
+	MaxBytesReceived int
+
+	// Sort is the field that results are ordered by.  Devices with the same value
+	// for that field are ordered by ID.  If unset, SortByID is used.
+	Sort QuerySort
+
+	// Descending reverses the sort order
+	Descending bool
+
+	// Limit is the maximum number of devices returned.  If nonpositive, DefaultQueryLimit is used.
+	Limit int
+
+	// Cursor is the NextCursor of a previous result, and resumes that query from where it left off.
+	// The query's criteria and sort must be the same as that of the query which produced the cursor.
+	Cursor string
+}
+
+// Querier is implemented by a Registry that executes device queries itself.  The Manager created by
+// NewManager implements this interface.  Queries against a Registry that does not implement this
+// interface can be executed with RunQuery.
+type Querier interface {
+	// Query returns a sorted page of the devices which match the given query
+	Query(Query) (QueryResult, error)
+}
+
+// QueryResult is a single page of devices matching a Query
+type QueryResult struct {
+	// Devices are the matching devices, in sorted order
+	Devices []Interface
+
+	// NextCursor, if not empty, can be supplied as Query.Cursor to fetch the next page of results
+	NextCursor string
+}
+
+const (
+	// MetadataQueryPrefix prefixes URL query parameters that match device metadata or claims,
+	// e.g. metadata.partner-id=comcast
+	MetadataQueryPrefix = "metadata."
+
+	// ConveyQueryPrefix prefixes URL query parameters that match convey fields, e.g. convey.fw-name=1.0
+	ConveyQueryPrefix = "convey."
+)
+
+// ParseQuery produces a Query from URL query parameters.  Besides the metadata and convey prefixed
+// parameters, the supported parameters are connectedSince (RFC3339), minUpTime and maxUpTime (durations),
+// minBytesSent, maxBytesSent, minBytesReceived, maxBytesReceived, sort, order (asc or desc), limit, and cursor.
+// Parameters may be repeated to match any of several values.
+func ParseQuery(values url.Values) (q Query, err error) {
+	for name, v := range values {
+		var target *map[string][]interface{}
+		switch {
+		case strings.HasPrefix(name, MetadataQueryPrefix):
+			target, name = &q.Metadata, strings.TrimPrefix(name, MetadataQueryPrefix)
+		case strings.HasPrefix(name, ConveyQueryPrefix):
+			target, name = &q.Convey, strings.TrimPrefix(name, ConveyQueryPrefix)
+		default:
+			continue
+		}
+
+		if *target == nil {
+			*target = make(map[string][]interface{})
+		}
+
+		for _, value := range v {
+			(*target)[name] = append((*target)[name], value)
+		}
+	}
+
+	if v := values.Get("connectedSince"); len(v) > 0 {
+		if q.ConnectedSince, err = time.Parse(time.RFC3339, v); err != nil {
+			return Query{}, fmt.Errorf("Invalid connectedSince: %s", err)
+		}
+	}
+
+	for name, target := range map[string]*time.Duration{"minUpTime": &q.MinUpTime, "maxUpTime": &q.MaxUpTime} {
+		if v := values.Get(name); len(v) > 0 {
+			if *target, err = time.ParseDuration(v); err != nil {
+				return Query{}, fmt.Errorf("Invalid %s: %s", name, err)
+			}
+		}
+	}
+
+	for name, target := range map[string]*int{
+		"minBytesSent":     &q.MinBytesSent,
+		"maxBytesSent":     &q.MaxBytesSent,
+		"minBytesReceived": &q.MinBytesReceived,
+		"maxBytesReceived": &q.MaxBytesReceived,
+		"limit":            &q.Limit,
+	} {
+		if v := values.Get(name); len(v) > 0 {
+			if *target, err = strconv.Atoi(v); err != nil {
+				return Query{}, fmt.Errorf("Invalid %s: %s", name, err)
+			}
+		}
+	}
+
+	q.Sort = QuerySort(values.Get("sort"))
+	if !q.validSort() {
+		return Query{}, ErrorInvalidQuerySort
+	}
+
+	switch order := values.Get("order"); order {
+	case "", "asc":
+	case "desc":
+		q.Descending = true
+	default:
+		return Query{}, fmt.Errorf("Invalid order: %s", order)
+	}
+
+	q.Cursor = values.Get("cursor")
+	return
+}
+
+// queryEntry is a matched device along with the value it is sorted by
+type queryEntry struct {
+	device Interface
+	id     string
+	key    int64
+}
+
+// less orders entries by key, then by ID
+func (qe queryEntry) less(other queryEntry) bool {
+	if qe.key != other.key {
+		return qe.key < other.key
+	}
+
+	return qe.id < other.id
+}
+
+func (q *Query) limit() int {
+	if q.Limit > 0 {
+		return q.Limit
+	}
+
+	return DefaultQueryLimit
+}
+
+// sortKey produces the value that a device is ordered by, apart from its ID.  Up time is sorted by
+// connection time in the opposite direction, so that cursors remain valid as time passes.
+func (q *Query) sortKey(d Interface) int64 {
+	switch q.Sort {
+	case SortByConnectedAt:
+		return d.Statistics().ConnectedAt().UnixNano()
+	case SortByUpTime:
+		return -d.Statistics().ConnectedAt().UnixNano()
+	case SortByBytesSent:
+		return int64(d.Statistics().BytesSent())
+	case SortByBytesReceived:
+		return int64(d.Statistics().BytesReceived())
+	default:
+		return 0
+	}
+}
+
+// validSort tests if this query's sort field is supported
+func (q *Query) validSort() bool {
+	switch q.Sort {
+	case "", SortByID, SortByConnectedAt, SortByUpTime, SortByBytesSent, SortByBytesReceived:
+		return true
+	default:
+		return false
+	}
+}
+
+// matches tests if a device satisfies all the criteria of this query
+func (q *Query) matches(d Interface, now time.Time) bool {
+	s := d.Statistics()
+	if !q.ConnectedSince.IsZero() && s.ConnectedAt().Before(q.ConnectedSince) {
+		return false
+	}
+
+	if q.MinUpTime > 0 || q.MaxUpTime > 0 {
+		upTime := now.Sub(s.ConnectedAt())
+		if (q.MinUpTime > 0 && upTime < q.MinUpTime) || (q.MaxUpTime > 0 && upTime > q.MaxUpTime) {
+			return false
+		}
+	}
+
+	if !inRange(s.BytesSent(), q.MinBytesSent, q.MaxBytesSent) || !inRange(s.BytesReceived(), q.MinBytesReceived, q.MaxBytesReceived) {
+		return false
+	}
+
+	for key, values := range q.Metadata {
+		metadata := d.Metadata()
+		actual := metadata.Load(key)
+		if actual == nil {
+			actual = metadata.Claims()[key]
+		}
+
+		if !valueMatch(actual, values) {
+			return false
+		}
+	}
+
+	for key, values := range q.Convey {
+		c := d.Convey()
+		if c == nil {
+			return false
+		}
+
+		actual, _ := c.Get(key)
+		if !valueMatch(actual, values) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// inRange tests a value against optional bounds, where nonpositive bounds are ignored
+func inRange(v, min, max int) bool {
+	return (min <= 0 || v >= min) && (max <= 0 || v <= max)
+}
+
+// valueMatch tests if an attribute, or any of its elements if it is multivalued, is one of the given values
+func valueMatch(actual interface{}, values []interface{}) bool {
+	if actual == nil {
+		return false
+	}
+
+	candidates, ok := actual.([]interface{})
+	if !ok {
+		candidates = []interface{}{actual}
+	}
+
+	for _, candidate := range candidates {
+		c := fmt.Sprint(candidate)
+		for _, v := range values {
+			if c == fmt.Sprint(v) {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+// encodeCursor produces the opaque cursor that resumes a query after the given entry
+func encodeCursor(last queryEntry) string {
+	return base64.RawURLEncoding.EncodeToString(
+		[]byte(strconv.FormatInt(last.key, 10) + "/" + last.id),
+	)
+}
+
+// decodeCursor parses a cursor produced by encodeCursor
+func decodeCursor(cursor string) (queryEntry, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return queryEntry{}, ErrorInvalidCursor
+	}
+
+	i := strings.IndexByte(string(raw), '/')
+	if i < 0 {
+		return queryEntry{}, ErrorInvalidCursor
+	}
+
+	key, err := strconv.ParseInt(string(raw[:i]), 10, 64)
+	if err != nil {
+		return queryEntry{}, ErrorInvalidCursor
+	}
+
+	return queryEntry{key: key, id: string(raw[i+1:])}, nil
+}
+
+// queryPage is a heap which holds the first n entries, in query order, out of all the entries offered
+// to it.  The root of the heap is the last of those entries, so that it can be replaced cheaply.
+type queryPage struct {
+	entries    []queryEntry
+	n          int
+	descending bool
+}
+
+// before tests if entry a comes before entry b in query order
+func (qp *queryPage) before(a, b queryEntry) bool {
+	if qp.descending {
+		return b.less(a)
+	}
+
+	return a.less(b)
+}
+
+func (qp *queryPage) Len() int           { return len(qp.entries) }
+func (qp *queryPage) Less(i, j int) bool { return qp.before(qp.entries[j], qp.entries[i]) }
+func (qp *queryPage) Swap(i, j int)      { qp.entries[i], qp.entries[j] = qp.entries[j], qp.entries[i] }
+
+func (qp *queryPage) Push(x interface{}) {
+	qp.entries = append(qp.entries, x.(queryEntry))
+}
+
+func (qp *queryPage) Pop() interface{} {
+	last := qp.entries[len(qp.entries)-1]
+	qp.entries = qp.entries[:len(qp.entries)-1]
+	return last
+}
+
+// offer adds an entry to this page if it is among the first n entries offered so far
+func (qp *queryPage) offer(e queryEntry) {
+	if len(qp.entries) < qp.n {
+		heap.Push(qp, e)
+	} else if qp.before(e, qp.entries[0]) {
+		qp.entries[0] = e
+		heap.Fix(qp, 0)
+	}
+}
+
+// sorted returns the entries of this page in query order
+func (qp *queryPage) sorted() []queryEntry {
+	sort.Slice(qp.entries, func(i, j int) bool {
+		return qp.before(qp.entries[i], qp.entries[j])
+	})
+
+	return qp.entries
+}
+
+// RunQuery executes a query against any Registry, using its VisitAll method.  If now is nil,
+// time.Now is used.  Only a page of matching devices is held in memory at once, regardless of
+// the size of the registry.
+//
+// Pagination is keyset-based: a cursor records the sort key and ID of the last device returned.
+// When sorting by ID, connection time, or up time, which never change for a connected device,
+// devices connecting or disconnecting between pages do not cause others to be skipped or repeated.
+// Sorting by bytes sent or received uses traffic counters that change as devices communicate,
+// so a device whose counters change between pages may be skipped or repeated.
+func RunQuery(r Registry, q Query, now func() time.Time) (QueryResult, error) {
+	if now == nil {
+		now = time.Now
+	}
+
+	if !q.validSort() {
+		return QueryResult{}, ErrorInvalidQuerySort
+	}
+
+	var (
+		after     queryEntry
+		hasCursor = len(q.Cursor) > 0
+		err       error
+	)
+
+	if hasCursor {
+		if after, err = decodeCursor(q.Cursor); err != nil {
+			return QueryResult{}, err
+		}
+	}
+
+	var (
+		start = now()
+		limit = q.limit()
+
+		// one entry beyond the limit is kept, to determine whether there is a next page
+		page = &queryPage{n: limit + 1, descending: q.Descending}
+	)
+
+	r.VisitAll(func(d Interface) bool {
+		if !q.matches(d, start) {
+			return true
+		}
+
+		e := queryEntry{device: d, id: string(d.ID()), key: q.sortKey(d)}
+		if hasCursor && !page.before(after, e) {
+			return true
+		}
+
+		page.offer(e)
+		return true
+	})
+
+	var (
+		result  QueryResult
+		entries = page.sorted()
+	)
+
+	if len(entries) > limit {
+		entries = entries[:limit]
+		result.NextCursor = encodeCursor(entries[limit-1])
+	}
+
+	result.Devices = make([]Interface, len(entries))
+	for i, e := range entries {
+		result.Devices[i] = e.device
+	}
+
+	return result, nil
+}
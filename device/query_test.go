@@ -0,0 +1,338 @@
+package device
+
+import (
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/xmidt-org/webpa-common/convey"
+	"github.com/xmidt-org/webpa-common/logging"
+)
+
+// testQueryRegistry is a simple Registry over a fixed set of devices
+type testQueryRegistry []Interface
+
+func (tqr testQueryRegistry) Len() int {
+	return len(tqr)
+}
+
+func (tqr testQueryRegistry) Get(id ID) (Interface, bool) {
+	for _, d := range tqr {
+		if d.ID() == id {
+			return d, true
+		}
+	}
+
+	return nil, false
+}
+
+func (tqr testQueryRegistry) VisitAll(f func(Interface) bool) int {
+	for i, d := range tqr {
+		if !f(d) {
+			return i + 1
+		}
+	}
+
+	return len(tqr)
+}
+
+func (tqr testQueryRegistry) Query(q Query) (QueryResult, error) {
+	return RunQuery(tqr, q, testQueryNow)
+}
+
+var testQueryEpoch = time.Date(2020, time.June, 1, 12, 0, 0, 0, time.UTC)
+
+func testQueryNow() time.Time {
+	return testQueryEpoch
+}
+
+// newTestQueryRegistry creates devices 0 through 9.  Device i connected i hours ago, has been sent
+// i*100 bytes, belongs to partner "even" or "odd", and reports firmware "fw-i".
+func newTestQueryRegistry(t *testing.T) testQueryRegistry {
+	var (
+		logger = logging.NewTestLogger(nil, t)
+		r      testQueryRegistry
+	)
+
+	for i := 0; i < 10; i++ {
+		metadata := new(Metadata)
+		partner := "even"
+		if i%2 == 1 {
+			partner = "odd"
+		}
+
+		metadata.SetClaims(map[string]interface{}{
+			PartnerIDClaimKey: partner,
+			TrustClaimKey:     i,
+		})
+
+		metadata.Store("tags", []interface{}{"all", partner})
+
+		d := newDevice(deviceOptions{
+			ID:          IntToMAC(uint64(i)),
+			C:           convey.C{"fw-name": "fw-" + string(rune('0'+i))},
+			ConnectedAt: testQueryEpoch.Add(-time.Duration(i) * time.Hour),
+			Metadata:    metadata,
+			Logger:      logger,
+		})
+
+		d.statistics.AddBytesSent(i * 100)
+		r = append(r, d)
+	}
+
+	return r
+}
+
+func testQueryIDs(devices []Interface) []ID {
+	ids := make([]ID, len(devices))
+	for i, d := range devices {
+		ids[i] = d.ID()
+	}
+
+	return ids
+}
+
+func testRunQueryFilter(t *testing.T) {
+	r := newTestQueryRegistry(t)
+	testData := []struct {
+		description string
+		query       Query
+		expected    []ID
+	}{
+		{"All", Query{}, testQueryIDs(r)},
+		{"Claim", Query{Metadata: map[string][]interface{}{PartnerIDClaimKey: {"odd"}}}, []ID{IntToMAC(1), IntToMAC(3), IntToMAC(5), IntToMAC(7), IntToMAC(9)}},
+		{"TypedClaim", Query{Metadata: map[string][]interface{}{TrustClaimKey: {"2", 4}}}, []ID{IntToMAC(2), IntToMAC(4)}},
+		{"MultivaluedMetadata", Query{Metadata: map[string][]interface{}{"tags": {"even"}}}, []ID{IntToMAC(0), IntToMAC(2), IntToMAC(4), IntToMAC(6), IntToMAC(8)}},
+		{"MissingMetadata", Query{Metadata: map[string][]interface{}{"nosuch": {"value"}}}, []ID{}},
+		{"Convey", Query{Convey: map[string][]interface{}{"fw-name": {"fw-3", "fw-7"}}}, []ID{IntToMAC(3), IntToMAC(7)}},
+		{"ConnectedSince", Query{ConnectedSince: testQueryEpoch.Add(-2 * time.Hour)}, []ID{IntToMAC(0), IntToMAC(1), IntToMAC(2)}},
+		{"UpTime", Query{MinUpTime: 4 * time.Hour, MaxUpTime: 6 * time.Hour}, []ID{IntToMAC(4), IntToMAC(5), IntToMAC(6)}},
+		{"BytesSent", Query{MinBytesSent: 750, MaxBytesSent: 800}, []ID{IntToMAC(8)}},
+		{"BytesReceived", Query{MinBytesReceived: 1}, []ID{}},
+		{
+			"Combined",
+			Query{
+				Metadata:     map[string][]interface{}{PartnerIDClaimKey: {"even"}},
+				MinBytesSent: 300,
+			},
+			[]ID{IntToMAC(4), IntToMAC(6), IntToMAC(8)},
+		},
+	}
+
+	for _, record := range testData {
+		t.Run(record.description, func(t *testing.T) {
+			var (
+				assert  = assert.New(t)
+				require = require.New(t)
+			)
+
+			result, err := r.Query(record.query)
+			require.NoError(err)
+			assert.Equal(record.expected, testQueryIDs(result.Devices))
+			assert.Empty(result.NextCursor)
+		})
+	}
+}
+
+func testRunQuerySort(t *testing.T) {
+	r := newTestQueryRegistry(t)
+	testData := []struct {
+		sort       QuerySort
+		descending bool
+		expected   []ID
+	}{
+		{SortByID, true, []ID{IntToMAC(9), IntToMAC(8), IntToMAC(7)}},
+		{SortByConnectedAt, false, []ID{IntToMAC(9), IntToMAC(8), IntToMAC(7)}},
+		{SortByUpTime, false, []ID{IntToMAC(0), IntToMAC(1), IntToMAC(2)}},
+		{SortByUpTime, true, []ID{IntToMAC(9), IntToMAC(8), IntToMAC(7)}},
+		{SortByBytesSent, true, []ID{IntToMAC(9), IntToMAC(8), IntToMAC(7)}},
+		{SortByBytesReceived, false, []ID{IntToMAC(0), IntToMAC(1), IntToMAC(2)}},
+	}
+
+	for _, record := range testData {
+		t.Run(string(record.sort), func(t *testing.T) {
+			var (
+				assert  = assert.New(t)
+				require = require.New(t)
+			)
+
+			result, err := r.Query(Query{Sort: record.sort, Descending: record.descending, Limit: 3})
+			require.NoError(err)
+			assert.Equal(record.expected, testQueryIDs(result.Devices))
+			assert.NotEmpty(result.NextCursor)
+		})
+	}
+
+	t.Run("Invalid", func(t *testing.T) {
+		_, err := r.Query(Query{Sort: "nosuch"})
+		assert.Equal(t, ErrorInvalidQuerySort, err)
+	})
+}
+
+func testRunQueryPagination(t *testing.T) {
+	for _, descending := range []bool{false, true} {
+		t.Run(map[bool]string{false: "Ascending", true: "Descending"}[descending], func(t *testing.T) {
+			var (
+				assert  = assert.New(t)
+				require = require.New(t)
+				r       = newTestQueryRegistry(t)
+
+				q     = Query{Sort: SortByBytesSent, Descending: descending, Limit: 4}
+				pages [][]ID
+			)
+
+			for {
+				result, err := r.Query(q)
+				require.NoError(err)
+				pages = append(pages, testQueryIDs(result.Devices))
+
+				// devices disconnecting between pages must not cause others to be skipped
+				if len(pages) == 1 {
+					r = r[1:]
+				}
+
+				if len(result.NextCursor) == 0 {
+					break
+				}
+
+				q.Cursor = result.NextCursor
+			}
+
+			if descending {
+				assert.Equal(
+					[][]ID{
+						{IntToMAC(9), IntToMAC(8), IntToMAC(7), IntToMAC(6)},
+						{IntToMAC(5), IntToMAC(4), IntToMAC(3), IntToMAC(2)},
+						{IntToMAC(1)},
+					},
+					pages,
+				)
+			} else {
+				assert.Equal(
+					[][]ID{
+						{IntToMAC(0), IntToMAC(1), IntToMAC(2), IntToMAC(3)},
+						{IntToMAC(4), IntToMAC(5), IntToMAC(6), IntToMAC(7)},
+						{IntToMAC(8), IntToMAC(9)},
+					},
+					pages,
+				)
+			}
+		})
+	}
+
+	t.Run("InvalidCursor", func(t *testing.T) {
+		r := newTestQueryRegistry(t)
+		for _, cursor := range []string{"this is not base64", "bm9zZXBhcmF0b3I", "eHl6L21hYzoxMjM"} {
+			_, err := r.Query(Query{Cursor: cursor})
+			assert.Equal(t, ErrorInvalidCursor, err, cursor)
+		}
+	})
+}
+
+func testRunQueryPageSize(t *testing.T) {
+	var (
+		assert  = assert.New(t)
+		require = require.New(t)
+		r       = newTestQueryRegistry(t)
+	)
+
+	// reverse the registry, so that the page must displace entries as devices are visited
+	for i, j := 0, len(r)-1; i < j; i, j = i+1, j-1 {
+		r[i], r[j] = r[j], r[i]
+	}
+
+	for limit := 1; limit <= len(r)+1; limit++ {
+		var (
+			q       = Query{Limit: limit}
+			visited []ID
+		)
+
+		for {
+			result, err := RunQuery(r, q, testQueryNow)
+			require.NoError(err)
+			require.True(len(result.Devices) <= limit)
+			visited = append(visited, testQueryIDs(result.Devices)...)
+			if len(result.NextCursor) == 0 {
+				break
+			}
+
+			q.Cursor = result.NextCursor
+		}
+
+		expected := make([]ID, len(r))
+		for i := range expected {
+			expected[i] = IntToMAC(uint64(i))
+		}
+
+		assert.Equal(expected, visited, "limit %d", limit)
+	}
+}
+
+func TestRunQuery(t *testing.T) {
+	t.Run("Filter", testRunQueryFilter)
+	t.Run("Sort", testRunQuerySort)
+	t.Run("Pagination", testRunQueryPagination)
+	t.Run("PageSize", testRunQueryPageSize)
+}
+
+func TestParseQuery(t *testing.T) {
+	t.Run("Valid", func(t *testing.T) {
+		var (
+			assert  = assert.New(t)
+			require = require.New(t)
+		)
+
+		q, err := ParseQuery(url.Values{
+			"metadata.partner-id": {"comcast", "sky"},
+			"convey.fw-name":      {"1.0"},
+			"connectedSince":      {"2020-06-01T12:00:00Z"},
+			"minUpTime":           {"1h"},
+			"maxUpTime":           {"2h"},
+			"minBytesSent":        {"10"},
+			"maxBytesSent":        {"20"},
+			"minBytesReceived":    {"30"},
+			"maxBytesReceived":    {"40"},
+			"sort":                {"bytesSent"},
+			"order":               {"desc"},
+			"limit":               {"50"},
+			"cursor":              {"abc"},
+			"unrelated":           {"ignored"},
+		})
+
+		require.NoError(err)
+		assert.Equal(
+			Query{
+				Metadata:         map[string][]interface{}{"partner-id": {"comcast", "sky"}},
+				Convey:           map[string][]interface{}{"fw-name": {"1.0"}},
+				ConnectedSince:   testQueryEpoch,
+				MinUpTime:        time.Hour,
+				MaxUpTime:        2 * time.Hour,
+				MinBytesSent:     10,
+				MaxBytesSent:     20,
+				MinBytesReceived: 30,
+				MaxBytesReceived: 40,
+				Sort:             SortByBytesSent,
+				Descending:       true,
+				Limit:            50,
+				Cursor:           "abc",
+			},
+			q,
+		)
+	})
+
+	t.Run("Invalid", func(t *testing.T) {
+		for _, values := range []url.Values{
+			{"connectedSince": {"yesterday"}},
+			{"minUpTime": {"forever"}},
+			{"maxBytesSent": {"lots"}},
+			{"limit": {"all"}},
+			{"sort": {"nosuch"}},
+			{"order": {"sideways"}},
+		} {
+			_, err := ParseQuery(values)
+			assert.Error(t, err, values.Encode())
+		}
+	})
+}
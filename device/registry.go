@@ -3,6 +3,7 @@ package device
 import (
 	"errors"
 	"sync"
+	"sync/atomic"
 
 	"github.com/go-kit/kit/log"
 	"github.com/xmidt-org/webpa-common/xmetrics"
@@ -10,21 +11,32 @@ import (
 
 var errDeviceLimitReached = errors.New("Device limit reached")
 
+// DefaultRegistryShards is the default number of independently locked shards in a device registry
+const DefaultRegistryShards = 32
+
 type registryOptions struct {
 	Logger          log.Logger
 	Limit           int
 	InitialCapacity int
+	Shards          int
 	Measures        Measures
 }
 
+// registryShard is a subset of the devices in a registry, guarded by its own lock
+type registryShard struct {
+	lock sync.RWMutex
+	data map[ID]*device
+}
+
 // registry is the internal lookup map for devices.  it is bounded by an optional maximum number
-// of connected devices.
+// of connected devices.  devices are spread across shards by a hash of their ID, so that operations
+// which iterate over all devices, such as drains, only ever hold the lock of one shard at a time.
 type registry struct {
 	logger          log.Logger
-	lock            sync.RWMutex
 	limit           int
 	initialCapacity int
-	data            map[ID]*device
+	shards          []*registryShard
+	size            int64
 
 	count        xmetrics.Setter
 	limitReached xmetrics.Incrementer
@@ -38,10 +50,14 @@ func newRegistry(o registryOptions) *registry {
 		o.InitialCapacity = 10
 	}
 
-	return &registry{
+	if o.Shards < 1 {
+		o.Shards = DefaultRegistryShards
+	}
+
+	r := &registry{
 		logger:          o.Logger,
-		initialCapacity: o.InitialCapacity,
-		data:            make(map[ID]*device, o.InitialCapacity),
+		initialCapacity: (o.InitialCapacity + o.Shards - 1) / o.Shards,
+		shards:          make([]*registryShard, o.Shards),
 		limit:           o.Limit,
 		count:           o.Measures.Device,
 		limitReached:    o.Measures.LimitReached,
@@ -49,37 +65,73 @@ func newRegistry(o registryOptions) *registry {
 		disconnect:      o.Measures.Disconnect,
 		duplicates:      o.Measures.Duplicates,
 	}
+
+	for i := range r.shards {
+		r.shards[i] = &registryShard{
+			data: make(map[ID]*device, r.initialCapacity),
+		}
+	}
+
+	return r
+}
+
+// shard returns the shard which holds the given device ID, using an FNV-1a hash of the ID
+func (r *registry) shard(id ID) *registryShard {
+	var h uint32 = 2166136261
+	for i := 0; i < len(id); i++ {
+		h ^= uint32(id[i])
+		h *= 16777619
+	}
+
+	return r.shards[h%uint32(len(r.shards))]
+}
+
+// updateSize adjusts the total number of devices in this registry by delta, and
+// updates the device count metric accordingly
+func (r *registry) updateSize(delta int64) {
+	r.count.Set(float64(atomic.AddInt64(&r.size, delta)))
+}
+
+// reserve attempts to add a new device to the total size, honoring the limit
+func (r *registry) reserve() bool {
+	for {
+		size := atomic.LoadInt64(&r.size)
+		if r.limit > 0 && size+1 > int64(r.limit) {
+			return false
+		}
+
+		if atomic.CompareAndSwapInt64(&r.size, size, size+1) {
+			r.count.Set(float64(size + 1))
+			return true
+		}
+	}
 }
 
 // len returns the size of this registry
 func (r *registry) len() int {
-	r.lock.RLock()
-	l := len(r.data)
-	r.lock.RUnlock()
-
-	return l
+	return int(atomic.LoadInt64(&r.size))
 }
 
 // add uses a factory function to create a new device atomically with modifying
 // the registry
 func (r *registry) add(newDevice *device) error {
 	id := newDevice.ID()
-	r.lock.Lock()
+	s := r.shard(id)
+	s.lock.Lock()
 
-	existing := r.data[id]
-	if existing == nil && r.limit > 0 && (len(r.data)+1) > r.limit {
+	existing := s.data[id]
+	if existing == nil && !r.reserve() {
 		// adding this would result in exceeding the limit
-		r.lock.Unlock()
+		s.lock.Unlock()
 		r.limitReached.Inc()
 		r.disconnect.Add(1.0)
 		newDevice.requestClose(CloseReason{Err: errDeviceLimitReached, Text: "device-limit-reached"})
 		return errDeviceLimitReached
 	}
 
-	// this will either leave the count the same or add 1 to it ...
-	r.data[id] = newDevice
-	r.count.Set(float64(len(r.data)))
-	r.lock.Unlock()
+	// the size was either reserved above, or stays the same because this replaces a duplicate
+	s.data[id] = newDevice
+	s.lock.Unlock()
 
 	if existing != nil {
 		r.disconnect.Add(1.0)
@@ -93,14 +145,15 @@ func (r *registry) add(newDevice *device) error {
 }
 
 func (r *registry) remove(id ID, reason CloseReason) (*device, bool) {
-	r.lock.Lock()
-	existing, ok := r.data[id]
+	s := r.shard(id)
+	s.lock.Lock()
+	existing, ok := s.data[id]
 	if ok {
-		delete(r.data, id)
+		delete(s.data, id)
+		r.updateSize(-1)
 	}
 
-	r.count.Set(float64(len(r.data)))
-	r.lock.Unlock()
+	s.lock.Unlock()
 
 	if existing != nil {
 		r.disconnect.Add(1.0)
@@ -110,44 +163,78 @@ func (r *registry) remove(id ID, reason CloseReason) (*device, bool) {
 	return existing, ok
 }
 
-func (r *registry) removeIf(f func(d *device) (CloseReason, bool)) int {
-	// first, gather up all the devices that match the predicate
-	matched := make([]*device, 0, 100)
-	reasons := make([]CloseReason, 0, 100)
-
-	r.lock.RLock()
-	for _, d := range r.data {
-		if reason, ok := f(d); ok {
-			matched = append(matched, d)
-			reasons = append(reasons, reason)
-		}
+// removeDevice removes the given device, but only if it is the device currently registered under
+// its ID.  This prevents a device that has been replaced by a duplicate from removing its replacement.
+// The given device is always closed.
+func (r *registry) removeDevice(d *device, reason CloseReason) bool {
+	s := r.shard(d.id)
+	s.lock.Lock()
+	ok := s.data[d.id] == d
+	if ok {
+		delete(s.data, d.id)
+		r.updateSize(-1)
 	}
 
-	r.lock.RUnlock()
+	s.lock.Unlock()
 
-	if len(matched) == 0 {
-		return 0
+	if ok {
+		r.disconnect.Add(1.0)
 	}
 
-	// now, remove each device one at a time, releasing the write
-	// lock in between
-	count := 0
-	for i, d := range matched {
-		r.lock.Lock()
-
-		// allow for barging
-		_, ok := r.data[d.ID()]
-		if ok {
-			delete(r.data, d.ID())
-			r.count.Set(float64(len(r.data)))
+	d.requestClose(reason)
+	return ok
+}
+
+// removeIf removes and closes each device for which the predicate returns true.  Each shard is
+// processed in turn, so only one shard is ever locked at a time.
+func (r *registry) removeIf(f func(d *device) (CloseReason, bool)) int {
+	var (
+		matched = make([]*device, 0, 100)
+		reasons = make([]CloseReason, 0, 100)
+		count   = 0
+	)
+
+	for _, s := range r.shards {
+		// first, gather up all the devices in this shard that match the predicate
+		matched, reasons = matched[:0], reasons[:0]
+
+		s.lock.RLock()
+		for _, d := range s.data {
+			if reason, ok := f(d); ok {
+				matched = append(matched, d)
+				reasons = append(reasons, reason)
+			}
 		}
 
-		r.lock.Unlock()
+		s.lock.RUnlock()
+
+		if len(matched) == 0 {
+			continue
+		}
 
-		if ok {
-			count++
-			d.requestClose(reasons[i])
+		// now, remove the matched devices under the write lock.  a matched device may
+		// have been replaced or removed in the meantime, in which case it is left alone.
+		removed := 0
+		s.lock.Lock()
+		for i, d := range matched {
+			if s.data[d.id] == d {
+				delete(s.data, d.id)
+				matched[removed], reasons[removed] = d, reasons[i]
+				removed++
+			}
 		}
+
+		if removed > 0 {
+			r.updateSize(int64(-removed))
+		}
+
+		s.lock.Unlock()
+
+		for i := 0; i < removed; i++ {
+			matched[i].requestClose(reasons[i])
+		}
+
+		count += removed
 	}
 
 	if count > 0 {
@@ -158,29 +245,33 @@ func (r *registry) removeIf(f func(d *device) (CloseReason, bool)) int {
 }
 
 func (r *registry) removeAll(reason CloseReason) int {
-	r.lock.Lock()
-	original := r.data
-	r.data = make(map[ID]*device, r.initialCapacity)
-	r.count.Set(0.0)
-	r.lock.Unlock()
+	count := 0
+	for _, s := range r.shards {
+		s.lock.Lock()
+		original := s.data
+		s.data = make(map[ID]*device, r.initialCapacity)
+		if len(original) > 0 {
+			r.updateSize(int64(-len(original)))
+		}
 
-	count := len(original)
-	for _, d := range original {
-		d.requestClose(reason)
+		s.lock.Unlock()
+
+		count += len(original)
+		for _, d := range original {
+			d.requestClose(reason)
+		}
 	}
 
 	r.disconnect.Add(float64(count))
 	return count
 }
 
+// visit invokes f for each device until f returns false.  Each shard is visited in turn,
+// holding only that shard's read lock.
 func (r *registry) visit(f func(d *device) bool) int {
-	defer r.lock.RUnlock()
-	r.lock.RLock()
-
 	visited := 0
-	for _, d := range r.data {
-		visited++
-		if !f(d) {
+	for _, s := range r.shards {
+		if !r.visitShard(s, f, &visited) {
 			break
 		}
 	}
@@ -188,10 +279,25 @@ func (r *registry) visit(f func(d *device) bool) int {
 	return visited
 }
 
+func (r *registry) visitShard(s *registryShard, f func(d *device) bool, visited *int) bool {
+	defer s.lock.RUnlock()
+	s.lock.RLock()
+
+	for _, d := range s.data {
+		*visited++
+		if !f(d) {
+			return false
+		}
+	}
+
+	return true
+}
+
 func (r *registry) get(id ID) (*device, bool) {
-	r.lock.RLock()
-	existing, ok := r.data[id]
-	r.lock.RUnlock()
+	s := r.shard(id)
+	s.lock.RLock()
+	existing, ok := s.data[id]
+	s.lock.RUnlock()
 
 	return existing, ok
 }
@@ -1,9 +1,13 @@
 package device
 
 import (
+	"fmt"
+	"runtime"
 	"strconv"
 	"testing"
 
+	"github.com/go-kit/kit/log"
+	"github.com/go-kit/kit/metrics/provider"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 	"github.com/xmidt-org/webpa-common/logging"
@@ -209,6 +213,43 @@ func testRegistryRemoveAndGet(t *testing.T) {
 	p.Assert(t, DuplicatesCounter)(xmetricstest.Value(0.0))
 }
 
+func testRegistryRemoveDevice(t *testing.T) {
+	var (
+		assert  = assert.New(t)
+		require = require.New(t)
+		logger  = logging.NewTestLogger(nil, t)
+
+		p = xmetricstest.NewProvider(nil, Metrics)
+		r = newRegistry(registryOptions{
+			Logger:   logger,
+			Limit:    1,
+			Measures: NewMeasures(p),
+		})
+
+		initial     = newDevice(deviceOptions{ID: ID("test"), Logger: logger})
+		replacement = newDevice(deviceOptions{ID: ID("test"), Logger: logger})
+	)
+
+	require.NoError(r.add(initial))
+	require.NoError(r.add(replacement))
+	assert.True(initial.Closed())
+	assert.False(replacement.Closed())
+
+	// removing a device that has already been replaced must not remove its replacement
+	assert.False(r.removeDevice(initial, CloseReason{}))
+	existing, ok := r.get(ID("test"))
+	assert.True(existing == replacement)
+	assert.True(ok)
+	assert.False(replacement.Closed())
+
+	assert.True(r.removeDevice(replacement, CloseReason{}))
+	assert.True(replacement.Closed())
+	existing, ok = r.get(ID("test"))
+	assert.Nil(existing)
+	assert.False(ok)
+	p.Assert(t, DeviceCounter)(xmetricstest.Value(0.0))
+}
+
 func testRegistryRemoveIf(t *testing.T) {
 	var (
 		assert  = assert.New(t)
@@ -350,10 +391,156 @@ func testRegistryVisit(t *testing.T) {
 	p.Assert(t, DuplicatesCounter)(xmetricstest.Value(0.0))
 }
 
+func testRegistrySharded(t *testing.T) {
+	var (
+		assert  = assert.New(t)
+		require = require.New(t)
+		logger  = logging.NewTestLogger(nil, t)
+
+		p = xmetricstest.NewProvider(nil, Metrics)
+		r = newRegistry(registryOptions{
+			Logger:   logger,
+			Limit:    100,
+			Shards:   8,
+			Measures: NewMeasures(p),
+		})
+
+		devices = make([]*device, 100)
+	)
+
+	for i := range devices {
+		devices[i] = newDevice(deviceOptions{ID: IntToMAC(uint64(i)), Logger: logger})
+		require.NoError(r.add(devices[i]))
+	}
+
+	populated := 0
+	for _, s := range r.shards {
+		if len(s.data) > 0 {
+			populated++
+		}
+	}
+
+	assert.Equal(8, populated)
+	assert.Equal(100, r.len())
+	p.Assert(t, DeviceCounter)(xmetricstest.Value(100.0))
+
+	// the limit applies across all shards
+	assert.Equal(errDeviceLimitReached, r.add(newDevice(deviceOptions{ID: IntToMAC(1000), Logger: logger})))
+	p.Assert(t, DeviceLimitReachedCounter)(xmetricstest.Value(1.0))
+
+	for _, d := range devices {
+		actual, ok := r.get(d.id)
+		assert.True(actual == d)
+		assert.True(ok)
+	}
+
+	assert.Equal(100, r.visit(func(*device) bool { return true }))
+	assert.Equal(1, r.visit(func(*device) bool { return false }))
+
+	assert.Equal(
+		50,
+		r.removeIf(func(d *device) (CloseReason, bool) {
+			return CloseReason{}, d.id[len(d.id)-1]%2 == 0
+		}),
+	)
+
+	assert.Equal(50, r.len())
+	p.Assert(t, DeviceCounter)(xmetricstest.Value(50.0))
+	assert.Equal(50, r.removeAll(CloseReason{}))
+	assert.Zero(r.len())
+	p.Assert(t, DeviceCounter)(xmetricstest.Value(0.0))
+
+	for _, d := range devices {
+		assert.True(d.Closed())
+	}
+}
+
 func TestRegistry(t *testing.T) {
 	t.Run("Add", testRegistryAdd)
 	t.Run("RemoveAndGet", testRegistryRemoveAndGet)
+	t.Run("RemoveDevice", testRegistryRemoveDevice)
 	t.Run("RemoveIf", testRegistryRemoveIf)
 	t.Run("RemoveAll", testRegistryRemoveAll)
 	t.Run("Visit", testRegistryVisit)
+	t.Run("Sharded", testRegistrySharded)
+}
+
+// newBenchmarkRegistry produces a registry populated with the given number of devices
+func newBenchmarkRegistry(b *testing.B, shards, size int) *registry {
+	r := newRegistry(registryOptions{
+		Logger:          log.NewNopLogger(),
+		Shards:          shards,
+		InitialCapacity: size,
+		Measures:        NewMeasures(provider.NewDiscardProvider()),
+	})
+
+	for i := 0; i < size; i++ {
+		d := newDevice(deviceOptions{ID: IntToMAC(uint64(i)), QueueSize: 1, Logger: r.logger, Metadata: new(Metadata)})
+		if err := r.add(d); err != nil {
+			b.Fatal(err)
+		}
+	}
+
+	return r
+}
+
+// benchmarkRegistryConnectDuringDrain measures the latency of connecting and disconnecting devices
+// while another goroutine continuously scans the registry, as a drain does.
+func benchmarkRegistryConnectDuringDrain(b *testing.B, r *registry) {
+	var (
+		connecting = make([]*device, 64)
+		scanning   = make(chan struct{})
+		done       = make(chan struct{})
+		stopped    = make(chan struct{})
+	)
+
+	for i := range connecting {
+		connecting[i] = newDevice(deviceOptions{ID: IntToMAC(uint64(0xFFFF0000 + i)), QueueSize: 1, Logger: r.logger, Metadata: new(Metadata)})
+	}
+
+	go func() {
+		defer close(stopped)
+		examined := 0
+		for {
+			select {
+			case <-done:
+				return
+			default:
+				// a drain that matches nothing still has to examine every device
+				r.removeIf(func(d *device) (CloseReason, bool) {
+					// periodically yield, so that connects interleave with the scan even with few CPUs
+					if examined++; examined == 1 {
+						close(scanning)
+					} else if examined%100 == 0 {
+						runtime.Gosched()
+					}
+
+					return CloseReason{}, d.Metadata().SessionID() == "nosuch"
+				})
+			}
+		}
+	}()
+
+	<-scanning
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		d := connecting[i%len(connecting)]
+		r.add(d)
+		r.removeDevice(d, CloseReason{})
+	}
+
+	b.StopTimer()
+	close(done)
+	<-stopped
+}
+
+func BenchmarkRegistryConnectDuringDrain(b *testing.B) {
+	for _, size := range []int{10000, 100000} {
+		for _, shards := range []int{1, DefaultRegistryShards, 256} {
+			r := newBenchmarkRegistry(b, shards, size)
+			b.Run(fmt.Sprintf("devices=%d/shards=%d", size, shards), func(b *testing.B) {
+				benchmarkRegistryConnectDuringDrain(b, r)
+			})
+		}
+	}
 }
@@ -11,6 +11,7 @@ const (
 	RehashDisconnectAllCounter = "rehash_disconnect_all_count"
 	RehashTimestamp            = "rehash_timestamp"
 	RehashDurationMilliseconds = "rehash_duration_ms"
+	RehashAbortedCounter       = "rehash_aborted_count"
 
 	ReasonLabel = "reason"
 
@@ -47,5 +48,10 @@ func Metrics() []xmetrics.Metric {
 			Type:       "gauge",
 			LabelNames: []string{service.ServiceLabel},
 		},
+		{
+			Name:       RehashAbortedCounter,
+			Type:       "counter",
+			LabelNames: []string{service.ServiceLabel},
+		},
 	}
 }
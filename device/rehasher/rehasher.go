@@ -1,6 +1,7 @@
 package rehasher
 
 import (
+	"sync"
 	"time"
 
 	"github.com/go-kit/kit/log"
@@ -21,6 +22,9 @@ const (
 	ServiceDiscoveryError       = "service-discovery-error"
 	ServiceDiscoveryStopped     = "service-discovery-stopped"
 	ServiceDiscoveryNoInstances = "service-discovery-no-instances"
+
+	// DefaultTick is the default interval between batches of disconnections when a rehash is spread out
+	DefaultTick = time.Second
 )
 
 // Option is a configuration option for a rehasher
@@ -57,6 +61,27 @@ func WithIsRegistered(f func(string) bool) Option {
 	}
 }
 
+// WithSpread configures a rehasher to disconnect the devices that no longer hash to this instance gradually,
+// in evenly sized batches spread over the given duration, rather than all at once.  A nonpositive duration,
+// which is the default, disconnects devices immediately.
+func WithSpread(d time.Duration) Option {
+	return func(r *rehasher) {
+		r.spread = d
+	}
+}
+
+// WithTick configures the interval between batches of disconnections when a rehash is spread out.
+// If d is nonpositive, DefaultTick is used.
+func WithTick(d time.Duration) Option {
+	return func(r *rehasher) {
+		if d > 0 {
+			r.tick = d
+		} else {
+			r.tick = DefaultTick
+		}
+	}
+}
+
 // WithMetricsProvider configures a metrics subsystem the resulting rehasher will use to track things.
 // A nil provider passed to this option means to discard all metrics.
 func WithMetricsProvider(p provider.Provider) Option {
@@ -70,6 +95,7 @@ func WithMetricsProvider(p provider.Provider) Option {
 		r.disconnectAllCounter = p.NewCounter(RehashDisconnectAllCounter)
 		r.timestamp = p.NewGauge(RehashTimestamp)
 		r.duration = p.NewGauge(RehashDurationMilliseconds)
+		r.abortedCounter = p.NewCounter(RehashAbortedCounter)
 	}
 }
 
@@ -80,7 +106,9 @@ func WithMetricsProvider(p provider.Provider) Option {
 //
 // If the returned listener encounters any service discovery error, all devices are disconnected.  Otherwise,
 // the IsRegistered strategy is used to determine which devices should still be connected to the Connector.  Devices
-// that hash to instances not registered in this environment are disconnected.
+// that hash to instances not registered in this environment are disconnected, gradually if WithSpread is used.
+// A gradual rehash still in progress is aborted when another event arrives for the same service.  Events for
+// other services do not affect it.
 func New(connector device.Connector, services []string, options ...Option) monitor.Listener {
 	if connector == nil {
 		panic("A device Connector is required.")
@@ -98,13 +126,17 @@ func New(connector device.Connector, services []string, options ...Option) monit
 			accessorFactory: service.DefaultAccessorFactory,
 			connector:       connector,
 			now:             time.Now,
+			newTicker:       defaultNewTicker,
+			tick:            DefaultTick,
 			services:        make(map[string]bool),
+			gradual:         make(map[string]gradualRehash),
 
 			keep:                 defaultProvider.NewGauge(RehashKeepDevice),
 			disconnect:           defaultProvider.NewGauge(RehashDisconnectDevice),
 			disconnectAllCounter: defaultProvider.NewCounter(RehashDisconnectAllCounter),
 			timestamp:            defaultProvider.NewGauge(RehashTimestamp),
 			duration:             defaultProvider.NewGauge(RehashDurationMilliseconds),
+			abortedCounter:       defaultProvider.NewCounter(RehashAbortedCounter),
 		}
 	)
 
@@ -132,12 +164,77 @@ type rehasher struct {
 	isRegistered    func(string) bool
 	connector       device.Connector
 	now             func() time.Time
+	newTicker       func(time.Duration) (<-chan time.Time, func())
+	spread          time.Duration
+	tick            time.Duration
 
 	keep                 metrics.Gauge
 	disconnect           metrics.Gauge
 	disconnectAllCounter metrics.Counter
 	timestamp            metrics.Gauge
 	duration             metrics.Gauge
+	abortedCounter       metrics.Counter
+
+	lock    sync.Mutex
+	gradual map[string]gradualRehash
+}
+
+// gradualRehash tracks the goroutine disconnecting devices for a single service's gradual rehash
+type gradualRehash struct {
+	cancel chan struct{}
+	done   chan struct{}
+}
+
+func defaultNewTicker(d time.Duration) (<-chan time.Time, func()) {
+	ticker := time.NewTicker(d)
+	return ticker.C, ticker.Stop
+}
+
+// pendingDisconnect is a device that a gradual rehash will disconnect
+type pendingDisconnect struct {
+	id     device.ID
+	reason device.CloseReason
+}
+
+// check determines if a device should be disconnected because of a rehash
+func (r *rehasher) check(logger log.Logger, accessor service.Accessor, candidate device.ID) (device.CloseReason, bool) {
+	instance, err := accessor.Get(candidate.Bytes())
+	switch {
+	case err != nil:
+		logger.Log(level.Key(), level.ErrorValue(),
+			logging.MessageKey(), "disconnecting device: error during rehash",
+			logging.ErrorKey(), err,
+			"id", candidate,
+		)
+
+		return device.CloseReason{Err: err, Text: RehashError}, true
+
+	case !r.isRegistered(instance):
+		logger.Log(level.Key(), level.InfoValue(),
+			logging.MessageKey(), "disconnecting device: rehashed to another instance",
+			"instance", instance,
+			"id", candidate,
+		)
+
+		return device.CloseReason{Text: RehashOtherInstance}, true
+
+	default:
+		logger.Log(level.Key(), level.DebugValue(), logging.MessageKey(), "device hashed to this instance", "id", candidate)
+		return device.CloseReason{}, false
+	}
+}
+
+// abort stops any gradual rehash in progress for the given service, waiting for it to exit
+func (r *rehasher) abort(svc string) {
+	r.lock.Lock()
+	g, ok := r.gradual[svc]
+	delete(r.gradual, svc)
+	r.lock.Unlock()
+
+	if ok {
+		close(g.cancel)
+		<-g.done
+	}
 }
 
 func (r *rehasher) rehash(svc string, logger log.Logger, accessor service.Accessor) {
@@ -146,35 +243,21 @@ func (r *rehasher) rehash(svc string, logger log.Logger, accessor service.Access
 	start := r.now()
 	r.timestamp.With(service.ServiceLabel, svc).Set(float64(start.UTC().Unix()))
 
+	if r.spread > 0 {
+		r.rehashGradually(svc, logger, accessor, start)
+		return
+	}
+
 	var (
 		keepCount = 0
 
 		disconnectCount = r.connector.DisconnectIf(func(candidate device.ID) (device.CloseReason, bool) {
-			instance, err := accessor.Get(candidate.Bytes())
-			switch {
-			case err != nil:
-				logger.Log(level.Key(), level.ErrorValue(),
-					logging.MessageKey(), "disconnecting device: error during rehash",
-					logging.ErrorKey(), err,
-					"id", candidate,
-				)
-
-				return device.CloseReason{Err: err, Text: RehashError}, true
-
-			case !r.isRegistered(instance):
-				logger.Log(level.Key(), level.InfoValue(),
-					logging.MessageKey(), "disconnecting device: rehashed to another instance",
-					"instance", instance,
-					"id", candidate,
-				)
-
-				return device.CloseReason{Text: RehashOtherInstance}, true
-
-			default:
-				logger.Log(level.Key(), level.DebugValue(), logging.MessageKey(), "device hashed to this instance", "id", candidate)
+			reason, disconnect := r.check(logger, accessor, candidate)
+			if !disconnect {
 				keepCount++
-				return device.CloseReason{}, false
 			}
+
+			return reason, disconnect
 		})
 
 		duration = r.now().Sub(start)
@@ -186,11 +269,96 @@ func (r *rehasher) rehash(svc string, logger log.Logger, accessor service.Access
 	logger.Log(level.Key(), level.InfoValue(), logging.MessageKey(), "rehash complete", "disconnectCount", disconnectCount, "duration", duration)
 }
 
+// rehashGradually determines which devices no longer hash to this instance, then starts a goroutine that
+// disconnects them in batches over the configured spread
+func (r *rehasher) rehashGradually(svc string, logger log.Logger, accessor service.Accessor, start time.Time) {
+	var (
+		keepCount = 0
+		pending   []pendingDisconnect
+	)
+
+	// nothing is disconnected here, as DisconnectIf is only used to visit each device
+	r.connector.DisconnectIf(func(candidate device.ID) (device.CloseReason, bool) {
+		if reason, disconnect := r.check(logger, accessor, candidate); disconnect {
+			pending = append(pending, pendingDisconnect{id: candidate, reason: reason})
+		} else {
+			keepCount++
+		}
+
+		return device.CloseReason{}, false
+	})
+
+	r.keep.With(service.ServiceLabel, svc).Set(float64(keepCount))
+
+	ticks := int(r.spread / r.tick)
+	if ticks < 1 {
+		ticks = 1
+	}
+
+	var (
+		batchSize = (len(pending) + ticks - 1) / ticks
+		g         = gradualRehash{cancel: make(chan struct{}), done: make(chan struct{})}
+	)
+
+	r.lock.Lock()
+	r.gradual[svc] = g
+	r.lock.Unlock()
+
+	logger.Log(level.Key(), level.InfoValue(), logging.MessageKey(), "rehash disconnecting devices gradually", "pendingCount", len(pending), "batchSize", batchSize, "spread", r.spread)
+	go r.disconnectGradually(svc, logger, pending, batchSize, start, g.cancel, g.done)
+}
+
+// disconnectGradually disconnects pending devices one batch per tick until none remain or the rehash is cancelled.
+// A drain.Interface is not used for this, because a drainer runs a single job at a time and would conflict with
+// operator-initiated drains.
+func (r *rehasher) disconnectGradually(svc string, logger log.Logger, pending []pendingDisconnect, batchSize int, start time.Time, cancel <-chan struct{}, done chan<- struct{}) {
+	defer close(done)
+
+	ticker, stop := r.newTicker(r.tick)
+	defer stop()
+
+	disconnectCount := 0
+	for len(pending) > 0 {
+		n := batchSize
+		if n > len(pending) {
+			n = len(pending)
+		}
+
+		for _, p := range pending[:n] {
+			if r.connector.Disconnect(p.id, p.reason) {
+				disconnectCount++
+			}
+		}
+
+		pending = pending[n:]
+		if len(pending) == 0 {
+			break
+		}
+
+		select {
+		case <-ticker:
+		case <-cancel:
+			r.disconnect.With(service.ServiceLabel, svc).Set(float64(disconnectCount))
+			r.abortedCounter.With(service.ServiceLabel, svc).Add(1.0)
+			logger.Log(level.Key(), level.InfoValue(), logging.MessageKey(), "rehash aborted", "disconnectCount", disconnectCount, "remainingCount", len(pending))
+			return
+		}
+	}
+
+	duration := r.now().Sub(start)
+	r.disconnect.With(service.ServiceLabel, svc).Set(float64(disconnectCount))
+	r.duration.With(service.ServiceLabel, svc).Set(float64(duration / time.Millisecond))
+	logger.Log(level.Key(), level.InfoValue(), logging.MessageKey(), "rehash complete", "disconnectCount", disconnectCount, "duration", duration)
+}
+
 func (r *rehasher) MonitorEvent(e monitor.Event) {
 	if !r.services[e.Service] {
 		return
 	}
 
+	// any newer event for a service supersedes that service's rehash still in progress
+	r.abort(e.Service)
+
 	logger := logging.Enrich(
 		log.With(
 			r.logger,
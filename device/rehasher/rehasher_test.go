@@ -2,6 +2,7 @@ package rehasher
 
 import (
 	"errors"
+	"strings"
 	"testing"
 	"time"
 
@@ -387,11 +388,229 @@ func testRehasherRehash(t *testing.T) {
 	provider.AssertExpectations(t)
 }
 
+// newSpreadTestRehasher creates a rehasher that spreads disconnections, using the given channel as its ticker.
+// Devices with IDs beginning with "keep" hash to this instance.
+func newSpreadTestRehasher(t *testing.T, connector device.Connector, provider xmetricstest.Provider, ticker chan time.Time) *rehasher {
+	r := New(
+		connector,
+		[]string{"talaria"},
+		WithLogger(logging.NewTestLogger(nil, t)),
+		WithIsRegistered(func(v string) bool { return v == "keep" }),
+		WithAccessorFactory(func([]string) service.Accessor {
+			return service.AccessorFunc(func(key []byte) (string, error) {
+				if strings.HasPrefix(string(key), "keep") {
+					return "keep", nil
+				}
+
+				return "other", nil
+			})
+		}),
+		WithMetricsProvider(provider),
+		WithSpread(3*time.Minute),
+		WithTick(time.Minute),
+	).(*rehasher)
+
+	r.newTicker = func(d time.Duration) (<-chan time.Time, func()) {
+		assert.Equal(t, time.Minute, d)
+		return ticker, func() {}
+	}
+
+	return r
+}
+
+// visitDevices sets up a connector expectation for DisconnectIf which visits the given devices and
+// verifies that none of them are disconnected immediately
+func visitDevices(t *testing.T, connector *device.MockConnector, ids ...device.ID) {
+	connector.On("DisconnectIf", mock.MatchedBy(
+		func(func(device.ID) (device.CloseReason, bool)) bool { return true },
+	)).
+		Run(func(arguments mock.Arguments) {
+			f := arguments.Get(0).(func(device.ID) (device.CloseReason, bool))
+			for _, id := range ids {
+				_, closed := f(id)
+				assert.False(t, closed)
+			}
+		}).
+		Return(0).
+		Once()
+}
+
+func testRehasherRehashSpread(t *testing.T) {
+	var (
+		assert   = assert.New(t)
+		provider = xmetricstest.NewProvider(nil, Metrics)
+
+		ticker    = make(chan time.Time)
+		connector = new(device.MockConnector)
+		r         = newSpreadTestRehasher(t, connector, provider, ticker)
+
+		disconnected = make(chan device.ID, 10)
+	)
+
+	visitDevices(t, connector, "keep1", "other1", "keep2", "other2", "other3", "other4", "other5")
+	for _, id := range []device.ID{"other1", "other2", "other3", "other4", "other5"} {
+		connector.On("Disconnect", id, device.CloseReason{Text: RehashOtherInstance}).
+			Run(func(arguments mock.Arguments) { disconnected <- arguments.Get(0).(device.ID) }).
+			Return(id != "other5").
+			Once()
+	}
+
+	provider.Expect(RehashKeepDevice, service.ServiceLabel, "talaria")(xmetricstest.Gauge, xmetricstest.Value(2.0))
+	provider.Expect(RehashDisconnectDevice, service.ServiceLabel, "talaria")(xmetricstest.Gauge, xmetricstest.Value(4.0))
+	provider.Expect(RehashAbortedCounter, service.ServiceLabel, "talaria")(xmetricstest.Counter, xmetricstest.Value(0.0))
+
+	r.MonitorEvent(monitor.Event{Key: "test", Service: "talaria", EventCount: 2, Instances: []string{"keep", "other"}})
+
+	// 5 devices over 3 ticks are disconnected in batches of 2
+	for i, expected := range [][]device.ID{{"other1", "other2"}, {"other3", "other4"}, {"other5"}} {
+		if i > 0 {
+			ticker <- time.Now()
+		}
+
+		for _, id := range expected {
+			select {
+			case actual := <-disconnected:
+				assert.Equal(id, actual)
+			case <-time.After(5 * time.Second):
+				assert.Fail("Device was not disconnected")
+				return
+			}
+		}
+
+		select {
+		case unexpected := <-disconnected:
+			assert.Fail("Too many devices disconnected in a batch", "id", unexpected)
+		default:
+		}
+	}
+
+	r.lock.Lock()
+	done := r.gradual["talaria"].done
+	r.lock.Unlock()
+
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		assert.Fail("Rehash did not complete")
+	}
+
+	connector.AssertExpectations(t)
+	provider.AssertExpectations(t)
+}
+
+func testRehasherRehashAbort(t *testing.T) {
+	var (
+		assert   = assert.New(t)
+		provider = xmetricstest.NewProvider(nil, Metrics)
+
+		ticker    = make(chan time.Time)
+		connector = new(device.MockConnector)
+		r         = newSpreadTestRehasher(t, connector, provider, ticker)
+
+		disconnected = make(chan device.ID, 10)
+	)
+
+	visitDevices(t, connector, "other1", "other2", "other3", "other4")
+	for _, id := range []device.ID{"other1", "other2"} {
+		connector.On("Disconnect", id, device.CloseReason{Text: RehashOtherInstance}).
+			Run(func(arguments mock.Arguments) { disconnected <- arguments.Get(0).(device.ID) }).
+			Return(true).
+			Once()
+	}
+
+	connector.On("DisconnectAll", device.CloseReason{Text: ServiceDiscoveryNoInstances}).Return(2).Once()
+
+	provider.Expect(RehashDisconnectDevice, service.ServiceLabel, "talaria")(xmetricstest.Gauge, xmetricstest.Value(2.0))
+	provider.Expect(RehashAbortedCounter, service.ServiceLabel, "talaria")(xmetricstest.Counter, xmetricstest.Value(1.0))
+
+	r.MonitorEvent(monitor.Event{Key: "test", Service: "talaria", EventCount: 2, Instances: []string{"keep", "other"}})
+
+	// the first batch is disconnected immediately, and the rest are abandoned when the next event arrives
+	for i := 0; i < 2; i++ {
+		select {
+		case <-disconnected:
+		case <-time.After(5 * time.Second):
+			assert.Fail("Device was not disconnected")
+			return
+		}
+	}
+
+	r.MonitorEvent(monitor.Event{Key: "test", Service: "talaria", EventCount: 3})
+
+	r.lock.Lock()
+	assert.Empty(r.gradual)
+	r.lock.Unlock()
+
+	connector.AssertExpectations(t)
+	provider.AssertExpectations(t)
+}
+
+func testRehasherRehashOtherService(t *testing.T) {
+	var (
+		assert   = assert.New(t)
+		provider = xmetricstest.NewProvider(nil, Metrics)
+
+		ticker    = make(chan time.Time)
+		connector = new(device.MockConnector)
+		r         = newSpreadTestRehasher(t, connector, provider, ticker)
+
+		disconnected = make(chan device.ID, 10)
+	)
+
+	r.services["scytale"] = true
+	visitDevices(t, connector, "other1", "other2", "other3", "other4")
+	for _, id := range []device.ID{"other1", "other2", "other3", "other4"} {
+		connector.On("Disconnect", id, device.CloseReason{Text: RehashOtherInstance}).
+			Run(func(arguments mock.Arguments) { disconnected <- arguments.Get(0).(device.ID) }).
+			Return(true).
+			Once()
+	}
+
+	provider.Expect(RehashDisconnectDevice, service.ServiceLabel, "talaria")(xmetricstest.Gauge, xmetricstest.Value(4.0))
+	provider.Expect(RehashAbortedCounter, service.ServiceLabel, "talaria")(xmetricstest.Counter, xmetricstest.Value(0.0))
+
+	r.MonitorEvent(monitor.Event{Key: "test", Service: "talaria", EventCount: 2, Instances: []string{"keep", "other"}})
+
+	// an event for another service does not abort this rehash
+	r.MonitorEvent(monitor.Event{Key: "test", Service: "scytale", EventCount: 1, Instances: []string{"keep"}})
+
+	for i := 0; i < 2; i++ {
+		if i > 0 {
+			ticker <- time.Now()
+		}
+
+		for j := 0; j < 2; j++ {
+			select {
+			case <-disconnected:
+			case <-time.After(5 * time.Second):
+				assert.Fail("Device was not disconnected")
+				return
+			}
+		}
+	}
+
+	r.lock.Lock()
+	done := r.gradual["talaria"].done
+	r.lock.Unlock()
+
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		assert.Fail("Rehash did not complete")
+	}
+
+	connector.AssertExpectations(t)
+	provider.AssertExpectations(t)
+}
+
 func TestRehasher(t *testing.T) {
 	t.Run("ServiceDiscoveryError", testRehasherServiceDiscoveryError)
 	t.Run("ServiceDiscoveryStopped", testRehasherServiceDiscoveryStopped)
 	t.Run("InitialEvent", testRehasherInitialEvent)
 	t.Run("NoInstances", testRehasherNoInstances)
 	t.Run("Rehash", testRehasherRehash)
+	t.Run("RehashSpread", testRehasherRehashSpread)
+	t.Run("RehashAbort", testRehasherRehashAbort)
+	t.Run("RehashOtherService", testRehasherRehashOtherService)
 	t.Run("SkippedServicee", testRehasherSkippedService)
 }
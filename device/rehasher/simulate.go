@@ -0,0 +1,160 @@
+package rehasher
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/xmidt-org/webpa-common/device"
+	"github.com/xmidt-org/webpa-common/service"
+	"github.com/xmidt-org/webpa-common/xhttp"
+)
+
+// UnknownValue is the breakdown value used for rehashed devices that have no value for the breakdown key
+const UnknownValue = "unknown"
+
+var (
+	// ErrNoRegistry is returned by a Simulator that has no Registry
+	ErrNoRegistry = errors.New("A Simulator requires a device Registry")
+
+	// ErrNoIsRegistered is returned by a Simulator that has no IsRegistered strategy
+	ErrNoIsRegistered = errors.New("A Simulator requires an IsRegistered strategy")
+)
+
+// Simulation is the predicted outcome of rehashing the connected devices against a set of instances
+type Simulation struct {
+	// Instances is the hypothetical list of instances
+	Instances []string `json:"instances"`
+
+	// Visited is the number of connected devices that were evaluated
+	Visited int `json:"visited"`
+
+	// Keep is the number of devices that would remain connected to this instance
+	Keep int `json:"keep"`
+
+	// Rehashed is the number of devices that would be disconnected, including those that could not be hashed
+	Rehashed int `json:"rehashed"`
+
+	// Errors is the number of devices that could not be hashed
+	Errors int `json:"errors"`
+
+	// Destinations counts the rehashed devices by the instance each would move to
+	Destinations map[string]int `json:"destinations"`
+
+	// Key is the metadata or claims key used to break down the rehashed devices, if any
+	Key string `json:"key,omitempty"`
+
+	// Breakdown counts the rehashed devices by their value for Key
+	Breakdown map[string]int `json:"breakdown,omitempty"`
+}
+
+// Simulator predicts how many connected devices a change of topology would move away from this instance,
+// using the same hashing and registration strategies as a rehasher.  A Simulator is also an http.Handler,
+// which accepts the hypothetical instances as one or more instance parameters and an optional key parameter,
+// and writes the Simulation as JSON.
+type Simulator struct {
+	// Registry holds the connected devices
+	Registry device.Registry
+
+	// AccessorFactory creates the hash for a list of instances.  If unset, service.DefaultAccessorFactory is used.
+	AccessorFactory service.AccessorFactory
+
+	// IsRegistered determines if an instance is this process.  There is no default.
+	IsRegistered func(string) bool
+}
+
+// breakdownValue returns the value of a metadata or claims key for a device, as a string
+func breakdownValue(d device.Interface, key string) string {
+	m := d.Metadata()
+	v := m.Load(key)
+	if v == nil {
+		var ok bool
+		if v, ok = m.Claims()[key]; !ok || v == nil {
+			return UnknownValue
+		}
+	}
+
+	return fmt.Sprint(v)
+}
+
+// Simulate rehashes every connected device against the given instances without disconnecting any of them.
+// If key is not empty, the rehashed devices are also counted by their value for that metadata or claims key.
+// An error is returned if this Simulator has no Registry or IsRegistered strategy.
+func (s *Simulator) Simulate(instances []string, key string) (Simulation, error) {
+	if s.Registry == nil {
+		return Simulation{}, ErrNoRegistry
+	}
+
+	if s.IsRegistered == nil {
+		return Simulation{}, ErrNoIsRegistered
+	}
+
+	af := s.AccessorFactory
+	if af == nil {
+		af = service.DefaultAccessorFactory
+	}
+
+	var (
+		accessor   = af(instances)
+		simulation = Simulation{
+			Instances:    instances,
+			Destinations: make(map[string]int),
+			Key:          key,
+		}
+	)
+
+	if len(key) > 0 {
+		simulation.Breakdown = make(map[string]int)
+	}
+
+	simulation.Visited = s.Registry.VisitAll(func(d device.Interface) bool {
+		instance, err := accessor.Get(d.ID().Bytes())
+		switch {
+		case err != nil:
+			simulation.Errors++
+		case s.IsRegistered(instance):
+			simulation.Keep++
+			return true
+		default:
+			simulation.Destinations[instance]++
+		}
+
+		simulation.Rehashed++
+		if simulation.Breakdown != nil {
+			simulation.Breakdown[breakdownValue(d, key)]++
+		}
+
+		return true
+	})
+
+	return simulation, nil
+}
+
+func (s *Simulator) ServeHTTP(response http.ResponseWriter, request *http.Request) {
+	if err := request.ParseForm(); err != nil {
+		xhttp.WriteError(response, http.StatusBadRequest, err)
+		return
+	}
+
+	instances := request.Form["instance"]
+	if len(instances) == 0 {
+		xhttp.WriteErrorf(response, http.StatusBadRequest, "At least one instance is required")
+		return
+	}
+
+	simulation, err := s.Simulate(instances, request.Form.Get("key"))
+	if err != nil {
+		xhttp.WriteError(response, http.StatusInternalServerError, err)
+		return
+	}
+
+	data, err := json.Marshal(simulation)
+	if err != nil {
+		xhttp.WriteError(response, http.StatusInternalServerError, err)
+		return
+	}
+
+	response.Header().Set("Content-Type", "application/json")
+	response.Write(data)
+}
@@ -0,0 +1,166 @@
+package rehasher
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+	"github.com/xmidt-org/webpa-common/device"
+	"github.com/xmidt-org/webpa-common/service"
+)
+
+// newSimulationTestSimulator produces a Simulator over devices whose IDs name the instance each hashes to
+func newSimulationTestSimulator(t *testing.T, expectedInstances []string) (*Simulator, *device.MockRegistry) {
+	var (
+		registry = new(device.MockRegistry)
+		devices  []device.Interface
+	)
+
+	for _, v := range []struct {
+		id      device.ID
+		partner string
+	}{
+		{"this-1", "comcast"},
+		{"this-2", "comcast"},
+		{"other-1", "comcast"},
+		{"other-2", "cox"},
+		{"another-1", "cox"},
+		{"error-1", ""},
+	} {
+		metadata := new(device.Metadata)
+		if len(v.partner) > 0 {
+			metadata.SetClaims(map[string]interface{}{"partner-id": v.partner})
+		}
+
+		d := new(device.MockDevice)
+		d.On("ID").Return(v.id)
+		d.On("Metadata").Return(metadata)
+		devices = append(devices, d)
+	}
+
+	registry.On("VisitAll", mock.MatchedBy(func(func(device.Interface) bool) bool { return true })).
+		Run(func(arguments mock.Arguments) {
+			visitor := arguments.Get(0).(func(device.Interface) bool)
+			for _, d := range devices {
+				visitor(d)
+			}
+		}).
+		Return(len(devices))
+
+	return &Simulator{
+		Registry: registry,
+		AccessorFactory: func(instances []string) service.Accessor {
+			assert.Equal(t, expectedInstances, instances)
+			return service.AccessorFunc(func(key []byte) (string, error) {
+				switch id := string(key); {
+				case id[:4] == "this":
+					return "this.example.com", nil
+				case id[:5] == "other":
+					return "other.example.com", nil
+				case id[:7] == "another":
+					return "another.example.com", nil
+				default:
+					return "", errors.New("expected")
+				}
+			})
+		},
+		IsRegistered: func(instance string) bool { return instance == "this.example.com" },
+	}, registry
+}
+
+func TestSimulatorSimulate(t *testing.T) {
+	var (
+		assert    = assert.New(t)
+		require   = require.New(t)
+		instances = []string{"this.example.com", "other.example.com", "another.example.com"}
+
+		simulator, registry = newSimulationTestSimulator(t, instances)
+	)
+
+	simulation, err := simulator.Simulate(instances, "")
+	require.NoError(err)
+	assert.Equal(
+		Simulation{
+			Instances:    instances,
+			Visited:      6,
+			Keep:         2,
+			Rehashed:     4,
+			Errors:       1,
+			Destinations: map[string]int{"other.example.com": 2, "another.example.com": 1},
+		},
+		simulation,
+	)
+
+	simulation, err = simulator.Simulate(instances, "partner-id")
+	require.NoError(err)
+	assert.Equal(
+		Simulation{
+			Instances:    instances,
+			Visited:      6,
+			Keep:         2,
+			Rehashed:     4,
+			Errors:       1,
+			Destinations: map[string]int{"other.example.com": 2, "another.example.com": 1},
+			Key:          "partner-id",
+			Breakdown:    map[string]int{"comcast": 1, "cox": 2, UnknownValue: 1},
+		},
+		simulation,
+	)
+
+	registry.AssertExpectations(t)
+}
+
+func TestSimulatorServeHTTP(t *testing.T) {
+	t.Run("Valid", func(t *testing.T) {
+		var (
+			assert       = assert.New(t)
+			simulator, _ = newSimulationTestSimulator(t, []string{"this.example.com", "other.example.com"})
+			response     = httptest.NewRecorder()
+		)
+
+		simulator.ServeHTTP(response, httptest.NewRequest("GET", "/?instance=this.example.com&instance=other.example.com&key=partner-id", nil))
+		assert.Equal(http.StatusOK, response.Code)
+		assert.Equal("application/json", response.Header().Get("Content-Type"))
+		assert.JSONEq(
+			`{
+				"instances": ["this.example.com", "other.example.com"],
+				"visited": 6, "keep": 2, "rehashed": 4, "errors": 1,
+				"destinations": {"other.example.com": 2, "another.example.com": 1},
+				"key": "partner-id",
+				"breakdown": {"comcast": 1, "cox": 2, "unknown": 1}
+			}`,
+			response.Body.String(),
+		)
+	})
+
+	t.Run("NoInstances", func(t *testing.T) {
+		var (
+			assert    = assert.New(t)
+			registry  = new(device.MockRegistry)
+			simulator = &Simulator{Registry: registry, IsRegistered: func(string) bool { return true }}
+			response  = httptest.NewRecorder()
+		)
+
+		simulator.ServeHTTP(response, httptest.NewRequest("GET", "/?key=partner-id", nil))
+		assert.Equal(http.StatusBadRequest, response.Code)
+		registry.AssertExpectations(t)
+	})
+
+	t.Run("Misconfigured", func(t *testing.T) {
+		registry := new(device.MockRegistry)
+		for _, simulator := range []*Simulator{
+			{IsRegistered: func(string) bool { return true }},
+			{Registry: registry},
+		} {
+			response := httptest.NewRecorder()
+			simulator.ServeHTTP(response, httptest.NewRequest("GET", "/?instance=this.example.com", nil))
+			assert.Equal(t, http.StatusInternalServerError, response.Code)
+		}
+
+		registry.AssertExpectations(t)
+	})
+}
@@ -0,0 +1,98 @@
+package device
+
+import (
+	"sync"
+	"time"
+)
+
+const (
+	// SessionIDHeader is the HTTP header in a websocket upgrade response which carries the session ID
+	// assigned to the connection.  Devices present this value as a resume token when reconnecting.
+	SessionIDHeader = "X-Xmidt-Session-Id"
+
+	// ResumeTokenHeader is the optional HTTP header in a websocket upgrade request which carries the
+	// session ID of a prior connection that the device wishes to resume.
+	ResumeTokenHeader = "X-Xmidt-Resume-Token"
+)
+
+// parkedSession is a disconnected device whose pending transactions are being held
+// in case that device reconnects within the resume window
+type parkedSession struct {
+	device *device
+	timer  *time.Timer
+}
+
+// sessions holds the sessions of recently disconnected devices, allowing new connections
+// to take over their pending transactions and statistics.  At most one session is held per device ID.
+type sessions struct {
+	lock   sync.Mutex
+	window time.Duration
+	parked map[ID]*parkedSession
+}
+
+func newSessions(window time.Duration) *sessions {
+	return &sessions{
+		window: window,
+		parked: make(map[ID]*parkedSession),
+	}
+}
+
+// park holds the given disconnected device's session for the resume window.  Once the window
+// elapses, the device's pending transactions are cancelled.  A device whose session has already
+// been resumed is ignored.
+func (s *sessions) park(d *device) {
+	s.lock.Lock()
+	if d.isResumed() {
+		s.lock.Unlock()
+		return
+	}
+
+	previous := s.parked[d.id]
+	s.parked[d.id] = &parkedSession{
+		device: d,
+		timer:  time.AfterFunc(s.window, func() { s.expire(d) }),
+	}
+
+	s.lock.Unlock()
+
+	// only the most recent session for an ID can be resumed
+	if previous != nil && previous.timer.Stop() {
+		previous.device.transactions.Close()
+	}
+}
+
+// expire cancels a parked session whose resume window has elapsed
+func (s *sessions) expire(d *device) {
+	s.lock.Lock()
+	if p, ok := s.parked[d.id]; ok && p.device == d {
+		delete(s.parked, d.id)
+	}
+
+	s.lock.Unlock()
+	d.transactions.Close()
+}
+
+// resume removes and returns the parked session for the given device ID, provided that the
+// token matches that session's ID and the resume window has not elapsed.
+func (s *sessions) resume(id ID, token string) (*device, bool) {
+	defer s.lock.Unlock()
+	s.lock.Lock()
+
+	p, ok := s.parked[id]
+	if !ok || len(token) == 0 || p.device.Metadata().SessionID() != token || !p.timer.Stop() {
+		return nil, false
+	}
+
+	delete(s.parked, id)
+	p.device.markResumed()
+	return p.device, true
+}
+
+// len returns the number of parked sessions
+func (s *sessions) len() int {
+	s.lock.Lock()
+	l := len(s.parked)
+	s.lock.Unlock()
+
+	return l
+}
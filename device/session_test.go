@@ -0,0 +1,132 @@
+package device
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/xmidt-org/webpa-common/logging"
+)
+
+func newTestSessionDevice(t *testing.T, id ID, sessionID string) *device {
+	metadata := new(Metadata)
+	metadata.SetSessionID(sessionID)
+
+	d := newDevice(deviceOptions{
+		ID:       id,
+		Logger:   logging.NewTestLogger(nil, t),
+		Metadata: metadata,
+	})
+
+	d.resumeWindow = time.Minute
+	return d
+}
+
+func testSessionsResume(t *testing.T) {
+	var (
+		assert  = assert.New(t)
+		require = require.New(t)
+		s       = newSessions(time.Hour)
+		d       = newTestSessionDevice(t, ID("test"), "session-1")
+	)
+
+	pending, err := d.transactions.Register("transaction-1")
+	require.NoError(err)
+	d.statistics.AddMessagesSent(3)
+
+	s.park(d)
+	assert.Equal(1, s.len())
+
+	prior, ok := s.resume(ID("test"), "wrong-token")
+	assert.Nil(prior)
+	assert.False(ok)
+
+	prior, ok = s.resume(ID("nosuch"), "session-1")
+	assert.Nil(prior)
+	assert.False(ok)
+	assert.Equal(1, s.len())
+
+	prior, ok = s.resume(ID("test"), "session-1")
+	require.True(ok)
+	assert.True(prior == d)
+	assert.True(d.isResumed())
+	assert.Zero(s.len())
+
+	next := newTestSessionDevice(t, ID("test"), "session-2")
+	next.resume(prior)
+	assert.Equal(3, next.Statistics().MessagesSent())
+	require.NoError(next.transactions.Complete("transaction-1", new(Response)))
+
+	select {
+	case response := <-pending:
+		assert.NotNil(response)
+	default:
+		assert.Fail("The pending transaction should have been completed through the resumed session")
+	}
+
+	// a resumed device is never parked again
+	s.park(d)
+	assert.Zero(s.len())
+}
+
+func testSessionsExpire(t *testing.T) {
+	var (
+		assert  = assert.New(t)
+		require = require.New(t)
+		s       = newSessions(10 * time.Millisecond)
+		d       = newTestSessionDevice(t, ID("test"), "session-1")
+	)
+
+	pending, err := d.transactions.Register("transaction-1")
+	require.NoError(err)
+
+	s.park(d)
+
+	select {
+	case response, ok := <-pending:
+		assert.Nil(response)
+		assert.False(ok)
+	case <-time.After(5 * time.Second):
+		assert.Fail("The pending transaction was not cancelled when the session expired")
+	}
+
+	assert.Zero(s.len())
+	prior, ok := s.resume(ID("test"), "session-1")
+	assert.Nil(prior)
+	assert.False(ok)
+}
+
+func testSessionsReplace(t *testing.T) {
+	var (
+		assert  = assert.New(t)
+		require = require.New(t)
+		s       = newSessions(time.Hour)
+		first   = newTestSessionDevice(t, ID("test"), "session-1")
+		second  = newTestSessionDevice(t, ID("test"), "session-2")
+	)
+
+	pending, err := first.transactions.Register("transaction-1")
+	require.NoError(err)
+
+	s.park(first)
+	s.park(second)
+	assert.Equal(1, s.len())
+
+	_, ok := <-pending
+	assert.False(ok)
+
+	prior, ok := s.resume(ID("test"), "session-1")
+	assert.Nil(prior)
+	assert.False(ok)
+
+	prior, ok = s.resume(ID("test"), "session-2")
+	assert.True(prior == second)
+	assert.True(ok)
+}
+
+func TestSessions(t *testing.T) {
+	t.Run("Resume", testSessionsResume)
+	t.Run("Expire", testSessionsExpire)
+	t.Run("Replace", testSessionsReplace)
+}
@@ -50,9 +50,34 @@ type Statistics interface {
 	UpTime() time.Duration
 }
 
+// WireStatistics is implemented by Statistics that also track the bytes actually read from and written
+// to the network.  The Statistics created by this package, including those of every connected device,
+// implement this interface.
+type WireStatistics interface {
+	// WireBytesReceived returns the total bytes actually read from the network since this instance
+	// was created.  Unlike BytesReceived, this includes framing and reflects any compression.
+	WireBytesReceived() int
+
+	// AddWireBytesReceived increments the WireBytesReceived count
+	AddWireBytesReceived(int)
+
+	// WireBytesSent returns the total bytes actually written to the network since this instance
+	// was created.  Unlike BytesSent, this includes framing and reflects any compression.
+	WireBytesSent() int
+
+	// AddWireBytesSent increments the WireBytesSent count
+	AddWireBytesSent(int)
+}
+
 // NewStatistics creates a Statistics instance with the given connection time
 // If now is nil, this method uses time.Now.
 func NewStatistics(now func() time.Time, connectedAt time.Time) Statistics {
+	return newStatistics(now, connectedAt, nil)
+}
+
+// newStatistics creates the internal Statistics implementation.  The optional laneDepths
+// closure supplies the current depth of each outbound lane for reporting.
+func newStatistics(now func() time.Time, connectedAt time.Time, laneDepths func() map[string]int) *statistics {
 	if now == nil {
 		now = time.Now
 	}
@@ -62,6 +87,7 @@ func NewStatistics(now func() time.Time, connectedAt time.Time) Statistics {
 		now:                  now,
 		connectedAt:          connectedAt,
 		formattedConnectedAt: connectedAt.Format(time.RFC3339Nano),
+		laneDepths:           laneDepths,
 	}
 }
 
@@ -75,9 +101,14 @@ type statistics struct {
 	messagesSent     int
 	duplications     int
 
+	wireBytesReceived int
+	wireBytesSent     int
+
 	now                  func() time.Time
 	connectedAt          time.Time
 	formattedConnectedAt string
+
+	laneDepths func() map[string]int
 }
 
 func (s *statistics) BytesReceived() int {
@@ -136,6 +167,34 @@ func (s *statistics) AddMessagesSent(delta int) {
 	s.lock.Unlock()
 }
 
+func (s *statistics) WireBytesReceived() int {
+	s.lock.RLock()
+	var result = s.wireBytesReceived
+	s.lock.RUnlock()
+
+	return result
+}
+
+func (s *statistics) AddWireBytesReceived(delta int) {
+	s.lock.Lock()
+	s.wireBytesReceived += delta
+	s.lock.Unlock()
+}
+
+func (s *statistics) WireBytesSent() int {
+	s.lock.RLock()
+	var result = s.wireBytesSent
+	s.lock.RUnlock()
+
+	return result
+}
+
+func (s *statistics) AddWireBytesSent(delta int) {
+	s.lock.Lock()
+	s.wireBytesSent += delta
+	s.lock.Unlock()
+}
+
 func (s *statistics) Duplications() int {
 	s.lock.RLock()
 	var result = s.duplications
@@ -169,15 +228,30 @@ func (s *statistics) String() string {
 func (s *statistics) MarshalJSON() ([]byte, error) {
 	s.lock.RLock()
 	output := []byte(fmt.Sprintf(
-		`{"bytesSent": %d, "messagesSent": %d, "bytesReceived": %d, "messagesReceived": %d, "duplications": %d, "connectedAt": "%s", "upTime": "%s"}`,
+		`{"bytesSent": %d, "messagesSent": %d, "bytesReceived": %d, "messagesReceived": %d, "wireBytesSent": %d, "wireBytesReceived": %d, "duplications": %d, "connectedAt": "%s", "upTime": "%s"}`,
 		s.bytesSent,
 		s.messagesSent,
 		s.bytesReceived,
 		s.messagesReceived,
+		s.wireBytesSent,
+		s.wireBytesReceived,
 		s.duplications,
 		s.formattedConnectedAt,
 		s.UpTime(),
 	))
 	s.lock.RUnlock()
+
+	if s.laneDepths != nil {
+		lanes, err := json.Marshal(s.laneDepths())
+		if err != nil {
+			return nil, err
+		}
+
+		// splice the lane depths into the JSON object
+		output = append(output[:len(output)-1], `, "lanes": `...)
+		output = append(output, lanes...)
+		output = append(output, '}')
+	}
+
 	return output, nil
 }
@@ -27,6 +27,8 @@ func testStatisticsInitialStateDefaultNow(t *testing.T) {
 	assert.Zero(statistics.BytesReceived())
 	assert.Zero(statistics.MessagesSent())
 	assert.Zero(statistics.MessagesReceived())
+	assert.Zero(statistics.(WireStatistics).WireBytesSent())
+	assert.Zero(statistics.(WireStatistics).WireBytesReceived())
 	assert.Zero(statistics.Duplications())
 	assert.Equal(expectedConnectedAt.UTC(), statistics.ConnectedAt())
 
@@ -75,6 +77,8 @@ func testStatisticsInitialStateCustomNow(t *testing.T) {
 	assert.Zero(statistics.BytesReceived())
 	assert.Zero(statistics.MessagesSent())
 	assert.Zero(statistics.MessagesReceived())
+	assert.Zero(statistics.(WireStatistics).WireBytesSent())
+	assert.Zero(statistics.(WireStatistics).WireBytesReceived())
 	assert.Zero(statistics.Duplications())
 	assert.Equal(expectedConnectedAt.UTC(), statistics.ConnectedAt())
 	assert.Equal(expectedUpTime, statistics.UpTime())
@@ -85,7 +89,7 @@ func testStatisticsInitialStateCustomNow(t *testing.T) {
 
 	assert.JSONEq(
 		fmt.Sprintf(
-			`{"duplications": 0, "bytesSent": 0, "messagesSent": 0, "bytesReceived": 0, "messagesReceived": 0, "connectedAt": "%s", "upTime": "%s"}`,
+			`{"duplications": 0, "bytesSent": 0, "messagesSent": 0, "bytesReceived": 0, "messagesReceived": 0, "wireBytesSent": 0, "wireBytesReceived": 0, "connectedAt": "%s", "upTime": "%s"}`,
 			expectedConnectedAt.UTC().Format(time.RFC3339Nano),
 			expectedUpTime,
 		),
@@ -125,6 +129,8 @@ func testStatisticsConcurrency(t *testing.T) {
 			statistics.AddMessagesSent(v)
 			statistics.AddBytesReceived(v)
 			statistics.AddMessagesReceived(v)
+			statistics.(WireStatistics).AddWireBytesSent(v)
+			statistics.(WireStatistics).AddWireBytesReceived(v)
 			statistics.AddDuplications(v)
 		}(v)
 	}
@@ -136,6 +142,8 @@ func testStatisticsConcurrency(t *testing.T) {
 	assert.Equal(expectedValue, statistics.MessagesSent())
 	assert.Equal(expectedValue, statistics.BytesReceived())
 	assert.Equal(expectedValue, statistics.MessagesReceived())
+	assert.Equal(expectedValue, statistics.(WireStatistics).WireBytesSent())
+	assert.Equal(expectedValue, statistics.(WireStatistics).WireBytesReceived())
 	assert.Equal(expectedValue, statistics.Duplications())
 	assert.Equal(expectedConnectedAt.UTC(), statistics.ConnectedAt())
 	assert.Equal(expectedUpTime, statistics.UpTime())
@@ -146,12 +154,46 @@ func testStatisticsConcurrency(t *testing.T) {
 
 	assert.JSONEq(
 		fmt.Sprintf(
-			`{"duplications": %d, "bytesSent": %d, "messagesSent": %d, "bytesReceived": %d, "messagesReceived": %d, "connectedAt": "%s", "upTime": "%s"}`,
+			`{"duplications": %d, "bytesSent": %d, "messagesSent": %d, "bytesReceived": %d, "messagesReceived": %d, "wireBytesSent": %d, "wireBytesReceived": %d, "connectedAt": "%s", "upTime": "%s"}`,
 			expectedValue,
 			expectedValue,
 			expectedValue,
 			expectedValue,
 			expectedValue,
+			expectedValue,
+			expectedValue,
+			expectedConnectedAt.UTC().Format(time.RFC3339Nano),
+			expectedUpTime,
+		),
+		string(data),
+	)
+}
+
+func testStatisticsLaneDepths(t *testing.T) {
+	var (
+		assert              = assert.New(t)
+		require             = require.New(t)
+		expectedConnectedAt = time.Now()
+		expectedUpTime      = 12 * time.Minute
+
+		statistics = newStatistics(
+			func() time.Time {
+				return expectedConnectedAt.Add(expectedUpTime)
+			},
+			expectedConnectedAt,
+			func() map[string]int {
+				return map[string]int{"requestResponse": 1, "event": 27, "bulk": 390}
+			},
+		)
+	)
+
+	data, err := statistics.MarshalJSON()
+	require.NotEmpty(data)
+	require.NoError(err)
+
+	assert.JSONEq(
+		fmt.Sprintf(
+			`{"duplications": 0, "bytesSent": 0, "messagesSent": 0, "bytesReceived": 0, "messagesReceived": 0, "wireBytesSent": 0, "wireBytesReceived": 0, "connectedAt": "%s", "upTime": "%s", "lanes": {"requestResponse": 1, "event": 27, "bulk": 390}}`,
 			expectedConnectedAt.UTC().Format(time.RFC3339Nano),
 			expectedUpTime,
 		),
@@ -166,4 +208,5 @@ func TestStatistics(t *testing.T) {
 	})
 
 	t.Run("Concurrency", testStatisticsConcurrency)
+	t.Run("LaneDepths", testStatisticsLaneDepths)
 }
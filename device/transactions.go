@@ -25,6 +25,10 @@ type Request struct {
 	// then Routing will be encoded prior to sending to devices.
 	Contents []byte
 
+	// Lane is the outbound priority lane through which this request is sent.  If unset, the lane
+	// is chosen based on the type of Message.
+	Lane Lane
+
 	// ctx is the API context for this request, which can be nil.  Normally, it's best to
 	// set this to context.Background() if no cancellation semantics are desired.
 	ctx context.Context
@@ -41,6 +45,17 @@ func (r *Request) Transactional() (string, bool) {
 	return "", false
 }
 
+// lane returns the outbound lane for this request, resolving AutoLane using the message type.
+func (r *Request) lane() Lane {
+	if r.Lane != AutoLane {
+		return r.Lane
+	} else if r.Message != nil {
+		return laneOf(r.Message.MessageType())
+	}
+
+	return EventLane
+}
+
 // Context returns the context.Context object associated with this Request.
 // This method never returns nil.  If no context is associated with this Request,
 // this method returns context.Background().
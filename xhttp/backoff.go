@@ -0,0 +1,109 @@
+package xhttp
+
+import (
+	"math"
+	"math/rand"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Backoff is a retry policy that computes how long to wait before a retry.  The attempt is the 1-based
+// number of the retry about to be made, and previous is the delay used before the prior retry, which is
+// zero before the first retry.
+type Backoff func(attempt int, previous time.Duration) time.Duration
+
+// ConstantBackoff returns a Backoff that always waits the same interval.  If interval is nonpositive,
+// DefaultRetryInterval is used.
+func ConstantBackoff(interval time.Duration) Backoff {
+	if interval < 1 {
+		interval = DefaultRetryInterval
+	}
+
+	return func(int, time.Duration) time.Duration {
+		return interval
+	}
+}
+
+// ExponentialBackoff returns a Backoff that waits initial before the first retry, then doubles the wait
+// before each subsequent retry up to max.  If initial is nonpositive, DefaultRetryInterval is used.  If max
+// is nonpositive, the wait is not capped.
+func ExponentialBackoff(initial, max time.Duration) Backoff {
+	if initial < 1 {
+		initial = DefaultRetryInterval
+	}
+
+	return func(attempt int, _ time.Duration) time.Duration {
+		delay := float64(initial) * math.Pow(2, float64(attempt-1))
+		switch {
+		case max > 0 && delay > float64(max):
+			return max
+
+		case delay >= math.MaxInt64:
+			return time.Duration(math.MaxInt64)
+
+		default:
+			return time.Duration(delay)
+		}
+	}
+}
+
+// DecorrelatedJitterBackoff returns a Backoff that waits a random time between base and three times the previous
+// wait, capped at max.  This spreads out the retries of many clients that failed at the same time.  If base is
+// nonpositive, DefaultRetryInterval is used.  If max is nonpositive, the wait is not capped.
+func DecorrelatedJitterBackoff(base, max time.Duration) Backoff {
+	if base < 1 {
+		base = DefaultRetryInterval
+	}
+
+	return func(_ int, previous time.Duration) time.Duration {
+		upper := time.Duration(math.MaxInt64)
+		if previous < upper/3 {
+			upper = 3 * previous
+		}
+
+		if upper < base {
+			upper = base
+		}
+
+		delay := base + time.Duration(rand.Int63n(int64(upper-base)+1))
+		if max > 0 && delay > max {
+			return max
+		}
+
+		return delay
+	}
+}
+
+// RetryAfter returns the wait requested by the Retry-After header of a 429 or 503 response.  The header may
+// be either a number of seconds or an HTTP date.  This function returns false if the response is nil, has
+// a different status code, or has a missing or invalid Retry-After header.
+func RetryAfter(response *http.Response, now time.Time) (time.Duration, bool) {
+	if response == nil || (response.StatusCode != http.StatusTooManyRequests && response.StatusCode != http.StatusServiceUnavailable) {
+		return 0, false
+	}
+
+	value := strings.TrimSpace(response.Header.Get("Retry-After"))
+	if len(value) == 0 {
+		return 0, false
+	}
+
+	if seconds, err := strconv.ParseInt(value, 10, 64); err == nil {
+		if seconds < 0 {
+			return 0, false
+		}
+
+		return time.Duration(seconds) * time.Second, true
+	}
+
+	if when, err := http.ParseTime(value); err == nil {
+		if delay := when.Sub(now); delay > 0 {
+			return delay, true
+		}
+
+		return 0, true
+	}
+
+	return 0, false
+}
@@ -0,0 +1,104 @@
+package xhttp
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestConstantBackoff(t *testing.T) {
+	assert := assert.New(t)
+	assert.Equal(DefaultRetryInterval, ConstantBackoff(0)(1, 0))
+
+	b := ConstantBackoff(15 * time.Second)
+	for attempt := 1; attempt < 5; attempt++ {
+		assert.Equal(15*time.Second, b(attempt, 15*time.Second))
+	}
+}
+
+func TestExponentialBackoff(t *testing.T) {
+	assert := assert.New(t)
+	assert.Equal(DefaultRetryInterval, ExponentialBackoff(0, 0)(1, 0))
+
+	b := ExponentialBackoff(100*time.Millisecond, time.Second)
+	assert.Equal(100*time.Millisecond, b(1, 0))
+	assert.Equal(200*time.Millisecond, b(2, 100*time.Millisecond))
+	assert.Equal(400*time.Millisecond, b(3, 200*time.Millisecond))
+	assert.Equal(800*time.Millisecond, b(4, 400*time.Millisecond))
+	assert.Equal(time.Second, b(5, 800*time.Millisecond))
+	assert.Equal(time.Second, b(100, time.Second))
+
+	uncapped := ExponentialBackoff(time.Second, 0)
+	assert.Equal(16*time.Second, uncapped(5, 0))
+	assert.True(uncapped(1000, 0) > 0)
+}
+
+func TestDecorrelatedJitterBackoff(t *testing.T) {
+	assert := assert.New(t)
+	assert.Equal(DefaultRetryInterval, DecorrelatedJitterBackoff(0, 0)(1, 0))
+
+	var (
+		base     = 100 * time.Millisecond
+		max      = 5 * time.Second
+		b        = DecorrelatedJitterBackoff(base, max)
+		previous time.Duration
+	)
+
+	for attempt := 1; attempt < 50; attempt++ {
+		delay := b(attempt, previous)
+		assert.True(delay >= base)
+		assert.True(delay <= max)
+		if previous > 0 {
+			assert.True(delay <= 3*previous)
+		}
+
+		previous = delay
+	}
+
+	assert.True(DecorrelatedJitterBackoff(base, 0)(1, time.Duration(1<<62)) >= base)
+}
+
+func TestRetryAfter(t *testing.T) {
+	now := time.Date(2020, time.June, 4, 12, 0, 0, 0, time.UTC)
+
+	testData := []struct {
+		description string
+		statusCode  int
+		retryAfter  string
+		expected    time.Duration
+		expectedOK  bool
+	}{
+		{"NoHeader", http.StatusServiceUnavailable, "", 0, false},
+		{"Seconds", http.StatusServiceUnavailable, "120", 2 * time.Minute, true},
+		{"TooManyRequests", http.StatusTooManyRequests, "3", 3 * time.Second, true},
+		{"Date", http.StatusTooManyRequests, now.Add(time.Minute).Format(http.TimeFormat), time.Minute, true},
+		{"PastDate", http.StatusTooManyRequests, now.Add(-time.Minute).Format(http.TimeFormat), 0, true},
+		{"Negative", http.StatusServiceUnavailable, "-1", 0, false},
+		{"Invalid", http.StatusServiceUnavailable, "this is not valid", 0, false},
+		{"OtherStatus", http.StatusInternalServerError, "120", 0, false},
+	}
+
+	for _, record := range testData {
+		t.Run(record.description, func(t *testing.T) {
+			var (
+				assert   = assert.New(t)
+				response = &http.Response{StatusCode: record.statusCode, Header: http.Header{}}
+			)
+
+			if len(record.retryAfter) > 0 {
+				response.Header.Set("Retry-After", record.retryAfter)
+			}
+
+			actual, ok := RetryAfter(response, now)
+			assert.Equal(record.expected, actual)
+			assert.Equal(record.expectedOK, ok)
+		})
+	}
+
+	t.Run("Nil", func(t *testing.T) {
+		_, ok := RetryAfter(nil, now)
+		assert.False(t, ok)
+	})
+}
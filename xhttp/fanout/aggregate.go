@@ -0,0 +1,248 @@
+package fanout
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/go-kit/kit/log"
+	"github.com/go-kit/kit/log/level"
+	"github.com/xmidt-org/webpa-common/logging"
+	"github.com/xmidt-org/webpa-common/tracing"
+	"github.com/xmidt-org/webpa-common/tracing/tracinghttp"
+)
+
+var errFanoutIncomplete = errors.New("Fanout canceled or timed out before a response was received")
+
+// Merger combines the bodies of the successful results of an aggregating fanout into a single JSON value.
+// Results are supplied in the order their endpoints were returned by the Endpoints strategy.
+type Merger func([]Result) (json.RawMessage, error)
+
+// MergeJSONArrays is a Merger that concatenates the JSON arrays returned by each endpoint.  Empty bodies
+// are treated as empty arrays.
+func MergeJSONArrays(results []Result) (json.RawMessage, error) {
+	merged := make([]json.RawMessage, 0, len(results))
+	for _, r := range results {
+		if len(bytes.TrimSpace(r.Body)) == 0 {
+			continue
+		}
+
+		var elements []json.RawMessage
+		if err := json.Unmarshal(r.Body, &elements); err != nil {
+			return nil, fmt.Errorf("Invalid JSON array from %s: %s", r.Request.URL, err)
+		}
+
+		merged = append(merged, elements...)
+	}
+
+	return json.Marshal(merged)
+}
+
+// MergeJSONObjects is a Merger that merges the top-level members of the JSON objects returned by each
+// endpoint.  When more than one endpoint returns the same member, the one from the later endpoint wins.
+// Empty bodies are treated as empty objects.
+func MergeJSONObjects(results []Result) (json.RawMessage, error) {
+	merged := make(map[string]json.RawMessage)
+	for _, r := range results {
+		if len(bytes.TrimSpace(r.Body)) == 0 {
+			continue
+		}
+
+		var members map[string]json.RawMessage
+		if err := json.Unmarshal(r.Body, &members); err != nil {
+			return nil, fmt.Errorf("Invalid JSON object from %s: %s", r.Request.URL, err)
+		}
+
+		for k, v := range members {
+			merged[k] = v
+		}
+	}
+
+	return json.Marshal(merged)
+}
+
+// EndpointStatus describes the outcome of a single fanout request within an aggregating fanout
+type EndpointStatus struct {
+	// URL is the fanout request URL
+	URL string `json:"url"`
+
+	// StatusCode is the status code of the fanout response, or an inferred status code if there was no response
+	StatusCode int `json:"statusCode"`
+
+	// Error is the text of any error that prevented a response from being received
+	Error string `json:"error,omitempty"`
+}
+
+// Aggregate is the envelope written by an aggregating fanout
+type Aggregate struct {
+	// Data is the merged body of every successful fanout response
+	Data json.RawMessage `json:"data,omitempty"`
+
+	// Partial is true if any fanout request failed, i.e. Data does not cover every endpoint
+	Partial bool `json:"partial"`
+
+	// Error is the text of the error returned by the Merger, if any
+	Error string `json:"error,omitempty"`
+
+	// Endpoints holds the status of each fanout request, in endpoint order
+	Endpoints []EndpointStatus `json:"endpoints"`
+}
+
+// WithAggregation configures an aggregating fanout.  Rather than writing the first terminating result, the Handler
+// sends every fanout request at once and waits for all of them, or for the fanout context to be canceled.  Results
+// for which the ShouldTerminateFunc returns true are considered successful, and their bodies are combined with
+// the given Merger.  The response is a JSON Aggregate holding the merged data along with the status of each endpoint.
+// The fanout after functions are invoked for each successful result and the failure functions for each failed
+// result, before the Aggregate is written.
+//
+// Endpoints ejected by WithBreakers are not sent a request.  They are reported in the Aggregate with a 503 status,
+// as failed results, so the Aggregate is partial.  Any hedge delay is ignored by an aggregating fanout.  If merger is nil, aggregation is disabled.
+func WithAggregation(merger Merger) Option {
+	return func(h *Handler) {
+		h.merger = merger
+	}
+}
+
+// aggregate executes every fanout request, except those for ejected endpoints, and writes an Aggregate of the results
+func (h *Handler) aggregate(logger log.Logger, response http.ResponseWriter, original *http.Request, requests, ejected []*http.Request) {
+	var (
+		fanoutCtx = original.Context()
+		spanner   = tracing.NewSpanner()
+		results   = make(chan Result, len(requests))
+
+		skipped  = make(map[*http.Request]bool, len(ejected))
+		indices  = make(map[*http.Request]int, len(requests))
+		received = make([]*Result, len(requests))
+		sent     = 0
+	)
+
+	for _, r := range ejected {
+		skipped[r] = true
+	}
+
+	for i, r := range requests {
+		if skipped[r] {
+			received[i] = &Result{
+				Request:    r,
+				StatusCode: http.StatusServiceUnavailable,
+				Err:        errEndpointEjected,
+			}
+
+			continue
+		}
+
+		indices[r] = i
+		sent++
+		go h.execute(logger, spanner, results, r)
+	}
+
+	for count := 0; count < sent; count++ {
+		select {
+		case <-fanoutCtx.Done():
+			logger.Log(level.Key(), level.ErrorValue(), logging.MessageKey(), "aggregating fanout canceled or timed out", "url", original.URL, logging.ErrorKey(), fanoutCtx.Err())
+			count = sent
+
+		case r := <-results:
+			tracinghttp.HeadersForSpans("", response.Header(), r.Span)
+			if r.Err != nil {
+				logger.Log(level.Key(), level.ErrorValue(), logging.MessageKey(), "fanout request complete", "statusCode", r.StatusCode, "url", r.Request.URL, logging.ErrorKey(), r.Err)
+			} else {
+				logger.Log(level.Key(), level.DebugValue(), logging.MessageKey(), "fanout request complete", "statusCode", r.StatusCode, "url", r.Request.URL)
+			}
+
+			received[indices[r.Request]] = &r
+		}
+	}
+
+	var (
+		aggregate = Aggregate{Endpoints: make([]EndpointStatus, len(requests))}
+		succeeded []Result
+		failed    []Result
+		worst     int
+	)
+
+	for i, r := range received {
+		if r == nil {
+			aggregate.Endpoints[i] = EndpointStatus{
+				URL:        requests[i].URL.String(),
+				StatusCode: http.StatusGatewayTimeout,
+				Error:      errFanoutIncomplete.Error(),
+			}
+
+			aggregate.Partial = true
+			if worst < http.StatusGatewayTimeout {
+				worst = http.StatusGatewayTimeout
+			}
+
+			continue
+		}
+
+		aggregate.Endpoints[i] = EndpointStatus{
+			URL:        r.Request.URL.String(),
+			StatusCode: r.StatusCode,
+		}
+
+		if r.Err != nil {
+			aggregate.Endpoints[i].Error = r.Err.Error()
+		}
+
+		if h.shouldTerminate(*r) {
+			succeeded = append(succeeded, *r)
+		} else {
+			if worst < r.StatusCode {
+				worst = r.StatusCode
+			}
+
+			failed = append(failed, *r)
+			aggregate.Partial = true
+		}
+	}
+
+	for _, r := range succeeded {
+		ctx := r.Request.Context()
+		for _, rf := range h.after {
+			ctx = rf(ctx, response, r)
+		}
+	}
+
+	for _, r := range failed {
+		ctx := r.Request.Context()
+		for _, rf := range h.failure {
+			ctx = rf(ctx, response, r)
+		}
+	}
+
+	statusCode := http.StatusOK
+	if len(succeeded) > 0 {
+		data, err := h.merger(succeeded)
+		if err != nil {
+			logger.Log(level.Key(), level.ErrorValue(), logging.MessageKey(), "unable to merge fanout responses", "url", original.URL, logging.ErrorKey(), err)
+			aggregate.Error = err.Error()
+			statusCode = http.StatusBadGateway
+		} else {
+			aggregate.Data = data
+		}
+	} else {
+		logger.Log(level.Key(), level.ErrorValue(), logging.MessageKey(), "all fanout requests failed", "statusCode", worst, "url", original.URL)
+		statusCode = worst
+	}
+
+	body, err := json.Marshal(aggregate)
+	if err != nil {
+		// this should not happen, since a Merger must return valid JSON
+		logger.Log(level.Key(), level.ErrorValue(), logging.MessageKey(), "unable to marshal fanout aggregate", logging.ErrorKey(), err)
+		h.errorEncoder(fanoutCtx, err, response)
+		return
+	}
+
+	response.Header().Set("Content-Type", "application/json")
+	response.WriteHeader(statusCode)
+	count, err := response.Write(body)
+	if err != nil {
+		logger.Log(level.Key(), level.ErrorValue(), logging.MessageKey(), "wrote fanout aggregate", "bytes", count, logging.ErrorKey(), err)
+	} else {
+		logger.Log(level.Key(), level.DebugValue(), logging.MessageKey(), "wrote fanout aggregate", "bytes", count, "partial", aggregate.Partial)
+	}
+}
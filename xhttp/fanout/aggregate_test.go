@@ -0,0 +1,278 @@
+package fanout
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/xmidt-org/webpa-common/logging"
+)
+
+func newMergeTestResults(bodies ...string) []Result {
+	results := make([]Result, len(bodies))
+	for i, b := range bodies {
+		results[i] = Result{
+			StatusCode: 200,
+			Request:    &http.Request{URL: &url.URL{Scheme: "http", Host: "localhost"}},
+			Body:       []byte(b),
+		}
+	}
+
+	return results
+}
+
+func TestMergeJSONArrays(t *testing.T) {
+	t.Run("Valid", func(t *testing.T) {
+		assert := assert.New(t)
+		merged, err := MergeJSONArrays(newMergeTestResults(`[1, "two"]`, ``, `[]`, `[{"three": 3}]`))
+		assert.NoError(err)
+		assert.JSONEq(`[1, "two", {"three": 3}]`, string(merged))
+	})
+
+	t.Run("Invalid", func(t *testing.T) {
+		assert := assert.New(t)
+		merged, err := MergeJSONArrays(newMergeTestResults(`[1]`, `{"this is": "not an array"}`))
+		assert.Nil(merged)
+		assert.Error(err)
+	})
+}
+
+func TestMergeJSONObjects(t *testing.T) {
+	t.Run("Valid", func(t *testing.T) {
+		assert := assert.New(t)
+		merged, err := MergeJSONObjects(newMergeTestResults(`{"one": 1, "two": 2}`, ``, `{"two": "two", "three": [3]}`))
+		assert.NoError(err)
+		assert.JSONEq(`{"one": 1, "two": "two", "three": [3]}`, string(merged))
+	})
+
+	t.Run("Invalid", func(t *testing.T) {
+		assert := assert.New(t)
+		merged, err := MergeJSONObjects(newMergeTestResults(`{"one": 1}`, `["not", "an", "object"]`))
+		assert.Nil(merged)
+		assert.Error(err)
+	})
+}
+
+func testHandlerAggregateAllSucceeded(t *testing.T) {
+	var (
+		assert  = assert.New(t)
+		require = require.New(t)
+
+		logger   = logging.NewTestLogger(nil, t)
+		ctx      = logging.WithLogger(context.Background(), logger)
+		original = httptest.NewRequest("GET", "/api/v2/devices", nil).WithContext(ctx)
+		response = httptest.NewRecorder()
+
+		endpoints  = generateEndpoints(3)
+		transactor = &hedgeTestTransactor{
+			responses: map[string]func(*http.Request) (*http.Response, error){
+				endpoints[0].Host: respondWith(200, `["mac:112233445566"]`),
+				endpoints[1].Host: respondWith(200, `[]`),
+				endpoints[2].Host: respondWith(200, `["mac:665544332211", "mac:aabbccddeeff"]`),
+			},
+		}
+
+		afterCount = 0
+		handler    = New(endpoints,
+			WithTransactor(transactor.Do),
+			WithHedgeDelay(time.Hour),
+			WithAggregation(MergeJSONArrays),
+			WithFanoutAfter(func(ctx context.Context, _ http.ResponseWriter, result Result) context.Context {
+				afterCount++
+				return ctx
+			}),
+		)
+	)
+
+	handler.ServeHTTP(response, original)
+	assert.Equal(http.StatusOK, response.Code)
+	assert.Equal("application/json", response.Header().Get("Content-Type"))
+	assert.Equal(3, afterCount)
+	assert.Len(transactor.Hosts(), 3)
+
+	var aggregate Aggregate
+	require.NoError(json.Unmarshal(response.Body.Bytes(), &aggregate))
+	assert.JSONEq(`["mac:112233445566", "mac:665544332211", "mac:aabbccddeeff"]`, string(aggregate.Data))
+	assert.False(aggregate.Partial)
+	assert.Empty(aggregate.Error)
+	assert.Equal(
+		[]EndpointStatus{
+			{URL: endpoints[0].String() + "/api/v2/devices", StatusCode: 200},
+			{URL: endpoints[1].String() + "/api/v2/devices", StatusCode: 200},
+			{URL: endpoints[2].String() + "/api/v2/devices", StatusCode: 200},
+		},
+		aggregate.Endpoints,
+	)
+}
+
+func testHandlerAggregatePartial(t *testing.T) {
+	var (
+		assert  = assert.New(t)
+		require = require.New(t)
+
+		logger   = logging.NewTestLogger(nil, t)
+		ctx      = logging.WithLogger(context.Background(), logger)
+		original = httptest.NewRequest("GET", "/api/v2/stats", nil).WithContext(ctx)
+		response = httptest.NewRecorder()
+
+		endpoints  = generateEndpoints(3)
+		transactor = &hedgeTestTransactor{
+			responses: map[string]func(*http.Request) (*http.Response, error){
+				endpoints[0].Host: respondWith(200, `{"connected": 12}`),
+				endpoints[1].Host: func(*http.Request) (*http.Response, error) {
+					return nil, errors.New("expected")
+				},
+				endpoints[2].Host: respondWith(200, `{"uptime": "1h"}`),
+			},
+		}
+
+		failureCount = 0
+		handler      = New(endpoints,
+			WithTransactor(transactor.Do),
+			WithAggregation(MergeJSONObjects),
+			WithFanoutFailure(func(ctx context.Context, _ http.ResponseWriter, result Result) context.Context {
+				failureCount++
+				assert.Equal(http.StatusServiceUnavailable, result.StatusCode)
+				return ctx
+			}),
+		)
+	)
+
+	handler.ServeHTTP(response, original)
+	assert.Equal(http.StatusOK, response.Code)
+	assert.Equal(1, failureCount)
+
+	var aggregate Aggregate
+	require.NoError(json.Unmarshal(response.Body.Bytes(), &aggregate))
+	assert.JSONEq(`{"connected": 12, "uptime": "1h"}`, string(aggregate.Data))
+	assert.True(aggregate.Partial)
+	assert.Equal(
+		[]EndpointStatus{
+			{URL: endpoints[0].String() + "/api/v2/stats", StatusCode: 200},
+			{URL: endpoints[1].String() + "/api/v2/stats", StatusCode: http.StatusServiceUnavailable, Error: "expected"},
+			{URL: endpoints[2].String() + "/api/v2/stats", StatusCode: 200},
+		},
+		aggregate.Endpoints,
+	)
+}
+
+func testHandlerAggregateAllFailed(t *testing.T) {
+	var (
+		assert  = assert.New(t)
+		require = require.New(t)
+
+		logger   = logging.NewTestLogger(nil, t)
+		ctx      = logging.WithLogger(context.Background(), logger)
+		original = httptest.NewRequest("GET", "/api/v2/stats", nil).WithContext(ctx)
+		response = httptest.NewRecorder()
+
+		endpoints  = generateEndpoints(2)
+		transactor = &hedgeTestTransactor{
+			responses: map[string]func(*http.Request) (*http.Response, error){
+				endpoints[0].Host: respondWith(500, "failed"),
+				endpoints[1].Host: respondWith(503, "failed"),
+			},
+		}
+
+		handler = New(endpoints, WithTransactor(transactor.Do), WithAggregation(MergeJSONObjects))
+	)
+
+	handler.ServeHTTP(response, original)
+	assert.Equal(503, response.Code)
+
+	var aggregate Aggregate
+	require.NoError(json.Unmarshal(response.Body.Bytes(), &aggregate))
+	assert.Empty(aggregate.Data)
+	assert.True(aggregate.Partial)
+	assert.Len(aggregate.Endpoints, 2)
+}
+
+func testHandlerAggregateTimeout(t *testing.T) {
+	var (
+		assert  = assert.New(t)
+		require = require.New(t)
+
+		logger      = logging.NewTestLogger(nil, t)
+		ctx, cancel = context.WithTimeout(logging.WithLogger(context.Background(), logger), 50*time.Millisecond)
+		original    = httptest.NewRequest("GET", "/api/v2/devices", nil).WithContext(ctx)
+		response    = httptest.NewRecorder()
+
+		slow       = make(chan struct{})
+		endpoints  = generateEndpoints(2)
+		transactor = &hedgeTestTransactor{
+			responses: map[string]func(*http.Request) (*http.Response, error){
+				endpoints[0].Host: respondWith(200, `["mac:112233445566"]`),
+				endpoints[1].Host: func(request *http.Request) (*http.Response, error) {
+					<-slow
+					return respondWith(200, `["mac:665544332211"]`)(request)
+				},
+			},
+		}
+
+		handler = New(endpoints, WithTransactor(transactor.Do), WithAggregation(MergeJSONArrays))
+	)
+
+	defer cancel()
+	defer close(slow)
+
+	handler.ServeHTTP(response, original)
+	assert.Equal(http.StatusOK, response.Code)
+
+	var aggregate Aggregate
+	require.NoError(json.Unmarshal(response.Body.Bytes(), &aggregate))
+	assert.JSONEq(`["mac:112233445566"]`, string(aggregate.Data))
+	assert.True(aggregate.Partial)
+	assert.Equal(
+		[]EndpointStatus{
+			{URL: endpoints[0].String() + "/api/v2/devices", StatusCode: 200},
+			{URL: endpoints[1].String() + "/api/v2/devices", StatusCode: http.StatusGatewayTimeout, Error: errFanoutIncomplete.Error()},
+		},
+		aggregate.Endpoints,
+	)
+}
+
+func testHandlerAggregateMergeError(t *testing.T) {
+	var (
+		assert  = assert.New(t)
+		require = require.New(t)
+
+		logger   = logging.NewTestLogger(nil, t)
+		ctx      = logging.WithLogger(context.Background(), logger)
+		original = httptest.NewRequest("GET", "/api/v2/devices", nil).WithContext(ctx)
+		response = httptest.NewRecorder()
+
+		endpoints  = generateEndpoints(2)
+		transactor = &hedgeTestTransactor{
+			responses: map[string]func(*http.Request) (*http.Response, error){
+				endpoints[0].Host: respondWith(200, `["mac:112233445566"]`),
+				endpoints[1].Host: respondWith(200, `this is not JSON`),
+			},
+		}
+
+		handler = New(endpoints, WithTransactor(transactor.Do), WithAggregation(MergeJSONArrays))
+	)
+
+	handler.ServeHTTP(response, original)
+	assert.Equal(http.StatusBadGateway, response.Code)
+
+	var aggregate Aggregate
+	require.NoError(json.Unmarshal(response.Body.Bytes(), &aggregate))
+	assert.Empty(aggregate.Data)
+	assert.False(aggregate.Partial)
+	assert.NotEmpty(aggregate.Error)
+}
+
+func TestHandlerAggregate(t *testing.T) {
+	t.Run("AllSucceeded", testHandlerAggregateAllSucceeded)
+	t.Run("Partial", testHandlerAggregatePartial)
+	t.Run("AllFailed", testHandlerAggregateAllFailed)
+	t.Run("Timeout", testHandlerAggregateTimeout)
+	t.Run("MergeError", testHandlerAggregateMergeError)
+}
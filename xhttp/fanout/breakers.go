@@ -0,0 +1,215 @@
+package fanout
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+
+	"github.com/go-kit/kit/log"
+	"github.com/go-kit/kit/log/level"
+	"github.com/rubyist/circuitbreaker"
+	"github.com/xmidt-org/webpa-common/logging"
+	"github.com/xmidt-org/webpa-common/xmetrics"
+)
+
+const (
+	DefaultBreakerThreshold int64         = 5
+	DefaultBreakerCoolDown  time.Duration = 30 * time.Second
+)
+
+// errEndpointEjected is reported by an aggregating fanout for each endpoint that was ejected by its breaker
+var errEndpointEjected = errors.New("Fanout endpoint ejected by its circuit breaker")
+
+// coolDown is a constant backoff policy for an endpoint breaker
+type coolDown time.Duration
+
+func (c coolDown) NextBackOff() time.Duration {
+	return time.Duration(c)
+}
+
+func (c coolDown) Reset() {}
+
+// endpointBreaker is the circuit breaker for a single fanout endpoint
+type endpointBreaker struct {
+	*circuit.Breaker
+
+	// ejected indicates that the breaker has tripped and the endpoint has been removed from fanouts
+	ejected bool
+
+	// probed is when the outstanding half-open probe request was allowed, or the zero time if there is none
+	probed time.Time
+}
+
+// Breakers tracks the health of each fanout endpoint, identified by URL scheme and host, with a circuit breaker.
+// An endpoint that fails Threshold consecutive times is ejected from fanouts for CoolDown, after which a single
+// probe request is allowed through.  A successful probe restores the endpoint, while a failed probe ejects it
+// for another CoolDown.  A fanout request fails if it returns an error, a 5xx status code, or takes longer than Latency.
+//
+// The zero value of this type is usable, with the defaults described on each field.
+type Breakers struct {
+	// Threshold is the number of consecutive failures that ejects an endpoint.  If unset, DefaultBreakerThreshold is used.
+	Threshold int64
+
+	// CoolDown is how long an endpoint is ejected before it is probed.  If unset, DefaultBreakerCoolDown is used.
+	// The breaker measures cool downs from the last failure with a resolution of one second.
+	CoolDown time.Duration
+
+	// Latency is the slowest response that counts as a success.  If unset, latency is not considered.
+	Latency time.Duration
+
+	// Logger receives ejection and restoration messages.  If unset, logging.DefaultLogger() is used.
+	Logger log.Logger
+
+	// Ejected is an optional gauge of the number of currently ejected endpoints
+	Ejected xmetrics.Adder
+
+	// Ejections is an optional counter of endpoint ejections
+	Ejections xmetrics.Adder
+
+	lock     sync.Mutex
+	breakers map[string]*endpointBreaker
+}
+
+// WithBreakers configures per-endpoint circuit breaking for a fanout.  Endpoints ejected by their breakers are
+// left out of each fanout, unless every endpoint is ejected, in which case all of them are used.  An aggregating
+// fanout reports each ejected endpoint in its Aggregate with a 503 status.  If b is nil, circuit breaking is disabled.
+func WithBreakers(b *Breakers) Option {
+	return func(h *Handler) {
+		h.breakers = b
+	}
+}
+
+func endpointKey(u *url.URL) string {
+	return u.Scheme + "://" + u.Host
+}
+
+func (b *Breakers) logger() log.Logger {
+	if b.Logger != nil {
+		return b.Logger
+	}
+
+	return logging.DefaultLogger()
+}
+
+func (b *Breakers) coolDown() time.Duration {
+	if b.CoolDown > 0 {
+		return b.CoolDown
+	}
+
+	return DefaultBreakerCoolDown
+}
+
+// breaker returns the breaker for an endpoint, creating it if necessary.  This method must be called under the lock.
+func (b *Breakers) breaker(key string) *endpointBreaker {
+	if eb, ok := b.breakers[key]; ok {
+		return eb
+	}
+
+	threshold := b.Threshold
+	if threshold <= 0 {
+		threshold = DefaultBreakerThreshold
+	}
+
+	if b.breakers == nil {
+		b.breakers = make(map[string]*endpointBreaker)
+	}
+
+	eb := &endpointBreaker{
+		Breaker: circuit.NewBreakerWithOptions(&circuit.Options{
+			BackOff:    coolDown(b.coolDown()),
+			ShouldTrip: circuit.ConsecutiveTripFunc(threshold),
+		}),
+	}
+
+	b.breakers[key] = eb
+	return eb
+}
+
+// Allow tests if a fanout request may be sent to the given URL.  For an ejected endpoint whose cool down has
+// elapsed, this method returns true for exactly one probe request until the outcome of that probe is recorded.
+// A probe whose outcome is not recorded within another cool down, e.g. because it was never sent, is abandoned.
+func (b *Breakers) Allow(u *url.URL) bool {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	eb := b.breaker(endpointKey(u))
+	switch {
+	case !eb.Tripped():
+		return true
+
+	case !eb.probed.IsZero() && time.Since(eb.probed) < b.coolDown():
+		return false
+
+	case eb.Ready():
+		eb.probed = time.Now()
+		return true
+
+	default:
+		return false
+	}
+}
+
+// Record updates the breaker for the endpoint of a fanout result.  Results for requests canceled by the
+// fanout itself, e.g. because another endpoint already responded, are not counted.
+func (b *Breakers) Record(result Result, latency time.Duration) {
+	key := endpointKey(result.Request.URL)
+
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	eb := b.breaker(key)
+	eb.probed = time.Time{}
+	if result.Request.Context().Err() == context.Canceled {
+		return
+	}
+
+	if result.Err != nil || result.StatusCode >= http.StatusInternalServerError || (b.Latency > 0 && latency > b.Latency) {
+		eb.Fail()
+		if eb.Tripped() && !eb.ejected {
+			eb.ejected = true
+			b.logger().Log(level.Key(), level.WarnValue(), logging.MessageKey(), "fanout endpoint ejected", "endpoint", key, "statusCode", result.StatusCode, "latency", latency)
+			if b.Ejected != nil {
+				b.Ejected.Add(1.0)
+			}
+
+			if b.Ejections != nil {
+				b.Ejections.Add(1.0)
+			}
+		}
+
+		return
+	}
+
+	eb.Success()
+	if eb.ejected && !eb.Tripped() {
+		eb.ejected = false
+		b.logger().Log(level.Key(), level.InfoValue(), logging.MessageKey(), "fanout endpoint restored", "endpoint", key)
+		if b.Ejected != nil {
+			b.Ejected.Add(-1.0)
+		}
+	}
+}
+
+// filter splits the fanout requests into those whose endpoints are allowed by their breakers and those whose
+// endpoints are ejected.  If no endpoint is allowed, all the requests are returned as allowed.
+func (b *Breakers) filter(logger log.Logger, requests []*http.Request) (allowed, ejected []*http.Request) {
+	allowed = make([]*http.Request, 0, len(requests))
+	for _, r := range requests {
+		if b.Allow(r.URL) {
+			allowed = append(allowed, r)
+		} else {
+			logger.Log(level.Key(), level.DebugValue(), logging.MessageKey(), "skipping ejected fanout endpoint", "url", r.URL)
+			ejected = append(ejected, r)
+		}
+	}
+
+	if len(allowed) == 0 {
+		logger.Log(level.Key(), level.WarnValue(), logging.MessageKey(), "all fanout endpoints are ejected, using all of them")
+		return requests, nil
+	}
+
+	return
+}
@@ -0,0 +1,251 @@
+package fanout
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/go-kit/kit/metrics/generic"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/xmidt-org/webpa-common/logging"
+)
+
+func newBreakerTestResult(target string, statusCode int, err error) Result {
+	return Result{
+		StatusCode: statusCode,
+		Request:    httptest.NewRequest("GET", target, nil),
+		Err:        err,
+	}
+}
+
+func testBreakersEjection(t *testing.T) {
+	var (
+		assert = assert.New(t)
+
+		ejected   = generic.NewGauge("ejected")
+		ejections = generic.NewCounter("ejections")
+		b         = &Breakers{
+			Threshold: 2,
+			CoolDown:  time.Hour,
+			Latency:   time.Second,
+			Logger:    logging.NewTestLogger(nil, t),
+			Ejected:   ejected,
+			Ejections: ejections,
+		}
+
+		first  = newBreakerTestResult("http://first.webpa.net:8080/api/v2/device", 0, nil)
+		second = newBreakerTestResult("http://second.webpa.net:8080/api/v2/device", 0, nil)
+	)
+
+	assert.True(b.Allow(first.Request.URL))
+	assert.True(b.Allow(second.Request.URL))
+
+	// client errors do not count against an endpoint
+	for i := 0; i < 5; i++ {
+		b.Record(newBreakerTestResult("http://first.webpa.net:8080/api/v2/device", 404, nil), time.Millisecond)
+	}
+
+	assert.True(b.Allow(first.Request.URL))
+
+	b.Record(newBreakerTestResult("http://first.webpa.net:8080/api/v2/device", 0, errors.New("expected")), time.Millisecond)
+	assert.True(b.Allow(first.Request.URL))
+	b.Record(newBreakerTestResult("http://first.webpa.net:8080/other", 503, nil), time.Millisecond)
+	assert.False(b.Allow(first.Request.URL))
+	assert.True(b.Allow(second.Request.URL))
+
+	// slow responses count against an endpoint
+	b.Record(newBreakerTestResult("http://second.webpa.net:8080/api/v2/device", 200, nil), 2*time.Second)
+	assert.True(b.Allow(second.Request.URL))
+	b.Record(newBreakerTestResult("http://second.webpa.net:8080/api/v2/device", 200, nil), 2*time.Second)
+	assert.False(b.Allow(second.Request.URL))
+
+	assert.Equal(2.0, ejected.Value())
+	assert.Equal(2.0, ejections.Value())
+}
+
+func testBreakersProbe(t *testing.T) {
+	var (
+		assert = assert.New(t)
+
+		ejected   = generic.NewGauge("ejected")
+		ejections = generic.NewCounter("ejections")
+		b         = &Breakers{
+			Threshold: 1,
+			CoolDown:  10 * time.Millisecond,
+			Logger:    logging.NewTestLogger(nil, t),
+			Ejected:   ejected,
+			Ejections: ejections,
+		}
+
+		target = "http://probe.webpa.net:8080/api/v2/device"
+		u      = newBreakerTestResult(target, 0, nil).Request.URL
+	)
+
+	b.Record(newBreakerTestResult(target, 500, nil), time.Millisecond)
+	assert.Equal(1.0, ejected.Value())
+
+	time.Sleep(20 * time.Millisecond)
+	assert.True(b.Allow(u))
+	assert.False(b.Allow(u), "Only one probe should be allowed at a time")
+
+	// a failed probe leaves the endpoint ejected
+	b.Record(newBreakerTestResult(target, 500, nil), time.Millisecond)
+	assert.Equal(1.0, ejected.Value())
+	assert.Equal(1.0, ejections.Value())
+
+	time.Sleep(20 * time.Millisecond)
+	assert.True(b.Allow(u))
+	b.Record(newBreakerTestResult(target, 200, nil), time.Millisecond)
+	assert.Equal(0.0, ejected.Value())
+	assert.Equal(1.0, ejections.Value())
+	assert.True(b.Allow(u))
+	assert.True(b.Allow(u))
+}
+
+func testBreakersCanceled(t *testing.T) {
+	var (
+		assert      = assert.New(t)
+		b           = &Breakers{Threshold: 1, CoolDown: time.Hour, Logger: logging.NewTestLogger(nil, t)}
+		ctx, cancel = context.WithCancel(context.Background())
+		result      = newBreakerTestResult("http://canceled.webpa.net:8080/api/v2/device", http.StatusGatewayTimeout, context.Canceled)
+	)
+
+	cancel()
+	result.Request = result.Request.WithContext(ctx)
+	b.Record(result, time.Millisecond)
+	assert.True(b.Allow(result.Request.URL))
+}
+
+func TestBreakers(t *testing.T) {
+	t.Run("Ejection", testBreakersEjection)
+	t.Run("Probe", testBreakersProbe)
+	t.Run("Canceled", testBreakersCanceled)
+}
+
+func testHandlerBreakersEjected(t *testing.T) {
+	var (
+		assert = assert.New(t)
+
+		logger = logging.NewTestLogger(nil, t)
+		ctx    = logging.WithLogger(context.Background(), logger)
+
+		endpoints  = generateEndpoints(3)
+		transactor = &hedgeTestTransactor{
+			responses: map[string]func(*http.Request) (*http.Response, error){
+				endpoints[0].Host: respondWith(404, "not here"),
+				endpoints[1].Host: respondWith(500, "failed"),
+				endpoints[2].Host: respondWith(404, "not here"),
+			},
+		}
+
+		handler = New(endpoints,
+			WithTransactor(transactor.Do),
+			WithBreakers(&Breakers{Threshold: 1, CoolDown: time.Hour, Logger: logger}),
+		)
+	)
+
+	response := httptest.NewRecorder()
+	handler.ServeHTTP(response, httptest.NewRequest("GET", "/api/v2/something", nil).WithContext(ctx))
+	assert.Equal(500, response.Code)
+	assert.ElementsMatch([]string{endpoints[0].Host, endpoints[1].Host, endpoints[2].Host}, transactor.Hosts())
+
+	response = httptest.NewRecorder()
+	handler.ServeHTTP(response, httptest.NewRequest("GET", "/api/v2/something", nil).WithContext(ctx))
+	assert.Equal(404, response.Code)
+	assert.ElementsMatch(
+		[]string{endpoints[0].Host, endpoints[1].Host, endpoints[2].Host, endpoints[0].Host, endpoints[2].Host},
+		transactor.Hosts(),
+	)
+}
+
+func testHandlerBreakersAllEjected(t *testing.T) {
+	var (
+		assert = assert.New(t)
+
+		logger = logging.NewTestLogger(nil, t)
+		ctx    = logging.WithLogger(context.Background(), logger)
+
+		endpoints  = generateEndpoints(1)
+		transactor = &hedgeTestTransactor{
+			responses: map[string]func(*http.Request) (*http.Response, error){
+				endpoints[0].Host: respondWith(500, "failed"),
+			},
+		}
+
+		handler = New(endpoints,
+			WithTransactor(transactor.Do),
+			WithBreakers(&Breakers{Threshold: 1, CoolDown: time.Hour, Logger: logger}),
+		)
+	)
+
+	for i := 0; i < 2; i++ {
+		response := httptest.NewRecorder()
+		handler.ServeHTTP(response, httptest.NewRequest("GET", "/api/v2/something", nil).WithContext(ctx))
+		assert.Equal(500, response.Code)
+	}
+
+	assert.Equal([]string{endpoints[0].Host, endpoints[0].Host}, transactor.Hosts())
+}
+
+func testHandlerBreakersAggregate(t *testing.T) {
+	var (
+		assert  = assert.New(t)
+		require = require.New(t)
+
+		logger = logging.NewTestLogger(nil, t)
+		ctx    = logging.WithLogger(context.Background(), logger)
+
+		endpoints  = generateEndpoints(3)
+		transactor = &hedgeTestTransactor{
+			responses: map[string]func(*http.Request) (*http.Response, error){
+				endpoints[0].Host: respondWith(200, `["mac:112233445566"]`),
+				endpoints[1].Host: respondWith(500, "failed"),
+				endpoints[2].Host: respondWith(200, `["mac:665544332211"]`),
+			},
+		}
+
+		handler = New(endpoints,
+			WithTransactor(transactor.Do),
+			WithAggregation(MergeJSONArrays),
+			WithBreakers(&Breakers{Threshold: 1, CoolDown: time.Hour, Logger: logger}),
+		)
+	)
+
+	response := httptest.NewRecorder()
+	handler.ServeHTTP(response, httptest.NewRequest("GET", "/api/v2/devices", nil).WithContext(ctx))
+	assert.Equal(http.StatusOK, response.Code)
+	assert.Len(transactor.Hosts(), 3)
+
+	// the ejected endpoint is not sent a request, but is still reported
+	response = httptest.NewRecorder()
+	handler.ServeHTTP(response, httptest.NewRequest("GET", "/api/v2/devices", nil).WithContext(ctx))
+	assert.Equal(http.StatusOK, response.Code)
+	assert.ElementsMatch(
+		[]string{endpoints[0].Host, endpoints[1].Host, endpoints[2].Host, endpoints[0].Host, endpoints[2].Host},
+		transactor.Hosts(),
+	)
+
+	var aggregate Aggregate
+	require.NoError(json.Unmarshal(response.Body.Bytes(), &aggregate))
+	assert.JSONEq(`["mac:112233445566", "mac:665544332211"]`, string(aggregate.Data))
+	assert.True(aggregate.Partial)
+	assert.Equal(
+		[]EndpointStatus{
+			{URL: endpoints[0].String() + "/api/v2/devices", StatusCode: 200},
+			{URL: endpoints[1].String() + "/api/v2/devices", StatusCode: http.StatusServiceUnavailable, Error: errEndpointEjected.Error()},
+			{URL: endpoints[2].String() + "/api/v2/devices", StatusCode: 200},
+		},
+		aggregate.Endpoints,
+	)
+}
+
+func TestHandlerBreakers(t *testing.T) {
+	t.Run("Ejected", testHandlerBreakersEjected)
+	t.Run("AllEjected", testHandlerBreakersAllEjected)
+	t.Run("Aggregate", testHandlerBreakersAggregate)
+}
@@ -37,9 +37,19 @@ type Configuration struct {
 	// ClientTimeout is the http.Client Timeout.  If not set, DefaultClientTimeout is used.
 	ClientTimeout time.Duration `json:"clientTimeout"`
 
+	// HedgeDelay, if positive, sends fanout requests one at a time in endpoint order, sending the next
+	// request after this delay or as soon as a request fails.  Any result that ShouldTerminate rejects counts
+	// as a failure, including 4xx responses and, with a custom ShouldTerminate, 2xx responses.  If unset,
+	// all fanout requests are sent at once.
+	HedgeDelay time.Duration `json:"hedgeDelay"`
+
 	// Concurrency is the maximum number of concurrent fanouts allowed.  If this is not set, DefaultConcurrency is used.
 	Concurrency int `json:"concurrency"`
 
+	// MaxBodySize is the largest request body, in bytes, that will be fanned out.  Larger requests are rejected
+	// with a 413 status.  If unset, request bodies are not limited.
+	MaxBodySize int64 `json:"maxBodySize"`
+
 	// MaxRedirects defines the maximum number of redirects each fanout will allow
 	MaxRedirects int `json:"maxRedirects"`
 
@@ -83,6 +93,14 @@ func (c *Configuration) clientTimeout() time.Duration {
 	return DefaultClientTimeout
 }
 
+func (c *Configuration) hedgeDelay() time.Duration {
+	if c != nil && c.HedgeDelay > 0 {
+		return c.HedgeDelay
+	}
+
+	return 0
+}
+
 func (c *Configuration) transport() http.RoundTripper {
 	var transport http.RoundTripper = new(http.Transport)
 	if c != nil {
@@ -102,6 +120,14 @@ func (c *Configuration) concurrency() int {
 	return DefaultConcurrency
 }
 
+func (c *Configuration) maxBodySize() int64 {
+	if c != nil && c.MaxBodySize > 0 {
+		return c.MaxBodySize
+	}
+
+	return 0
+}
+
 func (c *Configuration) maxRedirects() int {
 	if c != nil {
 		return c.MaxRedirects
@@ -143,5 +169,6 @@ func NewChain(c Configuration, rf ...gokithttp.RequestFunc) alice.Chain {
 		}),
 		xcontext.Populate(rf...),
 		xhttp.Busy(c.concurrency()),
+		xhttp.MaxBodySize(c.maxBodySize()),
 	)
 }
@@ -3,6 +3,7 @@ package fanout
 import (
 	"net/http"
 	"net/http/httptest"
+	"strings"
 	"testing"
 	"time"
 
@@ -17,8 +18,10 @@ func testConfigurationDefault(t *testing.T, cfg *Configuration) {
 	assert.Equal(DefaultClientTimeout, cfg.clientTimeout())
 	assert.NotNil(cfg.transport())
 	assert.Equal(DefaultConcurrency, cfg.concurrency())
+	assert.Zero(cfg.hedgeDelay())
 	assert.Empty(cfg.redirectExcludeHeaders())
 	assert.Zero(cfg.maxRedirects())
+	assert.Zero(cfg.maxBodySize())
 	assert.NotNil(cfg.checkRedirect())
 }
 
@@ -32,8 +35,10 @@ func testConfigurationCustom(t *testing.T) {
 			FanoutTimeout:          13 * time.Hour,
 			ClientTimeout:          981 * time.Millisecond,
 			Concurrency:            63482,
+			HedgeDelay:             250 * time.Millisecond,
 			RedirectExcludeHeaders: []string{"X-Test-1", "X-Test-2"},
 			MaxRedirects:           17,
+			MaxBodySize:            4096,
 		}
 	)
 
@@ -43,8 +48,10 @@ func testConfigurationCustom(t *testing.T) {
 	assert.Equal(981*time.Millisecond, cfg.clientTimeout())
 	assert.NotNil(cfg.transport())
 	assert.Equal(63482, cfg.concurrency())
+	assert.Equal(250*time.Millisecond, cfg.hedgeDelay())
 	assert.Equal([]string{"X-Test-1", "X-Test-2"}, cfg.redirectExcludeHeaders())
 	assert.Equal(17, cfg.maxRedirects())
+	assert.Equal(int64(4096), cfg.maxBodySize())
 	assert.NotNil(cfg.checkRedirect())
 }
 
@@ -84,3 +91,19 @@ func TestNewChain(t *testing.T) {
 	decorated.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/", nil))
 	assert.True(handlerCalled)
 }
+
+func TestNewChainMaxBodySize(t *testing.T) {
+	var (
+		assert = assert.New(t)
+
+		handler = http.HandlerFunc(func(http.ResponseWriter, *http.Request) {
+			assert.Fail("The handler should not have been called")
+		})
+
+		decorated = NewChain(Configuration{MaxBodySize: 4}).Then(handler)
+		response  = httptest.NewRecorder()
+	)
+
+	decorated.ServeHTTP(response, httptest.NewRequest("POST", "/", strings.NewReader("too large")))
+	assert.Equal(http.StatusRequestEntityTooLarge, response.Code)
+}
@@ -7,6 +7,7 @@ import (
 	"io/ioutil"
 	"net/http"
 	"net/url"
+	"time"
 
 	"github.com/go-kit/kit/log"
 	"github.com/go-kit/kit/log/level"
@@ -126,6 +127,21 @@ func WithClientFailure(failure ...gokithttp.ClientResponseFunc) Option {
 	}
 }
 
+// WithHedgeDelay configures a staged, or hedged, fanout.  Rather than sending every fanout request at once,
+// the Handler sends requests one at a time in the order returned by the Endpoints strategy.  The next request
+// is sent when delay elapses without a terminating result, or immediately when a request fails.  A request fails
+// when its result doesn't satisfy ShouldTerminate, whatever its status code.  If delay is nonpositive, the Handler
+// sends every fanout request at once, which is the default.
+func WithHedgeDelay(delay time.Duration) Option {
+	return func(h *Handler) {
+		if delay > 0 {
+			h.hedgeDelay = delay
+		} else {
+			h.hedgeDelay = 0
+		}
+	}
+}
+
 // WithConfiguration uses a set of (typically injected) fanout configuration options to configure a Handler.
 // Use of this option will not override the configured Endpoints instance.
 func WithConfiguration(c Configuration) Option {
@@ -136,6 +152,10 @@ func WithConfiguration(c Configuration) Option {
 		if len(authorization) > 0 {
 			WithClientBefore(gokithttp.SetRequestHeader("Authorization", authorization))(h)
 		}
+
+		if hedgeDelay := c.hedgeDelay(); hedgeDelay > 0 {
+			WithHedgeDelay(hedgeDelay)(h)
+		}
 	}
 }
 
@@ -148,6 +168,9 @@ type Handler struct {
 	failure         []FanoutResponseFunc
 	shouldTerminate ShouldTerminateFunc
 	transactor      func(*http.Request) (*http.Response, error)
+	hedgeDelay      time.Duration
+	merger          Merger
+	breakers        *Breakers
 }
 
 // New creates a fanout Handler.  The Endpoints strategy is required, and this constructor function will
@@ -227,6 +250,7 @@ func (h *Handler) execute(logger log.Logger, spanner tracing.Spanner, results ch
 		}
 	)
 
+	start := time.Now()
 	result.Response, result.Err = h.transactor(request)
 	switch {
 	case result.Response != nil:
@@ -265,6 +289,10 @@ func (h *Handler) execute(logger log.Logger, spanner tracing.Spanner, results ch
 		result.ContentType = "text/plain"
 	}
 
+	if h.breakers != nil {
+		h.breakers.Record(result, time.Since(start))
+	}
+
 	result.Span = finisher(result.Err)
 	results <- result
 }
@@ -312,25 +340,79 @@ func (h *Handler) ServeHTTP(response http.ResponseWriter, original *http.Request
 		return
 	}
 
+	var ejected []*http.Request
+	if h.breakers != nil {
+		var allowed []*http.Request
+		allowed, ejected = h.breakers.filter(logger, requests)
+		if h.merger == nil {
+			requests = allowed
+		}
+	}
+
+	if h.merger != nil {
+		// ejected endpoints are not sent a request, but they are still reported in the aggregate
+		h.aggregate(logger, response, original, requests, ejected)
+		return
+	}
+
 	var (
 		spanner = tracing.NewSpanner()
 		results = make(chan Result, len(requests))
+
+		next  int
+		timer *time.Timer
+		hedge <-chan time.Time
 	)
 
-	for _, r := range requests {
-		go h.execute(logger, spanner, results, r)
+	// send executes the next fanout request.  When hedging, this also starts the timer for the request after it.
+	send := func() {
+		if next > 0 {
+			logger.Log(level.Key(), level.DebugValue(), logging.MessageKey(), "hedging fanout request", "url", requests[next].URL)
+		}
+
+		go h.execute(logger, spanner, results, requests[next])
+		next++
+
+		if timer != nil {
+			timer.Stop()
+			hedge = nil
+		}
+
+		if next < len(requests) {
+			timer = time.NewTimer(h.hedgeDelay)
+			hedge = timer.C
+		}
+	}
+
+	if h.hedgeDelay > 0 {
+		send()
+		defer func() {
+			if timer != nil {
+				timer.Stop()
+			}
+		}()
+	} else {
+		for _, r := range requests {
+			go h.execute(logger, spanner, results, r)
+		}
+
+		next = len(requests)
 	}
 
 	statusCode := 0
 	var latestResponse Result
-	for i := 0; i < len(requests); i++ {
+	for i := 0; i < len(requests); {
 		select {
 		case <-fanoutCtx.Done():
 			logger.Log(level.Key(), level.ErrorValue(), logging.MessageKey(), "fanout operation canceled or timed out", "statusCode", http.StatusGatewayTimeout, "url", original.URL, logging.ErrorKey(), fanoutCtx.Err())
 			response.WriteHeader(http.StatusGatewayTimeout)
 			return
 
+		case <-hedge:
+			send()
+
 		case r := <-results:
+			i++
 			tracinghttp.HeadersForSpans("", response.Header(), r.Span)
 			if r.Err != nil {
 				logger.Log(level.Key(), level.ErrorValue(), logging.MessageKey(), "fanout request complete", "statusCode", r.StatusCode, "url", r.Request.URL, logging.ErrorKey(), r.Err)
@@ -348,6 +430,11 @@ func (h *Handler) ServeHTTP(response http.ResponseWriter, original *http.Request
 				statusCode = r.StatusCode
 				latestResponse = r
 			}
+
+			if next < len(requests) {
+				// a non-terminating result counts as a failure, which hedges immediately rather than waiting out the delay
+				send()
+			}
 		}
 	}
 
@@ -5,9 +5,11 @@ import (
 	"errors"
 	"fmt"
 	"io"
+	"io/ioutil"
 	"net/http"
 	"net/http/httptest"
 	"strings"
+	"sync"
 	"testing"
 	"time"
 
@@ -354,6 +356,224 @@ func testHandlerTimeout(t *testing.T, endpointCount int) {
 	transactor.AssertExpectations(t)
 }
 
+// hedgeTestTransactor is a transactor for hedged fanouts that records the order of requests
+type hedgeTestTransactor struct {
+	lock      sync.Mutex
+	hosts     []string
+	responses map[string]func(*http.Request) (*http.Response, error)
+}
+
+func (htt *hedgeTestTransactor) Do(request *http.Request) (*http.Response, error) {
+	htt.lock.Lock()
+	htt.hosts = append(htt.hosts, request.URL.Host)
+	respond := htt.responses[request.URL.Host]
+	htt.lock.Unlock()
+
+	return respond(request)
+}
+
+func (htt *hedgeTestTransactor) Hosts() []string {
+	htt.lock.Lock()
+	defer htt.lock.Unlock()
+	return append([]string(nil), htt.hosts...)
+}
+
+func respondWith(statusCode int, body string) func(*http.Request) (*http.Response, error) {
+	return func(*http.Request) (*http.Response, error) {
+		return &http.Response{
+			StatusCode: statusCode,
+			Header:     http.Header{"Content-Type": {"text/plain"}},
+			Body:       ioutil.NopCloser(strings.NewReader(body)),
+		}, nil
+	}
+}
+
+func testHandlerHedgeOnFailure(t *testing.T) {
+	var (
+		assert = assert.New(t)
+
+		logger   = logging.NewTestLogger(nil, t)
+		ctx      = logging.WithLogger(context.Background(), logger)
+		original = httptest.NewRequest("GET", "/api/v2/something", nil).WithContext(ctx)
+		response = httptest.NewRecorder()
+
+		endpoints  = generateEndpoints(3)
+		transactor = &hedgeTestTransactor{
+			responses: map[string]func(*http.Request) (*http.Response, error){
+				endpoints[0].Host: respondWith(500, "failed"),
+				endpoints[1].Host: func(request *http.Request) (*http.Response, error) {
+					assert.Equal("foobar", request.Header.Get("X-Test"))
+					return respondWith(200, "expected body")(request)
+				},
+				endpoints[2].Host: respondWith(200, "unexpected body"),
+			},
+		}
+
+		afterCalled = false
+		handler     = New(endpoints,
+			WithTransactor(transactor.Do),
+			WithHedgeDelay(time.Hour),
+			WithClientBefore(gokithttp.SetRequestHeader("X-Test", "foobar")),
+			WithFanoutAfter(func(ctx context.Context, _ http.ResponseWriter, result Result) context.Context {
+				afterCalled = true
+				assert.Equal(200, result.StatusCode)
+				return ctx
+			}),
+		)
+	)
+
+	handler.ServeHTTP(response, original)
+	assert.Equal(200, response.Code)
+	assert.Equal("expected body", response.Body.String())
+	assert.True(afterCalled)
+	assert.Equal([]string{endpoints[0].Host, endpoints[1].Host}, transactor.Hosts())
+}
+
+func testHandlerHedgeOnDelay(t *testing.T) {
+	var (
+		assert = assert.New(t)
+
+		logger   = logging.NewTestLogger(nil, t)
+		ctx      = logging.WithLogger(context.Background(), logger)
+		original = httptest.NewRequest("GET", "/api/v2/something", nil).WithContext(ctx)
+		response = httptest.NewRecorder()
+
+		slow       = make(chan struct{})
+		endpoints  = generateEndpoints(3)
+		transactor = &hedgeTestTransactor{
+			responses: map[string]func(*http.Request) (*http.Response, error){
+				endpoints[0].Host: func(request *http.Request) (*http.Response, error) {
+					<-slow
+					return respondWith(200, "slow body")(request)
+				},
+				endpoints[1].Host: respondWith(200, "expected body"),
+				endpoints[2].Host: respondWith(200, "unexpected body"),
+			},
+		}
+
+		handler = New(endpoints, WithTransactor(transactor.Do), WithHedgeDelay(10*time.Millisecond))
+	)
+
+	defer close(slow)
+	handler.ServeHTTP(response, original)
+	assert.Equal(200, response.Code)
+	assert.Equal("expected body", response.Body.String())
+
+	hosts := transactor.Hosts()
+	if assert.True(len(hosts) >= 2) {
+		assert.Equal([]string{endpoints[0].Host, endpoints[1].Host}, hosts[:2])
+	}
+}
+
+func testHandlerHedgeAllFailed(t *testing.T) {
+	var (
+		assert = assert.New(t)
+
+		logger   = logging.NewTestLogger(nil, t)
+		ctx      = logging.WithLogger(context.Background(), logger)
+		original = httptest.NewRequest("GET", "/api/v2/something", nil).WithContext(ctx)
+		response = httptest.NewRecorder()
+
+		endpoints  = generateEndpoints(3)
+		transactor = &hedgeTestTransactor{
+			responses: map[string]func(*http.Request) (*http.Response, error){
+				endpoints[0].Host: respondWith(500, "first"),
+				endpoints[1].Host: respondWith(503, "second"),
+				endpoints[2].Host: respondWith(502, "third"),
+			},
+		}
+
+		failureCalled = false
+		handler       = New(endpoints,
+			WithConfiguration(Configuration{HedgeDelay: time.Hour}),
+			WithTransactor(transactor.Do),
+			WithFanoutFailure(func(ctx context.Context, _ http.ResponseWriter, result Result) context.Context {
+				failureCalled = true
+				return ctx
+			}),
+		)
+	)
+
+	handler.ServeHTTP(response, original)
+	assert.Equal(503, response.Code)
+	assert.Equal("second", response.Body.String())
+	assert.True(failureCalled)
+	assert.Equal([]string{endpoints[0].Host, endpoints[1].Host, endpoints[2].Host}, transactor.Hosts())
+}
+
+func testHandlerHedgeShouldTerminate(t *testing.T) {
+	var (
+		assert = assert.New(t)
+
+		logger   = logging.NewTestLogger(nil, t)
+		ctx      = logging.WithLogger(context.Background(), logger)
+		original = httptest.NewRequest("GET", "/api/v2/something", nil).WithContext(ctx)
+		response = httptest.NewRecorder()
+
+		endpoints  = generateEndpoints(2)
+		transactor = &hedgeTestTransactor{
+			responses: map[string]func(*http.Request) (*http.Response, error){
+				endpoints[0].Host: respondWith(404, "not found"),
+				endpoints[1].Host: respondWith(200, "unexpected body"),
+			},
+		}
+
+		handler = New(endpoints,
+			WithTransactor(transactor.Do),
+			WithHedgeDelay(time.Hour),
+			WithShouldTerminate(func(r Result) bool { return r.StatusCode == 404 }),
+		)
+	)
+
+	handler.ServeHTTP(response, original)
+	assert.Equal(404, response.Code)
+	assert.Equal([]string{endpoints[0].Host}, transactor.Hosts())
+}
+
+func testHandlerHedgeNonTerminating(t *testing.T) {
+	testData := []struct {
+		description     string
+		statusCode      int
+		shouldTerminate ShouldTerminateFunc
+	}{
+		{"4xx", 404, nil},
+		{"2xx", 202, func(r Result) bool { return r.StatusCode == 200 }},
+	}
+
+	for _, record := range testData {
+		t.Run(record.description, func(t *testing.T) {
+			var (
+				assert = assert.New(t)
+
+				logger   = logging.NewTestLogger(nil, t)
+				ctx      = logging.WithLogger(context.Background(), logger)
+				original = httptest.NewRequest("GET", "/api/v2/something", nil).WithContext(ctx)
+				response = httptest.NewRecorder()
+
+				endpoints  = generateEndpoints(2)
+				transactor = &hedgeTestTransactor{
+					responses: map[string]func(*http.Request) (*http.Response, error){
+						endpoints[0].Host: respondWith(record.statusCode, "non-terminating body"),
+						endpoints[1].Host: respondWith(200, "expected body"),
+					},
+				}
+
+				options = []Option{WithTransactor(transactor.Do), WithHedgeDelay(time.Hour)}
+			)
+
+			if record.shouldTerminate != nil {
+				options = append(options, WithShouldTerminate(record.shouldTerminate))
+			}
+
+			// with an hour's delay, the second endpoint is only reached if the first result hedges immediately
+			New(endpoints, options...).ServeHTTP(response, original)
+			assert.Equal(200, response.Code)
+			assert.Equal("expected body", response.Body.String())
+			assert.Equal([]string{endpoints[0].Host, endpoints[1].Host}, transactor.Hosts())
+		})
+	}
+}
+
 func TestHandler(t *testing.T) {
 	t.Run("BodyError", testHandlerBodyError)
 	t.Run("NoEndpoints", testHandlerNoEndpoints)
@@ -462,6 +682,14 @@ func TestHandler(t *testing.T) {
 			})
 		}
 	})
+
+	t.Run("Hedge", func(t *testing.T) {
+		t.Run("OnFailure", testHandlerHedgeOnFailure)
+		t.Run("OnDelay", testHandlerHedgeOnDelay)
+		t.Run("AllFailed", testHandlerHedgeAllFailed)
+		t.Run("ShouldTerminate", testHandlerHedgeShouldTerminate)
+		t.Run("NonTerminating", testHandlerHedgeNonTerminating)
+	})
 }
 
 func testNewNilEndpoints(t *testing.T) {
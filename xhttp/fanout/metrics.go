@@ -0,0 +1,24 @@
+package fanout
+
+import "github.com/xmidt-org/webpa-common/xmetrics"
+
+const (
+	EjectedEndpointsGauge   = "fanout_ejected_endpoints"
+	EndpointEjectionCounter = "fanout_endpoint_ejections_count"
+)
+
+// Metrics is the module function for this package that adds the fanout endpoint breaker metrics
+func Metrics() []xmetrics.Metric {
+	return []xmetrics.Metric{
+		{
+			Name: EjectedEndpointsGauge,
+			Type: "gauge",
+			Help: "The number of fanout endpoints currently ejected by their circuit breakers",
+		},
+		{
+			Name: EndpointEjectionCounter,
+			Type: "counter",
+			Help: "The total number of times a fanout endpoint has been ejected by its circuit breaker",
+		},
+	}
+}
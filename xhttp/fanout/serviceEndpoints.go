@@ -3,6 +3,7 @@ package fanout
 import (
 	"net/http"
 	"net/url"
+	"sort"
 	"sync"
 
 	"github.com/xmidt-org/webpa-common/device"
@@ -20,11 +21,14 @@ type ServiceEndpoints struct {
 	keyFunc         servicehttp.KeyFunc
 	accessorFactory service.AccessorFactory
 	accessors       map[string]service.Accessor
+	preferredKeys   []string
+	order           []string
 }
 
 // FanoutURLs uses the currently available discovered endpoints to produce a set of URLs.
 // The original request is used to produce a hash key, then each accessor is consulted for
-// the endpoint that matches that key.
+// the endpoint that matches that key.  URLs are ordered by event key, with any preferred keys
+// first, so that a hedged fanout tries the owner of the hash key in the preferred instancers first.
 func (se *ServiceEndpoints) FanoutURLs(original *http.Request) ([]*url.URL, error) {
 	hashKey, err := se.keyFunc(original)
 	if err != nil {
@@ -33,8 +37,8 @@ func (se *ServiceEndpoints) FanoutURLs(original *http.Request) ([]*url.URL, erro
 
 	se.lock.RLock()
 	endpoints := make([]string, 0, len(se.accessors))
-	for _, a := range se.accessors {
-		e, err := a.Get(hashKey)
+	for _, key := range se.order {
+		e, err := se.accessors[key].Get(hashKey)
 		if err != nil {
 			continue
 		}
@@ -54,10 +58,38 @@ func (se *ServiceEndpoints) FanoutURLs(original *http.Request) ([]*url.URL, erro
 func (se *ServiceEndpoints) MonitorEvent(e monitor.Event) {
 	accessor := se.accessorFactory(e.Instances)
 	se.lock.Lock()
+	if _, ok := se.accessors[e.Key]; !ok {
+		se.order = append(se.order, e.Key)
+		se.sortKeys()
+	}
+
 	se.accessors[e.Key] = accessor
 	se.lock.Unlock()
 }
 
+// sortKeys orders the event keys so that preferred keys come first, in the order given, followed by
+// the remaining keys in lexical order
+func (se *ServiceEndpoints) sortKeys() {
+	rank := func(key string) int {
+		for i, pk := range se.preferredKeys {
+			if key == pk {
+				return i
+			}
+		}
+
+		return len(se.preferredKeys)
+	}
+
+	sort.SliceStable(se.order, func(i, j int) bool {
+		ri, rj := rank(se.order[i]), rank(se.order[j])
+		if ri != rj {
+			return ri < rj
+		}
+
+		return se.order[i] < se.order[j]
+	})
+}
+
 // ServiceEndpointsOption is a strategy for configuring a ServiceEndpoints
 type ServiceEndpointsOption func(*ServiceEndpoints)
 
@@ -85,6 +117,15 @@ func WithAccessorFactory(af service.AccessorFactory) ServiceEndpointsOption {
 	}
 }
 
+// WithPreferredKeys configures the service discovery event keys, i.e. instancers, whose endpoints are
+// returned first by FanoutURLs, in the order given.  This is typically used with a hedged fanout so that
+// the endpoint in the local datacenter is tried before any others.
+func WithPreferredKeys(keys ...string) ServiceEndpointsOption {
+	return func(se *ServiceEndpoints) {
+		se.preferredKeys = append([]string(nil), keys...)
+	}
+}
+
 // NewServiceEndpoints creates a ServiceEndpoints instance.  By default, device.IDHashParser is used as the KeyFunc
 // and service.DefaultAccessorFactory is used as the accessor factory.
 func NewServiceEndpoints(options ...ServiceEndpointsOption) *ServiceEndpoints {
@@ -164,6 +164,33 @@ func testNewServiceEndpointsCustom(t *testing.T) {
 	assert.NoError(err)
 }
 
+func testNewServiceEndpointsPreferredKeys(t *testing.T) {
+	var (
+		assert  = assert.New(t)
+		request = httptest.NewRequest("GET", "/", nil)
+
+		se = NewServiceEndpoints(WithPreferredKeys("local"))
+	)
+
+	request.Header.Set(device.DeviceNameHeader, "mac:112233445566")
+	se.MonitorEvent(monitor.Event{Key: "remote2", Instances: []string{"http://remote2.net"}})
+	se.MonitorEvent(monitor.Event{Key: "remote1", Instances: []string{"http://remote1.net"}})
+	se.MonitorEvent(monitor.Event{Key: "local", Instances: []string{"http://local.net"}})
+	se.MonitorEvent(monitor.Event{Key: "remote1", Instances: []string{"http://remote1.com"}})
+
+	urls, err := se.FanoutURLs(request)
+	assert.Equal(
+		[]*url.URL{
+			{Scheme: "http", Host: "local.net"},
+			{Scheme: "http", Host: "remote1.com"},
+			{Scheme: "http", Host: "remote2.net"},
+		},
+		urls,
+	)
+
+	assert.NoError(err)
+}
+
 func TestNewServiceEndpoints(t *testing.T) {
 	t.Run("KeyFuncError", testNewServiceEndpointsKeyFuncError)
 
@@ -173,6 +200,7 @@ func TestNewServiceEndpoints(t *testing.T) {
 	})
 
 	t.Run("Custom", testNewServiceEndpointsCustom)
+	t.Run("PreferredKeys", testNewServiceEndpointsPreferredKeys)
 }
 
 func TestServiceEndpointsAlternate(t *testing.T) {
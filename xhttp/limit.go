@@ -0,0 +1,79 @@
+package xhttp
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+
+	"github.com/go-kit/kit/log/level"
+	"github.com/xmidt-org/webpa-common/logging"
+)
+
+// newBodyTooLargeError produces the error returned when a request body exceeds its limit
+func newBodyTooLargeError(limit int64) *Error {
+	return &Error{
+		Code: http.StatusRequestEntityTooLarge,
+		Text: fmt.Sprintf("Request body exceeds %d bytes", limit),
+	}
+}
+
+// limitedBody is a request body that returns a 413 Error once more than a limited number of bytes are read
+type limitedBody struct {
+	io.ReadCloser
+	limit     int64
+	remaining int64
+	err       error
+}
+
+func (lb *limitedBody) Read(p []byte) (int, error) {
+	if lb.err != nil {
+		return 0, lb.err
+	}
+
+	if int64(len(p)) > lb.remaining+1 {
+		p = p[:lb.remaining+1]
+	}
+
+	n, err := lb.ReadCloser.Read(p)
+	if int64(n) <= lb.remaining {
+		lb.remaining -= int64(n)
+		return n, err
+	}
+
+	n = int(lb.remaining)
+	lb.remaining = 0
+	lb.err = newBodyTooLargeError(lb.limit)
+	return n, lb.err
+}
+
+// MaxBodySize creates an Alice-style constructor that limits the size of request bodies.  A request whose
+// Content-Length exceeds limit is rejected with http.StatusRequestEntityTooLarge before the decorated handler
+// is invoked.  Otherwise, reading more than limit bytes from the request body returns an *Error with a
+// http.StatusRequestEntityTooLarge code, which go-kit error encoders will write as a 413 response.
+//
+// If limit is nonpositive, request bodies are not limited.
+func MaxBodySize(limit int64) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		if limit < 1 {
+			return next
+		}
+
+		return http.HandlerFunc(func(response http.ResponseWriter, request *http.Request) {
+			if request.ContentLength > limit {
+				logging.GetLogger(request.Context()).Log(level.Key(), level.ErrorValue(), logging.MessageKey(), "request body too large", "contentLength", request.ContentLength, "limit", limit)
+				WriteError(response, http.StatusRequestEntityTooLarge, newBodyTooLargeError(limit))
+				return
+			}
+
+			if request.Body != nil && request.Body != http.NoBody {
+				request.Body = &limitedBody{
+					ReadCloser: request.Body,
+					limit:      limit,
+					remaining:  limit,
+				}
+			}
+
+			next.ServeHTTP(response, request)
+		})
+	}
+}
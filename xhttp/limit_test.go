@@ -0,0 +1,109 @@
+package xhttp
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	gokithttp "github.com/go-kit/kit/transport/http"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func testMaxBodySizeUnlimited(t *testing.T) {
+	var (
+		assert = assert.New(t)
+
+		handlerCalled = false
+		handler       = http.HandlerFunc(func(_ http.ResponseWriter, request *http.Request) {
+			handlerCalled = true
+			body, err := ioutil.ReadAll(request.Body)
+			assert.Equal("a body of any size", string(body))
+			assert.NoError(err)
+		})
+	)
+
+	for _, limit := range []int64{-1, 0} {
+		handlerCalled = false
+		MaxBodySize(limit)(handler).ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("POST", "/", strings.NewReader("a body of any size")))
+		assert.True(handlerCalled)
+	}
+}
+
+func testMaxBodySizeWithinLimit(t *testing.T) {
+	var (
+		assert = assert.New(t)
+
+		handlerCalled = false
+		handler       = http.HandlerFunc(func(_ http.ResponseWriter, request *http.Request) {
+			handlerCalled = true
+			body, err := ioutil.ReadAll(request.Body)
+			assert.Equal("exactly 16 bytes", string(body))
+			assert.NoError(err)
+		})
+
+		request = httptest.NewRequest("POST", "/", strings.NewReader("exactly 16 bytes"))
+	)
+
+	request.ContentLength = -1
+	MaxBodySize(16)(handler).ServeHTTP(httptest.NewRecorder(), request)
+	assert.True(handlerCalled)
+}
+
+func testMaxBodySizeContentLength(t *testing.T) {
+	var (
+		assert = assert.New(t)
+
+		handler = http.HandlerFunc(func(http.ResponseWriter, *http.Request) {
+			assert.Fail("The handler should not have been called")
+		})
+
+		response = httptest.NewRecorder()
+	)
+
+	MaxBodySize(8)(handler).ServeHTTP(response, httptest.NewRequest("POST", "/", strings.NewReader("more than 8 bytes")))
+	assert.Equal(http.StatusRequestEntityTooLarge, response.Code)
+	assert.Equal("application/json", response.Header().Get("Content-Type"))
+}
+
+func testMaxBodySizeRead(t *testing.T) {
+	var (
+		assert  = assert.New(t)
+		require = require.New(t)
+
+		handler = http.HandlerFunc(func(response http.ResponseWriter, request *http.Request) {
+			body, err := ioutil.ReadAll(request.Body)
+			assert.Equal("more thn", string(body))
+			require.Error(err)
+
+			e, ok := err.(*Error)
+			require.True(ok)
+			assert.Equal(http.StatusRequestEntityTooLarge, e.StatusCode())
+
+			// subsequent reads return the same error
+			n, err := request.Body.Read(make([]byte, 10))
+			assert.Zero(n)
+			assert.Equal(e, err)
+
+			gokithttp.DefaultErrorEncoder(context.Background(), err, response)
+		})
+
+		// a chunked request has no Content-Length, so the limit must be enforced on read
+		request  = httptest.NewRequest("POST", "/", strings.NewReader("more thn 8 bytes"))
+		response = httptest.NewRecorder()
+	)
+
+	request.ContentLength = -1
+	MaxBodySize(8)(handler).ServeHTTP(response, request)
+	assert.Equal(http.StatusRequestEntityTooLarge, response.Code)
+}
+
+func TestMaxBodySize(t *testing.T) {
+	t.Run("Unlimited", testMaxBodySizeUnlimited)
+	t.Run("WithinLimit", testMaxBodySizeWithinLimit)
+	t.Run("ContentLength", testMaxBodySizeContentLength)
+	t.Run("Read", testMaxBodySizeRead)
+}
@@ -1,6 +1,9 @@
 package xhttp
 
 import (
+	"context"
+	"io"
+	"io/ioutil"
 	"net/http"
 	"time"
 
@@ -11,7 +14,12 @@ import (
 	"github.com/xmidt-org/webpa-common/logging"
 )
 
-const DefaultRetryInterval = time.Second
+const (
+	DefaultRetryInterval = time.Second
+
+	// DefaultMaxRetryAfter is the longest Retry-After wait honored when RetryOptions.MaxRetryAfter is unset
+	DefaultMaxRetryAfter = time.Minute
+)
 
 // temporaryError is the expected interface for a (possibly) temporary error.
 // Several of the error types in the net package implicitely implement this interface,
@@ -53,10 +61,31 @@ type RetryOptions struct {
 	// Retries is the count of retries.  If not positive, then no transactor decoration is performed.
 	Retries int
 
-	// Interval is the time between retries.  If not set, DefaultRetryInterval is used.
+	// Interval is the time between retries.  If not set, DefaultRetryInterval is used.  This field is
+	// ignored if Backoff is set.
 	Interval time.Duration
 
-	// Sleep is function used to wait out a duration.  If unset, time.Sleep is used.
+	// Backoff is the policy that determines the wait before each retry.  If unset, ConstantBackoff(Interval) is used.
+	Backoff Backoff
+
+	// MaxElapsedTime is the longest time, measured from the initial attempt, within which a retry may be made.
+	// A retry whose wait would end after this time is not made.  If unset, there is no limit.
+	MaxElapsedTime time.Duration
+
+	// IgnoreRetryAfter disables the use of Retry-After headers.  By default, the wait before retrying a 429 or 503
+	// response with a Retry-After header is the time that header requests, rather than the Backoff's wait.
+	IgnoreRetryAfter bool
+
+	// MaxRetryAfter is the longest Retry-After wait that is honored.  A response whose Retry-After header requests
+	// a longer wait is not retried, and is returned as is.  If unset, DefaultMaxRetryAfter is used.
+	MaxRetryAfter time.Duration
+
+	// Budget is an optional retry budget, typically shared by several transactors, that limits retries
+	// to a fraction of the requests sent.
+	Budget *RetryBudget
+
+	// Sleep is function used to wait out a duration.  If unset, the wait ends early when the request's
+	// context is canceled.  In either case, no retry is made once the request's context is canceled.
 	Sleep func(time.Duration)
 
 	// ShouldRetry is the retry predicate.  Defaults to DefaultShouldRetry if unset.
@@ -68,6 +97,10 @@ type RetryOptions struct {
 	// Counter is the counter for total retries.  If unset, no metrics are collected on retries.
 	Counter metrics.Counter
 
+	// SpillThreshold, if positive, is the size beyond which request bodies are buffered for retries in a
+	// temporary file rather than in memory.  The file is closed once the final attempt has been made.
+	SpillThreshold int64
+
 	// UpdateRequest provides the ability to update the request before it is sent. default is noop
 	UpdateRequest func(*http.Request)
 }
@@ -103,19 +136,51 @@ func RetryTransactor(o RetryOptions, next func(*http.Request) (*http.Response, e
 		o.UpdateRequest = func(*http.Request) {}
 	}
 
-	if o.Interval < 1 {
-		o.Interval = DefaultRetryInterval
+	if o.Backoff == nil {
+		o.Backoff = ConstantBackoff(o.Interval)
 	}
 
-	if o.Sleep == nil {
-		o.Sleep = time.Sleep
+	if o.MaxRetryAfter < 1 {
+		o.MaxRetryAfter = DefaultMaxRetryAfter
+	}
+
+	wait := func(ctx context.Context, d time.Duration) error {
+		if o.Sleep != nil {
+			o.Sleep(d)
+			return ctx.Err()
+		}
+
+		timer := time.NewTimer(d)
+		defer timer.Stop()
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-timer.C:
+			return nil
+		}
 	}
 
 	return func(request *http.Request) (*http.Response, error) {
-		if err := EnsureRewindable(request); err != nil {
+		buffered := request.GetBody == nil && request.Body != nil
+		if err := EnsureRewindableSpill(request, o.SpillThreshold); err != nil {
 			return nil, err
 		}
-		var statusCode int
+
+		if buffered {
+			// this transactor owns the rewindable body it created, so it is released after the final attempt
+			defer ReleaseRewind(request.Body)
+		}
+
+		if o.Budget != nil {
+			o.Budget.Deposit()
+		}
+
+		var (
+			start      = time.Now()
+			backoff    time.Duration
+			statusCode int
+		)
 
 		// initial attempt:
 		response, err := next(request)
@@ -124,9 +189,39 @@ func RetryTransactor(o RetryOptions, next func(*http.Request) (*http.Response, e
 		}
 
 		for r := 0; r < o.Retries && ((err != nil && o.ShouldRetry(err)) || o.ShouldRetryStatus(statusCode)); r++ {
+			// the Backoff is always given its own previous delay, even when a Retry-After overrides it
+			backoff = o.Backoff(r+1, backoff)
+			delay := backoff
+			if !o.IgnoreRetryAfter {
+				if retryAfter, ok := RetryAfter(response, time.Now()); ok {
+					if retryAfter > o.MaxRetryAfter {
+						o.Logger.Log(level.Key(), level.DebugValue(), logging.MessageKey(), "HTTP transaction Retry-After exceeds the maximum", "url", request.URL.String(), "retry", r+1, "retryAfter", retryAfter)
+						break
+					}
+
+					delay = retryAfter
+				}
+			}
+
+			if o.MaxElapsedTime > 0 && time.Since(start)+delay > o.MaxElapsedTime {
+				o.Logger.Log(level.Key(), level.DebugValue(), logging.MessageKey(), "HTTP transaction retry would exceed the maximum elapsed time", "url", request.URL.String(), "retry", r+1, "delay", delay)
+				break
+			}
+
+			if o.Budget != nil && !o.Budget.Withdraw() {
+				o.Logger.Log(level.Key(), level.DebugValue(), logging.MessageKey(), "HTTP transaction retry budget exhausted", "url", request.URL.String(), "retry", r+1)
+				break
+			}
+
+			// the response is being discarded in favor of a retry
+			discardResponse(response)
+
+			if err := wait(request.Context(), delay); err != nil {
+				return nil, err
+			}
+
 			o.Counter.Add(1.0)
-			o.Sleep(o.Interval)
-			o.Logger.Log(level.Key(), level.DebugValue(), logging.MessageKey(), "retrying HTTP transaction", "url", request.URL.String(), logging.ErrorKey(), err, "retry", r+1, "statusCode", statusCode)
+			o.Logger.Log(level.Key(), level.DebugValue(), logging.MessageKey(), "retrying HTTP transaction", "url", request.URL.String(), logging.ErrorKey(), err, "retry", r+1, "statusCode", statusCode, "delay", delay)
 
 			if err := Rewind(request); err != nil {
 				return nil, err
@@ -146,3 +241,11 @@ func RetryTransactor(o RetryOptions, next func(*http.Request) (*http.Response, e
 		return response, err
 	}
 }
+
+// discardResponse drains and closes the body of a response that will not be returned to the caller
+func discardResponse(response *http.Response) {
+	if response != nil && response.Body != nil {
+		io.Copy(ioutil.Discard, response.Body)
+		response.Body.Close()
+	}
+}
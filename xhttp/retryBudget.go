@@ -0,0 +1,61 @@
+package xhttp
+
+import "sync"
+
+const DefaultRetryBudgetBurst = 10
+
+// RetryBudget limits the retries made by one or more retry transactors to a fraction of the requests they
+// send.  Each request deposits Ratio tokens into the budget, up to the burst size, and each retry withdraws
+// one token.  A retry is only made when a whole token is available.  The budget starts full, so a burst of
+// retries is allowed before any requests have been sent.
+//
+// A RetryBudget is safe for concurrent use, and is typically shared by every transactor that calls the same service.
+type RetryBudget struct {
+	ratio float64
+	burst float64
+
+	lock   sync.Mutex
+	tokens float64
+}
+
+// NewRetryBudget creates a RetryBudget that allows retries to be at most ratio of the requests, e.g. 0.1
+// for 10%.  If burst is nonpositive, DefaultRetryBudgetBurst is used.
+func NewRetryBudget(ratio float64, burst int) *RetryBudget {
+	if burst < 1 {
+		burst = DefaultRetryBudgetBurst
+	}
+
+	if ratio < 0 {
+		ratio = 0
+	}
+
+	return &RetryBudget{
+		ratio:  ratio,
+		burst:  float64(burst),
+		tokens: float64(burst),
+	}
+}
+
+// Deposit records a request, adding to the budget
+func (rb *RetryBudget) Deposit() {
+	rb.lock.Lock()
+	rb.tokens += rb.ratio
+	if rb.tokens > rb.burst {
+		rb.tokens = rb.burst
+	}
+
+	rb.lock.Unlock()
+}
+
+// Withdraw attempts to take a retry from the budget, returning true if the retry is allowed
+func (rb *RetryBudget) Withdraw() bool {
+	rb.lock.Lock()
+	defer rb.lock.Unlock()
+
+	if rb.tokens < 1.0 {
+		return false
+	}
+
+	rb.tokens--
+	return true
+}
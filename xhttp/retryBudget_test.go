@@ -0,0 +1,53 @@
+package xhttp
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRetryBudget(t *testing.T) {
+	t.Run("Default", func(t *testing.T) {
+		var (
+			assert = assert.New(t)
+			rb     = NewRetryBudget(-1.0, 0)
+		)
+
+		for i := 0; i < DefaultRetryBudgetBurst; i++ {
+			assert.True(rb.Withdraw())
+		}
+
+		rb.Deposit()
+		assert.False(rb.Withdraw())
+	})
+
+	t.Run("Ratio", func(t *testing.T) {
+		var (
+			assert = assert.New(t)
+			rb     = NewRetryBudget(0.25, 2)
+		)
+
+		// the budget starts full
+		assert.True(rb.Withdraw())
+		assert.True(rb.Withdraw())
+		assert.False(rb.Withdraw())
+
+		for i := 0; i < 3; i++ {
+			rb.Deposit()
+			assert.False(rb.Withdraw())
+		}
+
+		rb.Deposit()
+		assert.True(rb.Withdraw())
+		assert.False(rb.Withdraw())
+
+		// deposits are capped at the burst
+		for i := 0; i < 100; i++ {
+			rb.Deposit()
+		}
+
+		assert.True(rb.Withdraw())
+		assert.True(rb.Withdraw())
+		assert.False(rb.Withdraw())
+	})
+}
@@ -1,6 +1,7 @@
 package xhttp
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"io"
@@ -8,6 +9,7 @@ import (
 	"net"
 	"net/http"
 	"net/http/httptest"
+	"strings"
 	"testing"
 	"time"
 
@@ -250,6 +252,310 @@ func testRetryTransactorRewindError(t *testing.T) {
 	assert.Equal(expectedError, actualError)
 }
 
+func testRetryTransactorBackoff(t *testing.T) {
+	var (
+		assert  = assert.New(t)
+		require = require.New(t)
+
+		transactorCount = 0
+		slept           []time.Duration
+		retry           = RetryTransactor(
+			RetryOptions{
+				Logger:   logging.NewTestLogger(nil, t),
+				Retries:  3,
+				Interval: time.Hour,
+				Backoff:  ExponentialBackoff(time.Second, 3*time.Second),
+				Sleep:    func(d time.Duration) { slept = append(slept, d) },
+			},
+			func(*http.Request) (*http.Response, error) {
+				transactorCount++
+				return nil, &net.DNSError{IsTemporary: true}
+			},
+		)
+	)
+
+	require.NotNil(retry)
+	_, err := retry(httptest.NewRequest("GET", "/", nil))
+	assert.Error(err)
+	assert.Equal(4, transactorCount)
+	assert.Equal([]time.Duration{time.Second, 2 * time.Second, 3 * time.Second}, slept)
+}
+
+// closeRecorder is a response body that records whether it was closed
+type closeRecorder struct {
+	io.Reader
+	closed bool
+}
+
+func (cr *closeRecorder) Close() error {
+	cr.closed = true
+	return nil
+}
+
+func testRetryTransactorRetryAfter(t *testing.T, ignoreRetryAfter bool, expectedDelay time.Duration) {
+	var (
+		assert  = assert.New(t)
+		require = require.New(t)
+
+		bodies []*closeRecorder
+		slept  []time.Duration
+		retry  = RetryTransactor(
+			RetryOptions{
+				Logger:            logging.NewTestLogger(nil, t),
+				Retries:           2,
+				Interval:          time.Minute,
+				IgnoreRetryAfter:  ignoreRetryAfter,
+				ShouldRetryStatus: func(status int) bool { return status == http.StatusServiceUnavailable },
+				Sleep:             func(d time.Duration) { slept = append(slept, d) },
+			},
+			func(*http.Request) (*http.Response, error) {
+				body := &closeRecorder{Reader: strings.NewReader("unavailable")}
+				bodies = append(bodies, body)
+				return &http.Response{
+					StatusCode: http.StatusServiceUnavailable,
+					Header:     http.Header{"Retry-After": {"7"}},
+					Body:       body,
+				}, nil
+			},
+		)
+	)
+
+	require.NotNil(retry)
+	response, err := retry(httptest.NewRequest("GET", "/", nil))
+	assert.NoError(err)
+	require.NotNil(response)
+	assert.Equal(http.StatusServiceUnavailable, response.StatusCode)
+	assert.Equal([]time.Duration{expectedDelay, expectedDelay}, slept)
+
+	// every response but the one returned should have been closed
+	require.Len(bodies, 3)
+	assert.True(bodies[0].closed)
+	assert.True(bodies[1].closed)
+	assert.False(bodies[2].closed)
+}
+
+func testRetryTransactorMaxRetryAfter(t *testing.T) {
+	var (
+		assert  = assert.New(t)
+		require = require.New(t)
+
+		transactorCount = 0
+		slept           []time.Duration
+		retry           = RetryTransactor(
+			RetryOptions{
+				Logger:            logging.NewTestLogger(nil, t),
+				Retries:           3,
+				MaxRetryAfter:     10 * time.Second,
+				ShouldRetryStatus: func(status int) bool { return status == http.StatusTooManyRequests },
+				Sleep:             func(d time.Duration) { slept = append(slept, d) },
+			},
+			func(*http.Request) (*http.Response, error) {
+				transactorCount++
+				retryAfter := "5"
+				if transactorCount > 1 {
+					retryAfter = "3600"
+				}
+
+				return &http.Response{
+					StatusCode: http.StatusTooManyRequests,
+					Header:     http.Header{"Retry-After": {retryAfter}},
+					Body:       ioutil.NopCloser(strings.NewReader("slow down")),
+				}, nil
+			},
+		)
+	)
+
+	require.NotNil(retry)
+	response, err := retry(httptest.NewRequest("GET", "/", nil))
+	assert.NoError(err)
+	require.NotNil(response)
+	assert.Equal(http.StatusTooManyRequests, response.StatusCode)
+
+	// the second response asks for a wait longer than the maximum, so it is returned without a retry
+	assert.Equal(2, transactorCount)
+	assert.Equal([]time.Duration{5 * time.Second}, slept)
+}
+
+func testRetryTransactorRetryAfterBackoff(t *testing.T) {
+	var (
+		assert  = assert.New(t)
+		require = require.New(t)
+
+		previous []time.Duration
+		retry    = RetryTransactor(
+			RetryOptions{
+				Logger:  logging.NewTestLogger(nil, t),
+				Retries: 3,
+				Backoff: func(attempt int, p time.Duration) time.Duration {
+					previous = append(previous, p)
+					return time.Duration(attempt) * time.Second
+				},
+				ShouldRetryStatus: func(status int) bool { return status == http.StatusServiceUnavailable },
+				Sleep:             func(time.Duration) {},
+			},
+			func(*http.Request) (*http.Response, error) {
+				return &http.Response{
+					StatusCode: http.StatusServiceUnavailable,
+					Header:     http.Header{"Retry-After": {"30"}},
+					Body:       ioutil.NopCloser(strings.NewReader("unavailable")),
+				}, nil
+			},
+		)
+	)
+
+	require.NotNil(retry)
+	_, err := retry(httptest.NewRequest("GET", "/", nil))
+	assert.NoError(err)
+
+	// the Backoff sees its own previous delays, not the Retry-After waits
+	assert.Equal([]time.Duration{0, time.Second, 2 * time.Second}, previous)
+}
+
+func testRetryTransactorMaxElapsedTime(t *testing.T) {
+	var (
+		assert  = assert.New(t)
+		require = require.New(t)
+		counter = generic.NewCounter("test")
+
+		transactorCount = 0
+		retry           = RetryTransactor(
+			RetryOptions{
+				Logger:         logging.NewTestLogger(nil, t),
+				Retries:        5,
+				Counter:        counter,
+				Backoff:        ExponentialBackoff(10*time.Second, 0),
+				MaxElapsedTime: 30 * time.Second,
+				Sleep:          func(time.Duration) {},
+			},
+			func(*http.Request) (*http.Response, error) {
+				transactorCount++
+				return nil, &net.DNSError{IsTemporary: true}
+			},
+		)
+	)
+
+	require.NotNil(retry)
+	_, err := retry(httptest.NewRequest("GET", "/", nil))
+	assert.Error(err)
+
+	// the sleep does not actually wait, so the third wait of 40s is the first to end after the maximum elapsed time
+	assert.Equal(3, transactorCount)
+	assert.Equal(2.0, counter.Value())
+}
+
+func testRetryTransactorBudget(t *testing.T) {
+	var (
+		assert  = assert.New(t)
+		require = require.New(t)
+		budget  = NewRetryBudget(0.0, 1)
+
+		transactorCount = 0
+		transactor      = func(*http.Request) (*http.Response, error) {
+			transactorCount++
+			return nil, &net.DNSError{IsTemporary: true}
+		}
+
+		options = RetryOptions{
+			Logger:  logging.NewTestLogger(nil, t),
+			Retries: 3,
+			Budget:  budget,
+			Sleep:   func(time.Duration) {},
+		}
+
+		first  = RetryTransactor(options, transactor)
+		second = RetryTransactor(options, transactor)
+	)
+
+	require.NotNil(first)
+	require.NotNil(second)
+
+	first(httptest.NewRequest("GET", "/", nil))
+	assert.Equal(2, transactorCount)
+
+	// the budget is shared, so the second transactor cannot retry
+	second(httptest.NewRequest("GET", "/", nil))
+	assert.Equal(3, transactorCount)
+}
+
+func testRetryTransactorCanceled(t *testing.T) {
+	var (
+		assert  = assert.New(t)
+		require = require.New(t)
+
+		ctx, cancel     = context.WithCancel(context.Background())
+		transactorCount = 0
+		retry           = RetryTransactor(
+			RetryOptions{
+				Logger:   logging.NewTestLogger(nil, t),
+				Retries:  3,
+				Interval: time.Hour,
+			},
+			func(*http.Request) (*http.Response, error) {
+				transactorCount++
+				return nil, &net.DNSError{IsTemporary: true}
+			},
+		)
+
+		done = make(chan struct{})
+	)
+
+	require.NotNil(retry)
+	go func() {
+		defer close(done)
+		response, err := retry(httptest.NewRequest("GET", "/", nil).WithContext(ctx))
+		assert.Nil(response)
+		assert.Equal(context.Canceled, err)
+	}()
+
+	cancel()
+	select {
+	case <-done:
+		assert.Equal(1, transactorCount)
+	case <-time.After(5 * time.Second):
+		assert.Fail("The retry wait was not canceled")
+	}
+}
+
+func testRetryTransactorSpillThreshold(t *testing.T) {
+	var (
+		assert       = assert.New(t)
+		require      = require.New(t)
+		expectedBody = strings.Repeat("a large request body ", 100)
+
+		transactorCount = 0
+		sent            io.ReadCloser
+		retry           = RetryTransactor(
+			RetryOptions{
+				Logger:         logging.NewTestLogger(nil, t),
+				Retries:        2,
+				SpillThreshold: 64,
+				Sleep:          func(time.Duration) {},
+			},
+			func(request *http.Request) (*http.Response, error) {
+				transactorCount++
+				sent = request.Body
+				body, err := ioutil.ReadAll(request.Body)
+				assert.Equal(expectedBody, string(body))
+				assert.NoError(err)
+				assert.NoError(request.Body.Close())
+				return nil, &net.DNSError{IsTemporary: true}
+			},
+		)
+
+		request = httptest.NewRequest("POST", "/", ioutil.NopCloser(strings.NewReader(expectedBody)))
+	)
+
+	require.NotNil(retry)
+	_, err := retry(request)
+	assert.Error(err)
+	assert.Equal(3, transactorCount)
+
+	// the temporary file is closed after the final attempt
+	require.IsType(spillBody{}, sent)
+	_, err = sent.(spillBody).file.Stat()
+	assert.Error(err)
+}
+
 func TestRetryTransactor(t *testing.T) {
 	t.Run("DefaultLogger", testRetryTransactorDefaultLogger)
 	t.Run("NoRetries", testRetryTransactorNoRetries)
@@ -272,4 +578,20 @@ func TestRetryTransactor(t *testing.T) {
 	t.Run("NotRewindable", testRetryTransactorNotRewindable)
 	t.Run("RewindError", testRetryTransactorRewindError)
 	t.Run("StatusRetry", testRetryTransactorStatus)
+	t.Run("Backoff", testRetryTransactorBackoff)
+
+	t.Run("RetryAfter", func(t *testing.T) {
+		testRetryTransactorRetryAfter(t, false, 7*time.Second)
+	})
+
+	t.Run("IgnoreRetryAfter", func(t *testing.T) {
+		testRetryTransactorRetryAfter(t, true, time.Minute)
+	})
+
+	t.Run("MaxRetryAfter", testRetryTransactorMaxRetryAfter)
+	t.Run("RetryAfterBackoff", testRetryTransactorRetryAfterBackoff)
+	t.Run("MaxElapsedTime", testRetryTransactorMaxElapsedTime)
+	t.Run("Budget", testRetryTransactorBudget)
+	t.Run("Canceled", testRetryTransactorCanceled)
+	t.Run("SpillThreshold", testRetryTransactorSpillThreshold)
 }
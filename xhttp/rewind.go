@@ -6,6 +6,7 @@ import (
 	"io"
 	"io/ioutil"
 	"net/http"
+	"os"
 )
 
 var errNotRewindable = errors.New("That request is not rewindable")
@@ -65,6 +66,80 @@ func NewRewind(r io.Reader) (io.ReadCloser, func() (io.ReadCloser, error), error
 	return body, getBody, nil
 }
 
+// spillBody is a rewindable body backed by an anonymous temporary file.  Close does nothing, since the
+// same body is replayed by the get body function after an HTTP transport closes it.  The file is closed
+// by ReleaseRewind instead.
+type spillBody struct {
+	file *os.File
+}
+
+func (sb spillBody) Read(p []byte) (int, error) {
+	return sb.file.Read(p)
+}
+
+func (sb spillBody) Seek(offset int64, whence int) (int64, error) {
+	return sb.file.Seek(offset, whence)
+}
+
+func (sb spillBody) Close() error {
+	return nil
+}
+
+// NewRewindSpill is like NewRewind, except that when more than threshold bytes remain in r, those bytes are
+// written to a temporary file rather than held in memory.  The temporary file is removed as soon as it is created,
+// so that it does not outlive the process.  Once the body will no longer be sent, pass it to ReleaseRewind to close
+// the file.  Otherwise, the file descriptor is only released when the body is garbage collected.
+//
+// If threshold is nonpositive, this function behaves exactly like NewRewind.
+func NewRewindSpill(r io.Reader, threshold int64) (io.ReadCloser, func() (io.ReadCloser, error), error) {
+	if _, ok := r.(io.ReadSeeker); ok || threshold < 1 {
+		return NewRewind(r)
+	}
+
+	var buffer bytes.Buffer
+	if _, err := io.CopyN(&buffer, r, threshold+1); err == io.EOF {
+		body, getBody := NewRewindBytes(buffer.Bytes())
+		return body, getBody, nil
+	} else if err != nil {
+		return nil, nil, err
+	}
+
+	file, err := ioutil.TempFile("", "xhttp-rewind-")
+	if err != nil {
+		return nil, nil, err
+	}
+
+	// on platforms that cannot remove open files, the file is left to the usual temporary file cleanup
+	os.Remove(file.Name())
+
+	if _, err := io.Copy(file, io.MultiReader(&buffer, r)); err != nil {
+		file.Close()
+		return nil, nil, err
+	}
+
+	if _, err := file.Seek(0, io.SeekStart); err != nil {
+		file.Close()
+		return nil, nil, err
+	}
+
+	rsc := spillBody{file: file}
+	return rsc,
+		func() (io.ReadCloser, error) {
+			_, err := rsc.Seek(0, io.SeekStart)
+			return rsc, err
+		}, nil
+}
+
+// ReleaseRewind closes the temporary file behind a body created by NewRewindSpill, after which the body can no
+// longer be read or rewound.  For any other body, this function does nothing.
+func ReleaseRewind(body io.Reader) error {
+	if sb, ok := body.(spillBody); ok {
+		return sb.file.Close()
+	}
+
+	return nil
+}
+
 // NewRewindBytes produces both an io.ReadCloser that returns the given bytes
 // and a function that produces a new io.ReadCloser that returns those same bytes.
 // Both return values from this function are appropriate for http.Request.Body and
@@ -100,6 +175,24 @@ func EnsureRewindable(r *http.Request) error {
 	return nil
 }
 
+// EnsureRewindableSpill is like EnsureRewindable, except that it uses NewRewindSpill so that request
+// bodies larger than threshold are buffered in a temporary file rather than in memory.  The caller should
+// pass the request's Body to ReleaseRewind once the request will no longer be sent.
+func EnsureRewindableSpill(r *http.Request, threshold int64) error {
+	if r.GetBody != nil || r.Body == nil {
+		return nil
+	}
+
+	body, getBody, err := NewRewindSpill(r.Body, threshold)
+	if err != nil {
+		return err
+	}
+
+	r.Body = body
+	r.GetBody = getBody
+	return nil
+}
+
 // Rewind prepares a request body to be replayed.  If a GetBody function is present,
 // that function is invoked.  An error is returned if this function could not rewind the request.
 func Rewind(r *http.Request) error {
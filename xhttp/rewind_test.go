@@ -123,6 +123,136 @@ func TestNewRewind(t *testing.T) {
 	t.Run("Buffer", testNewRewindBuffer)
 }
 
+func testNewRewindSpillInMemory(t *testing.T, threshold int64) {
+	var (
+		assert        = assert.New(t)
+		require       = require.New(t)
+		expectedBytes = []byte("in memory")
+	)
+
+	body, getBody, err := NewRewindSpill(bytes.NewBuffer(expectedBytes), threshold)
+	require.NoError(err)
+	require.NotNil(body)
+	require.NotNil(getBody)
+	assert.IsType(closeAdapter{}, body)
+
+	actualBytes, err := ioutil.ReadAll(body)
+	assert.Equal(expectedBytes, actualBytes)
+	assert.NoError(err)
+
+	body2, err := getBody()
+	require.NoError(err)
+	actualBytes, err = ioutil.ReadAll(body2)
+	assert.Equal(expectedBytes, actualBytes)
+	assert.NoError(err)
+}
+
+func testNewRewindSpillFile(t *testing.T) {
+	var (
+		assert        = assert.New(t)
+		require       = require.New(t)
+		expectedBytes = bytes.Repeat([]byte("spilled to a file "), 100)
+	)
+
+	body, getBody, err := NewRewindSpill(bytes.NewBuffer(expectedBytes), 64)
+	require.NoError(err)
+	require.NotNil(body)
+	require.NotNil(getBody)
+	assert.IsType(spillBody{}, body)
+
+	// the body must survive being closed, as an HTTP transport does before a redirect
+	for i := 0; i < 3; i++ {
+		actualBytes, err := ioutil.ReadAll(body)
+		assert.Equal(expectedBytes, actualBytes)
+		assert.NoError(err)
+		assert.NoError(body.Close())
+
+		body, err = getBody()
+		require.NoError(err)
+		require.NotNil(body)
+	}
+
+	// once released, the file is closed
+	assert.NoError(ReleaseRewind(body))
+	_, err = ioutil.ReadAll(body)
+	assert.Error(err)
+	_, err = getBody()
+	assert.Error(err)
+}
+
+func testNewRewindSpillReadError(t *testing.T) {
+	var (
+		assert        = assert.New(t)
+		expectedError = errors.New("expected")
+		reader        = new(mockReader)
+	)
+
+	reader.On("Read", mock.MatchedBy(func([]byte) bool { return true })).Return(0, expectedError).Once()
+	body, getBody, err := NewRewindSpill(reader, 64)
+	assert.Nil(body)
+	assert.Nil(getBody)
+	assert.Equal(expectedError, err)
+
+	reader.AssertExpectations(t)
+}
+
+func TestReleaseRewind(t *testing.T) {
+	var (
+		assert  = assert.New(t)
+		require = require.New(t)
+	)
+
+	assert.NoError(ReleaseRewind(nil))
+
+	body, _ := NewRewindBytes([]byte("in memory"))
+	assert.NoError(ReleaseRewind(body))
+
+	// releasing a body that is not spilled to a file leaves it readable
+	actualBytes, err := ioutil.ReadAll(body)
+	require.NoError(err)
+	assert.Equal("in memory", string(actualBytes))
+}
+
+func TestNewRewindSpill(t *testing.T) {
+	t.Run("NoThreshold", func(t *testing.T) { testNewRewindSpillInMemory(t, 0) })
+	t.Run("BelowThreshold", func(t *testing.T) { testNewRewindSpillInMemory(t, 9) })
+	t.Run("AboveThreshold", testNewRewindSpillFile)
+	t.Run("ReadError", testNewRewindSpillReadError)
+}
+
+func TestEnsureRewindableSpill(t *testing.T) {
+	var (
+		assert           = assert.New(t)
+		require          = require.New(t)
+		expectedContents = bytes.Repeat([]byte{6, 253, 12, 34}, 16)
+
+		r = &http.Request{
+			Body: ioutil.NopCloser(bytes.NewReader(expectedContents)),
+		}
+	)
+
+	require.NoError(EnsureRewindableSpill(r, 8))
+	require.NotNil(r.Body)
+	require.NotNil(r.GetBody)
+
+	actualContents, err := ioutil.ReadAll(r.Body)
+	assert.Equal(expectedContents, actualContents)
+	assert.NoError(err)
+
+	require.NoError(Rewind(r))
+	actualContents, err = ioutil.ReadAll(r.Body)
+	assert.Equal(expectedContents, actualContents)
+	assert.NoError(err)
+
+	// requests that are already rewindable are left alone, so the body is never read
+	alreadyRewindable := &http.Request{
+		Body:    ioutil.NopCloser(new(mockReader)),
+		GetBody: func() (io.ReadCloser, error) { return nil, nil },
+	}
+
+	assert.NoError(EnsureRewindableSpill(alreadyRewindable, 8))
+}
+
 func TestNewRewindBytes(t *testing.T) {
 	var (
 		assert        = assert.New(t)